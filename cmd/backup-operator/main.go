@@ -21,6 +21,7 @@ import (
 	"runtime"
 	"time"
 
+	"github.com/coreos/etcd-operator/pkg/backup"
 	controller "github.com/coreos/etcd-operator/pkg/controller/backup-operator"
 	"github.com/coreos/etcd-operator/pkg/util/constants"
 	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
@@ -42,6 +43,7 @@ var (
 
 func init() {
 	flag.BoolVar(&createCRD, "create-crd", true, "The backup operator will not create the EtcdBackup CRD when this flag is set to false.")
+	flag.Int64Var(&backup.MultipartThreshold, "multipart-threshold", backup.MultipartThreshold, "The etcd db size in bytes above which backups are uploaded in multiple parts")
 	flag.Parse()
 }
 
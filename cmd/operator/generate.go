@@ -0,0 +1,49 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/coreos/etcd-operator/pkg/generate"
+)
+
+// generateCommand is the subcommand that prints the manifests of a new etcd cluster.
+const generateCommand = "generate"
+
+// runGenerate writes the manifests of the generate subcommand with the given args to stdout.
+func runGenerate(args []string) error {
+	var o generate.Options
+	fs := flag.NewFlagSet(generateCommand, flag.ExitOnError)
+	fs.StringVar(&o.Name, "name", "example-etcd-cluster", "The name of the etcd cluster")
+	fs.StringVar(&o.Namespace, "namespace", "default", "The namespace of the etcd cluster")
+	fs.IntVar(&o.Size, "size", 3, "The size of the etcd cluster")
+	fs.StringVar(&o.Version, "version", "", "The etcd version of the cluster. The operator's default version is used if not set.")
+	fs.StringVar(&o.BackupType, "backup-type", "", "Generate an EtcdBackup of the cluster to the storage type, one of S3 or ABS")
+	fs.BoolVar(&o.TLS, "tls", false, "Enable static TLS for the cluster, with placeholder secrets for the certificates")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s [flags]\n\nPrints the manifests of a new etcd cluster to stdout.\n\n", os.Args[0], generateCommand)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	objs, err := generate.Manifests(o)
+	if err != nil {
+		return err
+	}
+	return generate.WriteYAML(os.Stdout, objs)
+}
@@ -18,20 +18,24 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"os/signal"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/coreos/etcd-operator/pkg/chaos"
 	"github.com/coreos/etcd-operator/pkg/client"
+	"github.com/coreos/etcd-operator/pkg/cluster"
 	"github.com/coreos/etcd-operator/pkg/controller"
 	"github.com/coreos/etcd-operator/pkg/debug"
 	"github.com/coreos/etcd-operator/pkg/util/constants"
 	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
 	"github.com/coreos/etcd-operator/pkg/util/probe"
 	"github.com/coreos/etcd-operator/pkg/util/retryutil"
+	"github.com/coreos/etcd-operator/pkg/webhook"
 	"github.com/coreos/etcd-operator/version"
 	"github.com/prometheus/client_golang/prometheus"
 
@@ -54,25 +58,80 @@ var (
 	listenAddr string
 	gcInterval time.Duration
 
+	healthProbeAddr string
+
 	chaosLevel int
 
 	printVersion bool
 
 	createCRD bool
+
+	webhookListenAddr  string
+	webhookTLSCertFile string
+	webhookTLSKeyFile  string
+
+	logFormat string
+	logLevel  string
+
+	workers int
+	// maxConcurrentReconciles is the deprecated name of workers.
+	maxConcurrentReconciles int
+
+	dryRun bool
+
+	autoUpgrade     bool
+	githubTokenFile string
+
+	podCreationTimeout time.Duration
+
+	watchSpotInterruptions bool
+
+	watchNamespace string
 )
 
 func init() {
 	flag.StringVar(&debug.DebugFilePath, "debug-logfile-path", "", "only for a self hosted cluster, the path where the debug logfile will be written, recommended to be under: /var/tmp/etcd-operator/debug/ to avoid any issue with lack of write permissions")
+	flag.IntVar(&debug.EventBufferSize, "debug-event-buffer-size", 1000, "The number of most recent events kept in memory for each etcd cluster and served at /debug/events/<cluster-name>")
 	flag.StringVar(&listenAddr, "listen-addr", "0.0.0.0:8080", "The address on which the HTTP server will listen to")
+	flag.StringVar(&healthProbeAddr, "health-probe-addr", "", "The address on which a separate HTTP server serves only the /healthz and /readyz endpoints. If not set, they are served on --listen-addr.")
 	// chaos level will be removed once we have a formal tool to inject failures.
 	flag.IntVar(&chaosLevel, "chaos-level", -1, "DO NOT USE IN PRODUCTION - level of chaos injected into the etcd clusters created by the operator.")
 	flag.BoolVar(&printVersion, "version", false, "Show version and quit")
 	flag.BoolVar(&createCRD, "create-crd", true, "The operator will not create the EtcdCluster CRD when this flag is set to false.")
 	flag.DurationVar(&gcInterval, "gc-interval", 10*time.Minute, "GC interval")
+	flag.StringVar(&webhookListenAddr, "webhook-listen-addr", "", "The address on which the HTTPS server of the EtcdCluster validating, defaulting and conversion webhooks will listen to. The webhook is disabled if not set.")
+	flag.StringVar(&webhookTLSCertFile, "webhook-tls-cert-file", "", "The TLS certificate file of the webhook server")
+	flag.StringVar(&webhookTLSKeyFile, "webhook-tls-key-file", "", "The TLS private key file of the webhook server")
+	flag.StringVar(&logFormat, "log-format", "text", "The log format of the operator, one of text or json")
+	flag.StringVar(&logLevel, "log-level", "info", "The log level of the operator, one of debug, info, warn or error")
+	flag.IntVar(&workers, "workers", 10, "The number of workers that handle the events and reconciliations of the etcd clusters, i.e. the maximum number of clusters reconciled at the same time.")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 0, "Deprecated: use --workers. If set, it overrides --workers.")
+	flag.BoolVar(&dryRun, "dry-run", false, "Log the pods, services and etcd members the operator would create, delete or change instead of applying them. The planned actions of a cluster are served at /debug/dry-run/<cluster-name>.")
+	flag.BoolVar(&autoUpgrade, "auto-upgrade", false, "Upgrade the etcd clusters that set spec.allowAutoUpgrade to the latest patch release of their etcd minor version, as published on GitHub.")
+	flag.StringVar(&githubTokenFile, "github-token-file", "", "The file of an optional GitHub API token used by --auto-upgrade to list the etcd releases with a higher rate limit.")
+	flag.DurationVar(&podCreationTimeout, "pod-creation-timeout", 30*time.Second, "How long the operator waits for the API server to create an etcd pod before it gives up and retries on the next reconciliation.")
+	flag.BoolVar(&watchSpotInterruptions, "watch-spot-interruptions", false, "Watch the nodes for spot interruptions: an interrupted node is cordoned and the members of the clusters that set spec.pod.tolerateSpotInterruption are moved off it. Needs a ClusterRole with the permission to list, watch and patch nodes.")
+	flag.StringVar(&watchNamespace, "watch-namespace", "", "The namespace of the EtcdClusters the operator manages. If not set, default is the namespace of the operator pod.")
 	flag.Parse()
 }
 
 func main() {
+	if flag.Arg(0) == generateCommand {
+		if err := runGenerate(flag.Args()[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := setupLogging(); err != nil {
+		logrus.Fatal(err)
+	}
+	if maxConcurrentReconciles > 0 {
+		logrus.Warningf("--max-concurrent-reconciles is deprecated, use --workers instead")
+		workers = maxConcurrentReconciles
+	}
+
 	namespace = os.Getenv(constants.EnvOperatorPodNamespace)
 	if len(namespace) == 0 {
 		logrus.Fatalf("must set env (%s)", constants.EnvOperatorPodNamespace)
@@ -110,8 +169,20 @@ func main() {
 	kubecli := k8sutil.MustNewKubeClient()
 
 	http.HandleFunc(probe.HTTPReadyzEndpoint, probe.ReadyzHandler)
+	http.HandleFunc(probe.HTTPHealthzEndpoint, probe.HealthzHandler)
 	http.Handle("/metrics", prometheus.Handler())
+	http.HandleFunc(debug.EventsHTTPPath, debug.ServeEvents)
+	if dryRun {
+		http.HandleFunc(cluster.DryRunHTTPPath, cluster.ServeDryRunPlan)
+	}
 	go http.ListenAndServe(listenAddr, nil)
+	if len(healthProbeAddr) != 0 {
+		go startHealthProbeServer()
+	}
+
+	if len(webhookListenAddr) != 0 {
+		go startWebhook()
+	}
 
 	rl, err := resourcelock.New(resourcelock.EndpointsResourceLock,
 		namespace,
@@ -141,14 +212,37 @@ func main() {
 	panic("unreachable")
 }
 
+// startHealthProbeServer serves the health probe endpoints on healthProbeAddr.
+func startHealthProbeServer() {
+	mux := http.NewServeMux()
+	mux.HandleFunc(probe.HTTPHealthzEndpoint, probe.HealthzHandler)
+	mux.HandleFunc(probe.HTTPReadyzEndpoint, probe.ReadyzHandler)
+	if err := http.ListenAndServe(healthProbeAddr, mux); err != nil {
+		logrus.Fatalf("health probe server failed: %v", err)
+	}
+}
+
 func run(stop <-chan struct{}) {
 	cfg := newControllerConfig()
 
 	startChaos(context.Background(), cfg.KubeCli, cfg.Namespace, chaosLevel)
 
 	c := controller.New(cfg)
-	err := c.Start()
-	logrus.Fatalf("controller Start() failed: %v", err)
+	if err := c.Start(stop); err != nil {
+		logrus.Fatalf("controller Start() failed: %v", err)
+	}
+}
+
+// githubToken returns the GitHub API token in --github-token-file, if set.
+func githubToken() string {
+	if len(githubTokenFile) == 0 {
+		return ""
+	}
+	b, err := ioutil.ReadFile(githubTokenFile)
+	if err != nil {
+		logrus.Fatalf("failed to read GitHub token: %v", err)
+	}
+	return strings.TrimSpace(string(b))
 }
 
 func newControllerConfig() controller.Config {
@@ -159,13 +253,26 @@ func newControllerConfig() controller.Config {
 		logrus.Fatalf("fail to get my pod's service account: %v", err)
 	}
 
+	ns := namespace
+	if len(watchNamespace) != 0 {
+		ns = watchNamespace
+	}
 	cfg := controller.Config{
-		Namespace:      namespace,
+		Namespace:      ns,
 		ServiceAccount: serviceAccount,
 		KubeCli:        kubecli,
 		KubeExtCli:     k8sutil.MustNewKubeExtClient(),
 		EtcdCRCli:      client.MustNewInCluster(),
 		CreateCRD:      createCRD,
+		Logger:         logrus.StandardLogger(),
+
+		Workers:     workers,
+		DryRun:      dryRun,
+		AutoUpgrade: autoUpgrade,
+		GitHubToken: githubToken(),
+
+		PodCreationTimeoutSeconds: int(podCreationTimeout / time.Second),
+		WatchSpotInterruptions:    watchSpotInterruptions,
 	}
 
 	return cfg
@@ -222,6 +329,43 @@ func startChaos(ctx context.Context, kubecli kubernetes.Interface, ns string, ch
 	}
 }
 
+// setupLogging configures the format and level of the logrus standard logger,
+// which is the logger of the controller and the clusters.
+func setupLogging() error {
+	switch logFormat {
+	case "text":
+	case "json":
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	default:
+		return fmt.Errorf("unknown log format (%s), must be text or json", logFormat)
+	}
+
+	switch logLevel {
+	case "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("unknown log level (%s), must be one of debug, info, warn or error", logLevel)
+	}
+	lvl, err := logrus.ParseLevel(logLevel)
+	if err != nil {
+		return err
+	}
+	logrus.SetLevel(lvl)
+	return nil
+}
+
+func startWebhook() {
+	defaults, err := webhook.DefaultsFromEnv()
+	if err != nil {
+		logrus.Fatalf("failed to read webhook defaults: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(webhook.ValidateEtcdClusterPath, webhook.ServeValidateEtcdCluster)
+	mux.HandleFunc(webhook.MutateEtcdClusterPath, defaults.ServeMutateEtcdCluster)
+	mux.HandleFunc(webhook.ConvertPath, webhook.ServeConvert)
+	logrus.Infof("admission and conversion webhooks listening on %v", webhookListenAddr)
+	logrus.Fatal(http.ListenAndServeTLS(webhookListenAddr, webhookTLSCertFile, webhookTLSKeyFile, mux))
+}
+
 func createRecorder(kubecli kubernetes.Interface, name, namespace string) record.EventRecorder {
 	eventBroadcaster := record.NewBroadcaster()
 	eventBroadcaster.StartLogging(logrus.Infof)
@@ -15,12 +15,16 @@ Options:
                                (default=\"etcd-operator\", environment variable: ROLE_BINDING_NAME)
   --namespace=STRING         namespace to create role and role binding in. Must already exist.
                                (default=\"default\", environment vairable: NAMESPACE)
+  --namespace-scoped         Create a Role and RoleBinding in the namespace instead of a
+                               ClusterRole and ClusterRoleBinding. The operator must run with
+                               --create-crd=false. (environment variable: NAMESPACE_SCOPED=true)
 " >&2
 }
 
 ROLE_NAME="${ROLE_NAME:-etcd-operator}"
 ROLE_BINDING_NAME="${ROLE_BINDING_NAME:-etcd-operator}"
 NAMESPACE="${NAMESPACE:-default}"
+NAMESPACE_SCOPED="${NAMESPACE_SCOPED:-false}"
 
 for i in "$@"
 do
@@ -34,6 +38,9 @@ case $i in
     --namespace=*)
     NAMESPACE="${i#*=}"
     ;;
+    --namespace-scoped)
+    NAMESPACE_SCOPED=true
+    ;;
     -h|--help)
       print_usage
       exit 0
@@ -45,15 +52,22 @@ case $i in
 esac
 done
 
+ROLE_TEMPLATE=cluster-role-template.yaml
+ROLE_BINDING_TEMPLATE=cluster-role-binding-template.yaml
+if [ "${NAMESPACE_SCOPED}" = true ]; then
+  ROLE_TEMPLATE=role-template.yaml
+  ROLE_BINDING_TEMPLATE=role-binding-template.yaml
+fi
+
 echo "Creating role with ROLE_NAME=${ROLE_NAME}, NAMESPACE=${NAMESPACE}"
 sed -e "s/<ROLE_NAME>/${ROLE_NAME}/g" \
   -e "s/<NAMESPACE>/${NAMESPACE}/g" \
-  "${ETCD_OPERATOR_ROOT}/example/rbac/cluster-role-template.yaml" | \
+  "${ETCD_OPERATOR_ROOT}/example/rbac/${ROLE_TEMPLATE}" | \
   kubectl create -f -
 
 echo "Creating role binding with ROLE_NAME=${ROLE_NAME}, ROLE_BINDING_NAME=${ROLE_BINDING_NAME}, NAMESPACE=${NAMESPACE}"
 sed -e "s/<ROLE_NAME>/${ROLE_NAME}/g" \
   -e "s/<ROLE_BINDING_NAME>/${ROLE_BINDING_NAME}/g" \
   -e "s/<NAMESPACE>/${NAMESPACE}/g" \
-  "${ETCD_OPERATOR_ROOT}/example/rbac/cluster-role-binding-template.yaml" | \
+  "${ETCD_OPERATOR_ROOT}/example/rbac/${ROLE_BINDING_TEMPLATE}" | \
   kubectl create -f -
@@ -14,7 +14,14 @@
 
 package v1beta2
 
-import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
 
 const (
 	// AWS S3 related consts
@@ -26,8 +33,25 @@ const (
 	BackupStorageTypeABS      BackupStorageType = "ABS"
 	AzureSecretStorageAccount                   = "storage-account"
 	AzureSecretStorageKey                       = "storage-key"
+	AzureSecretSASEndpoint                      = "sas-endpoint"
+	AzureSecretSASToken                         = "sas-token"
+
+	// The tags the backup operator sets on every backup file in addition to BackupSpec.Tags.
+	BackupTagCluster  = "etcd-cluster"
+	BackupTagVersion  = "etcd-version"
+	BackupTagRevision = "etcd-revision"
+
+	// maxBackupTags is the number of tags S3 allows on an object, including the
+	// tags the backup operator sets.
+	maxBackupTags        = 10
+	maxBackupTagKeyLen   = 128
+	maxBackupTagValueLen = 256
 )
 
+// absMetadataNameRegexp matches the tag keys that are valid ABS blob metadata
+// names once '-' is replaced by '_'.
+var absMetadataNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
 type BackupStorageType string
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -57,6 +81,11 @@ type BackupSpec struct {
 	// the backup from the endpoint that has the most up-to-date state.
 	// The given endpoints must belong to the same etcd cluster.
 	EtcdEndpoints []string `json:"etcdEndpoints,omitempty"`
+	// PreferredEndpoint is the etcd endpoint to take the snapshot from, e.g. a
+	// follower in the same zone as the backup storage. It is used as long as
+	// it is healthy; otherwise the backup falls back to EtcdEndpoints.
+	// A follower may lag behind the leader, so the snapshot can be slightly stale.
+	PreferredEndpoint string `json:"preferredEndpoint,omitempty"`
 	// StorageType is the etcd backup storage type.
 	// We need this field because CRD doesn't support validation against invalid fields
 	// and we cannot verify invalid backup storage source.
@@ -72,6 +101,39 @@ type BackupSpec struct {
 	ClientTLSSecret string `json:"clientTLSSecret,omitempty"`
 	// BackupSchedule is the backup schedule related specification.
 	BackupSchedule `json:",inline"`
+	// BackupHooks are the commands to run around the backup.
+	BackupHooks `json:",inline"`
+	// ClusterName is the name of the EtcdCluster in the same namespace being backed up.
+	// If set, the operator annotates the EtcdCluster with the path and revision of
+	// its most recent backup.
+	ClusterName string `json:"clusterName,omitempty"`
+	// Tags are set on the backup files, as object tags on S3 and as blob metadata
+	// on ABS, e.g. for cost allocation. The etcd-cluster, etcd-version and
+	// etcd-revision tags are always set in addition; etcd-cluster requires ClusterName.
+	// At most 7 tags can be given. Keys are at most 128 characters and values at
+	// most 256; on ABS, keys must be identifiers, where '-' is replaced by '_'.
+	Tags map[string]string `json:"tags,omitempty"`
+	// ReplicationTarget is where each successful backup is copied to,
+	// e.g. a bucket in a secondary region for disaster recovery.
+	ReplicationTarget *BackupReplicationConfig `json:"replicationTarget,omitempty"`
+	// UploadRateLimitBytesPerSec limits the upload throughput of the backups of
+	// this EtcdBackup, e.g. to keep them from saturating the network shared with
+	// etcd. The limit applies to the total throughput of all the uploads of the
+	// EtcdBackup, including the replicas and the scheduled backups, across all
+	// the backup operator workers (currently 1).
+	// 0 means unlimited.
+	UploadRateLimitBytesPerSec int64 `json:"uploadRateLimitBytesPerSec,omitempty"`
+}
+
+// BackupReplicationConfig contains the destination to replicate backups to.
+// The backup is read back from the backup source with the credentials of
+// the backup source, and written to the destination with its own credentials.
+type BackupReplicationConfig struct {
+	// StorageType is the storage type of the replication destination.
+	StorageType BackupStorageType `json:"storageType"`
+	// BackupSource is the replication destination. The backup revision is appended
+	// to its path in the same way as it is appended to the backup source path.
+	BackupSource `json:",inline"`
 }
 
 // BackupSource contains the supported backup sources.
@@ -89,10 +151,39 @@ type BackupSchedule struct {
 	BackupIntervalInSecond int `json:"backupIntervalInSecond"`
 	// MaxBackups imply how many snapshots you want to back up
 	MaxBackups int `json:"maxBackups"`
+	// MaxBackupAgeInSecond is the age after which a snapshot is purged, even if
+	// there are at most MaxBackups snapshots. No snapshot is purged by age if it is 0.
+	MaxBackupAgeInSecond int `json:"maxBackupAgeInSecond,omitempty"`
+}
+
+// BackupHooks contains the commands to run in the etcd container of the leader
+// etcd pod before and after a snapshot is taken, e.g. to pause application traffic.
+type BackupHooks struct {
+	// PreBackupHook is run before the snapshot. If it exits non-zero, the backup is skipped.
+	PreBackupHook []string `json:"preBackupHook,omitempty"`
+	// PostBackupHook is run after the snapshot, whether it succeeded or not.
+	PostBackupHook []string `json:"postBackupHook,omitempty"`
 }
 
+// BackupPhase is the lifecycle phase of an EtcdBackup.
+type BackupPhase string
+
+const (
+	// BackupPhasePending means the backup has not been started yet.
+	// An EtcdBackup without a phase is pending.
+	BackupPhasePending BackupPhase = "Pending"
+	// BackupPhaseRunning means the backup is being taken and written.
+	BackupPhaseRunning BackupPhase = "Running"
+	// BackupPhaseSucceeded means the backup has been written.
+	BackupPhaseSucceeded BackupPhase = "Succeeded"
+	// BackupPhaseFailed means the backup failed; Reason tells why.
+	BackupPhaseFailed BackupPhase = "Failed"
+)
+
 // BackupStatus represents the status of the EtcdBackup Custom Resource.
 type BackupStatus struct {
+	// Phase is the lifecycle phase of the backup.
+	Phase BackupPhase `json:"phase,omitempty"`
 	// Succeeded indicates if the backup has Succeeded.
 	Succeeded bool `json:"succeeded"`
 	// Reason indicates the reason for any backup related failures.
@@ -101,6 +192,48 @@ type BackupStatus struct {
 	EtcdVersion string `json:"etcdVersion,omitempty"`
 	// EtcdRevision is the revision of etcd's KV store where the backup is performed on.
 	EtcdRevision int64 `json:"etcdRevision,omitempty"`
+	// BackupPath is the full path of the backup file, including the revision
+	// suffix if one was appended.
+	BackupPath string `json:"backupPath,omitempty"`
+	// StorageUsedBytes is the total size of the backup files under the backup path
+	// after the backup was written.
+	StorageUsedBytes int64 `json:"storageUsedBytes,omitempty"`
+	// Attempts is the number of times the backup was tried, including retries
+	// after transient storage errors.
+	Attempts int `json:"attempts,omitempty"`
+	// LastError is the error of the last failed attempt, if any.
+	LastError string `json:"lastError,omitempty"`
+	// ReplicationSucceeded indicates if the backup was copied to spec.replicationTarget.
+	ReplicationSucceeded bool `json:"replicationSucceeded,omitempty"`
+	// ReplicationReason indicates the reason the replication failed. A failed
+	// replication does not fail the backup.
+	ReplicationReason string `json:"replicationReason,omitempty"`
+}
+
+// ValidateTags checks that the tags of the backup spec can be set on the
+// backup files of its storage type together with the tags the backup operator sets.
+func (bs *BackupSpec) ValidateTags() error {
+	reserved := []string{BackupTagCluster, BackupTagVersion, BackupTagRevision}
+	if n := len(bs.Tags) + len(reserved); n > maxBackupTags {
+		return fmt.Errorf("tags: at most %d tags can be given, got %d", maxBackupTags-len(reserved), len(bs.Tags))
+	}
+	for _, k := range reserved {
+		if _, ok := bs.Tags[k]; ok {
+			return fmt.Errorf("tags: tag %s is reserved", k)
+		}
+	}
+	for k, v := range bs.Tags {
+		if len(k) == 0 || len(k) > maxBackupTagKeyLen {
+			return fmt.Errorf("tags: key (%s) must be 1 to %d characters", k, maxBackupTagKeyLen)
+		}
+		if len(v) > maxBackupTagValueLen {
+			return fmt.Errorf("tags: value of %s must be at most %d characters", k, maxBackupTagValueLen)
+		}
+		if bs.StorageType == BackupStorageTypeABS && !absMetadataNameRegexp.MatchString(k) {
+			return fmt.Errorf("tags: key (%s) is not a valid ABS metadata name", k)
+		}
+	}
+	return nil
 }
 
 // S3BackupSource provides the spec how to store backups on S3.
@@ -116,7 +249,37 @@ type S3BackupSource struct {
 	// The profile to use in both files will be 'default'.
 	//
 	// AWSSecret overwrites the default etcd operator wide AWS credential and config.
+	// It is ignored when UseIRSA is set.
 	AWSSecret string `json:"awsSecret"`
+
+	// UseIRSA makes the backup operator authenticate to S3 with the IAM role
+	// of its service account (IRSA on EKS) instead of the credentials in AWSSecret.
+	// The operator then assumes the role in AWS_ROLE_ARN with the token in
+	// AWS_WEB_IDENTITY_TOKEN_FILE, both of which EKS injects into the pod.
+	UseIRSA bool `json:"useIRSA,omitempty"`
+
+	// Endpoint is the URL of an S3 compatible object store to use instead of AWS S3,
+	// e.g. "https://minio.example.com:9000". Buckets are then addressed by path.
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// EnableTransferAcceleration uploads backups through the S3 Transfer Acceleration
+	// endpoint of the bucket, which must have transfer acceleration enabled.
+	// It cannot be used together with Endpoint.
+	EnableTransferAcceleration bool `json:"enableTransferAcceleration,omitempty"`
+}
+
+// Validate checks that the S3 backup source is well-formed.
+func (s *S3BackupSource) Validate() error {
+	if len(s.Endpoint) != 0 {
+		u, err := url.Parse(s.Endpoint)
+		if err != nil || len(u.Scheme) == 0 || len(u.Host) == 0 {
+			return fmt.Errorf("s3: invalid endpoint (%s)", s.Endpoint)
+		}
+		if s.EnableTransferAcceleration {
+			return errors.New("s3: enableTransferAcceleration cannot be used with a custom endpoint")
+		}
+	}
+	return nil
 }
 
 // ABSBackupSource provides the spec how to store backups on ABS.
@@ -128,4 +291,37 @@ type ABSBackupSource struct {
 
 	// The name of the secret object that stores the Azure storage credential
 	ABSSecret string `json:"absSecret"`
+
+	// SASTokenSecret is the name of the secret object that stores a Shared Access
+	// Signature token for the blob service instead of the storage account key.
+	// It must contain the following data items:
+	// data:
+	//    "sas-endpoint": <blob-service-endpoint>, e.g. "https://myaccount.blob.core.windows.net"
+	//    "sas-token": <sas-token>
+	// SASTokenSecret and ABSSecret are mutually exclusive.
+	SASTokenSecret string `json:"sasTokenSecret,omitempty"`
+
+	// PrivateEndpointURL is the URL of an Azure Private Endpoint of the blob
+	// service, e.g. "https://myaccount.privatelink.blob.core.windows.net".
+	// If set, the blob service is reached through it instead of the public
+	// endpoint of the storage account.
+	PrivateEndpointURL string `json:"privateEndpointURL,omitempty"`
+}
+
+// Validate checks that exactly one kind of ABS credential is given and
+// that the private endpoint URL, if any, is an absolute URL.
+func (s *ABSBackupSource) Validate() error {
+	if len(s.ABSSecret) != 0 && len(s.SASTokenSecret) != 0 {
+		return errors.New("abs: absSecret and sasTokenSecret are mutually exclusive")
+	}
+	if len(s.ABSSecret) == 0 && len(s.SASTokenSecret) == 0 {
+		return errors.New("abs: one of absSecret and sasTokenSecret must be specified")
+	}
+	if len(s.PrivateEndpointURL) != 0 {
+		u, err := url.Parse(s.PrivateEndpointURL)
+		if err != nil || len(u.Scheme) == 0 || len(u.Host) == 0 {
+			return fmt.Errorf("abs: invalid private endpoint URL (%s)", s.PrivateEndpointURL)
+		}
+	}
+	return nil
 }
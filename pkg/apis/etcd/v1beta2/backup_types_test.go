@@ -0,0 +1,67 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta2
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestS3BackupSourceValidate(t *testing.T) {
+	tests := []struct {
+		source  S3BackupSource
+		wantErr bool
+	}{
+		{source: S3BackupSource{}},
+		{source: S3BackupSource{EnableTransferAcceleration: true}},
+		{source: S3BackupSource{Endpoint: "https://minio.example.com:9000"}},
+		{source: S3BackupSource{Endpoint: "minio.example.com"}, wantErr: true},
+		{source: S3BackupSource{Endpoint: "https://minio.example.com:9000", EnableTransferAcceleration: true}, wantErr: true},
+	}
+	for i, tt := range tests {
+		err := tt.source.Validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("#%d: want error %v, get %v", i, tt.wantErr, err)
+		}
+	}
+}
+
+func TestBackupSpecValidateTags(t *testing.T) {
+	manyTags := map[string]string{}
+	for i := 0; i < 8; i++ {
+		manyTags[fmt.Sprintf("tag%d", i)] = "v"
+	}
+	tests := []struct {
+		spec    BackupSpec
+		wantErr bool
+	}{
+		{spec: BackupSpec{}},
+		{spec: BackupSpec{StorageType: BackupStorageTypeS3, Tags: map[string]string{"team": "storage", "cost:center": "42"}}},
+		{spec: BackupSpec{StorageType: BackupStorageTypeABS, Tags: map[string]string{"cost-center": "42"}}},
+		{spec: BackupSpec{StorageType: BackupStorageTypeABS, Tags: map[string]string{"cost:center": "42"}}, wantErr: true},
+		{spec: BackupSpec{StorageType: BackupStorageTypeS3, Tags: map[string]string{BackupTagRevision: "1"}}, wantErr: true},
+		{spec: BackupSpec{StorageType: BackupStorageTypeS3, Tags: map[string]string{"": "v"}}, wantErr: true},
+		{spec: BackupSpec{StorageType: BackupStorageTypeS3, Tags: map[string]string{strings.Repeat("k", 129): "v"}}, wantErr: true},
+		{spec: BackupSpec{StorageType: BackupStorageTypeS3, Tags: map[string]string{"k": strings.Repeat("v", 257)}}, wantErr: true},
+		{spec: BackupSpec{StorageType: BackupStorageTypeS3, Tags: manyTags}, wantErr: true},
+	}
+	for i, tt := range tests {
+		err := tt.spec.ValidateTags()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("#%d: want error %v, get %v", i, tt.wantErr, err)
+		}
+	}
+}
@@ -16,15 +16,42 @@ package v1beta2
 
 import (
 	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 const (
 	defaultRepository  = "quay.io/coreos/etcd"
 	DefaultEtcdVersion = "3.2.13"
+
+	// CaptureProfileAnnotation set to "true" on an EtcdCluster makes the operator
+	// capture a CPU profile of the etcd leader. The operator removes the annotation
+	// once the profile is captured.
+	CaptureProfileAnnotation = "etcd.database.coreos.com/capture-profile"
+
+	// RotatePeerSecretAnnotation set to the name of a secret on an EtcdCluster with
+	// static TLS makes the operator rotate the peer certificates of the members to
+	// the ones in that secret. The operator removes the annotation once all members
+	// use the new secret.
+	RotatePeerSecretAnnotation = "etcd.database.coreos.com/rotate-peer-secret"
+
+	// LastBackupPathAnnotation and LastBackupRevisionAnnotation are set on an
+	// EtcdCluster to the path and revision of its most recent backup. They are
+	// informational only and do not affect reconciliation.
+	LastBackupPathAnnotation     = "etcd.coreos.com/last-backup-path"
+	LastBackupRevisionAnnotation = "etcd.coreos.com/last-backup-revision"
+
+	// CleanupFinalizer is set on the EtcdClusters created by the operator. It keeps
+	// a deleted EtcdCluster until the operator has deleted its resources.
+	CleanupFinalizer = "etcd.coreos.com/cleanup"
 )
 
 var (
@@ -53,6 +80,16 @@ type EtcdCluster struct {
 	Status            ClusterStatus `json:"status"`
 }
 
+// HasFinalizer returns true if the EtcdCluster has the given finalizer.
+func (c *EtcdCluster) HasFinalizer(finalizer string) bool {
+	for _, f := range c.Finalizers {
+		if f == finalizer {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *EtcdCluster) AsOwner() metav1.OwnerReference {
 	trueVar := true
 	return metav1.OwnerReference{
@@ -83,30 +120,261 @@ type ClusterSpec struct {
 	// The etcd-operator will eventually make the etcd cluster version
 	// equal to the expected version.
 	//
-	// The version must follow the [semver]( http://semver.org) format, for example "3.2.13".
-	// Only etcd released versions are supported: https://github.com/coreos/etcd/releases
+	// The version must follow the [semver]( http://semver.org) format, for example "3.2.13",
+	// and be at least 3.0.0. Only etcd released versions are supported: https://github.com/coreos/etcd/releases
 	//
 	// If version is not set, default is "3.2.13".
 	Version string `json:"version,omitempty"`
 
+	// ImagePullPolicy is the pull policy of the etcd container image.
+	// Valid values are "Always", "IfNotPresent" and "Never".
+	//
+	// If not set, default is "IfNotPresent".
+	// Updating ImagePullPolicy replaces the existing etcd pods one at a time.
+	ImagePullPolicy v1.PullPolicy `json:"imagePullPolicy,omitempty"`
+
 	// Paused is to pause the control of the operator for the etcd cluster.
 	Paused bool `json:"paused,omitempty"`
 
 	// Pod defines the policy to create pod for the etcd pod.
 	//
-	// Updating Pod does not take effect on any existing etcd pods.
+	// Updating Pod replaces the existing etcd pods one at a time, except for a
+	// memory limit raised by AutoAdjustMemory, which only applies to new pods.
 	Pod *PodPolicy `json:"pod,omitempty"`
 
 	// SelfHosted determines if the etcd cluster is used for a self-hosted
 	// Kubernetes cluster.
 	//
-	// SelfHosted is a cluster initialization configuration. It cannot be updated.
+	// SelfHosted is a cluster initialization configuration. It cannot be set on
+	// an existing cluster. Removing it migrates the cluster to regular pods by
+	// replacing the self-hosted members one at a time.
 	SelfHosted *SelfHostedPolicy `json:"selfHosted,omitempty"`
 
 	// etcd cluster TLS configuration
 	TLS *TLSPolicy `json:"TLS,omitempty"`
+
+	// ExposeMetricsService makes etcd serve its metrics over plain HTTP on port 2381,
+	// and creates the "<cluster-name>-metrics" service for Prometheus to scrape them.
+	// It requires etcd 3.3 or later.
+	//
+	// Updating ExposeMetricsService replaces the existing etcd pods one at a time.
+	ExposeMetricsService bool `json:"exposeMetricsService,omitempty"`
+
+	// EnableNetworkPolicy makes the operator create a NetworkPolicy that only
+	// accepts traffic on the etcd peer port from the members of the cluster.
+	// The client port, and the metrics port if exposed, stay open to any pod.
+	// It requires a network plugin that enforces NetworkPolicies.
+	EnableNetworkPolicy bool `json:"enableNetworkPolicy,omitempty"`
+
+	// EnablePodDisruptionBudget makes the operator create a PodDisruptionBudget
+	// that keeps a quorum of the members, size/2+1, available during voluntary
+	// disruptions such as node drains. It is recreated when the size changes.
+	EnablePodDisruptionBudget bool `json:"enablePodDisruptionBudget,omitempty"`
+
+	// ExternalEndpoints are the client URLs of an existing etcd cluster that is
+	// migrated to the operator. If set, a new cluster is created by adding a
+	// member to the existing cluster instead of starting a seed member, and the
+	// operator adds its members up to Size next to the external ones.
+	// The external members are never managed by the operator; remove them with
+	// etcdctl once the cluster runs on the operator's members.
+	// This field cannot be updated.
+	ExternalEndpoints []string `json:"externalEndpoints,omitempty"`
+
+	// PrometheusMonitoring makes the operator create a Prometheus Operator
+	// ServiceMonitor for the metrics service. It requires ExposeMetricsService.
+	PrometheusMonitoring *PrometheusMonitoringConfig `json:"prometheusMonitoring,omitempty"`
+
+	// DNSDomain is the DNS domain of the Kubernetes cluster, e.g. "cluster.example.com".
+	// When set, the member peer and client URLs use fully qualified DNS names in this domain.
+	// If not set, the URLs use names relative to the domain of the cluster DNS
+	// ("<member>.<cluster-name>.<namespace>.svc"), which resolve in the default
+	// "cluster.local" domain.
+	//
+	// DNSDomain is a cluster initialization configuration. It cannot be updated.
+	DNSDomain string `json:"dnsDomain,omitempty"`
+
+	// ServiceType is the type of the client service: ClusterIP, NodePort or LoadBalancer.
+	// NodePort and LoadBalancer expose etcd to clients outside the Kubernetes cluster.
+	//
+	// If not set, default is ClusterIP.
+	// Updating ServiceType changes the type of the existing client service in place.
+	ServiceType v1.ServiceType `json:"serviceType,omitempty"`
+
+	// Auth defines the etcd authentication to bootstrap once the cluster is running.
+	Auth *AuthConfig `json:"auth,omitempty"`
+
+	// DefragEnabled makes the operator periodically defragment the ready etcd
+	// members one at a time to reclaim disk space after compaction.
+	DefragEnabled bool `json:"defragEnabled,omitempty"`
+	// DefragIntervalMinutes is the interval between two defragmentation rounds.
+	// If not set, default is 60 minutes.
+	DefragIntervalMinutes int `json:"defragIntervalMinutes,omitempty"`
+	// DefragSchedule restricts the defragmentation rounds to a daily window,
+	// e.g. off-peak hours. If not set, defragmentation runs at any time.
+	DefragSchedule *DefragSchedule `json:"defragSchedule,omitempty"`
+
+	// CompactionEnabled makes the operator compact the etcd keyspace up to the
+	// revision before the current one when the db size of a member exceeds 80% of
+	// its backend quota, then defragment the members one at a time.
+	CompactionEnabled bool `json:"compactionEnabled,omitempty"`
+	// CompactionIntervalMinutes is the minimum interval between two compactions.
+	// If not set, default is 10 minutes.
+	CompactionIntervalMinutes int `json:"compactionIntervalMinutes,omitempty"`
+
+	// HealthCheckTimeoutSeconds is the timeout of the liveness and readiness
+	// probes that check the health of each etcd member. Increase it for members
+	// with a high latency to their peers, e.g. spread across availability zones.
+	// If not set, the liveness probe times out after 10 seconds and the readiness
+	// probe after 5 seconds.
+	//
+	// Updating HealthCheckTimeoutSeconds replaces the existing etcd pods one at a time.
+	HealthCheckTimeoutSeconds int `json:"healthCheckTimeoutSeconds,omitempty"`
+
+	// UpgradeTimeoutSeconds is how long an upgraded member may stay unready before
+	// the operator rolls the upgrade back to the previous version. The spec
+	// version is left alone; status.rolledBackVersion records the failed version.
+	// If not set, default is 300 seconds.
+	UpgradeTimeoutSeconds int `json:"upgradeTimeoutSeconds,omitempty"`
+
+	// MaintenanceWindow restricts the disruptive operations, i.e. upgrades,
+	// member replacements to apply pod annotations, spec changes, peer
+	// certificate rotations or the self-hosted migration, and defragmentation,
+	// to a weekly window. Operations outside of it wait for the window.
+	// If not set, they run at any time.
+	MaintenanceWindow *MaintenanceWindow `json:"maintenanceWindow,omitempty"`
+
+	// AllowAutoUpgrade lets an operator started with --auto-upgrade set Version
+	// to the latest patch release of its minor version, e.g. from "3.2.13" to "3.2.18".
+	AllowAutoUpgrade bool `json:"allowAutoUpgrade,omitempty"`
+
+	// GatewayEnabled runs an etcd gateway, a TCP proxy to the members, behind the
+	// <cluster-name>-gateway service, which gives clients a stable endpoint while
+	// members are added and removed. The gateway pods are not counted in Size.
+	GatewayEnabled bool `json:"gatewayEnabled,omitempty"`
+	// GatewayReplicas is the number of etcd gateway pods.
+	// If not set, default is 1.
+	GatewayReplicas int `json:"gatewayReplicas,omitempty"`
+}
+
+// DefragSchedule is the daily window in which the members are defragmented.
+type DefragSchedule struct {
+	// StartHour is the hour the window starts at, from 0 to 23.
+	StartHour int `json:"startHour"`
+	// EndHour is the hour the window ends at, from 1 to 24. It must be after StartHour.
+	EndHour int `json:"endHour"`
+	// TimeZone is the IANA time zone of the hours, e.g. "Europe/Berlin".
+	// If not set, default is UTC.
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// Validate checks that the window is within a day and the time zone is known.
+func (s *DefragSchedule) Validate() error {
+	if s.StartHour < 0 || s.EndHour > 24 || s.StartHour >= s.EndHour {
+		return fmt.Errorf("spec: invalid defrag window (%d-%d), want 0 <= startHour < endHour <= 24", s.StartHour, s.EndHour)
+	}
+	if _, err := time.LoadLocation(s.TimeZone); err != nil {
+		return fmt.Errorf("spec: invalid defrag time zone (%s): %v", s.TimeZone, err)
+	}
+	return nil
+}
+
+// InWindow returns true if t falls within the window.
+// It assumes that the schedule is valid.
+func (s *DefragSchedule) InWindow(t time.Time) bool {
+	loc, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		return false
+	}
+	h := t.In(loc).Hour()
+	return h >= s.StartHour && h < s.EndHour
+}
+
+// MaintenanceWindow is the weekly window in which disruptive operations run.
+type MaintenanceWindow struct {
+	// DaysOfWeek are the days of the window, from 0 (Sunday) to 6 (Saturday).
+	// If not set, the window is open every day.
+	DaysOfWeek []int `json:"daysOfWeek,omitempty"`
+	// StartHour is the hour the window starts at, from 0 to 23.
+	StartHour int `json:"startHour"`
+	// EndHour is the hour the window ends at, from 1 to 24. It must be after StartHour.
+	EndHour int `json:"endHour"`
+	// TimeZone is the IANA time zone of the days and hours, e.g. "Europe/Berlin".
+	// If not set, default is UTC.
+	TimeZone string `json:"timeZone,omitempty"`
 }
 
+// Validate checks the days, that the hours are within a day and the time zone is known.
+func (w *MaintenanceWindow) Validate() error {
+	for _, d := range w.DaysOfWeek {
+		if d < 0 || d > 6 {
+			return fmt.Errorf("spec: invalid maintenance day of week (%d), want 0 to 6", d)
+		}
+	}
+	if w.StartHour < 0 || w.EndHour > 24 || w.StartHour >= w.EndHour {
+		return fmt.Errorf("spec: invalid maintenance window (%d-%d), want 0 <= startHour < endHour <= 24", w.StartHour, w.EndHour)
+	}
+	if _, err := time.LoadLocation(w.TimeZone); err != nil {
+		return fmt.Errorf("spec: invalid maintenance time zone (%s): %v", w.TimeZone, err)
+	}
+	return nil
+}
+
+// InWindow returns true if t falls within the window. A nil window is always open.
+// It assumes that the window is valid.
+func (w *MaintenanceWindow) InWindow(t time.Time) bool {
+	if w == nil {
+		return true
+	}
+	loc, err := time.LoadLocation(w.TimeZone)
+	if err != nil {
+		return false
+	}
+	t = t.In(loc)
+	if len(w.DaysOfWeek) != 0 {
+		day := false
+		for _, d := range w.DaysOfWeek {
+			if int(t.Weekday()) == d {
+				day = true
+				break
+			}
+		}
+		if !day {
+			return false
+		}
+	}
+	return t.Hour() >= w.StartHour && t.Hour() < w.EndHour
+}
+
+// String returns the window, e.g. "[1 3] 02-04 Europe/Berlin".
+func (w *MaintenanceWindow) String() string {
+	return fmt.Sprintf("%v %02d-%02d %s", w.DaysOfWeek, w.StartHour, w.EndHour, w.TimeZone)
+}
+
+// PrometheusMonitoringConfig defines the ServiceMonitor the operator creates
+// for the Prometheus Operator to scrape the etcd metrics.
+type PrometheusMonitoringConfig struct {
+	// Enabled enables the creation of the ServiceMonitor.
+	Enabled bool `json:"enabled,omitempty"`
+	// Interval is the scrape interval, e.g. "30s".
+	// If not set, the Prometheus global scrape interval is used.
+	Interval string `json:"interval,omitempty"`
+}
+
+// IsEnabled returns true if the ServiceMonitor should be created.
+func (pm *PrometheusMonitoringConfig) IsEnabled() bool {
+	return pm != nil && pm.Enabled
+}
+
+// PodAntiAffinityMode defines how the operator spreads etcd pods across nodes.
+type PodAntiAffinityMode string
+
+const (
+	// PodAntiAffinityPreferred spreads etcd pods across nodes on a best effort basis.
+	PodAntiAffinityPreferred PodAntiAffinityMode = "preferred"
+	// PodAntiAffinityRequired never schedules two etcd pods of the same cluster on one node.
+	PodAntiAffinityRequired PodAntiAffinityMode = "required"
+)
+
 // PodPolicy defines the policy to create pod for the etcd container.
 type PodPolicy struct {
 	// Labels specifies the labels to attach to pods the operator creates for the
@@ -115,6 +383,11 @@ type PodPolicy struct {
 	// Do not overwrite them.
 	Labels map[string]string `json:"labels,omitempty"`
 
+	// Annotations specifies the annotations to attach to pods the operator creates
+	// for the etcd cluster. Annotations used by the operator are not overwritten.
+	// Updating Annotations replaces the etcd members one at a time to apply them.
+	Annotations map[string]string `json:"annotations,omitempty"`
+
 	// NodeSelector specifies a map of key-value pairs. For the pod to be eligible
 	// to run on a node, the node must have each of the indicated key-value pairs as
 	// labels.
@@ -124,35 +397,360 @@ type PodPolicy struct {
 	Affinity *v1.Affinity `json:"affinity,omitempty"`
 	// **DEPRECATED**. Use Affinity instead.
 	AntiAffinity bool `json:"antiAffinity,omitempty"`
+	// PodAntiAffinity makes the operator generate a pod anti-affinity rule that
+	// spreads the etcd pods of the same cluster across nodes.
+	// Valid values are "preferred" and "required". It is ignored if
+	// Affinity.PodAntiAffinity is set.
+	PodAntiAffinity PodAntiAffinityMode `json:"podAntiAffinity,omitempty"`
 
 	// Resources is the resource requirements for the etcd container.
-	// This field cannot be updated once the cluster is created.
+	// This field cannot be updated once the cluster is created, except for the
+	// memory limit raised by AutoAdjustMemory.
 	Resources v1.ResourceRequirements `json:"resources,omitempty"`
 
+	// AutoAdjustMemory makes the operator raise the memory limit in Resources by
+	// 25% when an etcd container is OOM killed with that limit. Pods created
+	// afterwards, e.g. for replaced members, get the raised limit; existing pods
+	// keep theirs. It requires a memory limit in Resources.
+	AutoAdjustMemory bool `json:"autoAdjustMemory,omitempty"`
+	// AutoAdjustMemoryMax is the highest memory limit AutoAdjustMemory sets.
+	// The limit is raised without bound if it is not set.
+	AutoAdjustMemoryMax *resource.Quantity `json:"autoAdjustMemoryMax,omitempty"`
+
+	// LivenessProbe replaces the default liveness probe of the etcd container,
+	// e.g. for etcd configurations the default probe cannot check.
+	// HealthCheckTimeoutSeconds does not apply to it.
+	// Updating LivenessProbe replaces the existing etcd pods one at a time.
+	LivenessProbe *v1.Probe `json:"livenessProbe,omitempty"`
+	// ReadinessProbe replaces the default readiness probe of the etcd container.
+	// HealthCheckTimeoutSeconds does not apply to it.
+	// Updating ReadinessProbe replaces the existing etcd pods one at a time.
+	ReadinessProbe *v1.Probe `json:"readinessProbe,omitempty"`
+
 	// Tolerations specifies the pod's tolerations.
 	Tolerations []v1.Toleration `json:"tolerations,omitempty"`
 
+	// TolerateSpotInterruption lets the etcd pods run on spot nodes tainted with
+	// "aws.amazon.com/spot". If the operator watches spot interruptions, a member
+	// on a node annotated with "aws.amazon.com/spot-interruption" is replaced by
+	// a member on another node before the node is interrupted.
+	TolerateSpotInterruption bool `json:"tolerateSpotInterruption,omitempty"`
+
+	// HostNetwork runs the etcd pods in the host network namespace to avoid
+	// the CNI overhead. The etcd ports are then bound on the node, so at most
+	// one member of the cluster can run on a node.
+	// The member DNS names used in the peer and client URLs resolve to the node IP.
+	// This field cannot be updated.
+	HostNetwork bool `json:"hostNetwork,omitempty"`
+
+	// PodSecurityContext is the security context of the etcd pods.
+	// Updating PodSecurityContext replaces the existing etcd pods one at a time.
+	PodSecurityContext *v1.PodSecurityContext `json:"podSecurityContext,omitempty"`
+	// ContainerSecurityContext is the security context of the etcd container.
+	// Updating ContainerSecurityContext replaces the existing etcd pods one at a time.
+	ContainerSecurityContext *v1.SecurityContext `json:"containerSecurityContext,omitempty"`
+	// SecureDefaults runs etcd as the user nobody (65534) without privilege
+	// escalation, unless PodSecurityContext and ContainerSecurityContext set
+	// otherwise. The data volume is owned by the group nobody to be writable.
+	// It is not supported for self hosted clusters, whose host path data
+	// directory is not writable by nobody.
+	// Updating SecureDefaults replaces the existing etcd pods one at a time.
+	SecureDefaults bool `json:"secureDefaults,omitempty"`
+
 	// List of environment variables to set in the etcd container.
 	// This is used to configure etcd process. etcd cluster cannot be created, when
-	// bad environement variables are provided. Do not overwrite any flags used to
-	// bootstrap the cluster (for example `--initial-cluster` flag).
+	// bad environement variables are provided. The variables of the flags the
+	// operator sets, e.g. ETCD_INITIAL_CLUSTER for `--initial-cluster`, are
+	// rejected, see reservedEnvNames.
 	// This field cannot be updated.
 	EtcdEnv []v1.EnvVar `json:"etcdEnv,omitempty"`
+
+	// EtcdLogLevel sets the --log-level flag of etcd, one of debug, info, warn
+	// or error. It requires etcd 3.4 or later; the operator then runs etcd
+	// with --logger=zap, the only logger honoring the log flags.
+	// Updating EtcdLogLevel replaces the existing etcd pods one at a time.
+	EtcdLogLevel string `json:"etcdLogLevel,omitempty"`
+	// EtcdLogOutputs sets the --log-outputs flag of etcd, e.g. ["stderr", "/var/log/etcd/etcd.log"].
+	// Each entry is stdout, stderr, default or an absolute file path outside of
+	// the etcd data volume (/var/etcd). The directories of the file paths are
+	// mounted as empty dir volumes. It requires etcd 3.4 or later.
+	// Updating EtcdLogOutputs replaces the existing etcd pods one at a time.
+	EtcdLogOutputs []string `json:"etcdLogOutputs,omitempty"`
+
+	// AdditionalVolumes are added to the etcd pod, e.g. to provide secrets or
+	// config maps to custom authentication plugins.
+	// The names of the volumes the operator creates are reserved, see isReservedVolumeName.
+	// This field cannot be updated.
+	AdditionalVolumes []v1.Volume `json:"additionalVolumes,omitempty"`
+	// AdditionalVolumeMounts are added to the etcd container.
+	// This field cannot be updated.
+	AdditionalVolumeMounts []v1.VolumeMount `json:"additionalVolumeMounts,omitempty"`
+
+	// PodTemplateSpec is the base of the etcd pods, e.g. to set security contexts
+	// or add sidecar containers. The container named "etcd", if any, is the base of
+	// the etcd container.
+	// The fields the operator depends on are always overwritten: the pod name,
+	// hostname, subdomain and restart policy, the reserved labels, and the image,
+	// command, ports, probes and volume mounts of the etcd container. The operator's
+	// init containers and volumes are added to the ones in the template.
+	// The other fields of PodPolicy are applied on top of the template.
+	// This field cannot be updated.
+	PodTemplateSpec *v1.PodTemplateSpec `json:"podTemplateSpec,omitempty"`
+}
+
+// reservedVolumeNames are the names of the data and TLS volumes the operator
+// adds to etcd pods.
+var reservedVolumeNames = map[string]bool{
+	"etcd-data":         true,
+	"member-peer-tls":   true,
+	"member-server-tls": true,
+	"etcd-client-tls":   true,
+}
+
+// reservedEnvNames are the etcd environment variables of the flags the operator
+// sets on the etcd command line, which EtcdEnv must not set.
+var reservedEnvNames = map[string]bool{
+	"ETCD_DATA_DIR":                    true,
+	"ETCD_NAME":                        true,
+	"ETCD_INITIAL_ADVERTISE_PEER_URLS": true,
+	"ETCD_LISTEN_PEER_URLS":            true,
+	"ETCD_LISTEN_CLIENT_URLS":          true,
+	"ETCD_ADVERTISE_CLIENT_URLS":       true,
+	"ETCD_INITIAL_CLUSTER":             true,
+	"ETCD_INITIAL_CLUSTER_STATE":       true,
+	"ETCD_INITIAL_CLUSTER_TOKEN":       true,
+	"ETCD_LISTEN_METRICS_URLS":         true,
+	"ETCD_PEER_CLIENT_CERT_AUTH":       true,
+	"ETCD_PEER_TRUSTED_CA_FILE":        true,
+	"ETCD_PEER_CERT_FILE":              true,
+	"ETCD_PEER_KEY_FILE":               true,
+	"ETCD_CLIENT_CERT_AUTH":            true,
+	"ETCD_TRUSTED_CA_FILE":             true,
+	"ETCD_CERT_FILE":                   true,
+	"ETCD_KEY_FILE":                    true,
+	"ETCD_LOG_LEVEL":                   true,
+	"ETCD_LOG_OUTPUTS":                 true,
+}
+
+// etcdDataVolumeMountDir is where the operator mounts the etcd data volume,
+// which must not hold the EtcdLogOutputs files.
+const etcdDataVolumeMountDir = "/var/etcd"
+
+// etcdLogVolumePrefix is the name prefix of the volumes of the EtcdLogOutputs files.
+const etcdLogVolumePrefix = "etcd-logs-"
+
+func isReservedVolumeName(name string) bool {
+	return reservedVolumeNames[name] || strings.HasPrefix(name, etcdLogVolumePrefix)
+}
+
+// semverRegexp matches a semver 2.0.0 version with an optional "v" prefix.
+// The submatches are the major, minor and patch versions and the pre-release.
+var semverRegexp = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)` +
+	`(?:-((?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(?:\.(?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*))?` +
+	`(?:\+[0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*)?$`)
+
+// validateVersion checks that the etcd version is a semver version of at least
+// 3.0.0, e.g. "3.2.13" or "v3.2.13".
+func validateVersion(version string) error {
+	err := fmt.Errorf("spec: version must be a valid semver string >= v3.0.0, got: %s", version)
+	m := semverRegexp.FindStringSubmatch(version)
+	if m == nil {
+		return err
+	}
+	major, perr := strconv.Atoi(m[1])
+	if perr != nil || major < 3 {
+		return err
+	}
+	// pre-releases of 3.0.0 precede it
+	if major == 3 && m[2] == "0" && m[3] == "0" && len(m[4]) != 0 {
+		return err
+	}
+	return nil
+}
+
+// versionAtLeast reports whether the valid semver version is at least major.minor.
+func versionAtLeast(version string, major, minor int) bool {
+	m := semverRegexp.FindStringSubmatch(version)
+	if m == nil {
+		return false
+	}
+	vmajor, _ := strconv.Atoi(m[1])
+	vminor, _ := strconv.Atoi(m[2])
+	return vmajor > major || vmajor == major && vminor >= minor
 }
 
 func (c *ClusterSpec) Validate() error {
+	if len(c.Version) != 0 {
+		if err := validateVersion(c.Version); err != nil {
+			return err
+		}
+	}
+
 	if c.TLS != nil {
 		if err := c.TLS.Validate(); err != nil {
 			return err
 		}
 	}
 
+	// A new self-hosted cluster is created by the operator without TLS; the
+	// operator client TLS is only supported when migrating from a boot member.
+	if c.SelfHosted != nil && c.TLS.IsSecureClient() && len(c.SelfHosted.BootMemberClientEndpoint) == 0 {
+		return errors.New("spec: self hosted cluster with TLS operatorSecret must set selfHosted.bootMemberClientEndpoint")
+	}
+
+	// Static pods cannot mount the TLS secrets.
+	if c.SelfHosted != nil && len(c.SelfHosted.StaticPodManifestConfigMap) != 0 && (c.TLS.IsSecureClient() || c.TLS.IsSecurePeer()) {
+		return errors.New("spec: selfHosted.staticPodManifestConfigMap is not supported for TLS clusters")
+	}
+
+	if len(c.ExternalEndpoints) != 0 && c.SelfHosted != nil {
+		return errors.New("spec: externalEndpoints is not supported for self hosted clusters")
+	}
+
+	if c.Pod != nil && c.Pod.SecureDefaults && c.SelfHosted != nil {
+		return errors.New("spec: pod.secureDefaults is not supported for self hosted clusters")
+	}
+
+	if c.Auth != nil {
+		if err := c.Auth.Validate(); err != nil {
+			return err
+		}
+	}
+
+	switch c.ImagePullPolicy {
+	case "", v1.PullAlways, v1.PullIfNotPresent, v1.PullNever:
+	default:
+		return fmt.Errorf("spec: unknown image pull policy (%s)", c.ImagePullPolicy)
+	}
+
+	switch c.ServiceType {
+	case "", v1.ServiceTypeClusterIP, v1.ServiceTypeNodePort, v1.ServiceTypeLoadBalancer:
+	default:
+		return fmt.Errorf("spec: unsupported client service type (%s)", c.ServiceType)
+	}
+
+	if c.PrometheusMonitoring.IsEnabled() {
+		if !c.ExposeMetricsService {
+			return errors.New("spec: prometheus monitoring requires exposeMetricsService")
+		}
+		if len(c.PrometheusMonitoring.Interval) != 0 {
+			if _, err := time.ParseDuration(c.PrometheusMonitoring.Interval); err != nil {
+				return fmt.Errorf("spec: invalid prometheus monitoring interval (%s): %v", c.PrometheusMonitoring.Interval, err)
+			}
+		}
+	}
+
+	if c.HealthCheckTimeoutSeconds < 0 {
+		return errors.New("spec: health check timeout must not be negative")
+	}
+
+	if c.UpgradeTimeoutSeconds < 0 {
+		return errors.New("spec: upgrade timeout must not be negative")
+	}
+
+	if c.GatewayReplicas < 0 {
+		return errors.New("spec: gateway replicas must not be negative")
+	}
+
+	if c.DefragIntervalMinutes < 0 {
+		return errors.New("spec: defrag interval must not be negative")
+	}
+
+	if c.CompactionIntervalMinutes < 0 {
+		return errors.New("spec: compaction interval must not be negative")
+	}
+
+	if c.DefragSchedule != nil {
+		if err := c.DefragSchedule.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.MaintenanceWindow != nil {
+		if err := c.MaintenanceWindow.Validate(); err != nil {
+			return err
+		}
+	}
+
 	if c.Pod != nil {
 		for k := range c.Pod.Labels {
 			if k == "app" || strings.HasPrefix(k, "etcd_") {
 				return errors.New("spec: pod labels contains reserved label")
 			}
 		}
+		for _, env := range c.Pod.EtcdEnv {
+			if reservedEnvNames[env.Name] {
+				return fmt.Errorf("spec: etcd env sets reserved variable (%s)", env.Name)
+			}
+		}
+		for _, vol := range c.Pod.AdditionalVolumes {
+			if isReservedVolumeName(vol.Name) {
+				return fmt.Errorf("spec: additional volume uses reserved name (%s)", vol.Name)
+			}
+		}
+		if c.Pod.PodTemplateSpec != nil {
+			for _, vol := range c.Pod.PodTemplateSpec.Spec.Volumes {
+				if isReservedVolumeName(vol.Name) {
+					return fmt.Errorf("spec: pod template volume uses reserved name (%s)", vol.Name)
+				}
+			}
+		}
+		if err := validateProbe("liveness", c.Pod.LivenessProbe); err != nil {
+			return err
+		}
+		if err := validateProbe("readiness", c.Pod.ReadinessProbe); err != nil {
+			return err
+		}
+		switch c.Pod.PodAntiAffinity {
+		case "", PodAntiAffinityPreferred, PodAntiAffinityRequired:
+		default:
+			return fmt.Errorf("spec: unknown pod anti-affinity mode (%s)", c.Pod.PodAntiAffinity)
+		}
+		switch c.Pod.EtcdLogLevel {
+		case "", "debug", "info", "warn", "error":
+		default:
+			return fmt.Errorf("spec: unknown etcd log level (%s)", c.Pod.EtcdLogLevel)
+		}
+		for _, o := range c.Pod.EtcdLogOutputs {
+			switch {
+			case o == "stdout" || o == "stderr" || o == "default":
+			case path.IsAbs(o) && !strings.ContainsAny(o, " ,") && path.Dir(o) != "/":
+				if o == etcdDataVolumeMountDir || strings.HasPrefix(o, etcdDataVolumeMountDir+"/") {
+					return fmt.Errorf("spec: etcd log output (%s) must not be in the etcd data volume (%s)", o, etcdDataVolumeMountDir)
+				}
+			default:
+				return fmt.Errorf("spec: etcd log output (%s) is neither stdout, stderr, default nor an absolute file path outside of /", o)
+			}
+		}
+		if len(c.Pod.EtcdLogLevel) != 0 || len(c.Pod.EtcdLogOutputs) != 0 {
+			version := c.Version
+			if len(version) == 0 {
+				version = DefaultEtcdVersion
+			}
+			if !versionAtLeast(version, 3, 4) {
+				return fmt.Errorf("spec: etcdLogLevel and etcdLogOutputs require etcd 3.4 or later, got: %s", version)
+			}
+		}
+		if c.Pod.AutoAdjustMemory {
+			limit, ok := c.Pod.Resources.Limits[v1.ResourceMemory]
+			if !ok {
+				return errors.New("spec: autoAdjustMemory requires a memory limit in pod resources")
+			}
+			if max := c.Pod.AutoAdjustMemoryMax; max != nil && max.Cmp(limit) < 0 {
+				return fmt.Errorf("spec: autoAdjustMemoryMax (%s) is lower than the memory limit (%s)", max.String(), limit.String())
+			}
+		}
+	}
+	return nil
+}
+
+// validateProbe checks that a probe override has a handler.
+func validateProbe(name string, p *v1.Probe) error {
+	if p == nil {
+		return nil
+	}
+	if p.HTTPGet == nil && p.TCPSocket == nil && p.Exec == nil {
+		return fmt.Errorf("spec: %s probe must specify one of httpGet, tcpSocket or exec", name)
 	}
 	return nil
 }
@@ -0,0 +1,93 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta2
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// AuthSecretRootPasswordKey is the key of the etcd root user password
+	// in the secret referenced by AuthConfig.RootPasswordSecret.
+	AuthSecretRootPasswordKey = "password"
+
+	PermissionTypeRead      EtcdPermissionType = "read"
+	PermissionTypeWrite     EtcdPermissionType = "write"
+	PermissionTypeReadWrite EtcdPermissionType = "readwrite"
+)
+
+type EtcdPermissionType string
+
+// AuthConfig defines the etcd role based access control to bootstrap
+// once the cluster is running.
+type AuthConfig struct {
+	// Enabled enables etcd authentication on the cluster.
+	// Once authentication is enabled, it will not be disabled by the operator.
+	Enabled bool `json:"enabled,omitempty"`
+	// RootPasswordSecret is the secret containing the password of the etcd root user
+	// and must contain the following data item:
+	// data:
+	//    "password": <root-password>
+	RootPasswordSecret string `json:"rootPasswordSecret,omitempty"`
+	// Roles are the etcd roles created, with their permissions, before
+	// authentication is enabled.
+	Roles []EtcdRole `json:"roles,omitempty"`
+}
+
+type EtcdRole struct {
+	// Name is the name of the etcd role. "root" is reserved.
+	Name string `json:"name"`
+	// Permissions are the key permissions granted to the role.
+	Permissions []EtcdPermission `json:"permissions,omitempty"`
+}
+
+type EtcdPermission struct {
+	// Key is the key, or the start of the key range, the permission is granted on.
+	Key string `json:"key"`
+	// RangeEnd is the end of the key range. If empty, the permission is granted on Key only.
+	RangeEnd string `json:"rangeEnd,omitempty"`
+	// Type is the permission type, one of "read", "write" and "readwrite".
+	Type EtcdPermissionType `json:"type"`
+}
+
+func (ac *AuthConfig) Validate() error {
+	if !ac.Enabled {
+		return nil
+	}
+	if len(ac.RootPasswordSecret) == 0 {
+		return errors.New("auth enabled but rootPasswordSecret not set")
+	}
+	for _, r := range ac.Roles {
+		if len(r.Name) == 0 {
+			return errors.New("auth role name not set")
+		}
+		if r.Name == "root" {
+			return errors.New("auth role name root is reserved")
+		}
+		for _, p := range r.Permissions {
+			switch p.Type {
+			case PermissionTypeRead, PermissionTypeWrite, PermissionTypeReadWrite:
+			default:
+				return fmt.Errorf("auth role (%s) has unknown permission type: %q", r.Name, p.Type)
+			}
+		}
+	}
+	return nil
+}
+
+func (ac *AuthConfig) IsEnabled() bool {
+	return ac != nil && ac.Enabled
+}
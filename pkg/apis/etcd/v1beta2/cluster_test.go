@@ -0,0 +1,268 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta2
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+)
+
+func TestPodPolicyAdditionalVolumesRoundTrip(t *testing.T) {
+	in := &PodPolicy{
+		AdditionalVolumes: []v1.Volume{{
+			Name:         "auth-plugin",
+			VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: "auth-plugin-config"}},
+		}},
+		AdditionalVolumeMounts: []v1.VolumeMount{{Name: "auth-plugin", MountPath: "/etc/auth-plugin", ReadOnly: true}},
+	}
+	b, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &PodPolicy{}
+	if err := json.Unmarshal(b, out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("round trip mismatch: want %+v, get %+v", in, out)
+	}
+}
+
+func TestValidateAdditionalVolumes(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{"auth-plugin", false},
+		{"etcd-data", true},
+		{"member-peer-tls", true},
+		{"member-server-tls", true},
+		{"etcd-client-tls", true},
+	}
+	for i, tt := range tests {
+		cs := &ClusterSpec{
+			Size: 3,
+			Pod: &PodPolicy{
+				AdditionalVolumes: []v1.Volume{{Name: tt.name, VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}}},
+			},
+		}
+		err := cs.Validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("#%d: volume %q: want error %v, get %v", i, tt.name, tt.wantErr, err)
+		}
+	}
+}
+
+func TestTLSPolicyValidateCertManager(t *testing.T) {
+	tests := []struct {
+		tp      *TLSPolicy
+		wantErr bool
+	}{
+		{&TLSPolicy{CertManager: &CertManagerTLSConfig{IssuerRef: CertManagerIssuerRef{Name: "ca"}}}, false},
+		{&TLSPolicy{CertManager: &CertManagerTLSConfig{IssuerRef: CertManagerIssuerRef{Name: "ca", Kind: "ClusterIssuer"}, Duration: "2160h", RenewBefore: "360h"}}, false},
+		{&TLSPolicy{CertManager: &CertManagerTLSConfig{}}, true},
+		{&TLSPolicy{CertManager: &CertManagerTLSConfig{IssuerRef: CertManagerIssuerRef{Name: "ca", Kind: "Secret"}}}, true},
+		{&TLSPolicy{CertManager: &CertManagerTLSConfig{IssuerRef: CertManagerIssuerRef{Name: "ca"}, Duration: "90d"}}, true},
+		{&TLSPolicy{Static: &StaticTLS{}, CertManager: &CertManagerTLSConfig{IssuerRef: CertManagerIssuerRef{Name: "ca"}}}, true},
+	}
+	for i, tt := range tests {
+		err := tt.tp.Validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("#%d: want error %v, get %v", i, tt.wantErr, err)
+		}
+	}
+}
+
+func TestDefragSchedule(t *testing.T) {
+	tests := []struct {
+		schedule   DefragSchedule
+		wantErr    bool
+		now        time.Time
+		wantWindow bool
+	}{
+		{schedule: DefragSchedule{StartHour: 1, EndHour: 5}, now: time.Date(2018, 1, 1, 3, 0, 0, 0, time.UTC), wantWindow: true},
+		{schedule: DefragSchedule{StartHour: 1, EndHour: 5}, now: time.Date(2018, 1, 1, 5, 0, 0, 0, time.UTC), wantWindow: false},
+		{schedule: DefragSchedule{StartHour: 22, EndHour: 24}, now: time.Date(2018, 1, 1, 23, 59, 0, 0, time.UTC), wantWindow: true},
+		// 01:30 UTC is 02:30 in Berlin in winter
+		{schedule: DefragSchedule{StartHour: 2, EndHour: 3, TimeZone: "Europe/Berlin"}, now: time.Date(2018, 1, 1, 1, 30, 0, 0, time.UTC), wantWindow: true},
+		{schedule: DefragSchedule{StartHour: 5, EndHour: 5}, wantErr: true},
+		{schedule: DefragSchedule{StartHour: 6, EndHour: 2}, wantErr: true},
+		{schedule: DefragSchedule{StartHour: -1, EndHour: 2}, wantErr: true},
+		{schedule: DefragSchedule{StartHour: 1, EndHour: 25}, wantErr: true},
+		{schedule: DefragSchedule{StartHour: 1, EndHour: 2, TimeZone: "Mars/Olympus"}, wantErr: true},
+	}
+	for i, tt := range tests {
+		err := tt.schedule.Validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("#%d: want error %v, get %v", i, tt.wantErr, err)
+		}
+		if tt.wantErr {
+			continue
+		}
+		if got := tt.schedule.InWindow(tt.now); got != tt.wantWindow {
+			t.Errorf("#%d: in window = %v, want %v", i, got, tt.wantWindow)
+		}
+	}
+}
+
+func TestMaintenanceWindow(t *testing.T) {
+	// 2018-01-01 is a Monday.
+	tests := []struct {
+		window     MaintenanceWindow
+		wantErr    bool
+		now        time.Time
+		wantWindow bool
+	}{
+		{window: MaintenanceWindow{StartHour: 1, EndHour: 5}, now: time.Date(2018, 1, 1, 3, 0, 0, 0, time.UTC), wantWindow: true},
+		{window: MaintenanceWindow{StartHour: 1, EndHour: 5}, now: time.Date(2018, 1, 1, 5, 0, 0, 0, time.UTC), wantWindow: false},
+		{window: MaintenanceWindow{DaysOfWeek: []int{1, 3}, StartHour: 1, EndHour: 5}, now: time.Date(2018, 1, 1, 3, 0, 0, 0, time.UTC), wantWindow: true},
+		{window: MaintenanceWindow{DaysOfWeek: []int{0, 6}, StartHour: 1, EndHour: 5}, now: time.Date(2018, 1, 1, 3, 0, 0, 0, time.UTC), wantWindow: false},
+		// 23:30 UTC on Sunday is 00:30 on Monday in Berlin in winter
+		{window: MaintenanceWindow{DaysOfWeek: []int{1}, StartHour: 0, EndHour: 1, TimeZone: "Europe/Berlin"}, now: time.Date(2017, 12, 31, 23, 30, 0, 0, time.UTC), wantWindow: true},
+		{window: MaintenanceWindow{DaysOfWeek: []int{7}, StartHour: 1, EndHour: 5}, wantErr: true},
+		{window: MaintenanceWindow{StartHour: 6, EndHour: 2}, wantErr: true},
+		{window: MaintenanceWindow{StartHour: 1, EndHour: 2, TimeZone: "Mars/Olympus"}, wantErr: true},
+	}
+	for i, tt := range tests {
+		err := tt.window.Validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("#%d: want error %v, get %v", i, tt.wantErr, err)
+		}
+		if tt.wantErr {
+			continue
+		}
+		if got := tt.window.InWindow(tt.now); got != tt.wantWindow {
+			t.Errorf("#%d: in window = %v, want %v", i, got, tt.wantWindow)
+		}
+	}
+}
+
+func TestValidateProbeOverrides(t *testing.T) {
+	tests := []struct {
+		probe   *v1.Probe
+		wantErr bool
+	}{
+		{nil, false},
+		{&v1.Probe{Handler: v1.Handler{Exec: &v1.ExecAction{Command: []string{"true"}}}}, false},
+		{&v1.Probe{Handler: v1.Handler{TCPSocket: &v1.TCPSocketAction{}}}, false},
+		{&v1.Probe{TimeoutSeconds: 10}, true},
+	}
+	for i, tt := range tests {
+		cs := &ClusterSpec{Size: 3, Pod: &PodPolicy{LivenessProbe: tt.probe, ReadinessProbe: tt.probe}}
+		err := cs.Validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("#%d: want error %v, get %v", i, tt.wantErr, err)
+		}
+	}
+}
+
+func TestValidateEtcdLogSettings(t *testing.T) {
+	tests := []struct {
+		version string
+		level   string
+		outputs []string
+		wantErr bool
+	}{
+		{"", "", nil, false},
+		{"3.4.3", "warn", []string{"stderr", "/var/log/etcd/etcd.log"}, false},
+		{"3.5.0", "debug", nil, false},
+		{"3.4.3", "verbose", nil, true},
+		{"3.4.3", "", []string{"etcd.log"}, true},
+		{"3.4.3", "", []string{"/etcd.log"}, true},
+		{"3.4.3", "", []string{"/var/log/etcd/a,b.log"}, true},
+		// the data volume is not a log directory
+		{"3.4.3", "", []string{"/var/etcd/etcd.log"}, true},
+		{"3.4.3", "", []string{"/var/etcd/data/etcd.log"}, true},
+		{"3.4.3", "", []string{"/var/etcdlogs/etcd.log"}, false},
+		// the log flags require etcd 3.4
+		{"3.3.10", "info", nil, true},
+		{"3.3.10", "", []string{"stderr"}, true},
+		{"", "info", nil, true},
+	}
+	for i, tt := range tests {
+		cs := &ClusterSpec{Size: 3, Version: tt.version, Pod: &PodPolicy{EtcdLogLevel: tt.level, EtcdLogOutputs: tt.outputs}}
+		err := cs.Validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("#%d: want error %v, get %v", i, tt.wantErr, err)
+		}
+	}
+}
+
+func TestValidateSecureDefaults(t *testing.T) {
+	tests := []struct {
+		selfHosted *SelfHostedPolicy
+		wantErr    bool
+	}{
+		{nil, false},
+		{&SelfHostedPolicy{}, true},
+	}
+	for i, tt := range tests {
+		cs := &ClusterSpec{Size: 3, SelfHosted: tt.selfHosted, Pod: &PodPolicy{SecureDefaults: true}}
+		err := cs.Validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("#%d: want error %v, get %v", i, tt.wantErr, err)
+		}
+	}
+}
+
+func TestValidateEtcdEnv(t *testing.T) {
+	tests := []struct {
+		env     []v1.EnvVar
+		wantErr bool
+	}{
+		{nil, false},
+		{[]v1.EnvVar{{Name: "ETCD_QUOTA_BACKEND_BYTES", Value: "8589934592"}, {Name: "ETCD_ENABLE_PPROF", Value: "true"}}, false},
+		{[]v1.EnvVar{{Name: "ETCD_INITIAL_CLUSTER", Value: "example-0000=http://localhost:2380"}}, true},
+		{[]v1.EnvVar{{Name: "ETCD_ENABLE_PPROF", Value: "true"}, {Name: "ETCD_DATA_DIR", Value: "/tmp"}}, true},
+		{[]v1.EnvVar{{Name: "ETCD_LOG_LEVEL", Value: "debug"}}, true},
+		{[]v1.EnvVar{{Name: "ETCD_LOG_OUTPUTS", Value: "stderr"}}, true},
+	}
+	for i, tt := range tests {
+		cs := &ClusterSpec{Size: 3, Pod: &PodPolicy{EtcdEnv: tt.env}}
+		err := cs.Validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("#%d: want error %v, get %v", i, tt.wantErr, err)
+		}
+	}
+}
+
+func TestValidateVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		wantErr bool
+	}{
+		{"3.2.13", false},
+		{"v3.2.13", false},
+		{"3.0.0", false},
+		{"3.3.0-rc.1", false},
+		{"3.2.13+build.1", false},
+		{"latest", true},
+		{"v3.4", true},
+		{"3.02.1", true},
+		{"2.3.8", true},
+		{"3.0.0-alpha", true},
+	}
+	for i, tt := range tests {
+		cs := &ClusterSpec{Size: 3, Version: tt.version}
+		err := cs.Validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("#%d: version %q: want error %v, get %v", i, tt.version, tt.wantErr, err)
+		}
+	}
+}
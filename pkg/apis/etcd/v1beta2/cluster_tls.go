@@ -14,13 +14,21 @@
 
 package v1beta2
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
 // TLSPolicy defines the TLS policy of an etcd cluster
 type TLSPolicy struct {
 	// StaticTLS enables user to generate static x509 certificates and keys,
 	// put them into Kubernetes secrets, and specify them into here.
 	Static *StaticTLS `json:"static,omitempty"`
+	// CertManager makes the operator request the member and operator certificates
+	// from cert-manager instead of using pre-existing secrets. The certificates
+	// are renewed by cert-manager and picked up by the members without restart.
+	CertManager *CertManagerTLSConfig `json:"certManager,omitempty"`
 }
 
 type StaticTLS struct {
@@ -40,14 +48,41 @@ type MemberSecret struct {
 	ServerSecret string `json:"serverSecret,omitempty"`
 }
 
+// CertManagerTLSConfig configures the cert-manager Certificates of an etcd cluster.
+// The certificates are stored in the secrets "<cluster-name>-peer-tls",
+// "<cluster-name>-server-tls" and "<cluster-name>-operator-tls".
+type CertManagerTLSConfig struct {
+	// IssuerRef is the issuer that signs the certificates.
+	IssuerRef CertManagerIssuerRef `json:"issuerRef"`
+	// Duration is the requested lifetime of the certificates, e.g. "2160h".
+	// cert-manager's default is used if empty.
+	Duration string `json:"duration,omitempty"`
+	// RenewBefore is how long before expiry the certificates are renewed, e.g. "360h".
+	// cert-manager's default is used if empty.
+	RenewBefore string `json:"renewBefore,omitempty"`
+}
+
+// CertManagerIssuerRef refers to a cert-manager Issuer or ClusterIssuer.
+type CertManagerIssuerRef struct {
+	Name string `json:"name"`
+	// Kind is either "Issuer" or "ClusterIssuer". Default is "Issuer".
+	Kind string `json:"kind,omitempty"`
+}
+
 func (tp *TLSPolicy) Validate() error {
+	if tp.CertManager != nil {
+		if tp.Static != nil {
+			return errors.New("static and certManager TLS are mutually exclusive")
+		}
+		return tp.CertManager.Validate()
+	}
 	if tp.Static == nil {
 		return nil
 	}
 	st := tp.Static
 
 	if len(st.OperatorSecret) != 0 {
-		if len(st.Member.ServerSecret) == 0 {
+		if st.Member == nil || len(st.Member.ServerSecret) == 0 {
 			return errors.New("operator secret set but member serverSecret not set")
 		}
 	} else if st.Member != nil && len(st.Member.ServerSecret) != 0 {
@@ -56,7 +91,30 @@ func (tp *TLSPolicy) Validate() error {
 	return nil
 }
 
+func (cm *CertManagerTLSConfig) Validate() error {
+	if len(cm.IssuerRef.Name) == 0 {
+		return errors.New("certManager issuerRef name not set")
+	}
+	switch cm.IssuerRef.Kind {
+	case "", "Issuer", "ClusterIssuer":
+	default:
+		return fmt.Errorf("unknown certManager issuerRef kind (%s)", cm.IssuerRef.Kind)
+	}
+	for _, d := range []string{cm.Duration, cm.RenewBefore} {
+		if len(d) == 0 {
+			continue
+		}
+		if _, err := time.ParseDuration(d); err != nil {
+			return fmt.Errorf("invalid certManager duration (%s): %v", d, err)
+		}
+	}
+	return nil
+}
+
 func (tp *TLSPolicy) IsSecureClient() bool {
+	if tp != nil && tp.CertManager != nil {
+		return true
+	}
 	if tp == nil || tp.Static == nil {
 		return false
 	}
@@ -64,8 +122,36 @@ func (tp *TLSPolicy) IsSecureClient() bool {
 }
 
 func (tp *TLSPolicy) IsSecurePeer() bool {
+	if tp != nil && tp.CertManager != nil {
+		return true
+	}
 	if tp == nil || tp.Static == nil || tp.Static.Member == nil {
 		return false
 	}
 	return len(tp.Static.Member.PeerSecret) != 0
 }
+
+// PeerSecret returns the name of the secret containing the peer TLS certs of the members.
+func (tp *TLSPolicy) PeerSecret(clusterName string) string {
+	if tp.CertManager != nil {
+		return clusterName + "-peer-tls"
+	}
+	return tp.Static.Member.PeerSecret
+}
+
+// ServerSecret returns the name of the secret containing the client TLS certs of the members.
+func (tp *TLSPolicy) ServerSecret(clusterName string) string {
+	if tp.CertManager != nil {
+		return clusterName + "-server-tls"
+	}
+	return tp.Static.Member.ServerSecret
+}
+
+// OperatorSecret returns the name of the secret containing the TLS certs used
+// by the operator to talk to the cluster.
+func (tp *TLSPolicy) OperatorSecret(clusterName string) string {
+	if tp.CertManager != nil {
+		return clusterName + "-operator-tls"
+	}
+	return tp.Static.OperatorSecret
+}
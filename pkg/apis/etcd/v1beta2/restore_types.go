@@ -72,6 +72,8 @@ type S3RestoreSource struct {
 	// Path is the full s3 path where the backup is saved.
 	// The format of the path must be: "<s3-bucket-name>/<path-to-backup-file>"
 	// e.g: "mybucket/etcd.backup"
+	// If the path ends with "/", e.g. "mybucket/backups/", the backup with the highest
+	// etcd revision saved under it is restored.
 	Path string `json:"path"`
 
 	// The name of the secret object that stores the AWS credential and config files.
@@ -87,6 +89,8 @@ type ABSRestoreSource struct {
 	// Path is the full abs path where the backup is saved.
 	// The format of the path must be: "<abs-container-name>/<path-to-backup-file>"
 	// e.g: "myabscontainer/etcd.backup"
+	// If the path ends with "/", e.g. "myabscontainer/backups/", the backup with the
+	// highest etcd revision saved under it is restored.
 	Path string `json:"path"`
 
 	// The name of the secret object that stores the Azure Blob Storage credential.
@@ -28,4 +28,12 @@ type SelfHostedPolicy struct {
 	// If unspecified, the default is `false`. If set to `true`, you are
 	// expected to remove the boot member yourself from the etcd cluster.
 	SkipBootMemberRemoval bool `json:"skipBootMemberRemoval,omitempty"`
+
+	// StaticPodManifestConfigMap is the name of a ConfigMap to save the static pod
+	// manifest of the seed member of a new cluster in, under the "<member name>.json" key.
+	// Copied to the kubelet manifest directory of the node of the seed member, it
+	// runs the seed member as a static pod while the Kubernetes API is unavailable,
+	// e.g. to bootstrap the control plane. TLS clusters are not supported.
+	// If empty, no manifest is saved.
+	StaticPodManifestConfigMap string `json:"staticPodManifestConfigMap,omitempty"`
 }
@@ -29,12 +29,19 @@ const (
 	ClusterPhaseCreating              = "Creating"
 	ClusterPhaseRunning               = "Running"
 	ClusterPhaseFailed                = "Failed"
+	// ClusterPhaseMigrating is the phase of a self-hosted cluster whose members
+	// are replaced by regular members after spec.selfHosted was removed.
+	ClusterPhaseMigrating = "Migrating"
 
 	// See ./doc/user/conditions_and_events.md
-	ClusterConditionAvailable  ClusterConditionType = "Available"
-	ClusterConditionRecovering                      = "Recovering"
-	ClusterConditionScaling                         = "Scaling"
-	ClusterConditionUpgrading                       = "Upgrading"
+	ClusterConditionAvailable        ClusterConditionType = "Available"
+	ClusterConditionRecovering                            = "Recovering"
+	ClusterConditionScaling                               = "Scaling"
+	ClusterConditionUpgrading                             = "Upgrading"
+	ClusterConditionDiskPressure                          = "DiskPressure"
+	ClusterConditionCorrupt                               = "Corrupt"
+	ClusterConditionSecretMissing                         = "SecretMissing"
+	ClusterConditionMigrationBlocked                      = "MigrationBlocked"
 )
 
 type ClusterStatus struct {
@@ -42,6 +49,10 @@ type ClusterStatus struct {
 	Phase  ClusterPhase `json:"phase"`
 	Reason string       `json:"reason,omitempty"`
 
+	// ObservedGeneration is the metadata.generation of the EtcdCluster the
+	// operator last persisted the status for.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
 	// ControlPuased indicates the operator pauses the control of the cluster.
 	ControlPaused bool `json:"controlPaused,omitempty"`
 
@@ -53,6 +64,8 @@ type ClusterStatus struct {
 
 	// ServiceName is the LB service for accessing etcd nodes.
 	ServiceName string `json:"serviceName,omitempty"`
+	// ServiceIP is the cluster IP of the client service.
+	ServiceIP string `json:"serviceIP,omitempty"`
 
 	// ClientPort is the port for etcd client to access.
 	// It's the same on client LB service and etcd nodes.
@@ -65,6 +78,55 @@ type ClusterStatus struct {
 	// TargetVersion is the version the cluster upgrading to.
 	// If the cluster is not upgrading, TargetVersion is empty.
 	TargetVersion string `json:"targetVersion"`
+	// PreviousVersion is the version the cluster is upgrading from, which an upgrade
+	// is rolled back to if an upgraded member does not become ready.
+	// If the cluster is not upgrading, PreviousVersion is empty.
+	PreviousVersion string `json:"previousVersion,omitempty"`
+	// RolledBackVersion is the spec version whose upgrade was rolled back.
+	// The operator keeps the cluster on CurrentVersion until the spec version
+	// is changed to another version.
+	RolledBackVersion string `json:"rolledBackVersion,omitempty"`
+
+	// AuthEnabled indicates etcd authentication has been bootstrapped on the cluster.
+	AuthEnabled bool `json:"authEnabled,omitempty"`
+
+	// LastProfileConfigMap is the name of the ConfigMap that holds the last etcd
+	// CPU profile captured on request of the capture-profile annotation.
+	LastProfileConfigMap string `json:"lastProfileConfigMap,omitempty"`
+
+	// Stats are the cluster-wide etcd statistics. They are refreshed when the leader or
+	// the number of healthy members changes, and at least every 5 minutes otherwise.
+	Stats *ClusterStats `json:"stats,omitempty"`
+
+	// PeerCertRotation is the progress of the peer certificate rotation requested
+	// with the rotate-peer-secret annotation. It is nil if no rotation is in progress.
+	PeerCertRotation *RotationStatus `json:"peerCertRotation,omitempty"`
+}
+
+// RotationStatus is the progress of a rolling certificate rotation.
+type RotationStatus struct {
+	// Secret is the name of the secret the members are rotated to.
+	Secret string `json:"secret"`
+	// MembersRotated is the number of members that use the new secret.
+	MembersRotated int `json:"membersRotated"`
+	// Total is the number of members to rotate.
+	Total int `json:"total"`
+}
+
+// ClusterStats are cluster-wide etcd statistics.
+type ClusterStats struct {
+	// Leader is the name of the leader member.
+	Leader string `json:"leader,omitempty"`
+	// Term is the raft term of the leader.
+	Term uint64 `json:"term,omitempty"`
+	// Revision is the current revision of the key-value store.
+	Revision int64 `json:"revision,omitempty"`
+	// TotalKeys is the number of keys in the key-value store.
+	TotalKeys int64 `json:"totalKeys"`
+	// DBSizeBytes is the size of the backend database of the leader.
+	DBSizeBytes int64 `json:"dbSizeBytes,omitempty"`
+	// MembersHealthy is the number of members that answered the status request.
+	MembersHealthy int `json:"membersHealthy"`
 }
 
 // ClusterCondition represents one current condition of an etcd cluster.
@@ -120,6 +182,7 @@ func (cs *ClusterStatus) UpgradeVersionTo(v string) {
 
 func (cs *ClusterStatus) SetVersion(v string) {
 	cs.TargetVersion = ""
+	cs.PreviousVersion = ""
 	cs.CurrentVersion = v
 }
 
@@ -152,6 +215,26 @@ func (cs *ClusterStatus) SetUpgradingCondition(to string) {
 	cs.setClusterCondition(*c)
 }
 
+func (cs *ClusterStatus) SetDiskPressureCondition(msg string) {
+	c := newClusterCondition(ClusterConditionDiskPressure, v1.ConditionTrue, "Disk pressure", msg)
+	cs.setClusterCondition(*c)
+}
+
+func (cs *ClusterStatus) SetCorruptCondition(msg string) {
+	c := newClusterCondition(ClusterConditionCorrupt, v1.ConditionTrue, "Data corruption", msg)
+	cs.setClusterCondition(*c)
+}
+
+func (cs *ClusterStatus) SetSecretMissingCondition(msg string) {
+	c := newClusterCondition(ClusterConditionSecretMissing, v1.ConditionTrue, "Secret missing", msg)
+	cs.setClusterCondition(*c)
+}
+
+func (cs *ClusterStatus) SetMigrationBlockedCondition(msg string) {
+	c := newClusterCondition(ClusterConditionMigrationBlocked, v1.ConditionTrue, "Migration blocked", msg)
+	cs.setClusterCondition(*c)
+}
+
 func (cs *ClusterStatus) SetReadyCondition() {
 	c := newClusterCondition(ClusterConditionAvailable, v1.ConditionTrue, "Cluster available", "")
 	cs.setClusterCondition(*c)
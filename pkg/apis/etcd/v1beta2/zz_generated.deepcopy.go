@@ -22,6 +22,7 @@ package v1beta2
 
 import (
 	v1 "k8s.io/api/core/v1"
+	resource "k8s.io/apimachinery/pkg/api/resource"
 	conversion "k8s.io/apimachinery/pkg/conversion"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 	reflect "reflect"
@@ -32,6 +33,18 @@ import (
 // Deprecated: deepcopy registration will go away when static deepcopy is fully implemented.
 func GetGeneratedDeepCopyFuncs() []conversion.GeneratedDeepCopyFunc {
 	return []conversion.GeneratedDeepCopyFunc{
+		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*AuthConfig).DeepCopyInto(out.(*AuthConfig))
+			return nil
+		}, InType: reflect.TypeOf(&AuthConfig{})},
+		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*BackupHooks).DeepCopyInto(out.(*BackupHooks))
+			return nil
+		}, InType: reflect.TypeOf(&BackupHooks{})},
+		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*BackupReplicationConfig).DeepCopyInto(out.(*BackupReplicationConfig))
+			return nil
+		}, InType: reflect.TypeOf(&BackupReplicationConfig{})},
 		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
 			in.(*BackupSource).DeepCopyInto(out.(*BackupSource))
 			return nil
@@ -44,6 +57,14 @@ func GetGeneratedDeepCopyFuncs() []conversion.GeneratedDeepCopyFunc {
 			in.(*BackupStatus).DeepCopyInto(out.(*BackupStatus))
 			return nil
 		}, InType: reflect.TypeOf(&BackupStatus{})},
+		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*CertManagerIssuerRef).DeepCopyInto(out.(*CertManagerIssuerRef))
+			return nil
+		}, InType: reflect.TypeOf(&CertManagerIssuerRef{})},
+		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*CertManagerTLSConfig).DeepCopyInto(out.(*CertManagerTLSConfig))
+			return nil
+		}, InType: reflect.TypeOf(&CertManagerTLSConfig{})},
 		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
 			in.(*ClusterCondition).DeepCopyInto(out.(*ClusterCondition))
 			return nil
@@ -52,10 +73,18 @@ func GetGeneratedDeepCopyFuncs() []conversion.GeneratedDeepCopyFunc {
 			in.(*ClusterSpec).DeepCopyInto(out.(*ClusterSpec))
 			return nil
 		}, InType: reflect.TypeOf(&ClusterSpec{})},
+		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*ClusterStats).DeepCopyInto(out.(*ClusterStats))
+			return nil
+		}, InType: reflect.TypeOf(&ClusterStats{})},
 		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
 			in.(*ClusterStatus).DeepCopyInto(out.(*ClusterStatus))
 			return nil
 		}, InType: reflect.TypeOf(&ClusterStatus{})},
+		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*DefragSchedule).DeepCopyInto(out.(*DefragSchedule))
+			return nil
+		}, InType: reflect.TypeOf(&DefragSchedule{})},
 		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
 			in.(*EtcdBackup).DeepCopyInto(out.(*EtcdBackup))
 			return nil
@@ -76,6 +105,10 @@ func GetGeneratedDeepCopyFuncs() []conversion.GeneratedDeepCopyFunc {
 			in.(*EtcdClusterRef).DeepCopyInto(out.(*EtcdClusterRef))
 			return nil
 		}, InType: reflect.TypeOf(&EtcdClusterRef{})},
+		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*EtcdPermission).DeepCopyInto(out.(*EtcdPermission))
+			return nil
+		}, InType: reflect.TypeOf(&EtcdPermission{})},
 		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
 			in.(*EtcdRestore).DeepCopyInto(out.(*EtcdRestore))
 			return nil
@@ -84,6 +117,14 @@ func GetGeneratedDeepCopyFuncs() []conversion.GeneratedDeepCopyFunc {
 			in.(*EtcdRestoreList).DeepCopyInto(out.(*EtcdRestoreList))
 			return nil
 		}, InType: reflect.TypeOf(&EtcdRestoreList{})},
+		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*EtcdRole).DeepCopyInto(out.(*EtcdRole))
+			return nil
+		}, InType: reflect.TypeOf(&EtcdRole{})},
+		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*MaintenanceWindow).DeepCopyInto(out.(*MaintenanceWindow))
+			return nil
+		}, InType: reflect.TypeOf(&MaintenanceWindow{})},
 		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
 			in.(*MemberSecret).DeepCopyInto(out.(*MemberSecret))
 			return nil
@@ -96,6 +137,10 @@ func GetGeneratedDeepCopyFuncs() []conversion.GeneratedDeepCopyFunc {
 			in.(*PodPolicy).DeepCopyInto(out.(*PodPolicy))
 			return nil
 		}, InType: reflect.TypeOf(&PodPolicy{})},
+		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*PrometheusMonitoringConfig).DeepCopyInto(out.(*PrometheusMonitoringConfig))
+			return nil
+		}, InType: reflect.TypeOf(&PrometheusMonitoringConfig{})},
 		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
 			in.(*RestoreSource).DeepCopyInto(out.(*RestoreSource))
 			return nil
@@ -108,6 +153,10 @@ func GetGeneratedDeepCopyFuncs() []conversion.GeneratedDeepCopyFunc {
 			in.(*RestoreStatus).DeepCopyInto(out.(*RestoreStatus))
 			return nil
 		}, InType: reflect.TypeOf(&RestoreStatus{})},
+		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*RotationStatus).DeepCopyInto(out.(*RotationStatus))
+			return nil
+		}, InType: reflect.TypeOf(&RotationStatus{})},
 		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
 			in.(*S3BackupSource).DeepCopyInto(out.(*S3BackupSource))
 			return nil
@@ -131,6 +180,72 @@ func GetGeneratedDeepCopyFuncs() []conversion.GeneratedDeepCopyFunc {
 	}
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AuthConfig) DeepCopyInto(out *AuthConfig) {
+	*out = *in
+	if in.Roles != nil {
+		in, out := &in.Roles, &out.Roles
+		*out = make([]EtcdRole, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AuthConfig.
+func (in *AuthConfig) DeepCopy() *AuthConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(AuthConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackupHooks) DeepCopyInto(out *BackupHooks) {
+	*out = *in
+	if in.PreBackupHook != nil {
+		in, out := &in.PreBackupHook, &out.PreBackupHook
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PostBackupHook != nil {
+		in, out := &in.PostBackupHook, &out.PostBackupHook
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackupHooks.
+func (in *BackupHooks) DeepCopy() *BackupHooks {
+	if in == nil {
+		return nil
+	}
+	out := new(BackupHooks)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackupReplicationConfig) DeepCopyInto(out *BackupReplicationConfig) {
+	*out = *in
+	in.BackupSource.DeepCopyInto(&out.BackupSource)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackupReplicationConfig.
+func (in *BackupReplicationConfig) DeepCopy() *BackupReplicationConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(BackupReplicationConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *BackupSource) DeepCopyInto(out *BackupSource) {
 	*out = *in
@@ -165,6 +280,24 @@ func (in *BackupSpec) DeepCopyInto(out *BackupSpec) {
 		copy(*out, *in)
 	}
 	in.BackupSource.DeepCopyInto(&out.BackupSource)
+	out.BackupSchedule = in.BackupSchedule
+	in.BackupHooks.DeepCopyInto(&out.BackupHooks)
+	if in.Tags != nil {
+		in, out := &in.Tags, &out.Tags
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ReplicationTarget != nil {
+		in, out := &in.ReplicationTarget, &out.ReplicationTarget
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(BackupReplicationConfig)
+			(*in).DeepCopyInto(*out)
+		}
+	}
 	return
 }
 
@@ -194,6 +327,38 @@ func (in *BackupStatus) DeepCopy() *BackupStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CertManagerIssuerRef) DeepCopyInto(out *CertManagerIssuerRef) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertManagerIssuerRef.
+func (in *CertManagerIssuerRef) DeepCopy() *CertManagerIssuerRef {
+	if in == nil {
+		return nil
+	}
+	out := new(CertManagerIssuerRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CertManagerTLSConfig) DeepCopyInto(out *CertManagerTLSConfig) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertManagerTLSConfig.
+func (in *CertManagerTLSConfig) DeepCopy() *CertManagerTLSConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(CertManagerTLSConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterCondition) DeepCopyInto(out *ClusterCondition) {
 	*out = *in
@@ -240,6 +405,47 @@ func (in *ClusterSpec) DeepCopyInto(out *ClusterSpec) {
 			(*in).DeepCopyInto(*out)
 		}
 	}
+	if in.Auth != nil {
+		in, out := &in.Auth, &out.Auth
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(AuthConfig)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	if in.PrometheusMonitoring != nil {
+		in, out := &in.PrometheusMonitoring, &out.PrometheusMonitoring
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(PrometheusMonitoringConfig)
+			**out = **in
+		}
+	}
+	if in.ExternalEndpoints != nil {
+		in, out := &in.ExternalEndpoints, &out.ExternalEndpoints
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DefragSchedule != nil {
+		in, out := &in.DefragSchedule, &out.DefragSchedule
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(DefragSchedule)
+			**out = **in
+		}
+	}
+	if in.MaintenanceWindow != nil {
+		in, out := &in.MaintenanceWindow, &out.MaintenanceWindow
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(MaintenanceWindow)
+			(*in).DeepCopyInto(*out)
+		}
+	}
 	return
 }
 
@@ -253,6 +459,22 @@ func (in *ClusterSpec) DeepCopy() *ClusterSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterStats) DeepCopyInto(out *ClusterStats) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterStats.
+func (in *ClusterStats) DeepCopy() *ClusterStats {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterStats)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterStatus) DeepCopyInto(out *ClusterStatus) {
 	*out = *in
@@ -262,6 +484,24 @@ func (in *ClusterStatus) DeepCopyInto(out *ClusterStatus) {
 		copy(*out, *in)
 	}
 	in.Members.DeepCopyInto(&out.Members)
+	if in.Stats != nil {
+		in, out := &in.Stats, &out.Stats
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(ClusterStats)
+			**out = **in
+		}
+	}
+	if in.PeerCertRotation != nil {
+		in, out := &in.PeerCertRotation, &out.PeerCertRotation
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(RotationStatus)
+			**out = **in
+		}
+	}
 	return
 }
 
@@ -275,6 +515,22 @@ func (in *ClusterStatus) DeepCopy() *ClusterStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DefragSchedule) DeepCopyInto(out *DefragSchedule) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DefragSchedule.
+func (in *DefragSchedule) DeepCopy() *DefragSchedule {
+	if in == nil {
+		return nil
+	}
+	out := new(DefragSchedule)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *EtcdBackup) DeepCopyInto(out *EtcdBackup) {
 	*out = *in
@@ -417,6 +673,22 @@ func (in *EtcdClusterRef) DeepCopy() *EtcdClusterRef {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EtcdPermission) DeepCopyInto(out *EtcdPermission) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EtcdPermission.
+func (in *EtcdPermission) DeepCopy() *EtcdPermission {
+	if in == nil {
+		return nil
+	}
+	out := new(EtcdPermission)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *EtcdRestore) DeepCopyInto(out *EtcdRestore) {
 	*out = *in
@@ -480,6 +752,48 @@ func (in *EtcdRestoreList) DeepCopyObject() runtime.Object {
 	}
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EtcdRole) DeepCopyInto(out *EtcdRole) {
+	*out = *in
+	if in.Permissions != nil {
+		in, out := &in.Permissions, &out.Permissions
+		*out = make([]EtcdPermission, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EtcdRole.
+func (in *EtcdRole) DeepCopy() *EtcdRole {
+	if in == nil {
+		return nil
+	}
+	out := new(EtcdRole)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MaintenanceWindow) DeepCopyInto(out *MaintenanceWindow) {
+	*out = *in
+	if in.DaysOfWeek != nil {
+		in, out := &in.DaysOfWeek, &out.DaysOfWeek
+		*out = make([]int, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MaintenanceWindow.
+func (in *MaintenanceWindow) DeepCopy() *MaintenanceWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(MaintenanceWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MemberSecret) DeepCopyInto(out *MemberSecret) {
 	*out = *in
@@ -532,6 +846,13 @@ func (in *PodPolicy) DeepCopyInto(out *PodPolicy) {
 			(*out)[key] = val
 		}
 	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	if in.NodeSelector != nil {
 		in, out := &in.NodeSelector, &out.NodeSelector
 		*out = make(map[string]string, len(*in))
@@ -549,6 +870,33 @@ func (in *PodPolicy) DeepCopyInto(out *PodPolicy) {
 		}
 	}
 	in.Resources.DeepCopyInto(&out.Resources)
+	if in.AutoAdjustMemoryMax != nil {
+		in, out := &in.AutoAdjustMemoryMax, &out.AutoAdjustMemoryMax
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(resource.Quantity)
+			**out = (*in).DeepCopy()
+		}
+	}
+	if in.LivenessProbe != nil {
+		in, out := &in.LivenessProbe, &out.LivenessProbe
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(v1.Probe)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	if in.ReadinessProbe != nil {
+		in, out := &in.ReadinessProbe, &out.ReadinessProbe
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(v1.Probe)
+			(*in).DeepCopyInto(*out)
+		}
+	}
 	if in.Tolerations != nil {
 		in, out := &in.Tolerations, &out.Tolerations
 		*out = make([]v1.Toleration, len(*in))
@@ -556,6 +904,24 @@ func (in *PodPolicy) DeepCopyInto(out *PodPolicy) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.PodSecurityContext != nil {
+		in, out := &in.PodSecurityContext, &out.PodSecurityContext
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(v1.PodSecurityContext)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	if in.ContainerSecurityContext != nil {
+		in, out := &in.ContainerSecurityContext, &out.ContainerSecurityContext
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(v1.SecurityContext)
+			(*in).DeepCopyInto(*out)
+		}
+	}
 	if in.EtcdEnv != nil {
 		in, out := &in.EtcdEnv, &out.EtcdEnv
 		*out = make([]v1.EnvVar, len(*in))
@@ -563,6 +929,32 @@ func (in *PodPolicy) DeepCopyInto(out *PodPolicy) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.EtcdLogOutputs != nil {
+		in, out := &in.EtcdLogOutputs, &out.EtcdLogOutputs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AdditionalVolumes != nil {
+		in, out := &in.AdditionalVolumes, &out.AdditionalVolumes
+		*out = make([]v1.Volume, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.AdditionalVolumeMounts != nil {
+		in, out := &in.AdditionalVolumeMounts, &out.AdditionalVolumeMounts
+		*out = make([]v1.VolumeMount, len(*in))
+		copy(*out, *in)
+	}
+	if in.PodTemplateSpec != nil {
+		in, out := &in.PodTemplateSpec, &out.PodTemplateSpec
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(v1.PodTemplateSpec)
+			(*in).DeepCopyInto(*out)
+		}
+	}
 	return
 }
 
@@ -576,6 +968,22 @@ func (in *PodPolicy) DeepCopy() *PodPolicy {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PrometheusMonitoringConfig) DeepCopyInto(out *PrometheusMonitoringConfig) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PrometheusMonitoringConfig.
+func (in *PrometheusMonitoringConfig) DeepCopy() *PrometheusMonitoringConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(PrometheusMonitoringConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RestoreSource) DeepCopyInto(out *RestoreSource) {
 	*out = *in
@@ -635,6 +1043,22 @@ func (in *RestoreStatus) DeepCopy() *RestoreStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RotationStatus) DeepCopyInto(out *RotationStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RotationStatus.
+func (in *RotationStatus) DeepCopy() *RotationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RotationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *S3BackupSource) DeepCopyInto(out *S3BackupSource) {
 	*out = *in
@@ -720,6 +1144,15 @@ func (in *TLSPolicy) DeepCopyInto(out *TLSPolicy) {
 			(*in).DeepCopyInto(*out)
 		}
 	}
+	if in.CertManager != nil {
+		in, out := &in.CertManager, &out.CertManager
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(CertManagerTLSConfig)
+			**out = **in
+		}
+	}
 	return
 }
 
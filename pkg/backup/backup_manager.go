@@ -15,27 +15,66 @@
 package backup
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
 
+	"github.com/coreos/etcd-operator/pkg/backup/reader"
 	"github.com/coreos/etcd-operator/pkg/backup/writer"
 	"github.com/coreos/etcd-operator/pkg/util/constants"
 
+	"github.com/Azure/azure-sdk-for-go/storage"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/coreos/etcd/clientv3"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
 	"k8s.io/client-go/kubernetes"
 )
 
+const (
+	// multipartPartSize is the part size of multipart uploads.
+	multipartPartSize = 64 * 1024 * 1024
+)
+
+// MultipartThreshold is the etcd db size in bytes above which snapshots are
+// uploaded in parts of multipartPartSize.
+var MultipartThreshold int64 = 100 * 1024 * 1024
+
 // BackupManager backups an etcd cluster.
 type BackupManager struct {
 	kubecli kubernetes.Interface
 
-	endpoints     []string
-	namespace     string
-	etcdTLSConfig *tls.Config
+	endpoints []string
+	// preferredEndpoint is used for the snapshot when it is healthy.
+	preferredEndpoint string
+	namespace         string
+	etcdTLSConfig     *tls.Config
 
 	bw writer.Writer
+
+	// br reads back the backups written by bw for replication.
+	br reader.Reader
+	// rw writes the replicas of the backups to rPath.
+	rw    writer.Writer
+	rPath string
+
+	// uploadLimiter limits the throughput of the snapshot and replica uploads.
+	// It is nil if they are unlimited.
+	uploadLimiter *rate.Limiter
+
+	// retry calls the given func until it succeeds or retries are exhausted.
+	// The snapshot is saved once if it is nil.
+	retry func(func() error) error
+
+	// storageUsedBytes is the total size of the backups under the path of the
+	// last written snapshot.
+	storageUsedBytes int64
 }
 
 // NewBackupManagerFromWriter creates a BackupManager with backup writer.
@@ -49,9 +88,152 @@ func NewBackupManagerFromWriter(kubecli kubernetes.Interface, bw writer.Writer,
 	}
 }
 
+// NewBackupManagerFromReader creates a BackupManager that loads backups with
+// backup reader, e.g. to restore them.
+func NewBackupManagerFromReader(br reader.Reader) *BackupManager {
+	return &BackupManager{br: br}
+}
+
+// EnableReplication makes ReplicateSnap copy saved snapshots to rPath with rw.
+// The snapshots are read back from the backup storage with br.
+func (bm *BackupManager) EnableReplication(br reader.Reader, rw writer.Writer, rPath string) {
+	bm.br = br
+	bm.rw = rw
+	bm.rPath = rPath
+}
+
+// SetPreferredEndpoint makes the BackupManager take snapshots from ep while it
+// is healthy instead of the endpoint with the maximum revision.
+func (bm *BackupManager) SetPreferredEndpoint(ep string) {
+	bm.preferredEndpoint = ep
+}
+
+// SetUploadLimiter makes the BackupManager upload snapshots and their replicas
+// at most as fast as limiter allows. The limiter can be shared with other
+// BackupManagers to limit their total throughput.
+func (bm *BackupManager) SetUploadLimiter(limiter *rate.Limiter) {
+	bm.uploadLimiter = limiter
+}
+
+// SetRetry sets the func SaveSnapWithHooks retries saving the snapshot with.
+// The backup hooks are not run again on retries.
+func (bm *BackupManager) SetRetry(retry func(func() error) error) {
+	bm.retry = retry
+}
+
+// CopyBackup copies the backup file on srcPath to dstPath of the replication target.
+func (bm *BackupManager) CopyBackup(srcPath, dstPath string) error {
+	rc, err := bm.br.Open(srcPath)
+	if err != nil {
+		return fmt.Errorf("failed to read backup file (%v): %v", srcPath, err)
+	}
+	defer rc.Close()
+
+	_, err = bm.rw.Write(dstPath, newRateLimitedReader(rc, bm.uploadLimiter))
+	if err != nil {
+		return fmt.Errorf("failed to write backup file (%v): %v", dstPath, err)
+	}
+	return nil
+}
+
+// LoadSnap opens the backup file on path for reading and returns its size in
+// bytes, or -1 if the backup reader does not know it.
+func (bm *BackupManager) LoadSnap(path string) (io.ReadCloser, int64, error) {
+	if sr, ok := bm.br.(reader.SizedReader); ok {
+		rc, size, err := sr.OpenWithSize(path)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to read backup file (%v): %v", path, err)
+		}
+		return rc, size, nil
+	}
+	rc, err := bm.br.Open(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read backup file (%v): %v", path, err)
+	}
+	return rc, -1, nil
+}
+
+// VerifySnap reads the backup file on path and checks that it is complete:
+// its size matches the size reported by the backup reader, if any, and its
+// content matches the sha256 checksum etcd appends to snapshots.
+func (bm *BackupManager) VerifySnap(path string) error {
+	rc, size, err := bm.LoadSnap(path)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	h := sha256.New()
+	// tail holds the last bytes read, which end with the checksum.
+	var tail []byte
+	buf := make([]byte, 32*1024)
+	var n int64
+	for {
+		nr, rerr := rc.Read(buf)
+		n += int64(nr)
+		tail = append(tail, buf[:nr]...)
+		if len(tail) > sha256.Size {
+			h.Write(tail[:len(tail)-sha256.Size])
+			tail = append(tail[:0], tail[len(tail)-sha256.Size:]...)
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			return fmt.Errorf("failed to read backup file (%v): %v", path, rerr)
+		}
+	}
+	if size >= 0 && n != size {
+		return fmt.Errorf("backup file (%v) is truncated: read %d of %d bytes", path, n, size)
+	}
+	if len(tail) < sha256.Size {
+		return fmt.Errorf("backup file (%v) is too small to be an etcd snapshot: %d bytes", path, n)
+	}
+	if !bytes.Equal(h.Sum(nil), tail) {
+		return fmt.Errorf("backup file (%v) does not match its sha256 checksum", path)
+	}
+	return nil
+}
+
 // PurgeBackup used the s3Path as prefix, to purge stale backups more than maxBackups count
-func (bm *BackupManager) PurgeBackup(s3Path string, maxBackups int) error {
-	return bm.bw.Purge(s3Path, maxBackups)
+// and, if maxAge is not 0, backups older than maxAge.
+func (bm *BackupManager) PurgeBackup(s3Path string, maxBackups int, maxAge time.Duration) error {
+	return bm.bw.Purge(s3Path, maxBackups, maxAge)
+}
+
+// GetLatestBackup returns the backup file with the highest etcd revision among
+// the ones saved by SaveSnap with appendRev under path.
+func (bm *BackupManager) GetLatestBackup(path string) (*writer.BackupFile, error) {
+	files, err := bm.bw.List(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups (%v): %v", path, err)
+	}
+	var latest *writer.BackupFile
+	for i := range files {
+		f := &files[i]
+		// skip the files that only share the prefix, e.g. of another backup path
+		if f.EtcdRevision == 0 || f.Name != AppendRevToPath(true, f.EtcdRevision, path) {
+			continue
+		}
+		if latest == nil || f.EtcdRevision > latest.EtcdRevision {
+			latest = f
+		}
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("no backup found under (%v)", path)
+	}
+	return latest, nil
+}
+
+// TagBackup sets the tags on the backup file at the given path.
+func (bm *BackupManager) TagBackup(path string, tags map[string]string) error {
+	return bm.bw.Tag(path, tags)
+}
+
+// StorageUsedBytes returns the total size of the backups under the path of the
+// last snapshot saved by SaveSnap.
+func (bm *BackupManager) StorageUsedBytes() int64 {
+	return bm.storageUsedBytes
 }
 
 // SaveSnap uses backup writer to save etcd snapshot to a specified S3 path
@@ -79,16 +261,97 @@ func (bm *BackupManager) SaveSnap(s3Path string, appendRev bool) (int64, string,
 	}
 	defer rc.Close()
 
-	_, err = bm.bw.Write(
-		appendRevToPath(appendRev, rev, s3Path),
-		rc)
+	err = bm.writeSnap(rc, resp.DbSize, rev, s3Path, appendRev)
 	if err != nil {
-		return 0, "", fmt.Errorf("failed to write snapshot (%v)", err)
+		return 0, "", err
 	}
 	return rev, resp.Version, nil
 }
 
-func appendRevToPath(appendRev bool, rev int64, path string) string {
+// writeSnap writes the snapshot read from r.
+// dbSize is the expected size of the snapshot; snapshots larger than
+// MultipartThreshold are uploaded in multiple parts.
+func (bm *BackupManager) writeSnap(r io.Reader, dbSize, rev int64, path string, appendRev bool) error {
+	srcPath := AppendRevToPath(appendRev, rev, path)
+	r = newRateLimitedReader(r, bm.uploadLimiter)
+	var err error
+	if dbSize > MultipartThreshold {
+		_, err = bm.bw.WriteMultipart(srcPath, r, multipartPartSize)
+	} else {
+		_, err = bm.bw.Write(srcPath, r)
+	}
+	if err != nil {
+		werr := fmt.Errorf("failed to write snapshot (%v)", err)
+		if isTransientStorageError(err) {
+			return &TransientError{Err: werr}
+		}
+		return werr
+	}
+	bm.storageUsedBytes, err = bm.bw.TotalSize(path)
+	if err != nil {
+		// the snapshot is saved; only the storage usage is unknown.
+		logrus.Warningf("failed to get total size of backups (%v): %v", path, err)
+	}
+	return nil
+}
+
+// TransientError is returned when the backup storage failed with an error
+// that may not recur, e.g. a throttled or timed out request.
+type TransientError struct {
+	Err error
+}
+
+func (e *TransientError) Error() string {
+	return e.Err.Error()
+}
+
+func IsTransientError(err error) bool {
+	_, ok := err.(*TransientError)
+	return ok
+}
+
+// isTransientStorageError returns whether err of the S3 or ABS clients is a
+// server, throttling or network error.
+func isTransientStorageError(err error) bool {
+	switch e := err.(type) {
+	case awserr.RequestFailure:
+		return isTransientStatusCode(e.StatusCode())
+	case awserr.Error:
+		switch e.Code() {
+		case "RequestError", "RequestTimeout", "SlowDown", "Throttling", "ThrottlingException", "ServiceUnavailable":
+			return true
+		}
+		// s3manager wraps the errors of the failed part uploads.
+		return e.OrigErr() != nil && isTransientStorageError(e.OrigErr())
+	case storage.AzureStorageServiceError:
+		return isTransientStatusCode(e.StatusCode)
+	case *storage.AzureStorageServiceError:
+		return isTransientStatusCode(e.StatusCode)
+	case net.Error:
+		return e.Timeout() || e.Temporary()
+	}
+	return false
+}
+
+func isTransientStatusCode(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// ReplicateSnap copies the snapshot saved by SaveSnap at revision rev under path
+// to the replication target, if replication is enabled.
+func (bm *BackupManager) ReplicateSnap(path string, rev int64, appendRev bool) error {
+	if bm.rw == nil {
+		return nil
+	}
+	err := bm.CopyBackup(AppendRevToPath(appendRev, rev, path), AppendRevToPath(appendRev, rev, bm.rPath))
+	if err != nil {
+		return fmt.Errorf("failed to replicate snapshot (%v)", err)
+	}
+	return nil
+}
+
+// AppendRevToPath returns the path the backup at revision rev is saved to.
+func AppendRevToPath(appendRev bool, rev int64, path string) string {
 	if !appendRev {
 		return path
 	}
@@ -97,7 +360,18 @@ func appendRevToPath(appendRev bool, rev int64, path string) string {
 
 // etcdClientWithMaxRevision gets the etcd endpoint with the maximum kv store revision
 // and returns the etcd client of that member.
+// If a preferred endpoint is set and healthy, its client is returned instead.
 func (bm *BackupManager) etcdClientWithMaxRevision() (*clientv3.Client, int64, error) {
+	if len(bm.preferredEndpoint) != 0 {
+		etcdcli, rev, err := getClientWithMaxRev([]string{bm.preferredEndpoint}, bm.etcdTLSConfig)
+		if err == nil && etcdcli != nil {
+			return etcdcli, rev, nil
+		}
+		if etcdcli != nil {
+			etcdcli.Close()
+		}
+		logrus.Warningf("preferred endpoint (%s) is unhealthy, falling back to %v: %v", bm.preferredEndpoint, bm.endpoints, err)
+	}
 	etcdcli, rev, err := getClientWithMaxRev(bm.endpoints, bm.etcdTLSConfig)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to get etcd client with maximum kv store revision: %v", err)
@@ -0,0 +1,382 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/backup/reader"
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+	"github.com/coreos/etcd-operator/pkg/backup/writer"
+
+	"github.com/Azure/azure-sdk-for-go/storage"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// memStore is an in-memory backup storage that implements writer.Writer.
+type memStore struct {
+	files    map[string][]byte
+	tags     map[string]map[string]string
+	writeErr error
+}
+
+func newMemStore() *memStore {
+	return &memStore{files: map[string][]byte{}}
+}
+
+func (m *memStore) Write(path string, r io.Reader) (int64, error) {
+	if m.writeErr != nil {
+		return 0, m.writeErr
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	m.files[path] = b
+	return int64(len(b)), nil
+}
+
+func (m *memStore) WriteMultipart(path string, r io.Reader, partSize int64) (int64, error) {
+	return m.Write(path, r)
+}
+
+func (m *memStore) Purge(path string, maxBackups int, maxAge time.Duration) error { return nil }
+
+func (m *memStore) List(path string) ([]writer.BackupFile, error) {
+	var files []writer.BackupFile
+	for p, b := range m.files {
+		if strings.HasPrefix(p, path) {
+			files = append(files, writer.BackupFile{Name: p, Size: int64(len(b)), EtcdRevision: util.RevisionFromBackupPath(p)})
+		}
+	}
+	return files, nil
+}
+
+func (m *memStore) TotalSize(path string) (int64, error) {
+	var size int64
+	for p, b := range m.files {
+		if strings.HasPrefix(p, path) {
+			size += int64(len(b))
+		}
+	}
+	return size, nil
+}
+
+func (m *memStore) Head(path string) (*writer.BackupMetadata, error) {
+	b, ok := m.files[path]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return &writer.BackupMetadata{BackupFile: writer.BackupFile{Name: path, Size: int64(len(b))}}, nil
+}
+
+func (m *memStore) Tag(path string, tags map[string]string) error {
+	if _, ok := m.files[path]; !ok {
+		return errors.New("not found")
+	}
+	if m.tags == nil {
+		m.tags = map[string]map[string]string{}
+	}
+	m.tags[path] = tags
+	return nil
+}
+
+// memReader reads the files of a memStore. It implements reader.Reader.
+type memReader struct {
+	*memStore
+}
+
+func (m memReader) Open(path string) (io.ReadCloser, error) {
+	b, ok := m.files[path]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return ioutil.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (m memReader) List(path string) ([]string, error) { return nil, nil }
+
+// sizedMemReader is a memReader that reports size as the size of every file.
+// It implements reader.SizedReader.
+type sizedMemReader struct {
+	memReader
+	size int64
+}
+
+func (m sizedMemReader) OpenWithSize(path string) (io.ReadCloser, int64, error) {
+	rc, err := m.Open(path)
+	return rc, m.size, err
+}
+
+// newSnapshot returns an etcd snapshot of data, which ends with its sha256 checksum.
+func newSnapshot(data string) []byte {
+	sum := sha256.Sum256([]byte(data))
+	return append([]byte(data), sum[:]...)
+}
+
+func TestLoadSnap(t *testing.T) {
+	store := newMemStore()
+	store.files["bucket/etcd.backup"] = []byte("snapshot")
+
+	tests := []struct {
+		br       reader.Reader
+		wantSize int64
+	}{
+		{br: memReader{store}, wantSize: -1},
+		{br: sizedMemReader{memReader{store}, 8}, wantSize: 8},
+	}
+	for i, tt := range tests {
+		bm := NewBackupManagerFromReader(tt.br)
+		rc, size, err := bm.LoadSnap("bucket/etcd.backup")
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		b, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil || string(b) != "snapshot" {
+			t.Errorf("#%d: loaded %q, %v, want %q", i, b, err, "snapshot")
+		}
+		if size != tt.wantSize {
+			t.Errorf("#%d: size = %d, want %d", i, size, tt.wantSize)
+		}
+	}
+
+	if _, _, err := NewBackupManagerFromReader(memReader{store}).LoadSnap("bucket/missing"); err == nil {
+		t.Error("want error for missing backup, got nil")
+	}
+}
+
+func TestVerifySnap(t *testing.T) {
+	snap := newSnapshot(strings.Repeat("data", 10000))
+	corrupt := append([]byte{}, snap...)
+	corrupt[0] ^= 1
+
+	tests := []struct {
+		file    []byte
+		size    int64
+		wantErr bool
+	}{
+		{file: snap, size: -1},
+		{file: snap, size: int64(len(snap))},
+		{file: newSnapshot(""), size: -1},
+		// the upload of the backup was cut short
+		{file: snap[:len(snap)/2], size: -1, wantErr: true},
+		{file: snap, size: int64(len(snap)) + 1, wantErr: true},
+		{file: corrupt, size: -1, wantErr: true},
+		{file: []byte("short"), size: -1, wantErr: true},
+	}
+	for i, tt := range tests {
+		store := newMemStore()
+		store.files["bucket/etcd.backup"] = tt.file
+		bm := NewBackupManagerFromReader(sizedMemReader{memReader{store}, tt.size})
+		err := bm.VerifySnap("bucket/etcd.backup")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("#%d: err = %v, want error %v", i, err, tt.wantErr)
+		}
+	}
+}
+
+func TestReplicateSnap(t *testing.T) {
+	src, dst := newMemStore(), newMemStore()
+	bm := &BackupManager{bw: src}
+	bm.EnableReplication(memReader{src}, dst, "dr-bucket/etcd.backup")
+
+	err := bm.writeSnap(bytes.NewBufferString("snapshot"), 8, 16, "bucket/etcd.backup", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dst.files) != 0 {
+		t.Fatalf("backup is replicated before ReplicateSnap: %v", dst.files)
+	}
+	if err := bm.ReplicateSnap("bucket/etcd.backup", 16, true); err != nil {
+		t.Fatal(err)
+	}
+	got, ok := dst.files["dr-bucket/etcd.backup_0000000000000010"]
+	if !ok {
+		t.Fatalf("backup is not replicated, replication target has %v", dst.files)
+	}
+	if string(got) != "snapshot" {
+		t.Errorf("replicated backup = %q, want %q", got, "snapshot")
+	}
+}
+
+func TestWriteSnapSkipsReplicationAfterFailedWrite(t *testing.T) {
+	src, dst := newMemStore(), newMemStore()
+	src.writeErr = errors.New("write failed")
+	bm := &BackupManager{bw: src}
+	bm.EnableReplication(memReader{src}, dst, "dr-bucket/etcd.backup")
+
+	err := bm.writeSnap(bytes.NewBufferString("snapshot"), 8, 16, "bucket/etcd.backup", false)
+	if err == nil {
+		t.Fatal("expect error, got nil")
+	}
+	if len(dst.files) != 0 {
+		t.Errorf("backup is replicated after a failed write: %v", dst.files)
+	}
+}
+
+func TestWriteSnapTransientError(t *testing.T) {
+	tests := []struct {
+		err           error
+		wantTransient bool
+	}{
+		{err: awserr.NewRequestFailure(awserr.New("InternalError", "internal error", nil), 500, "req"), wantTransient: true},
+		{err: awserr.NewRequestFailure(awserr.New("SlowDown", "reduce your request rate", nil), 503, "req"), wantTransient: true},
+		{err: awserr.New("MultipartUpload", "upload multipart failed", awserr.New("RequestError", "send request failed", nil)), wantTransient: true},
+		{err: storage.AzureStorageServiceError{Code: "ServerBusy", StatusCode: 503}, wantTransient: true},
+		{err: &net.DNSError{Err: "i/o timeout", IsTimeout: true}, wantTransient: true},
+		{err: awserr.NewRequestFailure(awserr.New("AccessDenied", "access denied", nil), 403, "req"), wantTransient: false},
+		{err: awserr.New("NoSuchBucket", "bucket does not exist", nil), wantTransient: false},
+		{err: storage.AzureStorageServiceError{Code: "AuthenticationFailed", StatusCode: 403}, wantTransient: false},
+		{err: errors.New("container does not exist"), wantTransient: false},
+	}
+	for i, tt := range tests {
+		s := newMemStore()
+		s.writeErr = tt.err
+		bm := &BackupManager{bw: s}
+		err := bm.writeSnap(bytes.NewBufferString("snapshot"), 8, 16, "bucket/etcd.backup", false)
+		if err == nil {
+			t.Fatalf("#%d: expect error, got nil", i)
+		}
+		if IsTransientError(err) != tt.wantTransient {
+			t.Errorf("#%d: transient = %v, want %v (err: %v)", i, IsTransientError(err), tt.wantTransient, err)
+		}
+	}
+}
+
+// A failed replication leaves the saved backup in place.
+func TestReplicateSnapFailure(t *testing.T) {
+	src, dst := newMemStore(), newMemStore()
+	dst.writeErr = errors.New("write failed")
+	bm := &BackupManager{bw: src}
+	bm.EnableReplication(memReader{src}, dst, "dr-bucket/etcd.backup")
+
+	if err := bm.writeSnap(bytes.NewBufferString("snapshot"), 8, 16, "bucket/etcd.backup", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := bm.ReplicateSnap("bucket/etcd.backup", 16, false); err == nil {
+		t.Fatal("expect replication error, got nil")
+	}
+	if got := string(src.files["bucket/etcd.backup"]); got != "snapshot" {
+		t.Errorf("saved backup = %q, want %q", got, "snapshot")
+	}
+}
+
+func TestWriteSnapRecordsStorageUsed(t *testing.T) {
+	src := newMemStore()
+	src.files["bucket/etcd.backup_0000000000000001"] = []byte("old")
+	src.files["bucket/other.backup"] = []byte("not counted")
+	bm := &BackupManager{bw: src}
+
+	err := bm.writeSnap(bytes.NewBufferString("snapshot"), 8, 16, "bucket/etcd.backup", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if get, want := bm.StorageUsedBytes(), int64(len("old")+len("snapshot")); get != want {
+		t.Errorf("storage used = %d, want %d", get, want)
+	}
+}
+
+func TestWriteSnapUploadRateLimit(t *testing.T) {
+	src, dst := newMemStore(), newMemStore()
+	bm := &BackupManager{bw: src}
+	bm.EnableReplication(memReader{src}, dst, "dr-bucket/etcd.backup")
+	// the snapshot uses up the burst, so its replica has to wait for a second.
+	bm.SetUploadLimiter(NewUploadLimiter(1000))
+
+	snap := strings.Repeat("s", 1000)
+	start := time.Now()
+	err := bm.writeSnap(bytes.NewBufferString(snap), 1000, 16, "bucket/etcd.backup", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bm.ReplicateSnap("bucket/etcd.backup", 16, false); err != nil {
+		t.Fatal(err)
+	}
+	if took := time.Since(start); took < 900*time.Millisecond {
+		t.Errorf("uploads took %v, want at least 900ms", took)
+	}
+	if got := string(dst.files["dr-bucket/etcd.backup"]); got != snap {
+		t.Errorf("replicated backup has %d bytes, want %d", len(got), len(snap))
+	}
+}
+
+func TestNewUploadLimiter(t *testing.T) {
+	tests := []struct {
+		bytesPerSec int64
+		wantNil     bool
+		wantBurst   int
+	}{
+		{bytesPerSec: 0, wantNil: true},
+		{bytesPerSec: -1, wantNil: true},
+		{bytesPerSec: 1000, wantBurst: 1000},
+		{bytesPerSec: 100 * 1024 * 1024, wantBurst: maxUploadBurstBytes},
+	}
+	for i, tt := range tests {
+		l := NewUploadLimiter(tt.bytesPerSec)
+		if tt.wantNil {
+			if l != nil {
+				t.Errorf("#%d: want nil limiter, got %v", i, l)
+			}
+			continue
+		}
+		if l.Burst() != tt.wantBurst {
+			t.Errorf("#%d: burst = %d, want %d", i, l.Burst(), tt.wantBurst)
+		}
+	}
+}
+
+func TestGetLatestBackup(t *testing.T) {
+	tests := []struct {
+		files   []string
+		want    string
+		wantErr bool
+	}{
+		{files: nil, wantErr: true},
+		{files: []string{"bucket/etcd.backup"}, wantErr: true},
+		{
+			files: []string{"bucket/etcd.backup_0000000000000009", "bucket/etcd.backup_000000000000000a", "bucket/etcd.backup_0000000000000002"},
+			want:  "bucket/etcd.backup_000000000000000a",
+		},
+		// another backup path sharing the prefix is ignored
+		{
+			files: []string{"bucket/etcd.backup_0000000000000002", "bucket/etcd.backup.old_00000000000000ff"},
+			want:  "bucket/etcd.backup_0000000000000002",
+		},
+	}
+	for i, tt := range tests {
+		store := newMemStore()
+		for _, f := range tt.files {
+			store.files[f] = []byte("snapshot")
+		}
+		bm := &BackupManager{bw: store}
+		got, err := bm.GetLatestBackup("bucket/etcd.backup")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("#%d: want error %v, get %v", i, tt.wantErr, err)
+			continue
+		}
+		if err == nil && got.Name != tt.want {
+			t.Errorf("#%d: latest backup = %s, want %s", i, got.Name, tt.want)
+		}
+	}
+}
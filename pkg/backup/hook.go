@@ -0,0 +1,131 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/coreos/etcd-operator/pkg/util/constants"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/sirupsen/logrus"
+)
+
+// etcdContainerName is the name of the etcd container in the etcd pods created by the etcd operator.
+const etcdContainerName = "etcd"
+
+// PreBackupHookError is returned when the pre-backup hook fails and the backup is skipped.
+type PreBackupHookError struct {
+	Err error
+}
+
+func (e *PreBackupHookError) Error() string {
+	return fmt.Sprintf("pre-backup hook failed: %v", e.Err)
+}
+
+func IsPreBackupHookError(err error) bool {
+	_, ok := err.(*PreBackupHookError)
+	return ok
+}
+
+// SaveSnapWithHooks runs preHook in the leader etcd pod, saves the snapshot like SaveSnap,
+// and then runs postHook in the leader etcd pod.
+// If preHook fails, the snapshot is not taken and a *PreBackupHookError is returned.
+// Saving the snapshot is retried with the func set by SetRetry; the hooks run once.
+// A failing postHook is only logged since the snapshot has been saved.
+func (bm *BackupManager) SaveSnapWithHooks(s3Path string, appendRev bool, preHook, postHook []string) (int64, string, error) {
+	if len(preHook) != 0 {
+		if err := bm.RunHook(preHook); err != nil {
+			return 0, "", &PreBackupHookError{Err: err}
+		}
+	}
+
+	var (
+		rev         int64
+		etcdVersion string
+	)
+	save := func() error {
+		var err error
+		rev, etcdVersion, err = bm.SaveSnap(s3Path, appendRev)
+		return err
+	}
+	var err error
+	if bm.retry != nil {
+		err = bm.retry(save)
+	} else {
+		err = save()
+	}
+
+	if len(postHook) != 0 {
+		if herr := bm.RunHook(postHook); herr != nil {
+			logrus.Warningf("post-backup hook failed: %v", herr)
+		}
+	}
+	return rev, etcdVersion, err
+}
+
+// RunHook runs cmd in the etcd container of the leader etcd pod.
+func (bm *BackupManager) RunHook(cmd []string) error {
+	leader, err := bm.leaderPodName()
+	if err != nil {
+		return err
+	}
+	cfg, err := k8sutil.InClusterConfig()
+	if err != nil {
+		return err
+	}
+
+	stdout, stderr, err := k8sutil.ExecInPod(bm.kubecli, cfg, bm.namespace, leader, etcdContainerName, cmd)
+	if err != nil {
+		return fmt.Errorf("command (%s) failed in pod (%s): %v, stderr: %s", strings.Join(cmd, " "), leader, err, stderr)
+	}
+	logrus.Infof("command (%s) succeeded in pod (%s), stdout: %s", strings.Join(cmd, " "), leader, stdout)
+	return nil
+}
+
+// leaderPodName returns the name of the pod the etcd leader runs in,
+// which is the name of the leader member.
+func (bm *BackupManager) leaderPodName() (string, error) {
+	cfg := clientv3.Config{
+		Endpoints:   bm.endpoints,
+		DialTimeout: constants.DefaultDialTimeout,
+		TLS:         bm.etcdTLSConfig,
+	}
+	etcdcli, err := clientv3.New(cfg)
+	if err != nil {
+		return "", fmt.Errorf("create etcd client failed: %v", err)
+	}
+	defer etcdcli.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), constants.DefaultRequestTimeout)
+	defer cancel()
+	sresp, err := etcdcli.Status(ctx, etcdcli.Endpoints()[0])
+	if err != nil {
+		return "", fmt.Errorf("failed to get etcd status: %v", err)
+	}
+	mresp, err := etcdcli.MemberList(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to list etcd members: %v", err)
+	}
+	for _, m := range mresp.Members {
+		if m.ID == sresp.Leader {
+			return m.Name, nil
+		}
+	}
+	return "", fmt.Errorf("leader (%x) not found in etcd members", sresp.Leader)
+}
@@ -0,0 +1,68 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/time/rate"
+)
+
+// maxUploadBurstBytes caps the burst of upload limiters, and so the size of
+// the reads of a rate limited reader, for high limits.
+const maxUploadBurstBytes = 4 * 1024 * 1024
+
+// NewUploadLimiter returns a limiter of bytesPerSec bytes per second for
+// uploads, or nil if bytesPerSec is not positive.
+func NewUploadLimiter(bytesPerSec int64) *rate.Limiter {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+	burst := bytesPerSec
+	if burst > maxUploadBurstBytes {
+		burst = maxUploadBurstBytes
+	}
+	return rate.NewLimiter(rate.Limit(bytesPerSec), int(burst))
+}
+
+// rateLimitedReader reads from r at most as fast as limiter allows.
+type rateLimitedReader struct {
+	r       io.Reader
+	limiter *rate.Limiter
+}
+
+// newRateLimitedReader returns a reader of r limited by limiter, or r itself
+// if limiter is nil.
+func newRateLimitedReader(r io.Reader, limiter *rate.Limiter) io.Reader {
+	if limiter == nil {
+		return r
+	}
+	return &rateLimitedReader{r: r, limiter: limiter}
+}
+
+func (rr *rateLimitedReader) Read(p []byte) (int, error) {
+	// WaitN fails for more bytes than the burst.
+	if b := rr.limiter.Burst(); len(p) > b {
+		p = p[:b]
+	}
+	n, err := rr.r.Read(p)
+	if n > 0 {
+		if werr := rr.limiter.WaitN(context.Background(), n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
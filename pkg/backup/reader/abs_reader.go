@@ -24,7 +24,7 @@ import (
 )
 
 // ensure absReader satisfies reader interface.
-var _ Reader = &absReader{}
+var _ SizedReader = &absReader{}
 
 // absReader provides Reader implementation for reading a file from ABS
 type absReader struct {
@@ -37,11 +37,64 @@ func NewABSReader(abs *storage.BlobStorageClient) Reader {
 
 // Open opens the file on path where path must be in the format "<abs-container-name>/<key>"
 func (absr *absReader) Open(path string) (io.ReadCloser, error) {
+	rc, _, err := absr.OpenWithSize(path)
+	return rc, err
+}
+
+// OpenWithSize opens the file on path like Open and returns its size.
+func (absr *absReader) OpenWithSize(path string) (io.ReadCloser, int64, error) {
 	container, key, err := util.ParseBucketAndKey(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to parse abs container and key: %v", err)
+	}
+
+	containerRef, err := absr.getContainer(container)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	blob := containerRef.GetBlobReference(key)
+	getBlobOpts := &storage.GetBlobOptions{}
+	// Get sets the blob properties from the response headers.
+	rc, err := blob.Get(getBlobOpts)
+	if err != nil {
+		return nil, 0, err
+	}
+	return rc, blob.Properties.ContentLength, nil
+}
+
+// List lists the files on ABS whose path starts with the given path,
+// where path must be in the format "<abs-container-name>/<key-prefix>"
+func (absr *absReader) List(path string) ([]string, error) {
+	container, prefix, err := util.ParseBucketAndKey(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse abs container and key: %v", err)
 	}
 
+	containerRef, err := absr.getContainer(container)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	params := storage.ListBlobsParameters{Prefix: prefix}
+	for {
+		resp, err := containerRef.ListBlobs(params)
+		if err != nil {
+			return nil, err
+		}
+		for _, blob := range resp.Blobs {
+			paths = append(paths, container+"/"+blob.Name)
+		}
+		if len(resp.NextMarker) == 0 {
+			break
+		}
+		params.Marker = resp.NextMarker
+	}
+	return paths, nil
+}
+
+func (absr *absReader) getContainer(container string) (*storage.Container, error) {
 	containerRef := absr.abs.GetContainerReference(container)
 	containerExists, err := containerRef.Exists()
 	if err != nil {
@@ -51,8 +104,5 @@ func (absr *absReader) Open(path string) (io.ReadCloser, error) {
 	if !containerExists {
 		return nil, fmt.Errorf("container %v does not exist", container)
 	}
-
-	blob := containerRef.GetBlobReference(key)
-	getBlobOpts := &storage.GetBlobOptions{}
-	return blob.Get(getBlobOpts)
+	return containerRef, nil
 }
@@ -0,0 +1,76 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reader
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ensure localReader satisfies reader interface.
+var _ SizedReader = &localReader{}
+
+// localReader provides Reader implementation for reading a file from the local filesystem.
+type localReader struct{}
+
+func NewLocalReader() Reader {
+	return &localReader{}
+}
+
+// Open opens the file on the local path.
+func (lr *localReader) Open(path string) (io.ReadCloser, error) {
+	return os.Open(path)
+}
+
+// OpenWithSize opens the file on the local path and returns its size.
+func (lr *localReader) OpenWithSize(path string) (io.ReadCloser, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, fi.Size(), nil
+}
+
+// List lists the regular files whose path starts with the given path.
+func (lr *localReader) List(path string) ([]string, error) {
+	// filepath.Walk returns cleaned paths, so the prefix is cleaned as well.
+	prefix := filepath.Clean(path)
+	dir := filepath.Dir(prefix)
+	if strings.HasSuffix(path, string(filepath.Separator)) {
+		dir = prefix
+		prefix += string(filepath.Separator)
+	}
+	var paths []string
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() && strings.HasPrefix(p, prefix) {
+			paths = append(paths, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
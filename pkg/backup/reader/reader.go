@@ -14,10 +14,43 @@
 
 package reader
 
-import "io"
+import (
+	"fmt"
+	"io"
+
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+)
 
 // Reader defines required reader operations
 type Reader interface {
 	// Open opens up a backup file for reading.
 	Open(path string) (rc io.ReadCloser, err error)
+	// List lists the paths of the backup files whose path starts with the given path.
+	List(path string) ([]string, error)
+}
+
+// SizedReader is a Reader that knows the size of the backup files it opens.
+type SizedReader interface {
+	Reader
+	// OpenWithSize opens up a backup file for reading and returns its size in bytes.
+	OpenWithSize(path string) (rc io.ReadCloser, size int64, err error)
+}
+
+// LatestBackupPath returns the path of the backup file with the highest etcd
+// revision among the files whose path starts with the given prefix.
+func LatestBackupPath(r Reader, prefix string) (string, error) {
+	paths, err := r.List(prefix)
+	if err != nil {
+		return "", err
+	}
+	latest, latestRev := "", int64(-1)
+	for _, p := range paths {
+		if rev := util.RevisionFromBackupPath(p); rev > latestRev {
+			latest, latestRev = p, rev
+		}
+	}
+	if len(latest) == 0 {
+		return "", fmt.Errorf("no backup file found under (%v)", prefix)
+	}
+	return latest, nil
 }
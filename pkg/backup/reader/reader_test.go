@@ -0,0 +1,61 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reader
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLatestBackupPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "etcd-backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{
+		"etcd.backup_0000000000000010",
+		"etcd.backup_0000000000000a00",
+		"etcd.backup_0000000000000100",
+		"other.backup_0000000000001000",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		prefix  string
+		wLatest string
+		wErr    bool
+	}{
+		{prefix: filepath.Join(dir, "etcd.backup"), wLatest: filepath.Join(dir, "etcd.backup_0000000000000a00")},
+		{prefix: dir + string(filepath.Separator), wLatest: filepath.Join(dir, "other.backup_0000000000001000")},
+		{prefix: filepath.Join(dir, "missing"), wErr: true},
+	}
+	for i, tt := range tests {
+		latest, err := LatestBackupPath(NewLocalReader(), tt.prefix)
+		if (err != nil) != tt.wErr {
+			t.Errorf("#%d: err = %v, want error %v", i, err, tt.wErr)
+			continue
+		}
+		if latest != tt.wLatest {
+			t.Errorf("#%d: latest = %s, want %s", i, latest, tt.wLatest)
+		}
+	}
+}
@@ -25,7 +25,7 @@ import (
 )
 
 // ensure s3Reader satisfies reader interface.
-var _ Reader = &s3Reader{}
+var _ SizedReader = &s3Reader{}
 
 // s3Reader provides Reader imlementation for reading a file from S3
 type s3Reader struct {
@@ -38,17 +38,53 @@ func NewS3Reader(s3 *s3.S3) Reader {
 
 // Open opens the file on path where path must be in the format "<s3-bucket-name>/<key>"
 func (s3r *s3Reader) Open(path string) (io.ReadCloser, error) {
+	rc, _, err := s3r.OpenWithSize(path)
+	return rc, err
+}
+
+// OpenWithSize opens the file on path like Open and returns its size.
+func (s3r *s3Reader) OpenWithSize(path string) (io.ReadCloser, int64, error) {
 	bucket, key, err := util.ParseBucketAndKey(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse s3 bucket and key: %v", err)
+		return nil, 0, fmt.Errorf("failed to parse s3 bucket and key: %v", err)
 	}
 	resp, err := s3r.s3.GetObject(&s3.GetObjectInput{
 		Bucket: aws.String(bucket),
 		Key:    aws.String(key),
 	})
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+	if resp.ContentLength == nil {
+		resp.Body.Close()
+		return nil, 0, fmt.Errorf("failed to get size of (%v)", path)
+	}
+
+	return resp.Body, *resp.ContentLength, nil
+}
+
+// List lists the files on S3 whose path starts with the given path,
+// where path must be in the format "<s3-bucket-name>/<key-prefix>"
+func (s3r *s3Reader) List(path string) ([]string, error) {
+	bucket, prefix, err := util.ParseBucketAndKey(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse s3 bucket and key: %v", err)
 	}
 
-	return resp.Body, nil
+	var paths []string
+	err = s3r.s3.ListObjectsV2Pages(
+		&s3.ListObjectsV2Input{
+			Bucket: aws.String(bucket),
+			Prefix: aws.String(prefix),
+		},
+		func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+			for _, obj := range page.Contents {
+				paths = append(paths, bucket+"/"+aws.StringValue(obj.Key))
+			}
+			return true
+		})
+	if err != nil {
+		return nil, err
+	}
+	return paths, nil
 }
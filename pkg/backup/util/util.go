@@ -16,6 +16,7 @@ package util
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -32,3 +33,18 @@ func ParseBucketAndKey(path string) (string, string, error) {
 	}
 	return toks[0], toks[1], nil
 }
+
+// RevisionFromBackupPath parses the etcd revision appended to the backup path
+// in the format "<path>_<16-digit-hex-revision>".
+// It returns 0 if the path does not end with a revision.
+func RevisionFromBackupPath(path string) int64 {
+	i := strings.LastIndex(path, "_")
+	if i == -1 || len(path)-i-1 != 16 {
+		return 0
+	}
+	rev, err := strconv.ParseInt(path[i+1:], 16, 64)
+	if err != nil {
+		return 0
+	}
+	return rev
+}
@@ -15,13 +15,15 @@
 package writer
 
 import (
-	"bytes"
 	"encoding/base64"
 	"fmt"
 	"io"
-	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/storage"
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
 	"github.com/coreos/etcd-operator/pkg/backup/util"
 	"github.com/pborman/uuid"
 )
@@ -35,6 +37,9 @@ type absWriter struct {
 const (
 	// AzureBlobBlockChunkLimitInBytes 100MiB is the limit
 	AzureBlobBlockChunkLimitInBytes = 104857600
+
+	// maxConcurrentBlockPuts is the number of blocks put in parallel.
+	maxConcurrentBlockPuts = 4
 )
 
 // NewABSWriter creates a abs writer.
@@ -55,8 +60,21 @@ func (absw *absWriter) getContainer(container string) (*storage.Container, error
 	return containerRef, nil
 }
 
-// Write writes the backup file to the given abs path, "<abs-container-name>/<key>".
+// Write writes the backup file to the given abs path, "<abs-container-name>/<key>",
+// by putting blocks of AzureBlobBlockChunkLimitInBytes in parallel and committing
+// the block list.
 func (absw *absWriter) Write(path string, r io.Reader) (int64, error) {
+	return absw.WriteMultipart(path, r, AzureBlobBlockChunkLimitInBytes)
+}
+
+// WriteMultipart writes the backup file to the given abs path, "<abs-container-name>/<key>",
+// by putting blocks of partSize bytes and committing the block list.
+// It does not buffer the whole backup file in memory.
+func (absw *absWriter) WriteMultipart(path string, r io.Reader, partSize int64) (int64, error) {
+	if partSize > AzureBlobBlockChunkLimitInBytes {
+		partSize = AzureBlobBlockChunkLimitInBytes
+	}
+
 	container, key, err := util.ParseBucketAndKey(path)
 	if err != nil {
 		return 0, err
@@ -67,49 +85,90 @@ func (absw *absWriter) Write(path string, r io.Reader) (int64, error) {
 	}
 
 	blob := containerRef.GetBlobReference(key)
-	putBlobOpts := storage.PutBlobOptions{}
-
-	err = blob.CreateBlockBlob(&putBlobOpts)
+	blocks, size, err := putBlocks(blob, r, partSize, maxConcurrentBlockPuts)
 	if err != nil {
 		return 0, err
 	}
+	err = blob.PutBlockList(blocks, &storage.PutBlockListOptions{})
+	if err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// blockPutter puts the blocks of a block blob.
+type blockPutter interface {
+	PutBlock(blockID string, chunk []byte, options *storage.PutBlockOptions) error
+}
+
+// putBlocks reads r in blocks of blockSize bytes and puts them with up to
+// concurrency puts at a time. It returns the blocks in the order of r and
+// the number of bytes read. At most concurrency+1 blocks are held in memory.
+func putBlocks(bp blockPutter, r io.Reader, blockSize int64, concurrency int) ([]storage.Block, int64, error) {
+	var (
+		size   int64
+		blocks []storage.Block
+		wg     sync.WaitGroup
+	)
+	sem := make(chan struct{}, concurrency)
+	errCh := make(chan error, 1)
+	reportErr := func(err error) {
+		select {
+		case errCh <- err:
+		default:
+		}
+	}
+
+	var rerr error
+	for {
+		// stop reading once a put failed
+		if len(errCh) != 0 {
+			break
+		}
+		buf := make([]byte, blockSize)
+		n, err := io.ReadFull(r, buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			rerr = err
+			break
+		}
 
-	buf := new(bytes.Buffer)
-	buf.ReadFrom(r)
-	len := len(buf.Bytes())
-	chunckCount := len/AzureBlobBlockChunkLimitInBytes + 1
-	blocks := make([]storage.Block, 0, chunckCount)
-	for i := 0; i < chunckCount; i++ {
 		blockID := base64.StdEncoding.EncodeToString([]byte(uuid.New()))
 		blocks = append(blocks, storage.Block{ID: blockID, Status: storage.BlockStatusLatest})
-		start := i * AzureBlobBlockChunkLimitInBytes
-		end := (i + 1) * AzureBlobBlockChunkLimitInBytes
-		if len < end {
-			end = len
-		}
+		size += int64(n)
 
-		chunk := buf.Bytes()[start:end]
-		err = blob.PutBlock(blockID, chunk, &storage.PutBlockOptions{})
-		if err != nil {
-			return 0, err
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(chunk []byte) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if perr := bp.PutBlock(blockID, chunk, &storage.PutBlockOptions{}); perr != nil {
+				reportErr(fmt.Errorf("failed to put block (%s): %v", blockID, perr))
+			}
+		}(buf[:n])
+
+		if err == io.ErrUnexpectedEOF {
+			break
 		}
 	}
+	wg.Wait()
 
-	err = blob.PutBlockList(blocks, &storage.PutBlockListOptions{})
-	if err != nil {
-		return 0, err
+	if rerr != nil {
+		return nil, 0, rerr
 	}
-
-	getBlobOpts := &storage.GetBlobOptions{}
-	_, err = blob.Get(getBlobOpts)
-	if err != nil {
-		return 0, err
+	select {
+	case err := <-errCh:
+		return nil, 0, err
+	default:
 	}
-
-	return blob.Properties.ContentLength, nil
+	return blocks, size, nil
 }
 
-func (absw *absWriter) Purge(path string, maxBackups int) error {
+func (absw *absWriter) Purge(path string, maxBackups int, maxAge time.Duration) error {
 	container, key, err := util.ParseBucketAndKey(path)
 	if err != nil {
 		return err
@@ -126,15 +185,13 @@ func (absw *absWriter) Purge(path string, maxBackups int) error {
 		return err
 	}
 
-	blobNames := []string{}
+	files := []BackupFile{}
 	for _, blob := range resp.Blobs {
-		blobNames = append(blobNames, (blob.Name))
+		files = append(files, BackupFile{Name: blob.Name, LastModified: time.Time(blob.Properties.LastModified)})
 	}
 
-	// we can just use string comparison
-	sort.Strings(blobNames)
-	for i := 0; i < len(blobNames)-maxBackups; i++ {
-		blob := containerRef.GetBlobReference(blobNames[i])
+	for _, f := range backupsToPurge(files, maxBackups, maxAge, time.Now()) {
+		blob := containerRef.GetBlobReference(f.Name)
 		err = blob.Delete(&storage.DeleteBlobOptions{})
 		if err != nil {
 			return err
@@ -142,3 +199,106 @@ func (absw *absWriter) Purge(path string, maxBackups int) error {
 	}
 	return nil
 }
+
+// List lists the backup files under the given abs path, "<abs-container-name>/<key-prefix>".
+func (absw *absWriter) List(path string) ([]BackupFile, error) {
+	container, key, err := util.ParseBucketAndKey(path)
+	if err != nil {
+		return nil, err
+	}
+
+	containerRef, err := absw.getContainer(container)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []BackupFile{}
+	params := storage.ListBlobsParameters{Prefix: key}
+	for {
+		resp, err := containerRef.ListBlobs(params)
+		if err != nil {
+			return nil, err
+		}
+		for _, blob := range resp.Blobs {
+			name := container + "/" + blob.Name
+			files = append(files, BackupFile{
+				Name:         name,
+				Size:         blob.Properties.ContentLength,
+				LastModified: time.Time(blob.Properties.LastModified),
+				EtcdRevision: util.RevisionFromBackupPath(name),
+			})
+		}
+		if len(resp.NextMarker) == 0 {
+			break
+		}
+		params.Marker = resp.NextMarker
+	}
+	return files, nil
+}
+
+// TotalSize returns the total size of the backup files under the given abs path.
+func (absw *absWriter) TotalSize(path string) (int64, error) {
+	return totalSize(absw.List(path))
+}
+
+// Head returns the metadata of the backup file at the given abs path, "<abs-container-name>/<key>".
+func (absw *absWriter) Head(path string) (*BackupMetadata, error) {
+	container, key, err := util.ParseBucketAndKey(path)
+	if err != nil {
+		return nil, err
+	}
+	containerRef, err := absw.getContainer(container)
+	if err != nil {
+		return nil, err
+	}
+
+	blob := containerRef.GetBlobReference(key)
+	if err := blob.GetProperties(&storage.GetBlobPropertiesOptions{}); err != nil {
+		return nil, err
+	}
+	if err := blob.GetMetadata(&storage.GetBlobMetadataOptions{}); err != nil {
+		return nil, err
+	}
+	return &BackupMetadata{
+		BackupFile: BackupFile{
+			Name:         path,
+			Size:         blob.Properties.ContentLength,
+			LastModified: time.Time(blob.Properties.LastModified),
+			EtcdRevision: util.RevisionFromBackupPath(path),
+		},
+		ETag:        blob.Properties.Etag,
+		EtcdVersion: blob.Metadata[absMetadataName(api.BackupTagVersion)],
+	}, nil
+}
+
+// Tag sets the tags as the metadata of the backup file at the given abs path,
+// "<abs-container-name>/<key>". Metadata names must be identifiers, so '-' in
+// the tag keys is replaced by '_'.
+func (absw *absWriter) Tag(path string, tags map[string]string) error {
+	container, key, err := util.ParseBucketAndKey(path)
+	if err != nil {
+		return err
+	}
+	containerRef, err := absw.getContainer(container)
+	if err != nil {
+		return err
+	}
+
+	blob := containerRef.GetBlobReference(key)
+	blob.Metadata = absMetadata(tags)
+	return blob.SetMetadata(&storage.SetBlobMetadataOptions{})
+}
+
+// absMetadata returns the tags as blob metadata.
+func absMetadata(tags map[string]string) storage.BlobMetadata {
+	md := storage.BlobMetadata{}
+	for k, v := range tags {
+		md[absMetadataName(k)] = v
+	}
+	return md
+}
+
+// absMetadataName returns the blob metadata name of a tag key.
+func absMetadataName(key string) string {
+	return strings.Replace(key, "-", "_", -1)
+}
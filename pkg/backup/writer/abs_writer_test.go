@@ -0,0 +1,80 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/storage"
+)
+
+// fakeBlockPutter records the put blocks by ID.
+type fakeBlockPutter struct {
+	mu     sync.Mutex
+	blocks map[string][]byte
+	err    error
+}
+
+func (f *fakeBlockPutter) PutBlock(blockID string, chunk []byte, options *storage.PutBlockOptions) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.blocks[blockID] = append([]byte(nil), chunk...)
+	return nil
+}
+
+func TestPutBlocks(t *testing.T) {
+	tests := []struct {
+		data       []byte
+		blockSize  int64
+		putErr     error
+		wantBlocks int
+		wantErr    bool
+	}{
+		{data: []byte("0123456789"), blockSize: 3, wantBlocks: 4},
+		{data: []byte("012345"), blockSize: 3, wantBlocks: 2},
+		{data: []byte("01"), blockSize: 3, wantBlocks: 1},
+		{data: []byte{}, blockSize: 3, wantBlocks: 0},
+		{data: []byte("0123456789"), blockSize: 3, putErr: errors.New("put failed"), wantErr: true},
+	}
+	for i, tt := range tests {
+		f := &fakeBlockPutter{blocks: map[string][]byte{}, err: tt.putErr}
+		blocks, size, err := putBlocks(f, bytes.NewReader(tt.data), tt.blockSize, 2)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("#%d: want error %v, get %v", i, tt.wantErr, err)
+		}
+		if tt.wantErr {
+			continue
+		}
+		if len(blocks) != tt.wantBlocks {
+			t.Errorf("#%d: want %d blocks, get %d", i, tt.wantBlocks, len(blocks))
+		}
+		if size != int64(len(tt.data)) {
+			t.Errorf("#%d: size = %d, want %d", i, size, len(tt.data))
+		}
+		var got []byte
+		for _, b := range blocks {
+			got = append(got, f.blocks[b.ID]...)
+		}
+		if !bytes.Equal(got, tt.data) {
+			t.Errorf("#%d: blocks = %q, want %q", i, got, tt.data)
+		}
+	}
+}
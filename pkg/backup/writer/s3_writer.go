@@ -15,9 +15,12 @@
 package writer
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"time"
 
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
 	"github.com/coreos/etcd-operator/pkg/backup/util"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -25,6 +28,9 @@ import (
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 )
 
+// s3MaxDeleteObjects is the maximum number of keys of a DeleteObjects request.
+const s3MaxDeleteObjects = 1000
+
 type s3Writer struct {
 	s3 *s3.S3
 }
@@ -64,6 +70,221 @@ func (s3w *s3Writer) Write(path string, r io.Reader) (int64, error) {
 	return *resp.ContentLength, nil
 }
 
-func (s3w *s3Writer) Purge(path string, maxBackups int) error {
+// WriteMultipart writes the backup file to the given s3 path, "<s3-bucket-name>/<key>",
+// with the S3 multipart upload API.
+func (s3w *s3Writer) WriteMultipart(path string, r io.Reader, partSize int64) (int64, error) {
+	bk, key, err := util.ParseBucketAndKey(path)
+	if err != nil {
+		return 0, err
+	}
+
+	mu, err := s3w.s3.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+		Bucket: aws.String(bk),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create multipart upload: %v", err)
+	}
+
+	size, parts, err := s3w.uploadParts(mu, r, partSize)
+	if err != nil {
+		_, aerr := s3w.s3.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+			Bucket:   mu.Bucket,
+			Key:      mu.Key,
+			UploadId: mu.UploadId,
+		})
+		if aerr != nil {
+			return 0, fmt.Errorf("%v; failed to abort multipart upload: %v", err, aerr)
+		}
+		return 0, err
+	}
+
+	_, err = s3w.s3.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:          mu.Bucket,
+		Key:             mu.Key,
+		UploadId:        mu.UploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to complete multipart upload: %v", err)
+	}
+	return size, nil
+}
+
+func (s3w *s3Writer) uploadParts(mu *s3.CreateMultipartUploadOutput, r io.Reader, partSize int64) (int64, []*s3.CompletedPart, error) {
+	var (
+		size  int64
+		parts []*s3.CompletedPart
+	)
+	buf := make([]byte, partSize)
+	for num := int64(1); ; num++ {
+		n, err := io.ReadFull(r, buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return 0, nil, err
+		}
+
+		resp, uerr := s3w.s3.UploadPart(&s3.UploadPartInput{
+			Bucket:     mu.Bucket,
+			Key:        mu.Key,
+			UploadId:   mu.UploadId,
+			PartNumber: aws.Int64(num),
+			Body:       bytes.NewReader(buf[:n]),
+		})
+		if uerr != nil {
+			return 0, nil, fmt.Errorf("failed to upload part %d: %v", num, uerr)
+		}
+		parts = append(parts, &s3.CompletedPart{ETag: resp.ETag, PartNumber: aws.Int64(num)})
+		size += int64(n)
+
+		if err == io.ErrUnexpectedEOF {
+			break
+		}
+	}
+	return size, parts, nil
+}
+
+// Purge deletes the stale backup files of the given s3 path, "<s3-bucket-name>/<key>",
+// whose keys are the key followed by the appended revision number.
+func (s3w *s3Writer) Purge(path string, maxBackups int, maxAge time.Duration) error {
+	bk, key, err := util.ParseBucketAndKey(path)
+	if err != nil {
+		return err
+	}
+
+	files := []BackupFile{}
+	err = s3w.s3.ListObjectsV2Pages(
+		&s3.ListObjectsV2Input{
+			Bucket: aws.String(bk),
+			Prefix: aws.String(key + "_"),
+		},
+		func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+			for _, obj := range page.Contents {
+				files = append(files, BackupFile{Name: aws.StringValue(obj.Key), LastModified: aws.TimeValue(obj.LastModified)})
+			}
+			return true
+		})
+	if err != nil {
+		return err
+	}
+
+	stale := backupsToPurge(files, maxBackups, maxAge, time.Now())
+	for len(stale) != 0 {
+		n := len(stale)
+		if n > s3MaxDeleteObjects {
+			n = s3MaxDeleteObjects
+		}
+		objects := make([]*s3.ObjectIdentifier, 0, n)
+		for _, f := range stale[:n] {
+			objects = append(objects, &s3.ObjectIdentifier{Key: aws.String(f.Name)})
+		}
+		out, err := s3w.s3.DeleteObjects(&s3.DeleteObjectsInput{
+			Bucket: aws.String(bk),
+			Delete: &s3.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return err
+		}
+		if len(out.Errors) != 0 {
+			e := out.Errors[0]
+			return fmt.Errorf("failed to delete %d backups, e.g. (%s): %s", len(out.Errors), aws.StringValue(e.Key), aws.StringValue(e.Message))
+		}
+		stale = stale[n:]
+	}
 	return nil
 }
+
+// List lists the backup files under the given s3 path, "<s3-bucket-name>/<key-prefix>".
+func (s3w *s3Writer) List(path string) ([]BackupFile, error) {
+	bk, key, err := util.ParseBucketAndKey(path)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []BackupFile{}
+	err = s3w.s3.ListObjectsV2Pages(
+		&s3.ListObjectsV2Input{
+			Bucket: aws.String(bk),
+			Prefix: aws.String(key),
+		},
+		func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+			for _, obj := range page.Contents {
+				name := bk + "/" + aws.StringValue(obj.Key)
+				files = append(files, BackupFile{
+					Name:         name,
+					Size:         aws.Int64Value(obj.Size),
+					LastModified: aws.TimeValue(obj.LastModified),
+					EtcdRevision: util.RevisionFromBackupPath(name),
+				})
+			}
+			return true
+		})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// TotalSize returns the total size of the backup files under the given s3 path.
+func (s3w *s3Writer) TotalSize(path string) (int64, error) {
+	return totalSize(s3w.List(path))
+}
+
+// Head returns the metadata of the backup file at the given s3 path, "<s3-bucket-name>/<key>".
+func (s3w *s3Writer) Head(path string) (*BackupMetadata, error) {
+	bk, key, err := util.ParseBucketAndKey(path)
+	if err != nil {
+		return nil, err
+	}
+	out, err := s3w.s3.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(bk),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	md := &BackupMetadata{
+		BackupFile: BackupFile{
+			Name:         path,
+			Size:         aws.Int64Value(out.ContentLength),
+			LastModified: aws.TimeValue(out.LastModified),
+			EtcdRevision: util.RevisionFromBackupPath(path),
+		},
+		ETag: aws.StringValue(out.ETag),
+	}
+
+	// Tagging may not be permitted, like in Tag, which leaves the version out.
+	tagging, err := s3w.s3.GetObjectTagging(&s3.GetObjectTaggingInput{
+		Bucket: aws.String(bk),
+		Key:    aws.String(key),
+	})
+	if err == nil {
+		for _, t := range tagging.TagSet {
+			if aws.StringValue(t.Key) == api.BackupTagVersion {
+				md.EtcdVersion = aws.StringValue(t.Value)
+			}
+		}
+	}
+	return md, nil
+}
+
+// Tag sets the tags as the object tags of the backup file at the given s3 path,
+// "<s3-bucket-name>/<key>".
+func (s3w *s3Writer) Tag(path string, tags map[string]string) error {
+	bk, key, err := util.ParseBucketAndKey(path)
+	if err != nil {
+		return err
+	}
+	tagSet := make([]*s3.Tag, 0, len(tags))
+	for k, v := range tags {
+		tagSet = append(tagSet, &s3.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+	_, err = s3w.s3.PutObjectTagging(&s3.PutObjectTaggingInput{
+		Bucket:  aws.String(bk),
+		Key:     aws.String(key),
+		Tagging: &s3.Tagging{TagSet: tagSet},
+	})
+	return err
+}
@@ -0,0 +1,166 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// fakeS3 serves the S3 requests of Purge and Head for the objects of one
+// bucket.
+type fakeS3 struct {
+	objects map[string]time.Time
+	deleted []string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/bucket/") {
+		f.serveObject(w, r, r.URL.Path[len("/bucket/"):])
+		return
+	}
+	if r.URL.Path != "/bucket" {
+		http.NotFound(w, r)
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+		prefix := r.URL.Query().Get("prefix")
+		fmt.Fprint(w, `<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><Name>bucket</Name><IsTruncated>false</IsTruncated>`)
+		for key, mtime := range f.objects {
+			if len(key) >= len(prefix) && key[:len(prefix)] == prefix {
+				fmt.Fprintf(w, "<Contents><Key>%s</Key><LastModified>%s</LastModified><Size>1</Size></Contents>", key, mtime.UTC().Format(time.RFC3339))
+			}
+		}
+		fmt.Fprint(w, `</ListBucketResult>`)
+	case r.Method == http.MethodPost && r.URL.Query()["delete"] != nil:
+		var req struct {
+			Objects []struct {
+				Key string
+			} `xml:"Object"`
+		}
+		if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, o := range req.Objects {
+			f.deleted = append(f.deleted, o.Key)
+			delete(f.objects, o.Key)
+		}
+		fmt.Fprint(w, `<DeleteResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/"></DeleteResult>`)
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+// serveObject serves the HeadObject and GetObjectTagging requests of Head.
+// Every object is tagged with etcd version 3.2.13.
+func (f *fakeS3) serveObject(w http.ResponseWriter, r *http.Request, key string) {
+	mtime, ok := f.objects[key]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	switch {
+	case r.Method == http.MethodHead:
+		w.Header().Set("Content-Length", "1")
+		w.Header().Set("Last-Modified", mtime.UTC().Format(http.TimeFormat))
+		w.Header().Set("ETag", `"etag"`)
+	case r.Method == http.MethodGet && r.URL.Query()["tagging"] != nil:
+		fmt.Fprint(w, `<Tagging xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><TagSet>`+
+			`<Tag><Key>etcd-version</Key><Value>3.2.13</Value></Tag></TagSet></Tagging>`)
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+func newFakeS3Writer(t *testing.T, f *fakeS3) (Writer, func()) {
+	ts := httptest.NewServer(f)
+	sess, err := session.NewSession(&aws.Config{
+		Endpoint:         aws.String(ts.URL),
+		Region:           aws.String("us-east-1"),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+	})
+	if err != nil {
+		ts.Close()
+		t.Fatal(err)
+	}
+	return NewS3Writer(s3.New(sess)), ts.Close
+}
+
+func TestS3WriterHead(t *testing.T) {
+	mtime := time.Date(2018, 1, 10, 0, 0, 0, 0, time.UTC)
+	w, closeServer := newFakeS3Writer(t, &fakeS3{objects: map[string]time.Time{"etcd/backup_0000000000000010": mtime}})
+	defer closeServer()
+
+	md, err := w.Head("bucket/etcd/backup_0000000000000010")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !md.LastModified.Equal(mtime) {
+		t.Errorf("last modified = %v, want %v", md.LastModified, mtime)
+	}
+	md.LastModified = time.Time{}
+	want := &BackupMetadata{
+		BackupFile: BackupFile{
+			Name:         "bucket/etcd/backup_0000000000000010",
+			Size:         1,
+			EtcdRevision: 16,
+		},
+		ETag:        `"etag"`,
+		EtcdVersion: "3.2.13",
+	}
+	if !reflect.DeepEqual(md, want) {
+		t.Errorf("metadata = %+v, want %+v", md, want)
+	}
+}
+
+func TestS3WriterPurge(t *testing.T) {
+	now := time.Now()
+	day := 24 * time.Hour
+	f := &fakeS3{objects: map[string]time.Time{
+		"etcd/backup_0000000000000001": now.Add(-5 * day),
+		"etcd/backup_0000000000000002": now.Add(-3 * day),
+		"etcd/backup_0000000000000003": now.Add(-time.Hour),
+		// not a periodic backup of the path
+		"etcd/backup": now.Add(-5 * day),
+	}}
+	w, closeServer := newFakeS3Writer(t, f)
+	defer closeServer()
+
+	// two backups are kept by count, and only one of them by age
+	if err := w.Purge("bucket/etcd/backup", 2, 2*day); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"etcd/backup_0000000000000001", "etcd/backup_0000000000000002"}
+	if !reflect.DeepEqual(f.deleted, want) {
+		t.Errorf("deleted %v, want %v", f.deleted, want)
+	}
+	if _, ok := f.objects["etcd/backup"]; !ok {
+		t.Error("purged the backup without a revision")
+	}
+}
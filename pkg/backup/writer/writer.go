@@ -14,12 +14,80 @@
 
 package writer
 
-import "io"
+import (
+	"io"
+	"sort"
+	"time"
+)
 
 // Writer defines the required writer operations.
 type Writer interface {
 	// Write writes a backup file to the given path and returns size of written file.
 	Write(path string, r io.Reader) (int64, error)
-	// Purge purges stale backup files according to the appended revision number
-	Purge(path string, maxBackups int) error
+	// WriteMultipart writes a backup file to the given path in parts of partSize bytes
+	// and returns size of written file. It is meant for large backup files.
+	WriteMultipart(path string, r io.Reader, partSize int64) (int64, error)
+	// Purge purges stale backup files according to the appended revision number:
+	// all but the newest maxBackups files, and the files older than maxAge if it is not 0.
+	Purge(path string, maxBackups int, maxAge time.Duration) error
+	// List lists the backup files whose path starts with the given path.
+	List(path string) ([]BackupFile, error)
+	// TotalSize returns the total size in bytes of the backup files whose path
+	// starts with the given path.
+	TotalSize(path string) (int64, error)
+	// Head returns the metadata of the backup file at the given path without
+	// reading its content.
+	Head(path string) (*BackupMetadata, error)
+	// Tag sets the tags on the backup file at the given path, replacing its
+	// existing tags.
+	Tag(path string, tags map[string]string) error
+}
+
+// BackupFile describes a backup file saved by a Writer.
+type BackupFile struct {
+	// Name is the full path of the backup file, e.g. "<s3-bucket-name>/<key>".
+	Name string `json:"name"`
+	// Size is the size of the backup file in bytes.
+	Size int64 `json:"size"`
+	// LastModified is the time the backup file was last modified.
+	LastModified time.Time `json:"lastModified"`
+	// EtcdRevision is the etcd revision appended to the backup file name.
+	// It is 0 if the name does not end with a revision.
+	EtcdRevision int64 `json:"etcdRevision,omitempty"`
+}
+
+// BackupMetadata is the metadata of a backup file returned by Head.
+type BackupMetadata struct {
+	BackupFile `json:",inline"`
+	// ETag is the entity tag of the backup file in the storage.
+	ETag string `json:"etag,omitempty"`
+	// EtcdVersion is the version of the etcd the snapshot was taken from, read
+	// from the tags of the backup file. It is empty if the file is not tagged.
+	EtcdVersion string `json:"etcdVersion,omitempty"`
+}
+
+// backupsToPurge returns the backup files that Purge deletes. The files are
+// ordered by name, i.e. by the appended revision number.
+func backupsToPurge(files []BackupFile, maxBackups int, maxAge time.Duration, now time.Time) []BackupFile {
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+	var stale []BackupFile
+	for i, f := range files {
+		if i < len(files)-maxBackups || (maxAge > 0 && now.Sub(f.LastModified) > maxAge) {
+			stale = append(stale, f)
+		}
+	}
+	return stale
+}
+
+// totalSize sums the size of the files listed by List.
+func totalSize(files []BackupFile, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	for _, f := range files {
+		size += f.Size
+	}
+	return size, nil
 }
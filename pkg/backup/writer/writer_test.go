@@ -0,0 +1,55 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBackupsToPurge(t *testing.T) {
+	now := time.Date(2018, 1, 10, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	files := func() []BackupFile {
+		// unordered, like some listing APIs return them
+		return []BackupFile{
+			{Name: "b_0000000000000003", LastModified: now.Add(-1 * day)},
+			{Name: "b_0000000000000001", LastModified: now.Add(-5 * day)},
+			{Name: "b_0000000000000002", LastModified: now.Add(-3 * day)},
+		}
+	}
+	tests := []struct {
+		maxBackups int
+		maxAge     time.Duration
+		want       []string
+	}{
+		{3, 0, nil},
+		{2, 0, []string{"b_0000000000000001"}},
+		{3, 2 * day, []string{"b_0000000000000001", "b_0000000000000002"}},
+		// the stricter of both constraints applies
+		{1, 4 * day, []string{"b_0000000000000001", "b_0000000000000002"}},
+		{2, 2 * day, []string{"b_0000000000000001", "b_0000000000000002"}},
+	}
+	for i, tt := range tests {
+		var get []string
+		for _, f := range backupsToPurge(files(), tt.maxBackups, tt.maxAge, now) {
+			get = append(get, f.Name)
+		}
+		if !reflect.DeepEqual(get, tt.want) {
+			t.Errorf("#%d: want %v, get %v", i, tt.want, get)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/constants"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/etcdserverpb"
+)
+
+// alarmCorrupt is the CORRUPT alarm type introduced in etcd 3.3.
+// The vendored etcd client only defines NONE and NOSPACE.
+const alarmCorrupt etcdserverpb.AlarmType = 2
+
+// checkAlarmStatus inspects the active alarms of the cluster. A NOSPACE alarm is
+// cleared by compacting the keyspace, defragmenting the members and disarming it.
+// A CORRUPT alarm is reported in the Corrupt condition and a warning event; the
+// data is not repaired.
+func (c *Cluster) checkAlarmStatus() error {
+	etcdcli, err := c.etcdClient()
+	if err != nil {
+		return err
+	}
+	return c.handleAlarms(etcdcli)
+}
+
+// alarmClient lists and disarms the alarms of an etcd cluster.
+type alarmClient interface {
+	AlarmList(ctx context.Context) (*clientv3.AlarmResponse, error)
+	AlarmDisarm(ctx context.Context, m *clientv3.AlarmMember) (*clientv3.AlarmResponse, error)
+}
+
+func (c *Cluster) handleAlarms(etcdcli alarmClient) error {
+	ctx, cancel := context.WithTimeout(context.Background(), constants.DefaultRequestTimeout)
+	resp, err := etcdcli.AlarmList(ctx)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("failed to list alarms: %v", err)
+	}
+
+	var nospace []*etcdserverpb.AlarmMember
+	var corrupt []string
+	for _, a := range resp.Alarms {
+		c.logger.Warningf("active alarm (%v) on member (%x)", a.Alarm, a.MemberID)
+		switch a.Alarm {
+		case etcdserverpb.AlarmType_NOSPACE:
+			nospace = append(nospace, a)
+		case alarmCorrupt:
+			corrupt = append(corrupt, fmt.Sprintf("%x", a.MemberID))
+		}
+	}
+
+	if len(corrupt) == 0 {
+		c.status.ClearCondition(api.ClusterConditionCorrupt)
+	} else {
+		ids := strings.Join(corrupt, ",")
+		if !c.hasCondition(api.ClusterConditionCorrupt) {
+			_, err := c.eventsCli.Create(k8sutil.ClusterCorruptEvent(ids, c.cluster))
+			if err != nil {
+				c.logger.Errorf("failed to create cluster corrupt event: %v", err)
+			}
+		}
+		c.status.SetCorruptCondition(fmt.Sprintf("corruption alarm on members %s", ids))
+	}
+
+	if len(nospace) == 0 {
+		return nil
+	}
+	if c.config.DryRun {
+		c.planAction("compact, defragment and disarm the NOSPACE alarm", c.cluster.Name)
+		return nil
+	}
+	rev, err := c.currentRevision(context.Background(), c.members.ClientURLs())
+	if err != nil {
+		return err
+	}
+	if err := c.compact(context.Background(), c.cluster.Name, c.members.ClientURLs(), rev); err != nil {
+		return err
+	}
+	if err := c.defragment(context.Background(), c.cluster, c.members, 0, "to clear the NOSPACE alarm"); err != nil {
+		return err
+	}
+	for _, a := range nospace {
+		ctx, cancel := context.WithTimeout(context.Background(), constants.DefaultRequestTimeout)
+		_, err := etcdcli.AlarmDisarm(ctx, (*clientv3.AlarmMember)(a))
+		cancel()
+		if err != nil {
+			return fmt.Errorf("failed to disarm alarm (%v) on member (%x): %v", a.Alarm, a.MemberID, err)
+		}
+		c.logger.Infof("disarmed alarm (%v) on member (%x)", a.Alarm, a.MemberID)
+	}
+	return nil
+}
+
+func (c *Cluster) hasCondition(t api.ClusterConditionType) bool {
+	for _, cond := range c.status.Conditions {
+		if cond.Type == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/etcdserverpb"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+type fakeAlarmClient struct {
+	alarms   []*etcdserverpb.AlarmMember
+	disarmed []*clientv3.AlarmMember
+}
+
+func (f *fakeAlarmClient) AlarmList(ctx context.Context) (*clientv3.AlarmResponse, error) {
+	return &clientv3.AlarmResponse{Alarms: f.alarms}, nil
+}
+
+func (f *fakeAlarmClient) AlarmDisarm(ctx context.Context, m *clientv3.AlarmMember) (*clientv3.AlarmResponse, error) {
+	f.disarmed = append(f.disarmed, m)
+	return &clientv3.AlarmResponse{}, nil
+}
+
+func newAlarmTestCluster(dryRun bool) *Cluster {
+	kubecli := fake.NewSimpleClientset()
+	return &Cluster{
+		logger:    logrus.WithField("pkg", "cluster"),
+		config:    Config{KubeCli: kubecli, DryRun: dryRun},
+		cluster:   &api.EtcdCluster{ObjectMeta: metav1.ObjectMeta{Name: "alarm-test", Namespace: metav1.NamespaceDefault}},
+		eventsCli: kubecli.CoreV1().Events(metav1.NamespaceDefault),
+	}
+}
+
+func TestHandleAlarmsCorrupt(t *testing.T) {
+	c := newAlarmTestCluster(false)
+	ac := &fakeAlarmClient{alarms: []*etcdserverpb.AlarmMember{{MemberID: 0xa, Alarm: alarmCorrupt}}}
+
+	// the event is created once while the alarm is active.
+	for i := 0; i < 2; i++ {
+		if err := c.handleAlarms(ac); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !hasCondition(c.status, api.ClusterConditionCorrupt) {
+		t.Errorf("Corrupt condition is not set: %v", c.status.Conditions)
+	}
+	events, err := c.eventsCli.List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events.Items) != 1 {
+		t.Errorf("created %d events, want 1", len(events.Items))
+	}
+	if len(ac.disarmed) != 0 {
+		t.Errorf("disarmed corruption alarms: %v", ac.disarmed)
+	}
+
+	ac.alarms = nil
+	if err := c.handleAlarms(ac); err != nil {
+		t.Fatal(err)
+	}
+	if hasCondition(c.status, api.ClusterConditionCorrupt) {
+		t.Errorf("Corrupt condition is not cleared: %v", c.status.Conditions)
+	}
+}
+
+func TestHandleAlarmsNoSpaceDryRun(t *testing.T) {
+	c := newAlarmTestCluster(true)
+	defer deleteDryRunPlan(c.cluster.Name)
+	ac := &fakeAlarmClient{alarms: []*etcdserverpb.AlarmMember{{MemberID: 0xa, Alarm: etcdserverpb.AlarmType_NOSPACE}}}
+
+	if err := c.handleAlarms(ac); err != nil {
+		t.Fatal(err)
+	}
+	if len(ac.disarmed) != 0 {
+		t.Errorf("disarmed alarms in dry run: %v", ac.disarmed)
+	}
+	if len(DryRunPlan(c.cluster.Name)) != 1 {
+		t.Errorf("plan = %v, want the NOSPACE alarm to be cleared", DryRunPlan(c.cluster.Name))
+	}
+	if hasCondition(c.status, api.ClusterConditionCorrupt) {
+		t.Errorf("Corrupt condition is set for a NOSPACE alarm")
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"context"
+	"fmt"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/constants"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const etcdRootUser = "root"
+
+// etcdCredentials returns the credentials the operator's etcd clients
+// authenticate with, or nil if etcd authentication is not set up.
+func (c *Cluster) etcdCredentials() *etcdutil.Credentials {
+	cred, _ := c.authCredentials.Load().(*etcdutil.Credentials)
+	return cred
+}
+
+// etcdClientConfig returns the config of an etcd client of endpoints with the
+// TLS config and credentials of the operator.
+func (c *Cluster) etcdClientConfig(endpoints []string) clientv3.Config {
+	return etcdutil.NewClientConfig(endpoints, c.tlsConfig, c.etcdCredentials())
+}
+
+// etcdClient returns the etcd client the reconciliation shares, pointed at
+// the current members. It is created on first use and again when the TLS
+// config or the credentials of the operator change; finish closes it.
+func (c *Cluster) etcdClient() (*clientv3.Client, error) {
+	cred := c.etcdCredentials()
+	if c.etcdcli != nil && (c.etcdcliTLS != c.tlsConfig || c.etcdcliCred != cred) {
+		c.closeEtcdClient()
+	}
+	if c.etcdcli != nil {
+		c.etcdcli.SetEndpoints(c.members.ClientURLs()...)
+		return c.etcdcli, nil
+	}
+	etcdcli, err := clientv3.New(c.etcdClientConfig(c.members.ClientURLs()))
+	if err != nil {
+		return nil, fmt.Errorf("creating etcd client failed: %v", err)
+	}
+	c.etcdcli, c.etcdcliTLS, c.etcdcliCred = etcdcli, c.tlsConfig, cred
+	return etcdcli, nil
+}
+
+func (c *Cluster) closeEtcdClient() {
+	if c.etcdcli == nil {
+		return
+	}
+	if err := c.etcdcli.Close(); err != nil {
+		c.logger.Warningf("failed to close etcd client: %v", err)
+	}
+	c.etcdcli = nil
+}
+
+// loadAuthCredentials loads the password of the etcd root user from the root
+// password secret. The etcd clients of the operator authenticate as root from
+// then on.
+func (c *Cluster) loadAuthCredentials() error {
+	name := c.cluster.Spec.Auth.RootPasswordSecret
+	se, err := c.config.KubeCli.CoreV1().Secrets(c.cluster.Namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get root password secret (%s): %v", name, err)
+	}
+	rootPassword := string(se.Data[api.AuthSecretRootPasswordKey])
+	if len(rootPassword) == 0 {
+		return fmt.Errorf("root password secret (%s) has no %q data item", name, api.AuthSecretRootPasswordKey)
+	}
+	c.authCredentials.Store(&etcdutil.Credentials{Username: etcdRootUser, Password: rootPassword})
+	return nil
+}
+
+// setupAuth bootstraps etcd authentication as specified by spec.auth:
+// it creates the root user and the configured roles, and then enables auth.
+// It is safe to call setupAuth again if it failed halfway. The etcd clients
+// authenticate as root before auth is enabled, which etcd ignores until then.
+func (c *Cluster) setupAuth() error {
+	ac := c.cluster.Spec.Auth
+	if err := c.loadAuthCredentials(); err != nil {
+		return err
+	}
+	rootPassword := c.etcdCredentials().Password
+
+	etcdcli, err := clientv3.New(c.etcdClientConfig(c.members.ClientURLs()))
+	if err != nil {
+		return fmt.Errorf("setup auth failed: creating etcd client failed %v", err)
+	}
+	defer etcdcli.Close()
+
+	err = withRequestTimeout(func(ctx context.Context) error {
+		_, err := etcdcli.UserAdd(ctx, etcdRootUser, rootPassword)
+		if err == rpctypes.ErrUserAlreadyExist {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add root user: %v", err)
+	}
+	err = withRequestTimeout(func(ctx context.Context) error {
+		_, err := etcdcli.RoleAdd(ctx, etcdRootUser)
+		if err == rpctypes.ErrRoleAlreadyExist {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add root role: %v", err)
+	}
+	err = withRequestTimeout(func(ctx context.Context) error {
+		_, err := etcdcli.UserGrantRole(ctx, etcdRootUser, etcdRootUser)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to grant root role to root user: %v", err)
+	}
+
+	for _, r := range ac.Roles {
+		err = withRequestTimeout(func(ctx context.Context) error {
+			_, err := etcdcli.RoleAdd(ctx, r.Name)
+			if err == rpctypes.ErrRoleAlreadyExist {
+				return nil
+			}
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to add role (%s): %v", r.Name, err)
+		}
+		for _, p := range r.Permissions {
+			err = withRequestTimeout(func(ctx context.Context) error {
+				_, err := etcdcli.RoleGrantPermission(ctx, r.Name, p.Key, p.RangeEnd, etcdPermissionType(p.Type))
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("failed to grant permission on key (%s) to role (%s): %v", p.Key, r.Name, err)
+			}
+		}
+	}
+
+	err = withRequestTimeout(func(ctx context.Context) error {
+		_, err := etcdcli.AuthEnable(ctx)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to enable auth: %v", err)
+	}
+	c.logger.Infof("etcd authentication enabled")
+	return nil
+}
+
+func etcdPermissionType(t api.EtcdPermissionType) clientv3.PermissionType {
+	switch t {
+	case api.PermissionTypeWrite:
+		return clientv3.PermissionType(clientv3.PermWrite)
+	case api.PermissionTypeReadWrite:
+		return clientv3.PermissionType(clientv3.PermReadWrite)
+	default:
+		return clientv3.PermissionType(clientv3.PermRead)
+	}
+}
+
+func withRequestTimeout(f func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), constants.DefaultRequestTimeout)
+	defer cancel()
+	return f(ctx)
+}
@@ -0,0 +1,72 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"testing"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestEtcdClientConfigAuth(t *testing.T) {
+	se := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "root-password", Namespace: metav1.NamespaceDefault},
+		Data:       map[string][]byte{api.AuthSecretRootPasswordKey: []byte("secret")},
+	}
+	c := &Cluster{
+		logger: logrus.WithField("pkg", "cluster"),
+		config: Config{KubeCli: fake.NewSimpleClientset(se)},
+		cluster: &api.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: metav1.NamespaceDefault},
+			Spec:       api.ClusterSpec{Auth: &api.AuthConfig{Enabled: true, RootPasswordSecret: "root-password"}},
+		},
+	}
+
+	cfg := c.etcdClientConfig([]string{"http://test-0000.test.default.svc:2379"})
+	if len(cfg.Username) != 0 || len(cfg.Password) != 0 {
+		t.Errorf("credentials = %q/%q before auth is set up, want none", cfg.Username, cfg.Password)
+	}
+
+	if err := c.loadAuthCredentials(); err != nil {
+		t.Fatal(err)
+	}
+	cfg = c.etcdClientConfig([]string{"http://test-0000.test.default.svc:2379"})
+	if cfg.Username != etcdRootUser || cfg.Password != "secret" {
+		t.Errorf("credentials = %q/%q, want %q/%q", cfg.Username, cfg.Password, etcdRootUser, "secret")
+	}
+}
+
+func TestLoadAuthCredentialsMissingPassword(t *testing.T) {
+	se := &v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "root-password", Namespace: metav1.NamespaceDefault}}
+	c := &Cluster{
+		logger: logrus.WithField("pkg", "cluster"),
+		config: Config{KubeCli: fake.NewSimpleClientset(se)},
+		cluster: &api.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: metav1.NamespaceDefault},
+			Spec:       api.ClusterSpec{Auth: &api.AuthConfig{Enabled: true, RootPasswordSecret: "root-password"}},
+		},
+	}
+	if err := c.loadAuthCredentials(); err == nil {
+		t.Error("want error for a secret without the root password")
+	}
+	if cred := c.etcdCredentials(); cred != nil {
+		t.Errorf("credentials = %+v, want nil", cred)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+)
+
+// checkAutoUpgrade sets the spec version to the latest patch release of its
+// minor version if both the operator and the cluster allow auto upgrades.
+// The releases are fetched by the operator, see EtcdReleases.
+func (c *Cluster) checkAutoUpgrade() {
+	if c.config.Releases == nil || !c.cluster.Spec.AllowAutoUpgrade {
+		return
+	}
+	versions := c.config.Releases.Versions()
+	if len(versions) == 0 {
+		return
+	}
+	// A rolled back upgrade leaves the spec version in place, so the releases
+	// are compared to it and the failed version is not picked again.
+	current := c.cluster.Spec.Version
+	latest, ok := latestPatchVersion(current, versions)
+	if !ok {
+		return
+	}
+	if c.config.DryRun {
+		c.planAction("auto upgrade to "+latest, c.name())
+		return
+	}
+
+	cl := c.cluster.DeepCopy()
+	cl.Spec.Version = latest
+	cl.Status = c.status
+	cl, err := c.config.EtcdCRCli.EtcdV1beta2().EtcdClusters(cl.Namespace).Update(cl)
+	if err != nil {
+		c.logger.Errorf("failed to auto upgrade from %s to %s: %v", current, latest, err)
+		return
+	}
+	c.cluster = cl
+	c.logger.Infof("auto upgrading from %s to %s", current, latest)
+	_, err = c.eventsCli.Create(k8sutil.AutoUpgradeEvent(current, latest, c.cluster))
+	if err != nil {
+		c.logger.Errorf("failed to create auto upgrade event: %v", err)
+	}
+}
+
+// latestPatchVersion returns the highest version of versions with the same
+// major and minor version as current and a higher patch version.
+// Versions that are not of the form "X.Y.Z" are ignored.
+func latestPatchVersion(current string, versions []string) (string, bool) {
+	cur, ok := parseVersion(current)
+	if !ok {
+		return "", false
+	}
+	latest, found := cur, false
+	for _, v := range versions {
+		pv, ok := parseVersion(v)
+		if !ok || pv[0] != cur[0] || pv[1] != cur[1] || pv[2] <= latest[2] {
+			continue
+		}
+		latest, found = pv, true
+	}
+	if !found {
+		return "", false
+	}
+	return fmt.Sprintf("%d.%d.%d", latest[0], latest[1], latest[2]), true
+}
+
+func parseVersion(v string) ([3]int, bool) {
+	var pv [3]int
+	parts := strings.Split(strings.TrimPrefix(v, "v"), ".")
+	if len(parts) != 3 {
+		return pv, false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return pv, false
+		}
+		pv[i] = n
+	}
+	return pv, true
+}
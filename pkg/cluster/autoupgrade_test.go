@@ -0,0 +1,38 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import "testing"
+
+func TestLatestPatchVersion(t *testing.T) {
+	versions := []string{"3.3.1", "3.2.13", "3.2.18", "3.2.9", "3.2.20-rc.0", "3.1.12", "v3.2.15"}
+	tests := []struct {
+		current string
+		want    string
+		wantOK  bool
+	}{
+		{"3.2.13", "3.2.18", true},
+		{"3.2.18", "", false},
+		{"3.1.11", "3.1.12", true},
+		{"3.0.17", "", false},
+		{"3.2", "", false},
+	}
+	for i, tt := range tests {
+		got, ok := latestPatchVersion(tt.current, versions)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("#%d: latestPatchVersion(%s) = (%s, %v), want (%s, %v)", i, tt.current, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
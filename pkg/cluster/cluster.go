@@ -15,12 +15,13 @@
 package cluster
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
-	"math"
 	"reflect"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
@@ -30,11 +31,15 @@ import (
 	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
 	"github.com/coreos/etcd-operator/pkg/util/retryutil"
 
+	"github.com/coreos/etcd/clientv3"
 	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 )
@@ -42,8 +47,17 @@ import (
 var (
 	reconcileInterval         = 8 * time.Second
 	podTerminationGracePeriod = int64(5)
+	// maxBackoffDuration caps the reconcile back-off after transient API server errors.
+	maxBackoffDuration = 5 * time.Minute
+	// clusterStatsInterval is how often the cluster stats are refreshed in the status
+	// while the leader and healthy members do not change. The revision changes with
+	// every write, so refreshing it every reconciliation would update the CR each time.
+	clusterStatsInterval = 5 * time.Minute
 )
 
+// reportFailedStatusRetries bounds how long reportFailedStatus holds a pool worker.
+const reportFailedStatusRetries = 2
+
 type clusterEventType string
 
 const (
@@ -60,8 +74,36 @@ type Config struct {
 
 	KubeCli   kubernetes.Interface
 	EtcdCRCli versioned.Interface
+
+	// Logger is the logger of the cluster. If nil, the logrus standard logger is used.
+	Logger *logrus.Logger
+
+	// Pool handles the events and reconciliations of the cluster once it is set up.
+	// If nil, the cluster gets a pool of its own with a single worker.
+	Pool *ClusterPool
+
+	// DryRun makes the cluster log and record the pods, services, members, etcd
+	// maintenance and status updates it would create, delete or change instead
+	// of applying them, see DryRunPlan.
+	DryRun bool
+
+	// Releases makes the clusters that set spec.allowAutoUpgrade upgrade to
+	// the latest patch release of their etcd minor version. Auto upgrades are
+	// disabled if it is nil.
+	Releases *EtcdReleases
+
+	// PodCreationTimeoutSeconds is how long the cluster waits for the API server
+	// to create a member pod. Defaults to 30 if not positive.
+	PodCreationTimeoutSeconds int
+
+	// InterruptedNodes are the spot nodes about to be interrupted. Members on them
+	// are moved to other nodes if the pod policy tolerates spot interruptions.
+	// If nil, spot interruptions are not handled.
+	InterruptedNodes *InterruptedNodes
 }
 
+const defaultPodCreationTimeoutSeconds = 30
+
 type Cluster struct {
 	logger *logrus.Entry
 	// debug logger for self hosted cluster
@@ -75,6 +117,8 @@ type Cluster struct {
 	// status is the source of truth after Cluster struct is materialized.
 	status        api.ClusterStatus
 	memberCounter int
+	// persistedState is the data of the state ConfigMap last saved or loaded.
+	persistedState map[string]string
 
 	eventCh chan *clusterEvent
 	stopCh  chan struct{}
@@ -85,31 +129,125 @@ type Cluster struct {
 	members etcdutil.MemberSet
 
 	tlsConfig *tls.Config
+	// clientCert holds the *tls.Certificate served by tlsConfig for cert-manager TLS.
+	clientCert atomic.Value
+	// tlsSecretVersions are the resource versions of the cert-manager TLS secrets
+	// last seen by checkCertificateRenewal.
+	tlsSecretVersions map[string]string
+	// authCredentials holds the *etcdutil.Credentials of the etcd root user
+	// once etcd authentication is set up, see etcdCredentials.
+	authCredentials atomic.Value
+	// etcdcli is the etcd client shared by the reconciliation, see etcdClient.
+	// etcdcliTLS and etcdcliCred are the TLS config and credentials it was created with.
+	etcdcli     *clientv3.Client
+	etcdcliTLS  *tls.Config
+	etcdcliCred *etcdutil.Credentials
+
+	// readyMembers holds a snapshot of status.members.ready ([]string)
+	// for goroutines running beside the reconcile loop.
+	readyMembers atomic.Value
+	// clusterSnapshot holds a deep copy of the cluster (*api.EtcdCluster) as of
+	// the last reconciliation for the same goroutines, see snapshot.
+	clusterSnapshot atomic.Value
+	// defragmenting is set to 1 while defragment runs, so that the members
+	// are never defragmented at the same time.
+	defragmenting int32
+	// diskPressure is set to 1 by monitorDiskUsage when the cluster is under disk pressure.
+	diskPressure int32
 
 	eventsCli corev1.EventInterface
+
+	// profiling is true while a CPU profile of the etcd leader is being captured.
+	// The result of the capture is sent on profileCh. profileCaptured is true
+	// until the capture-profile annotation of the finished capture is removed.
+	profiling       bool
+	profileCaptured bool
+	profileCh       chan profileResult
+
+	// started is set to 1 once the cluster is handled by config.Pool.
+	started int32
+	// stopped is set once the cluster is deleted or failed; the pool stops handling it.
+	stopped bool
+	// nextReconcile is when the pool reconciles the cluster next.
+	nextReconcile time.Time
+	// rerr is the error of the last reconciliation that was not skipped.
+	rerr error
+
+	// selfHostedJoin is the self-hosted member created last, until it joined.
+	selfHostedJoin *selfHostedJoin
+
+	// upgradedMember is the member upgraded last, until it becomes ready.
+	// upgradedAt is the time it was upgraded at.
+	upgradedMember string
+	upgradedAt     time.Time
+
+	// leaderMember caches the etcd leader found by identifyEtcdLeader.
+	// It is reset on every reconcile tick.
+	leaderMember *etcdutil.Member
+
+	// quorumWaitStart is when seedHasQuorum found the seed member not serving
+	// requests first, or zero if it serves them. lastQuorumProgress is when
+	// the last waiting for quorum event was emitted.
+	quorumWaitStart    time.Time
+	lastQuorumProgress time.Time
+
+	// membershipChanged is set when a member is added, and reset once the
+	// peer connectivity of the resized cluster is checked.
+	membershipChanged bool
+
+	// lastValidSize is the last spec size accepted by ensureMinimumMemberCount,
+	// or the size it keeps if no valid size was seen yet.
+	lastValidSize int
+	// rejectedSize is the invalid spec size last rejected by ensureMinimumMemberCount.
+	rejectedSize *int
+
+	// backoffDuration is the interval until the next reconciliation after
+	// a transient API server error. It is 0 if the last reconciliation had none.
+	backoffDuration time.Duration
+
+	// lastReconciled is when the last reconciliation without errors finished,
+	// or when the cluster started running.
+	lastReconciled time.Time
+
+	// lastOOMKill is when the last OOM kill handled by handleOOMEvent finished.
+	lastOOMKill time.Time
+
+	// pdbMinAvailable is the minAvailable of the PodDisruptionBudget the
+	// operator created, 0 if there is none.
+	pdbMinAvailable int
+
+	// statsUpdated is when status.stats was last refreshed, see setClusterStats.
+	statsUpdated time.Time
 }
 
 func New(config Config, cl *api.EtcdCluster) *Cluster {
-	lg := logrus.WithField("pkg", "cluster").WithField("cluster-name", cl.Name)
-	var debugLogger *debug.DebugLogger
-	if cl.Spec.SelfHosted != nil {
-		debugLogger = debug.New(cl.Name)
+	if config.Logger == nil {
+		config.Logger = logrus.StandardLogger()
 	}
-
+	if config.PodCreationTimeoutSeconds <= 0 {
+		config.PodCreationTimeoutSeconds = defaultPodCreationTimeoutSeconds
+	}
+	lg := config.Logger.WithField("pkg", "cluster").WithField("cluster-name", cl.Name)
 	c := &Cluster{
 		logger:      lg,
-		debugLogger: debugLogger,
+		debugLogger: debug.New(cl.Name, cl.Spec.SelfHosted != nil),
 		config:      config,
 		cluster:     cl,
 		eventCh:     make(chan *clusterEvent, 100),
 		stopCh:      make(chan struct{}),
+		profileCh:   make(chan profileResult, 1),
 		status:      *(cl.Status.DeepCopy()),
 		eventsCli:   config.KubeCli.Core().Events(cl.Namespace),
 	}
+	if c.config.Pool == nil {
+		c.config.Pool = NewClusterPool(1)
+		go c.config.Pool.Run(c.stopCh)
+	}
 
 	go func() {
 		if err := c.setup(); err != nil {
 			c.logger.Errorf("cluster failed to setup: %v", err)
+			c.debugLogger.Close()
 			if c.status.Phase != api.ClusterPhaseFailed {
 				c.status.SetReason(err.Error())
 				c.status.SetPhase(api.ClusterPhaseFailed)
@@ -119,7 +257,8 @@ func New(config Config, cl *api.EtcdCluster) *Cluster {
 			}
 			return
 		}
-		c.run()
+		c.start()
+		c.config.Pool.Add(c)
 	}()
 
 	return c
@@ -132,20 +271,27 @@ func (c *Cluster) setup() error {
 		shouldCreateCluster = true
 	case api.ClusterPhaseCreating:
 		return errCreatedCluster
-	case api.ClusterPhaseRunning:
+	case api.ClusterPhaseRunning, api.ClusterPhaseMigrating:
 		shouldCreateCluster = false
 
 	default:
 		return fmt.Errorf("unexpected cluster phase: %s", c.status.Phase)
 	}
 
+	if c.isCertManagerTLS() {
+		if err := c.ensureCertificates(); err != nil {
+			return err
+		}
+	}
+
 	if c.isSecureClient() {
-		d, err := k8sutil.GetTLSDataFromSecret(c.config.KubeCli, c.cluster.Namespace, c.cluster.Spec.TLS.Static.OperatorSecret)
-		if err != nil {
+		if err := c.loadTLSConfig(); err != nil {
 			return err
 		}
-		c.tlsConfig, err = etcdutil.NewTLSConfig(d.CertData, d.KeyData, d.CAData)
-		if err != nil {
+	}
+
+	if c.status.AuthEnabled {
+		if err := c.loadAuthCredentials(); err != nil {
 			return err
 		}
 	}
@@ -153,11 +299,21 @@ func (c *Cluster) setup() error {
 	if shouldCreateCluster {
 		return c.create()
 	}
+	if err := c.reconcileLabels(); err != nil {
+		c.logger.Warningf("fail to reconcile pod labels: %v", err)
+	}
+	if err := c.reconcileOwnerReferences(); err != nil {
+		c.logger.Warningf("fail to reconcile owner references: %v", err)
+	}
+	c.loadState()
 	return nil
 }
 
 func (c *Cluster) create() error {
 	c.status.SetPhase(api.ClusterPhaseCreating)
+	if !c.cluster.HasFinalizer(api.CleanupFinalizer) {
+		c.cluster.Finalizers = append(c.cluster.Finalizers, api.CleanupFinalizer)
+	}
 
 	if err := c.updateCRStatus(); err != nil {
 		return fmt.Errorf("cluster create: failed to update cluster phase (%v): %v", api.ClusterPhaseCreating, err)
@@ -168,7 +324,7 @@ func (c *Cluster) create() error {
 }
 
 func (c *Cluster) prepareSeedMember() error {
-	c.status.SetScalingUpCondition(0, c.cluster.Spec.Size)
+	c.status.SetScalingUpCondition(0, c.desiredSize())
 
 	var err error
 	if sh := c.cluster.Spec.SelfHosted; sh != nil {
@@ -190,7 +346,10 @@ func (c *Cluster) prepareSeedMember() error {
 
 func (c *Cluster) Delete() {
 	c.logger.Info("cluster is deleted by user")
+	c.debugLogger.Close()
+	deleteDryRunPlan(c.cluster.Name)
 	close(c.stopCh)
+	c.enqueue()
 }
 
 func (c *Cluster) send(ev *clusterEvent) {
@@ -200,16 +359,30 @@ func (c *Cluster) send(ev *clusterEvent) {
 		if l > int(float64(ecap)*0.8) {
 			c.logger.Warningf("eventCh buffer is almost full [%d/%d]", l, ecap)
 		}
+		c.enqueue()
 	case <-c.stopCh:
 	}
 }
 
-func (c *Cluster) run() {
+// enqueue makes the pool handle the cluster right away once it started.
+func (c *Cluster) enqueue() {
+	if atomic.LoadInt32(&c.started) == 1 {
+		c.config.Pool.Add(c)
+	}
+}
+
+// start prepares a cluster that finished its setup for reconciliation by the
+// ClusterPool.
+func (c *Cluster) start() {
 	if err := c.setupServices(); err != nil {
 		c.logger.Errorf("fail to setup etcd services: %v", err)
 	}
 	c.status.ServiceName = k8sutil.ClientServiceName(c.cluster.Name)
+	if err := c.updateServiceStatus(); err != nil {
+		c.logger.Errorf("fail to update service status: %v", err)
+	}
 	c.status.ClientPort = k8sutil.EtcdClientPort
+	c.syncPodDisruptionBudget()
 
 	c.status.SetPhase(api.ClusterPhaseRunning)
 	if err := c.updateCRStatus(); err != nil {
@@ -217,91 +390,232 @@ func (c *Cluster) run() {
 	}
 	c.logger.Infof("start running...")
 
-	var rerr error
+	c.storeSnapshot()
+	go c.defragLoop()
+	go c.monitorDiskUsage()
+
+	c.lastReconciled = time.Now()
+	c.nextReconcile = time.Now().Add(reconcileInterval)
+	atomic.StoreInt32(&c.started, 1)
+}
+
+// handle processes the pending events of the cluster and reconciles it if the
+// reconcile interval passed. It returns false once the cluster is deleted or
+// failed and must not be handled anymore.
+func (c *Cluster) handle() bool {
+	if c.stopped {
+		return false
+	}
 	for {
 		select {
 		case <-c.stopCh:
-			return
+			return false
 		case event := <-c.eventCh:
-			switch event.typ {
-			case eventModifyCluster:
-				err := c.handleUpdateEvent(event)
-				if err != nil {
-					c.logger.Errorf("handle update event failed: %v", err)
-					c.status.SetReason(err.Error())
-					c.reportFailedStatus()
-					return
-				}
-			default:
-				panic("unknown event type" + event.typ)
+			if !c.handleEvent(event) {
+				return false
 			}
+			continue
+		default:
+		}
+		break
+	}
 
-		case <-time.After(reconcileInterval):
-			start := time.Now()
-
-			if c.cluster.Spec.Paused {
-				c.status.PauseControl()
-				c.logger.Infof("control is paused, skipping reconciliation")
-				continue
-			} else {
-				c.status.Control()
-			}
+	if time.Now().Before(c.nextReconcile) {
+		return true
+	}
+	defer func() { c.nextReconcile = time.Now().Add(c.nextReconcileInterval()) }()
+	concurrentReconciles.Inc()
+	reconciled := c.reconcileOnce()
+	concurrentReconciles.Dec()
+	if !reconciled {
+		return true
+	}
+	if c.rerr != nil {
+		reconcileFailed.WithLabelValues(c.rerr.Error()).Inc()
+	}
+	if isFatalError(c.rerr) {
+		c.status.SetReason(c.rerr.Error())
+		c.logger.Errorf("cluster failed: %v", c.rerr)
+		c.reportFailedStatus()
+		return false
+	}
+	return true
+}
 
-			running, pending, err := c.pollPods()
-			if err != nil {
-				c.logger.Errorf("fail to poll pods: %v", err)
-				reconcileFailed.WithLabelValues("failed to poll pods").Inc()
-				continue
-			}
+// handleEvent applies a cluster event. It returns false if the cluster failed.
+func (c *Cluster) handleEvent(event *clusterEvent) bool {
+	switch event.typ {
+	case eventModifyCluster:
+		err := c.handleUpdateEvent(event)
+		if err != nil {
+			c.logger.Errorf("handle update event failed: %v", err)
+			c.status.SetReason(err.Error())
+			c.reportFailedStatus()
+			return false
+		}
+	default:
+		panic("unknown event type" + event.typ)
+	}
+	return true
+}
 
-			if len(pending) > 0 {
-				// Pod startup might take long, e.g. pulling image. It would deterministically become running or succeeded/failed later.
-				c.logger.Infof("skip reconciliation: running (%v), pending (%v)", k8sutil.GetPodNames(running), k8sutil.GetPodNames(pending))
-				reconcileFailed.WithLabelValues("not all pods are running").Inc()
-				continue
-			}
-			if len(running) == 0 {
-				// TODO: how to handle this case?
-				c.logger.Warningf("all etcd pods are dead.")
-				break
-			}
+// reconcileOnce runs one reconciliation of the cluster. It returns false if
+// the reconciliation was skipped, in which case c.rerr is left unchanged.
+func (c *Cluster) reconcileOnce() bool {
+	start := time.Now()
+	c.leaderMember = nil
 
-			// On controller restore, we could have "members == nil"
-			if rerr != nil || c.members == nil {
-				rerr = c.updateMembers(podsToMemberSet(running, c.isSecureClient()))
-				if rerr != nil {
-					c.logger.Errorf("failed to update members: %v", rerr)
-					break
-				}
-			}
-			rerr = c.reconcile(running)
-			if rerr != nil {
-				c.logger.Errorf("failed to reconcile: %v", rerr)
-				break
-			}
-			c.updateMemberStatus(running)
-			if err := c.updateCRStatus(); err != nil {
-				c.logger.Warningf("periodic update CR status failed: %v", err)
-			}
+	if c.cluster.Spec.Paused {
+		c.status.PauseControl()
+		c.logger.Infof("control is paused, skipping reconciliation")
+		return false
+	} else {
+		c.status.Control()
+	}
+	c.reportReconcileLag()
 
-			reconcileHistogram.WithLabelValues(c.name()).Observe(time.Since(start).Seconds())
+	if err := c.syncSecrets(); err != nil {
+		c.logger.Warningf("skip reconciliation: %v", err)
+		reconcileFailed.WithLabelValues("secret missing").Inc()
+		if err := c.updateCRStatus(); err != nil {
+			c.logger.Warningf("update CR status failed: %v", err)
 		}
+		return false
+	}
 
-		if rerr != nil {
-			reconcileFailed.WithLabelValues(rerr.Error()).Inc()
-		}
+	running, pending, err := c.pollPods()
+	if err != nil {
+		c.logger.Errorf("fail to poll pods: %v", err)
+		reconcileFailed.WithLabelValues("failed to poll pods").Inc()
+		c.backoffOnTransientError(err)
+		return false
+	}
 
-		if isFatalError(rerr) {
-			c.status.SetReason(rerr.Error())
-			c.logger.Errorf("cluster failed: %v", rerr)
-			c.reportFailedStatus()
-			return
+	if len(pending) > 0 {
+		// Pod startup might take long, e.g. pulling image. It would deterministically become running or succeeded/failed later.
+		c.logger.Infof("skip reconciliation: running (%v), pending (%v)", k8sutil.GetPodNames(running), k8sutil.GetPodNames(pending))
+		reconcileFailed.WithLabelValues("not all pods are running").Inc()
+		return false
+	}
+	if len(running) == 0 {
+		// TODO: how to handle this case?
+		c.logger.Warningf("all etcd pods are dead.")
+		return true
+	}
+
+	// On controller restore, we could have "members == nil"
+	if c.rerr != nil || c.members == nil {
+		c.rerr = c.updateMembers(podsToMemberSet(running, c.isSecureClient(), c.cluster.Spec.DNSDomain))
+		if c.rerr != nil {
+			c.logger.Errorf("failed to update members: %v", c.rerr)
+			return true
+		}
+	}
+	if err := c.pruneStaleMembers(running); err != nil {
+		c.logger.Warningf("failed to prune stale members: %v", err)
+	}
+	if err := c.checkAlarmStatus(); err != nil {
+		c.logger.Warningf("failed to check alarm status: %v", err)
+	}
+	c.rerr = c.reconcile(running)
+	if c.rerr != nil {
+		c.logger.Errorf("failed to reconcile: %v", c.rerr)
+		c.debugLogger.LogEvent(fmt.Sprintf("failed to reconcile: %v", c.rerr))
+		return true
+	}
+	c.updateMemberStatus(running)
+	c.updateClusterStats()
+	if err := c.reconcileConfigMap(); err != nil {
+		c.logger.Warningf("fail to reconcile operator state: %v", err)
+	}
+	c.ensureServices()
+	c.syncPodDisruptionBudget()
+	if c.cluster.Spec.PrometheusMonitoring.IsEnabled() {
+		if err := c.ensureServiceMonitor(); err != nil {
+			c.logger.Errorf("fail to ensure ServiceMonitor: %v", err)
 		}
 	}
+	c.storeSnapshot()
+	c.updateDiskPressureCondition()
+	if c.isCertManagerTLS() {
+		c.checkCertificateRenewal()
+	}
+	c.handleCaptureProfile()
+	c.handlePeerCertRotation()
+	c.checkAutoUpgrade()
+	c.handleOOMEvent(running)
+	if c.cluster.Spec.Auth.IsEnabled() && !c.status.AuthEnabled {
+		if c.config.DryRun {
+			c.planAction("enable etcd authentication", c.cluster.Name)
+		} else if err := c.setupAuth(); err != nil {
+			c.logger.Errorf("failed to setup auth: %v", err)
+		} else {
+			c.status.AuthEnabled = true
+		}
+	}
+	if err := c.updateCRStatus(); err != nil {
+		c.logger.Warningf("periodic update CR status failed: %v", err)
+		c.backoffOnTransientError(err)
+	} else {
+		c.backoffDuration = 0
+		c.resetReconcileLag()
+	}
+
+	c.reportReconcileDuration(start)
+	c.debugLogger.LogEvent(fmt.Sprintf("reconciled %d members", c.members.Size()))
+	return true
+}
+
+// untilNextReconcile returns how long the cluster waits for its next reconciliation.
+func (c *Cluster) untilNextReconcile() time.Duration {
+	return c.nextReconcile.Sub(time.Now())
+}
+
+// finish releases what the cluster holds for reconciliation once it is deleted
+// or failed.
+func (c *Cluster) finish() {
+	if c.stopped {
+		return
+	}
+	c.stopped = true
+	c.closeEtcdClient()
+	c.debugLogger.Close()
+	reconcileLag.DeleteLabelValues(c.name(), c.cluster.Namespace)
+	podCreationTimeouts.DeleteLabelValues(c.name(), c.cluster.Namespace)
+}
+
+// nextReconcileInterval returns the back-off duration after a transient
+// API server error, and reconcileInterval otherwise.
+func (c *Cluster) nextReconcileInterval() time.Duration {
+	if c.backoffDuration > 0 {
+		return c.backoffDuration
+	}
+	return reconcileInterval
+}
+
+// backoffOnTransientError doubles the back-off duration on a transient API server error,
+// up to maxBackoffDuration. Any other error resets it.
+func (c *Cluster) backoffOnTransientError(err error) {
+	if !isTransientError(err) {
+		c.backoffDuration = 0
+		return
+	}
+	if c.backoffDuration == 0 {
+		c.backoffDuration = reconcileInterval
+	}
+	c.backoffDuration *= 2
+	if c.backoffDuration > maxBackoffDuration {
+		c.backoffDuration = maxBackoffDuration
+	}
+	c.logger.Infof("transient API server error, backing off for %v", c.backoffDuration)
 }
 
 func (c *Cluster) handleUpdateEvent(event *clusterEvent) error {
 	oldSpec := c.cluster.Spec.DeepCopy()
+	if oldSpec.SelfHosted == nil && event.cluster.Spec.SelfHosted != nil {
+		c.logger.Errorf("ignoring update event: spec.selfHosted cannot be set on an existing cluster")
+		return nil
+	}
 	c.cluster = event.cluster
 
 	if isSpecEqual(event.cluster.Spec, *oldSpec) {
@@ -314,6 +628,17 @@ func (c *Cluster) handleUpdateEvent(event *clusterEvent) error {
 	// TODO: we can't handle another upgrade while an upgrade is in progress
 
 	c.logSpecUpdate(*oldSpec, event.cluster.Spec)
+	if event.cluster.Spec.ServiceType != oldSpec.ServiceType {
+		c.updateClientServiceType()
+	}
+	if !isGatewaySpecEqual(event.cluster.Spec, *oldSpec) {
+		if err := c.syncGateway(); err != nil {
+			c.logger.Errorf("fail to sync etcd gateway: %v", err)
+		}
+	}
+	if oldSpec.SelfHosted != nil && event.cluster.Spec.SelfHosted == nil {
+		c.logger.Infof("self-hosted policy removed: migrating the members to regular pods")
+	}
 	return nil
 }
 
@@ -321,15 +646,29 @@ func isSpecEqual(s1, s2 api.ClusterSpec) bool {
 	if s1.Size != s2.Size || s1.Paused != s2.Paused || s1.Version != s2.Version {
 		return false
 	}
+	if s1.ServiceType != s2.ServiceType {
+		return false
+	}
+	if !isGatewaySpecEqual(s1, s2) {
+		return false
+	}
+	if (s1.SelfHosted == nil) != (s2.SelfHosted == nil) {
+		return false
+	}
+	// e.g. the pod policy, which the pods are replaced for by syncPodSpec
+	if k8sutil.SpecHash(s1) != k8sutil.SpecHash(s2) {
+		return false
+	}
 	return true
 }
 
 func (c *Cluster) startSeedMember() error {
 	m := &etcdutil.Member{
-		Name:         etcdutil.CreateMemberName(c.cluster.Name, c.memberCounter),
-		Namespace:    c.cluster.Namespace,
-		SecurePeer:   c.isSecurePeer(),
-		SecureClient: c.isSecureClient(),
+		Name:          etcdutil.CreateMemberName(c.cluster.Name, c.memberCounter),
+		Namespace:     c.cluster.Namespace,
+		SecurePeer:    c.isSecurePeer(),
+		SecureClient:  c.isSecureClient(),
+		ClusterDomain: c.cluster.Spec.DNSDomain,
 	}
 	ms := etcdutil.NewMemberSet(m)
 	if err := c.createPod(ms, m, "new"); err != nil {
@@ -346,6 +685,19 @@ func (c *Cluster) startSeedMember() error {
 	return nil
 }
 
+// storeSnapshot publishes the cluster and its ready members to the goroutines
+// running beside the reconcile loop.
+func (c *Cluster) storeSnapshot() {
+	c.readyMembers.Store(append([]string(nil), c.status.Members.Ready...))
+	c.clusterSnapshot.Store(c.cluster.DeepCopy())
+}
+
+// snapshot returns the cluster as of the last reconciliation.
+// It is shared and must not be modified.
+func (c *Cluster) snapshot() *api.EtcdCluster {
+	return c.clusterSnapshot.Load().(*api.EtcdCluster)
+}
+
 func (c *Cluster) isSecurePeer() bool {
 	return c.cluster.Spec.TLS.IsSecurePeer()
 }
@@ -354,8 +706,12 @@ func (c *Cluster) isSecureClient() bool {
 	return c.cluster.Spec.TLS.IsSecureClient()
 }
 
-// bootstrap creates the seed etcd member for a new cluster.
+// bootstrap creates the seed etcd member for a new cluster, or adds the first
+// member to the existing cluster at spec.externalEndpoints.
 func (c *Cluster) bootstrap() error {
+	if len(c.cluster.Spec.ExternalEndpoints) != 0 {
+		return c.joinExternalCluster()
+	}
 	return c.startSeedMember()
 }
 
@@ -367,21 +723,217 @@ func (c *Cluster) Update(cl *api.EtcdCluster) {
 }
 
 func (c *Cluster) setupServices() error {
-	err := k8sutil.CreateClientService(c.config.KubeCli, c.cluster.Name, c.cluster.Namespace, c.cluster.AsOwner())
+	if c.config.DryRun {
+		c.planAction("create services", k8sutil.ClientServiceName(c.cluster.Name)+","+c.cluster.Name)
+		return nil
+	}
+
+	err := k8sutil.CreateClientService(c.config.KubeCli, c.cluster.Name, c.cluster.Namespace, c.cluster.Spec.ServiceType, c.cluster.AsOwner())
 	if err != nil {
 		return err
 	}
 
-	return k8sutil.CreatePeerService(c.config.KubeCli, c.cluster.Name, c.cluster.Namespace, c.cluster.AsOwner())
+	err = k8sutil.CreatePeerService(c.config.KubeCli, c.cluster.Name, c.cluster.Namespace, c.cluster.AsOwner())
+	if err != nil {
+		return err
+	}
+
+	if c.cluster.Spec.ExposeMetricsService {
+		if err := c.exposeEtcdMetricsService(); err != nil {
+			return err
+		}
+	}
+	if c.cluster.Spec.EnableNetworkPolicy {
+		if err := c.syncNetworkPolicies(); err != nil {
+			return err
+		}
+	}
+	if c.cluster.Spec.GatewayEnabled {
+		if err := c.syncGateway(); err != nil {
+			return err
+		}
+	}
+	if c.cluster.Spec.PrometheusMonitoring.IsEnabled() {
+		// The Prometheus Operator might not be installed yet; the reconcile loop retries.
+		if err := c.ensureServiceMonitor(); err != nil {
+			c.logger.Errorf("fail to ensure ServiceMonitor: %v", err)
+		}
+	}
+	return nil
+}
+
+// exposeEtcdMetricsService creates the service for Prometheus to scrape etcd metrics.
+// The service selects the etcd pods by the cluster label, so it keeps up with
+// cluster size changes; it is garbage collected with the EtcdCluster.
+func (c *Cluster) exposeEtcdMetricsService() error {
+	return k8sutil.CreateMetricsService(c.config.KubeCli, c.cluster.Name, c.cluster.Namespace, c.cluster.AsOwner())
+}
+
+// syncNetworkPolicies creates the NetworkPolicy restricting the peer traffic of
+// the etcd pods. It is garbage collected with the EtcdCluster.
+func (c *Cluster) syncNetworkPolicies() error {
+	return k8sutil.CreateNetworkPolicy(c.config.KubeCli, c.cluster.Name, c.cluster.Namespace, c.cluster.Spec.ExposeMetricsService, c.cluster.AsOwner())
+}
+
+// syncPodDisruptionBudget makes the PodDisruptionBudget of the cluster keep a
+// quorum of the desired size available, and deletes it once it is disabled.
+// The spec of a PodDisruptionBudget cannot be updated before Kubernetes 1.15,
+// so it is recreated when the quorum changes. It is garbage collected with the
+// EtcdCluster.
+func (c *Cluster) syncPodDisruptionBudget() {
+	minAvailable := 0
+	if c.cluster.Spec.EnablePodDisruptionBudget {
+		minAvailable = c.desiredSize()/2 + 1
+	}
+	if minAvailable == c.pdbMinAvailable {
+		return
+	}
+	name := k8sutil.PodDisruptionBudgetName(c.cluster.Name)
+	if c.config.DryRun {
+		c.planAction(fmt.Sprintf("set minAvailable of PodDisruptionBudget to %d", minAvailable), name)
+		c.pdbMinAvailable = minAvailable
+		return
+	}
+
+	if err := k8sutil.DeleteEtcdPodDisruptionBudget(c.config.KubeCli, c.cluster.Name, c.cluster.Namespace); err != nil {
+		c.logger.Errorf("fail to delete PodDisruptionBudget (%s): %v", name, err)
+		return
+	}
+	c.pdbMinAvailable = 0
+	if minAvailable == 0 {
+		c.logger.Infof("deleted PodDisruptionBudget (%s)", name)
+		return
+	}
+	err := k8sutil.CreateEtcdPodDisruptionBudget(c.config.KubeCli, c.cluster.Name, c.cluster.Namespace, minAvailable, c.cluster.AsOwner())
+	if err != nil {
+		c.logger.Errorf("fail to create PodDisruptionBudget (%s): %v", name, err)
+		return
+	}
+	c.pdbMinAvailable = minAvailable
+	c.logger.Infof("created PodDisruptionBudget (%s) with minAvailable %d", name, minAvailable)
+}
+
+// ensureServiceMonitor creates the ServiceMonitor of the cluster if it does not exist,
+// e.g. it was deleted by a user. It is garbage collected with the EtcdCluster.
+func (c *Cluster) ensureServiceMonitor() error {
+	exists, err := k8sutil.ServiceMonitorExists(c.config.KubeCli, c.cluster.Name, c.cluster.Namespace)
+	if err != nil {
+		return fmt.Errorf("failed to get ServiceMonitor: %v", err)
+	}
+	if exists {
+		return nil
+	}
+	if c.config.DryRun {
+		c.planAction("create ServiceMonitor", k8sutil.ServiceMonitorName(c.cluster.Name))
+		return nil
+	}
+	err = k8sutil.CreateServiceMonitor(c.config.KubeCli, c.cluster.Name, c.cluster.Namespace, c.cluster.Spec.PrometheusMonitoring, c.cluster.AsOwner())
+	if err != nil {
+		return fmt.Errorf("failed to create ServiceMonitor: %v", err)
+	}
+	c.logger.Infof("created ServiceMonitor (%s)", k8sutil.ServiceMonitorName(c.cluster.Name))
+	return nil
+}
+
+// updatePeerService makes sure the peer service selects the pods of all members
+// after the member set changed.
+func (c *Cluster) updatePeerService() {
+	if c.config.DryRun {
+		c.planAction("update peer service", c.cluster.Name)
+		return
+	}
+	if err := k8sutil.UpdatePeerService(c.config.KubeCli, c.cluster.Name, c.cluster.Namespace); err != nil {
+		c.logger.Warningf("fail to update peer service: %v", err)
+	}
+}
+
+// updateClientServiceType changes the type of the client service to the one in the spec.
+func (c *Cluster) updateClientServiceType() {
+	if c.config.DryRun {
+		c.planAction("change client service type to "+string(c.cluster.Spec.ServiceType), k8sutil.ClientServiceName(c.cluster.Name))
+		return
+	}
+	err := k8sutil.UpdateClientServiceType(c.config.KubeCli, c.cluster.Name, c.cluster.Namespace, c.cluster.Spec.ServiceType)
+	if err != nil {
+		c.logger.Errorf("fail to update client service type to (%s): %v", c.cluster.Spec.ServiceType, err)
+		return
+	}
+	c.logger.Infof("client service type updated to (%s)", c.cluster.Spec.ServiceType)
+}
+
+// ensureServices recreates the etcd services if they are missing, e.g. after
+// they were deleted by hand, and refreshes the service status.
+func (c *Cluster) ensureServices() {
+	if err := c.setupServices(); err != nil {
+		c.logger.Errorf("fail to setup etcd services: %v", err)
+		return
+	}
+	if err := c.updateServiceStatus(); err != nil {
+		c.logger.Errorf("fail to update service status: %v", err)
+	}
+}
+
+// updateServiceStatus populates status.serviceIP with the cluster IP of the client service.
+func (c *Cluster) updateServiceStatus() error {
+	svc, err := c.config.KubeCli.CoreV1().Services(c.cluster.Namespace).Get(c.status.ServiceName, metav1.GetOptions{})
+	if err != nil {
+		c.status.ServiceIP = ""
+		return err
+	}
+	c.status.ServiceIP = svc.Spec.ClusterIP
+	return nil
 }
 
 func (c *Cluster) createPod(members etcdutil.MemberSet, m *etcdutil.Member, state string) error {
-	pod := k8sutil.NewEtcdPod(m, members.PeerURLPairs(), c.cluster.Name, state, uuid.New(), c.cluster.Spec, c.cluster.AsOwner())
-	_, err := c.config.KubeCli.Core().Pods(c.cluster.Namespace).Create(pod)
-	return err
+	initialCluster := members.PeerURLPairs()
+	if len(c.cluster.Spec.ExternalEndpoints) != 0 && state == "existing" {
+		var err error
+		initialCluster, err = c.externalInitialCluster(m)
+		if err != nil {
+			return err
+		}
+	}
+	if c.config.DryRun {
+		c.planAction("create pod", m.Name)
+		return nil
+	}
+	pod := k8sutil.NewEtcdPod(m, initialCluster, c.cluster.Name, state, uuid.New(), c.podSpec(), c.cluster.AsOwner())
+	if err := c.createPodWithTimeout(pod); err != nil {
+		return err
+	}
+	c.debugLogger.LogPodCreation(pod)
+	return nil
+}
+
+// createPodWithTimeout creates pod and gives up once the pod creation timeout
+// is exceeded, so that an unresponsive API server does not block the cluster.
+// The client does not take a context, so the abandoned request may still create
+// the pod; a later reconciliation then finds it like any other pod.
+func (c *Cluster) createPodWithTimeout(pod *v1.Pod) error {
+	timeout := time.Duration(c.config.PodCreationTimeoutSeconds) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := c.config.KubeCli.Core().Pods(c.cluster.Namespace).Create(pod)
+		errCh <- err
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		c.logger.Errorf("timed out creating pod (%s) after %v", pod.Name, timeout)
+		podCreationTimeouts.WithLabelValues(c.name(), c.cluster.Namespace).Inc()
+		return fmt.Errorf("timed out creating pod (%s) after %v: %v", pod.Name, timeout, ctx.Err())
+	}
 }
 
 func (c *Cluster) removePod(name string) error {
+	if c.config.DryRun {
+		c.planAction("delete pod", name)
+		return nil
+	}
 	ns := c.cluster.Namespace
 	opts := metav1.NewDeleteOptions(podTerminationGracePeriod)
 	err := c.config.KubeCli.Core().Pods(ns).Delete(name, opts)
@@ -389,22 +941,141 @@ func (c *Cluster) removePod(name string) error {
 		if !k8sutil.IsKubernetesResourceNotFoundError(err) {
 			return err
 		}
-		if c.isDebugLoggerEnabled() {
-			c.debugLogger.LogMessage(fmt.Sprintf("pod (%s) not found while trying to delete it", name))
+		c.debugLogger.LogMessage(fmt.Sprintf("pod (%s) not found while trying to delete it", name))
+	}
+	c.debugLogger.LogPodDeletion(name)
+	return nil
+}
+
+// reconcileLabels adds the labels the operator selects etcd pods by to the pods
+// of the cluster missing them, e.g. pods created by an old operator version.
+// Pods are found by the etcd_cluster label alone; pods with another app label,
+// such as the etcd gateway pods, are left alone.
+func (c *Cluster) reconcileLabels() error {
+	ns := c.cluster.Namespace
+	opt := metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(map[string]string{"etcd_cluster": c.cluster.Name}).String(),
+	}
+	podList, err := c.config.KubeCli.CoreV1().Pods(ns).List(opt)
+	if err != nil {
+		return fmt.Errorf("failed to list pods: %v", err)
+	}
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		missing := missingLabels(pod, c.cluster.Name)
+		if len(missing) == 0 {
+			continue
+		}
+		if c.config.DryRun {
+			c.planAction("set labels", pod.Name)
+			continue
+		}
+		oldpod := pod.DeepCopy()
+		if pod.Labels == nil {
+			pod.Labels = map[string]string{}
+		}
+		for k, v := range missing {
+			pod.Labels[k] = v
+		}
+		patchdata, err := k8sutil.CreatePatch(oldpod, pod, v1.Pod{})
+		if err != nil {
+			return fmt.Errorf("error creating patch: %v", err)
+		}
+		_, err = c.config.KubeCli.CoreV1().Pods(ns).Patch(pod.Name, types.StrategicMergePatchType, patchdata)
+		if err != nil {
+			return fmt.Errorf("fail to set labels of pod (%s): %v", pod.Name, err)
+		}
+		c.logger.Infof("set labels %v of pod (%s)", missing, pod.Name)
+	}
+	return nil
+}
+
+// missingLabels returns the operator-managed labels that the etcd pod lacks or
+// that have a wrong value. It returns nil for pods that are not etcd pods: pods
+// with an app label other than the one of etcd pods, and pods with neither the
+// etcd_node label nor an etcd container, e.g. other pods a user labeled with
+// the cluster name.
+func missingLabels(pod *v1.Pod, clusterName string) map[string]string {
+	want := k8sutil.LabelsForCluster(clusterName)
+	if app, ok := pod.Labels["app"]; ok && app != want["app"] {
+		return nil
+	}
+	if _, ok := pod.Labels["etcd_node"]; !ok && !hasEtcdContainer(pod) {
+		return nil
+	}
+	want["etcd_node"] = pod.Name
+	var missing map[string]string
+	for k, v := range want {
+		if pod.Labels[k] == v {
+			continue
+		}
+		if missing == nil {
+			missing = map[string]string{}
 		}
+		missing[k] = v
 	}
-	if c.isDebugLoggerEnabled() {
-		c.debugLogger.LogPodDeletion(name)
+	return missing
+}
+
+func hasEtcdContainer(pod *v1.Pod) bool {
+	for _, c := range pod.Spec.Containers {
+		if c.Name == "etcd" {
+			return true
+		}
+	}
+	return false
+}
+
+// reconcileOwnerReferences sets the cluster as the owner of its pods that have
+// no or another owner, e.g. pods created by an old operator version, which
+// pollPods would otherwise ignore.
+func (c *Cluster) reconcileOwnerReferences() error {
+	ns := c.cluster.Namespace
+	podList, err := c.config.KubeCli.CoreV1().Pods(ns).List(k8sutil.ClusterListOpt(c.cluster.Name))
+	if err != nil {
+		return fmt.Errorf("failed to list pods: %v", err)
+	}
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		if pod.DeletionTimestamp != nil || !needsOwnerReference(pod, c.cluster.UID) {
+			continue
+		}
+		if c.config.DryRun {
+			c.planAction("set owner reference", pod.Name)
+			continue
+		}
+		oldpod := pod.DeepCopy()
+		pod.OwnerReferences = []metav1.OwnerReference{c.cluster.AsOwner()}
+		patchdata, err := k8sutil.CreatePatch(oldpod, pod, v1.Pod{})
+		if err != nil {
+			return fmt.Errorf("error creating patch: %v", err)
+		}
+		_, err = c.config.KubeCli.CoreV1().Pods(ns).Patch(pod.Name, types.StrategicMergePatchType, patchdata)
+		if err != nil {
+			return fmt.Errorf("fail to set owner reference of pod (%s): %v", pod.Name, err)
+		}
+		c.logger.Infof("set the owner reference of pod (%s)", pod.Name)
 	}
 	return nil
 }
 
+// needsOwnerReference returns true if the first owner of pod, which pollPods
+// checks, is not the cluster with the given UID.
+func needsOwnerReference(pod *v1.Pod, uid types.UID) bool {
+	return len(pod.OwnerReferences) == 0 || pod.OwnerReferences[0].UID != uid
+}
+
 func (c *Cluster) pollPods() (running, pending []*v1.Pod, err error) {
 	podList, err := c.config.KubeCli.Core().Pods(c.cluster.Namespace).List(k8sutil.ClusterListOpt(c.cluster.Name))
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to list running pods: %v", err)
+		return nil, nil, errors.Wrap(err, "failed to list running pods")
 	}
 
+	specHash := k8sutil.SpecHash(c.cluster.Spec)
+	var drifted []string
 	for i := range podList.Items {
 		pod := &podList.Items[i]
 		// Avoid polling deleted pods. k8s issue where deleted pods would sometimes show the status Pending
@@ -421,6 +1092,9 @@ func (c *Cluster) pollPods() (running, pending []*v1.Pod, err error) {
 				pod.Name, pod.OwnerReferences[0].UID, c.cluster.UID)
 			continue
 		}
+		if h := k8sutil.GetSpecHash(pod); len(h) != 0 && h != specHash {
+			drifted = append(drifted, pod.Name)
+		}
 		switch pod.Status.Phase {
 		case v1.PodRunning:
 			running = append(running, pod)
@@ -428,10 +1102,41 @@ func (c *Cluster) pollPods() (running, pending []*v1.Pod, err error) {
 			pending = append(pending, pod)
 		}
 	}
+	if len(drifted) != 0 {
+		c.logger.Infof("pollPods: pods %v were created from an older spec and need to be replaced to apply the current spec", drifted)
+	}
 
 	return running, pending, nil
 }
 
+// updateClusterStats records the etcd cluster statistics in the status.
+// The last statistics are kept if they cannot be gathered.
+func (c *Cluster) updateClusterStats() {
+	etcdcli, err := c.etcdClient()
+	if err != nil {
+		c.logger.Warningf("failed to get cluster stats: %v", err)
+		return
+	}
+	stats, err := etcdutil.GetClusterStatsWithClient(etcdcli, c.members.ClientURLs())
+	if err != nil {
+		c.logger.Warningf("failed to get cluster stats: %v", err)
+		return
+	}
+	c.setClusterStats(api.ClusterStats(*stats), time.Now())
+}
+
+// setClusterStats records s in the status if the leader or the number of healthy
+// members changed, or if the stats are older than clusterStatsInterval.
+func (c *Cluster) setClusterStats(s api.ClusterStats, now time.Time) {
+	old := c.status.Stats
+	if old != nil && old.Leader == s.Leader && old.MembersHealthy == s.MembersHealthy &&
+		now.Sub(c.statsUpdated) < clusterStatsInterval {
+		return
+	}
+	c.status.Stats = &s
+	c.statsUpdated = now
+}
+
 func (c *Cluster) updateMemberStatus(running []*v1.Pod) {
 	var unready []string
 	var ready []string
@@ -448,15 +1153,20 @@ func (c *Cluster) updateMemberStatus(running []*v1.Pod) {
 }
 
 func (c *Cluster) updateCRStatus() error {
+	c.status.ObservedGeneration = c.cluster.Generation
 	if reflect.DeepEqual(c.cluster.Status, c.status) {
 		return nil
 	}
+	if c.config.DryRun {
+		c.planAction("update status", c.cluster.Name)
+		return nil
+	}
 
 	newCluster := c.cluster
 	newCluster.Status = c.status
 	newCluster, err := c.config.EtcdCRCli.EtcdV1beta2().EtcdClusters(c.cluster.Namespace).Update(c.cluster)
 	if err != nil {
-		return fmt.Errorf("failed to update CR status: %v", err)
+		return errors.Wrap(err, "failed to update CR status")
 	}
 
 	c.cluster = newCluster
@@ -464,6 +1174,8 @@ func (c *Cluster) updateCRStatus() error {
 	return nil
 }
 
+// reportFailedStatus saves the failed phase in the CR status. It runs on a pool
+// worker, so it gives up after reportFailedStatusRetries attempts.
 func (c *Cluster) reportFailedStatus() {
 	c.logger.Info("cluster failed. Reporting failed reason...")
 
@@ -496,7 +1208,9 @@ func (c *Cluster) reportFailedStatus() {
 		return false, nil
 	}
 
-	retryutil.Retry(retryInterval, math.MaxInt64, f)
+	if err := retryutil.Retry(retryInterval, reportFailedStatusRetries, f); err != nil {
+		c.logger.Errorf("failed to report failed status: %v", err)
+	}
 }
 
 func (c *Cluster) name() string {
@@ -535,14 +1249,5 @@ func (c *Cluster) logSpecUpdate(oldSpec, newSpec api.ClusterSpec) {
 		c.logger.Info(m)
 	}
 
-	if c.isDebugLoggerEnabled() {
-		c.debugLogger.LogClusterSpecUpdate(string(oldSpecBytes), string(newSpecBytes))
-	}
-}
-
-func (c *Cluster) isDebugLoggerEnabled() bool {
-	if c.cluster.Spec.SelfHosted != nil && c.debugLogger != nil {
-		return true
-	}
-	return false
+	c.debugLogger.LogClusterSpecUpdate(string(oldSpecBytes), string(newSpecBytes))
 }
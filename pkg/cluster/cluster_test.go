@@ -15,11 +15,30 @@
 package cluster
 
 import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	crfake "github.com/coreos/etcd-operator/pkg/generated/clientset/versioned/fake"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
 
+	"github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	ktesting "k8s.io/client-go/testing"
 )
 
 // When EtcdCluster update event happens, local object ref should be updated.
@@ -56,3 +75,461 @@ func TestUpdateEventUpdateLocalClusterObj(t *testing.T) {
 		t.Errorf("expect version=%s, get=%s", newVersion, c.cluster.ResourceVersion)
 	}
 }
+
+func TestUpdateEventIgnoresSelfHosted(t *testing.T) {
+	oldObj := &api.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: metav1.NamespaceDefault},
+		Spec:       api.ClusterSpec{Size: 3},
+	}
+	newObj := oldObj.DeepCopy()
+	newObj.Spec.SelfHosted = &api.SelfHostedPolicy{}
+
+	c := &Cluster{
+		logger:  logrus.WithField("pkg", "cluster"),
+		cluster: oldObj,
+	}
+	if err := c.handleUpdateEvent(&clusterEvent{typ: eventModifyCluster, cluster: newObj}); err != nil {
+		t.Fatal(err)
+	}
+	if c.cluster.Spec.SelfHosted != nil {
+		t.Error("selfHosted was set on an existing cluster")
+	}
+}
+
+func TestUpdateCRStatusObservedGeneration(t *testing.T) {
+	cl := &api.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "test",
+			Namespace:  metav1.NamespaceDefault,
+			Generation: 3,
+		},
+		Status: api.ClusterStatus{ObservedGeneration: 2},
+	}
+	crcli := crfake.NewSimpleClientset(cl)
+	c := &Cluster{
+		logger:  logrus.WithField("pkg", "cluster"),
+		config:  Config{EtcdCRCli: crcli},
+		cluster: cl.DeepCopy(),
+		status:  *cl.Status.DeepCopy(),
+	}
+	if err := c.updateCRStatus(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := crcli.EtcdV1beta2().EtcdClusters(cl.Namespace).Get(cl.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status.ObservedGeneration != got.Generation {
+		t.Errorf("status.observedGeneration = %d, want metadata.generation %d", got.Status.ObservedGeneration, got.Generation)
+	}
+}
+
+// A restarted operator must not reuse the counter of removed members.
+func TestMemberCounterRecoveryAfterRestart(t *testing.T) {
+	cl := &api.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: metav1.NamespaceDefault,
+		},
+	}
+	lg := logrus.WithField("pkg", "cluster")
+
+	// test-0000 to test-0004 were created, test-0003 and test-0004 were removed.
+	before := &Cluster{
+		logger:        lg,
+		cluster:       cl,
+		memberCounter: 5,
+		members: etcdutil.NewMemberSet(
+			&etcdutil.Member{Name: "test-0000"},
+			&etcdutil.Member{Name: "test-0001"},
+			&etcdutil.Member{Name: "test-0002"},
+		),
+	}
+	cm := before.newStateConfigMap()
+	if cm.Data[stateMembersKey] != "test-0000,test-0001,test-0002" {
+		t.Errorf("members = %s, want test-0000,test-0001,test-0002", cm.Data[stateMembersKey])
+	}
+
+	// counter of the highest running member, as recovered by updateMembers
+	after := &Cluster{logger: lg, cluster: cl, memberCounter: 3}
+	after.restoreState(cm)
+	if after.memberCounter != 5 {
+		t.Errorf("member counter = %d, want 5", after.memberCounter)
+	}
+}
+
+// fakeEvents records the created events.
+type fakeEvents struct {
+	corev1.EventInterface
+	events []*v1.Event
+}
+
+func (f *fakeEvents) Create(e *v1.Event) (*v1.Event, error) {
+	f.events = append(f.events, e)
+	return e, nil
+}
+
+func TestEnsureMinimumMemberCount(t *testing.T) {
+	tests := []struct {
+		lastValidSize int
+		members       int
+		size          int
+		wantSize      int
+		wantEvent     bool
+	}{
+		{lastValidSize: 3, members: 3, size: 5, wantSize: 5},
+		{lastValidSize: 3, members: 3, size: 1, wantSize: 1},
+		{lastValidSize: 3, members: 3, size: 0, wantSize: 3, wantEvent: true},
+		{lastValidSize: 3, members: 3, size: 2, wantSize: 3, wantEvent: true},
+		{lastValidSize: 5, members: 5, size: -1, wantSize: 5, wantEvent: true},
+		// no valid size known, e.g. after an operator restart: never shrink
+		{members: 4, size: 4, wantSize: 4, wantEvent: true},
+		{members: 3, size: 0, wantSize: 3, wantEvent: true},
+		{members: 1, size: 4, wantSize: 3, wantEvent: true},
+		{members: 0, size: 0, wantSize: 1, wantEvent: true},
+	}
+	for i, tt := range tests {
+		ms := etcdutil.MemberSet{}
+		for j := 0; j < tt.members; j++ {
+			ms.Add(&etcdutil.Member{Name: etcdutil.CreateMemberName("test", j)})
+		}
+		ev := &fakeEvents{}
+		c := &Cluster{
+			logger: logrus.WithField("pkg", "cluster"),
+			cluster: &api.EtcdCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: metav1.NamespaceDefault},
+				Spec:       api.ClusterSpec{Size: tt.size},
+			},
+			members:       ms,
+			lastValidSize: tt.lastValidSize,
+			eventsCli:     ev,
+		}
+		c.ensureMinimumMemberCount()
+		// a rejected size is reported once
+		c.ensureMinimumMemberCount()
+		if got := c.desiredSize(); got != tt.wantSize {
+			t.Errorf("#%d: desired size = %d, want %d", i, got, tt.wantSize)
+		}
+		if c.cluster.Spec.Size != tt.size {
+			t.Errorf("#%d: spec size changed to %d", i, c.cluster.Spec.Size)
+		}
+		wantEvents := 0
+		if tt.wantEvent {
+			wantEvents = 1
+		}
+		if len(ev.events) != wantEvents {
+			t.Errorf("#%d: events = %d, want %d", i, len(ev.events), wantEvents)
+		}
+	}
+}
+
+func TestIsSpecEqualServiceType(t *testing.T) {
+	tests := []struct {
+		old, new v1.ServiceType
+		want     bool
+	}{
+		{"", "", true},
+		{v1.ServiceTypeClusterIP, v1.ServiceTypeClusterIP, true},
+		{"", v1.ServiceTypeNodePort, false},
+		{v1.ServiceTypeNodePort, v1.ServiceTypeLoadBalancer, false},
+	}
+	for i, tt := range tests {
+		s1 := api.ClusterSpec{Size: 3, ServiceType: tt.old}
+		s2 := api.ClusterSpec{Size: 3, ServiceType: tt.new}
+		if got := isSpecEqual(s1, s2); got != tt.want {
+			t.Errorf("#%d: isSpecEqual = %v, want %v", i, got, tt.want)
+		}
+	}
+}
+
+func TestIsSpecEqualPodPolicy(t *testing.T) {
+	s1 := api.ClusterSpec{Size: 3}
+	s2 := api.ClusterSpec{Size: 3, Pod: &api.PodPolicy{Resources: v1.ResourceRequirements{Limits: v1.ResourceList{}}}}
+	s2.Pod.Resources.Limits[v1.ResourceMemory] = resource.MustParse("1Gi")
+	if isSpecEqual(s1, s2) {
+		t.Error("isSpecEqual = true after the pod resources changed, want false")
+	}
+}
+
+func TestExpectedSecrets(t *testing.T) {
+	tests := []struct {
+		spec api.ClusterSpec
+		want []string
+	}{
+		{api.ClusterSpec{}, nil},
+		{
+			api.ClusterSpec{TLS: &api.TLSPolicy{Static: &api.StaticTLS{
+				Member:         &api.MemberSecret{PeerSecret: "peer", ServerSecret: "server"},
+				OperatorSecret: "operator",
+			}}},
+			[]string{"peer", "server", "operator"},
+		},
+		{
+			api.ClusterSpec{Auth: &api.AuthConfig{Enabled: true, RootPasswordSecret: "root"}},
+			[]string{"root"},
+		},
+	}
+	for i, tt := range tests {
+		c := &Cluster{cluster: &api.EtcdCluster{ObjectMeta: metav1.ObjectMeta{Name: "test"}, Spec: tt.spec}}
+		if got := c.expectedSecrets(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("#%d: secrets = %v, want %v", i, got, tt.want)
+		}
+	}
+}
+
+func TestMissingLabels(t *testing.T) {
+	tests := []struct {
+		labels        map[string]string
+		etcdContainer bool
+		want          map[string]string
+	}{
+		{
+			labels: map[string]string{"app": "etcd", "etcd_cluster": "example", "etcd_node": "example-0000"},
+			want:   nil,
+		},
+		{
+			labels:        map[string]string{"etcd_cluster": "example"},
+			etcdContainer: true,
+			want:          map[string]string{"app": "etcd", "etcd_node": "example-0000"},
+		},
+		{
+			labels: map[string]string{"etcd_cluster": "example", "etcd_node": "example-0000"},
+			want:   map[string]string{"app": "etcd"},
+		},
+		// a pod with neither an etcd_node label nor an etcd container is not an etcd pod
+		{
+			labels: map[string]string{"etcd_cluster": "example"},
+			want:   nil,
+		},
+		{
+			labels: map[string]string{"app": "etcd", "etcd_cluster": "example", "etcd_node": "old-name"},
+			want:   map[string]string{"etcd_node": "example-0000"},
+		},
+		// the etcd gateway pods are not etcd pods
+		{
+			labels: map[string]string{"app": "etcd-gateway", "etcd_cluster": "example"},
+			want:   nil,
+		},
+	}
+	for i, tt := range tests {
+		pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "example-0000", Labels: tt.labels}}
+		if tt.etcdContainer {
+			pod.Spec.Containers = []v1.Container{{Name: "etcd"}}
+		}
+		if got := missingLabels(pod, "example"); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("#%d: missing labels = %v, want %v", i, got, tt.want)
+		}
+	}
+}
+
+func TestNeedsOwnerReference(t *testing.T) {
+	tests := []struct {
+		owners []metav1.OwnerReference
+		want   bool
+	}{
+		{owners: nil, want: true},
+		{owners: []metav1.OwnerReference{{UID: "old"}}, want: true},
+		{owners: []metav1.OwnerReference{{UID: "old"}, {UID: "uid"}}, want: true},
+		{owners: []metav1.OwnerReference{{UID: "uid"}}, want: false},
+	}
+	for i, tt := range tests {
+		pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{OwnerReferences: tt.owners}}
+		if got := needsOwnerReference(pod, "uid"); got != tt.want {
+			t.Errorf("#%d: needsOwnerReference = %v, want %v", i, got, tt.want)
+		}
+	}
+}
+
+func TestCreatePodWithTimeout(t *testing.T) {
+	kubecli := fake.NewSimpleClientset()
+	unblock := make(chan struct{})
+	defer close(unblock)
+	kubecli.PrependReactor("create", "pods", func(ktesting.Action) (bool, runtime.Object, error) {
+		<-unblock
+		return true, nil, nil
+	})
+	c := &Cluster{
+		logger:  logrus.WithField("pkg", "cluster"),
+		config:  Config{KubeCli: kubecli, PodCreationTimeoutSeconds: 1},
+		cluster: &api.EtcdCluster{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: metav1.NamespaceDefault}},
+	}
+
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "test-0000"}}
+	err := c.createPodWithTimeout(pod)
+	if err == nil || !strings.Contains(err.Error(), "timed out creating pod (test-0000) after 1s") {
+		t.Errorf("want timeout error, get %v", err)
+	}
+}
+
+func TestSyncPodDisruptionBudget(t *testing.T) {
+	kubecli := fake.NewSimpleClientset()
+	c := &Cluster{
+		logger: logrus.WithField("pkg", "cluster"),
+		config: Config{KubeCli: kubecli},
+		cluster: &api.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: metav1.NamespaceDefault},
+			Spec:       api.ClusterSpec{Size: 3},
+		},
+	}
+	tests := []struct {
+		enabled          bool
+		size             int
+		wantMinAvailable int
+	}{
+		{false, 3, 0},
+		{true, 3, 2},
+		{true, 5, 3},
+		{false, 5, 0},
+	}
+	for i, tt := range tests {
+		c.cluster.Spec.EnablePodDisruptionBudget = tt.enabled
+		c.cluster.Spec.Size = tt.size
+		c.syncPodDisruptionBudget()
+
+		pdb, err := kubecli.PolicyV1beta1().PodDisruptionBudgets(metav1.NamespaceDefault).Get("test-pdb", metav1.GetOptions{})
+		if tt.wantMinAvailable == 0 {
+			if err == nil {
+				t.Errorf("#%d: PodDisruptionBudget exists, want none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if got := pdb.Spec.MinAvailable.IntValue(); got != tt.wantMinAvailable {
+			t.Errorf("#%d: minAvailable = %d, want %d", i, got, tt.wantMinAvailable)
+		}
+	}
+}
+
+func TestSetClusterStats(t *testing.T) {
+	now := time.Now()
+	stats := api.ClusterStats{Leader: "example-0000", Revision: 10, MembersHealthy: 3}
+	tests := []struct {
+		stats   api.ClusterStats
+		at      time.Time
+		wantRev int64
+	}{
+		// only the revision changed
+		{stats: api.ClusterStats{Leader: "example-0000", Revision: 11, MembersHealthy: 3}, at: now.Add(time.Minute), wantRev: 10},
+		{stats: api.ClusterStats{Leader: "example-0001", Revision: 11, MembersHealthy: 3}, at: now.Add(time.Minute), wantRev: 11},
+		{stats: api.ClusterStats{Leader: "example-0000", Revision: 11, MembersHealthy: 2}, at: now.Add(time.Minute), wantRev: 11},
+		{stats: api.ClusterStats{Leader: "example-0000", Revision: 11, MembersHealthy: 3}, at: now.Add(clusterStatsInterval), wantRev: 11},
+	}
+	for i, tt := range tests {
+		c := &Cluster{}
+		c.setClusterStats(stats, now)
+		c.setClusterStats(tt.stats, tt.at)
+		if c.status.Stats.Revision != tt.wantRev {
+			t.Errorf("#%d: revision = %d, want %d", i, c.status.Stats.Revision, tt.wantRev)
+		}
+	}
+}
+
+// fakeServiceMonitors serves the ServiceMonitors of the monitoring.coreos.com/v1
+// API, which the fake clientset cannot serve through its REST client.
+type fakeServiceMonitors struct {
+	mu      sync.Mutex
+	objs    map[string][]byte
+	creates int
+}
+
+func (f *fakeServiceMonitors) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	switch req.Method {
+	case http.MethodGet:
+		body, ok := f.objs[req.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound","code":404}`))
+			return
+		}
+		w.Write(body)
+	case http.MethodPost:
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var sm struct {
+			metav1.ObjectMeta `json:"metadata"`
+		}
+		if err := json.Unmarshal(body, &sm); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.objs[req.URL.Path+"/"+sm.Name] = body
+		f.creates++
+		w.WriteHeader(http.StatusCreated)
+		w.Write(body)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestEnsureServiceMonitor(t *testing.T) {
+	f := &fakeServiceMonitors{objs: map[string][]byte{}}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	kubecli, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Cluster{
+		logger: logrus.WithField("pkg", "cluster"),
+		config: Config{KubeCli: kubecli},
+		cluster: &api.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: metav1.NamespaceDefault},
+			Spec: api.ClusterSpec{
+				Size:                 3,
+				ExposeMetricsService: true,
+				PrometheusMonitoring: &api.PrometheusMonitoringConfig{Enabled: true, Interval: "30s"},
+			},
+		},
+	}
+	path := "/apis/monitoring.coreos.com/v1/namespaces/default/servicemonitors/test"
+	tests := []struct {
+		deleted     bool
+		wantCreates int
+	}{
+		{wantCreates: 1},
+		// an existing ServiceMonitor is left as is
+		{wantCreates: 1},
+		// a ServiceMonitor deleted by a user is created again
+		{deleted: true, wantCreates: 2},
+	}
+	for i, tt := range tests {
+		if tt.deleted {
+			f.mu.Lock()
+			delete(f.objs, path)
+			f.mu.Unlock()
+		}
+		if err := c.ensureServiceMonitor(); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+
+		f.mu.Lock()
+		creates, body := f.creates, f.objs[path]
+		f.mu.Unlock()
+		if creates != tt.wantCreates {
+			t.Errorf("#%d: creates = %d, want %d", i, creates, tt.wantCreates)
+		}
+		var sm struct {
+			Spec struct {
+				Endpoints []struct {
+					Port     string `json:"port"`
+					Interval string `json:"interval"`
+				} `json:"endpoints"`
+			} `json:"spec"`
+		}
+		if err := json.Unmarshal(body, &sm); err != nil {
+			t.Fatalf("#%d: ServiceMonitor (%s): %v", i, path, err)
+		}
+		if len(sm.Spec.Endpoints) != 1 || sm.Spec.Endpoints[0].Port != "metrics" || sm.Spec.Endpoints[0].Interval != "30s" {
+			t.Errorf("#%d: endpoints = %+v, want the metrics port scraped every 30s", i, sm.Spec.Endpoints)
+		}
+	}
+}
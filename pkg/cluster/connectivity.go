@@ -0,0 +1,68 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"net"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+)
+
+// peerDialTimeout is the timeout of a connection attempt to a member peer port.
+const peerDialTimeout = 3 * time.Second
+
+// dialPeer is overridden in tests.
+var dialPeer = func(addr string) error {
+	conn, err := net.DialTimeout("tcp", addr, peerDialTimeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// validateMemberPeerConnectivity dials the peer port of every member and emits
+// a PeerConnectivityIssue warning event for each member that cannot be reached,
+// e.g. because a network policy blocks the peer traffic.
+// The connections are made from the operator pod, since the operator cannot dial
+// from one member to another. It is meant to run in its own goroutine and only
+// reads the given members.
+func (c *Cluster) validateMemberPeerConnectivity(members []*etcdutil.Member) {
+	for _, m := range members {
+		addr := net.JoinHostPort(m.Addr(), "2380")
+		if err := dialPeer(addr); err != nil {
+			c.logger.Warningf("peer port of member (%s) is unreachable: %v", m.Name, err)
+			_, eerr := c.eventsCli.Create(k8sutil.PeerConnectivityIssueEvent("etcd-operator", m.Name, err, c.cluster))
+			if eerr != nil {
+				c.logger.Errorf("failed to create peer connectivity issue event: %v", eerr)
+			}
+		}
+	}
+}
+
+// checkPeerConnectivity starts validateMemberPeerConnectivity in the background
+// after the membership changed, once the cluster reached its size.
+func (c *Cluster) checkPeerConnectivity() {
+	if !c.membershipChanged {
+		return
+	}
+	c.membershipChanged = false
+	var members []*etcdutil.Member
+	for _, m := range c.members {
+		members = append(members, &etcdutil.Member{Name: m.Name, Namespace: m.Namespace, ClusterDomain: m.ClusterDomain})
+	}
+	go c.validateMemberPeerConnectivity(members)
+}
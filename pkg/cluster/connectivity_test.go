@@ -0,0 +1,58 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidateMemberPeerConnectivity(t *testing.T) {
+	defer func(f func(string) error) { dialPeer = f }(dialPeer)
+	dialPeer = func(addr string) error {
+		if strings.HasPrefix(addr, "test-0001.") {
+			return errors.New("i/o timeout")
+		}
+		return nil
+	}
+
+	ev := &fakeEvents{}
+	c := &Cluster{
+		logger: logrus.WithField("pkg", "cluster"),
+		cluster: &api.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: metav1.NamespaceDefault},
+		},
+		eventsCli: ev,
+	}
+	var members []*etcdutil.Member
+	for i := 0; i < 3; i++ {
+		members = append(members, &etcdutil.Member{Name: etcdutil.CreateMemberName("test", i), Namespace: metav1.NamespaceDefault})
+	}
+	c.validateMemberPeerConnectivity(members)
+
+	if len(ev.events) != 1 {
+		t.Fatalf("events = %d, want 1", len(ev.events))
+	}
+	if e := ev.events[0]; e.Reason != "PeerConnectivityIssue" || !strings.Contains(e.Message, "test-0001") {
+		t.Errorf("event = %s: %s, want PeerConnectivityIssue for test-0001", e.Reason, e.Message)
+	}
+}
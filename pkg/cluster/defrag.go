@@ -0,0 +1,149 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultDefragIntervalMinutes = 60
+	// defragTimeout is the timeout of defragmenting a single member.
+	// Defragmentation blocks the member and may take long on a large database.
+	defragTimeout = 1 * time.Minute
+	// defragMemberPause is the pause between defragmenting two members,
+	// so that members are never defragmented at the same time.
+	defragMemberPause = 30 * time.Second
+)
+
+// defragLoop periodically defragments the ready members of the cluster, one
+// member at a time, while spec.defragEnabled is set. The spec is read from the
+// snapshot of the last reconciliation on every round, so that changes to the
+// interval and the windows take effect. It returns when the cluster is deleted.
+func (c *Cluster) defragLoop() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-c.stopCh
+		cancel()
+	}()
+
+	for {
+		cl := c.snapshot()
+		minutes := cl.Spec.DefragIntervalMinutes
+		if minutes == 0 {
+			minutes = defaultDefragIntervalMinutes
+		}
+		select {
+		case <-c.stopCh:
+			return
+		case <-time.After(time.Duration(minutes) * time.Minute):
+		}
+
+		cl = c.snapshot()
+		if !shouldDefrag(cl.Spec, time.Now(), c.logger) {
+			continue
+		}
+		if err := c.defragment(ctx, cl, c.readyEtcdMembers(cl), defragMemberPause, "periodically"); err != nil {
+			c.logger.Errorf("periodic defragmentation failed: %v", err)
+		}
+	}
+}
+
+// shouldDefrag returns true if periodic defragmentation is enabled and now is
+// inside both the defrag schedule and the maintenance window.
+func shouldDefrag(cs api.ClusterSpec, now time.Time, logger *logrus.Entry) bool {
+	if !cs.DefragEnabled {
+		return false
+	}
+	if s := cs.DefragSchedule; s != nil && !s.InWindow(now) {
+		logger.Infof("skipping defragmentation outside of the defrag window (%d-%d %s)", s.StartHour, s.EndHour, s.TimeZone)
+		return false
+	}
+	if !cs.MaintenanceWindow.InWindow(now) {
+		logger.Infof("skipping defragmentation outside of the maintenance window (%s)", cs.MaintenanceWindow)
+		return false
+	}
+	return true
+}
+
+// errDefragInProgress is returned by defragment while another defragmentation
+// of the cluster runs.
+var errDefragInProgress = errors.New("another defragmentation is in progress")
+
+// defragment defragments the members one at a time, pausing for pause between
+// two members, and stops at the first failure. The periodic defragmentation,
+// the one after compaction and the one clearing a NOSPACE alarm never run at
+// the same time: defragment returns errDefragInProgress instead of waiting for
+// another one, so that it does not hold a pool worker. cl labels the metrics
+// and the dry-run plan.
+func (c *Cluster) defragment(ctx context.Context, cl *api.EtcdCluster, ms etcdutil.MemberSet, pause time.Duration, reason string) error {
+	if !atomic.CompareAndSwapInt32(&c.defragmenting, 0, 1) {
+		return errDefragInProgress
+	}
+	defer atomic.StoreInt32(&c.defragmenting, 0)
+
+	i := 0
+	for _, m := range ms {
+		if i > 0 && pause > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(pause):
+			}
+		}
+		i++
+		if err := c.defragMember(ctx, cl.Name, m); err != nil {
+			defragTotal.WithLabelValues(cl.Name, "failed").Inc()
+			return fmt.Errorf("failed to defragment member (%s) %s: %v", m.Name, reason, err)
+		}
+		c.logger.Infof("defragmented member (%s) %s", m.Name, reason)
+		defragTotal.WithLabelValues(cl.Name, "succeeded").Inc()
+	}
+	return nil
+}
+
+func (c *Cluster) defragMember(ctx context.Context, clusterName string, m *etcdutil.Member) error {
+	if c.config.DryRun {
+		c.planClusterAction(clusterName, "defragment", m.Name)
+		return nil
+	}
+	return defragmentEtcdMember(ctx, c.etcdClientConfig([]string{m.ClientURL()}), m.ClientURL())
+}
+
+// defragmentEtcdMember defragments the member serving clientURL.
+// It is overridden in tests.
+var defragmentEtcdMember = func(ctx context.Context, cfg clientv3.Config, clientURL string) error {
+	etcdcli, err := clientv3.New(cfg)
+	if err != nil {
+		return fmt.Errorf("creating etcd client failed: %v", err)
+	}
+	defer etcdcli.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, defragTimeout)
+	defer cancel()
+	_, err = etcdcli.Defragment(ctx, clientURL)
+	return err
+}
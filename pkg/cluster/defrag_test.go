@@ -0,0 +1,162 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestShouldDefrag(t *testing.T) {
+	now := time.Date(2018, 1, 1, 3, 0, 0, 0, time.UTC)
+	tests := []struct {
+		spec api.ClusterSpec
+		want bool
+	}{
+		{spec: api.ClusterSpec{}, want: false},
+		{spec: api.ClusterSpec{DefragEnabled: true}, want: true},
+		{spec: api.ClusterSpec{DefragEnabled: true, DefragSchedule: &api.DefragSchedule{StartHour: 1, EndHour: 5}}, want: true},
+		{spec: api.ClusterSpec{DefragEnabled: true, DefragSchedule: &api.DefragSchedule{StartHour: 5, EndHour: 6}}, want: false},
+		{spec: api.ClusterSpec{DefragEnabled: true, MaintenanceWindow: &api.MaintenanceWindow{StartHour: 22, EndHour: 24}}, want: false},
+	}
+	for i, tt := range tests {
+		if got := shouldDefrag(tt.spec, now, logrus.WithField("pkg", "cluster")); got != tt.want {
+			t.Errorf("#%d: shouldDefrag = %v, want %v", i, got, tt.want)
+		}
+	}
+}
+
+func TestDefragmentSerialized(t *testing.T) {
+	var running, maxRunning, calls int32
+	defer func(f func(context.Context, clientv3.Config, string) error) { defragmentEtcdMember = f }(defragmentEtcdMember)
+	defragmentEtcdMember = func(ctx context.Context, cfg clientv3.Config, clientURL string) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	}
+
+	c := &Cluster{logger: logrus.WithField("pkg", "cluster")}
+	cl := &api.EtcdCluster{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: metav1.NamespaceDefault}}
+	ms := etcdutil.NewMemberSet(&etcdutil.Member{Name: "test-0000"}, &etcdutil.Member{Name: "test-0001"})
+
+	var wg sync.WaitGroup
+	var rounds int32
+	for _, reason := range []string{"periodically", "after compaction", "to clear the NOSPACE alarm"} {
+		wg.Add(1)
+		go func(reason string) {
+			defer wg.Done()
+			switch err := c.defragment(context.Background(), cl, ms, 0, reason); err {
+			case nil:
+				atomic.AddInt32(&rounds, 1)
+			case errDefragInProgress:
+			default:
+				t.Errorf("%s: unexpected error: %v", reason, err)
+			}
+		}(reason)
+	}
+	wg.Wait()
+
+	if maxRunning != 1 {
+		t.Errorf("%d members were defragmented at the same time, want 1", maxRunning)
+	}
+	if rounds == 0 || calls != 2*rounds {
+		t.Errorf("defragmented %d times in %d rounds, want every member once per round", calls, rounds)
+	}
+
+	// A defragmentation can start once the previous one finished.
+	if err := c.defragment(context.Background(), cl, ms, 0, "periodically"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestDefragmentStopsAtFirstFailure(t *testing.T) {
+	calls := 0
+	defer func(f func(context.Context, clientv3.Config, string) error) { defragmentEtcdMember = f }(defragmentEtcdMember)
+	defragmentEtcdMember = func(ctx context.Context, cfg clientv3.Config, clientURL string) error {
+		calls++
+		return errors.New("timed out")
+	}
+
+	c := &Cluster{logger: logrus.WithField("pkg", "cluster")}
+	cl := &api.EtcdCluster{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: metav1.NamespaceDefault}}
+	ms := etcdutil.NewMemberSet(&etcdutil.Member{Name: "test-0000"}, &etcdutil.Member{Name: "test-0001"})
+	if err := c.defragment(context.Background(), cl, ms, time.Hour, "periodically"); err == nil {
+		t.Error("expect error when a member fails to defragment")
+	}
+	if calls != 1 {
+		t.Errorf("defragmented %d times, want 1", calls)
+	}
+}
+
+// The dry-run plan of the defragmentation, which runs beside the reconciliation,
+// is recorded for the cluster snapshot it is given and not for c.cluster.
+func TestDefragmentDryRunUsesSnapshot(t *testing.T) {
+	c := &Cluster{logger: logrus.WithField("pkg", "cluster"), config: Config{DryRun: true}}
+	cl := &api.EtcdCluster{ObjectMeta: metav1.ObjectMeta{Name: "defrag-dry-run", Namespace: metav1.NamespaceDefault}}
+	defer deleteDryRunPlan(cl.Name)
+	ms := etcdutil.NewMemberSet(&etcdutil.Member{Name: "defrag-dry-run-0000"})
+	if err := c.defragment(context.Background(), cl, ms, 0, "periodically"); err != nil {
+		t.Fatal(err)
+	}
+	plan := DryRunPlan(cl.Name)
+	if len(plan) != 1 || plan[0].Action != "defragment" || plan[0].Target != "defrag-dry-run-0000" {
+		t.Errorf("plan = %v, want the member to be defragmented", plan)
+	}
+}
+
+func TestSnapshotIsNotShared(t *testing.T) {
+	c := &Cluster{
+		cluster: &api.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: metav1.NamespaceDefault},
+			Spec:       api.ClusterSpec{DNSDomain: "cluster.local", Pod: &api.PodPolicy{}},
+		},
+		status: api.ClusterStatus{Members: api.MembersStatus{Ready: []string{"test-0000"}}},
+	}
+	c.storeSnapshot()
+
+	// The reconcile loop replaces and modifies the cluster after the snapshot.
+	c.cluster.Spec.Pod.EtcdEnv = append(c.cluster.Spec.Pod.EtcdEnv, v1.EnvVar{Name: envQuotaBackendBytes, Value: "1024"})
+	c.cluster = &api.EtcdCluster{Spec: api.ClusterSpec{DNSDomain: "example.com"}}
+	c.status.Members.Ready = append(c.status.Members.Ready, "test-0001")
+
+	cl := c.snapshot()
+	if q := quotaBackendBytes(cl.Spec.Pod); q != defaultQuotaBackendBytes {
+		t.Errorf("quota = %d, want the default quota of the snapshot", q)
+	}
+	ms := c.readyEtcdMembers(cl)
+	if ms.Size() != 1 || ms["test-0000"].ClusterDomain != "cluster.local" {
+		t.Errorf("ready members = %v, want test-0000 in cluster.local", ms)
+	}
+}
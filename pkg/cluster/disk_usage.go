@@ -0,0 +1,284 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/constants"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
+	"github.com/prometheus/common/expfmt"
+)
+
+const (
+	diskUsageCheckInterval = 60 * time.Second
+	// diskUsageWarningPercent is the quota usage of a member above which a warning event is emitted.
+	diskUsageWarningPercent = 80
+	// diskPressurePercent is the quota usage of a member above which the cluster is under disk pressure.
+	diskPressurePercent = 95
+	// defaultCompactionIntervalMinutes is the default minimum interval between two compactions.
+	defaultCompactionIntervalMinutes = 10
+
+	// defaultQuotaBackendBytes is the etcd default of --quota-backend-bytes, 2GB.
+	defaultQuotaBackendBytes = 2 * 1024 * 1024 * 1024
+	envQuotaBackendBytes     = "ETCD_QUOTA_BACKEND_BYTES"
+)
+
+// dbSizeMetrics are the metrics reporting the etcd db size. The first one was
+// introduced in etcd 3.3; older versions only expose the debugging one.
+var dbSizeMetrics = []string{
+	"etcd_mvcc_db_total_size_in_bytes",
+	"etcd_debugging_mvcc_db_total_size_in_bytes",
+}
+
+// monitorDiskUsage periodically checks the db size of the ready members against
+// the backend quota. It emits a warning event for each member whose usage crosses
+// diskUsageWarningPercent, and reports disk pressure above diskPressurePercent.
+// If compaction is enabled, the cluster is compacted and defragmented once a
+// member crosses diskUsageWarningPercent, see compactToRevision.
+// The spec is read from the snapshot of the last reconciliation on every check.
+// It returns when the cluster is deleted.
+func (c *Cluster) monitorDiskUsage() {
+	hc := &http.Client{
+		Timeout:   constants.DefaultRequestTimeout,
+		Transport: &http.Transport{TLSClientConfig: c.tlsConfig},
+	}
+	// warned keeps the members that are above the warning threshold,
+	// so the warning is only emitted once until the usage drops again.
+	warned := map[string]bool{}
+	var lastCompaction time.Time
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-c.stopCh
+		cancel()
+	}()
+
+	for {
+		select {
+		case <-c.stopCh:
+			return
+		case <-time.After(diskUsageCheckInterval):
+		}
+
+		cl := c.snapshot()
+		quota := quotaBackendBytes(cl.Spec.Pod)
+		ready := c.readyEtcdMembers(cl)
+		pressure, high := false, false
+		for name, m := range ready {
+			size, err := memberDBSize(hc, m.ClientURL())
+			if err != nil {
+				c.logger.Warningf("failed to get db size of member (%s): %v", name, err)
+				continue
+			}
+			percent := float64(size) / float64(quota) * 100
+
+			if percent < diskUsageWarningPercent {
+				delete(warned, name)
+				continue
+			}
+			high = true
+			if percent >= diskPressurePercent {
+				pressure = true
+			}
+			if warned[name] {
+				continue
+			}
+			warned[name] = true
+			c.logger.Warningf("member (%s) uses %.1f%% of its backend quota", name, percent)
+			_, err = c.eventsCli.Create(k8sutil.DiskUsageWarningEvent(name, percent, cl))
+			if err != nil {
+				c.logger.Errorf("failed to create disk usage warning event: %v", err)
+			}
+		}
+
+		if pressure {
+			atomic.StoreInt32(&c.diskPressure, 1)
+		} else {
+			atomic.StoreInt32(&c.diskPressure, 0)
+		}
+
+		if !shouldCompact(cl.Spec, high, lastCompaction, time.Now()) {
+			continue
+		}
+		lastCompaction = time.Now()
+		rev, err := c.currentRevision(ctx, ready.ClientURLs())
+		if err != nil {
+			c.logger.Errorf("failed to compact: %v", err)
+			continue
+		}
+		if rev <= 1 {
+			continue
+		}
+		if err := c.compactToRevision(ctx, cl, ready, rev-1); err != nil {
+			c.logger.Errorf("failed to compact: %v", err)
+		}
+	}
+}
+
+// shouldCompact returns true if compaction is enabled, the usage of a member is
+// high and the minimum compaction interval passed since the last compaction.
+func shouldCompact(cs api.ClusterSpec, high bool, last, now time.Time) bool {
+	if !cs.CompactionEnabled || !high {
+		return false
+	}
+	minutes := cs.CompactionIntervalMinutes
+	if minutes == 0 {
+		minutes = defaultCompactionIntervalMinutes
+	}
+	return now.Sub(last) >= time.Duration(minutes)*time.Minute
+}
+
+// updateDiskPressureCondition reflects the last result of monitorDiskUsage in the cluster status.
+func (c *Cluster) updateDiskPressureCondition() {
+	if atomic.LoadInt32(&c.diskPressure) == 1 {
+		c.status.SetDiskPressureCondition(fmt.Sprintf("db size of a member exceeds %d%% of its backend quota", diskPressurePercent))
+		return
+	}
+	c.status.ClearCondition(api.ClusterConditionDiskPressure)
+}
+
+// readyEtcdMembers returns the ready members of the last reconciliation of cl.
+func (c *Cluster) readyEtcdMembers(cl *api.EtcdCluster) etcdutil.MemberSet {
+	ms := etcdutil.MemberSet{}
+	ready, _ := c.readyMembers.Load().([]string)
+	for _, name := range ready {
+		ms.Add(&etcdutil.Member{
+			Name:          name,
+			Namespace:     cl.Namespace,
+			SecureClient:  cl.Spec.TLS.IsSecureClient(),
+			ClusterDomain: cl.Spec.DNSDomain,
+		})
+	}
+	return ms
+}
+
+// compactToRevision compacts the etcd keyspace up to revision rev, then
+// defragments the members ms one at a time to reclaim the freed space.
+// A keyspace already compacted beyond rev is still defragmented.
+func (c *Cluster) compactToRevision(ctx context.Context, cl *api.EtcdCluster, ms etcdutil.MemberSet, rev int64) error {
+	if ms.Size() == 0 {
+		return fmt.Errorf("no ready members")
+	}
+	if err := c.compact(ctx, cl.Name, ms.ClientURLs(), rev); err != nil {
+		return err
+	}
+	return c.defragment(ctx, cl, ms, defragMemberPause, "after compaction")
+}
+
+// currentRevision returns the current revision of the etcd keyspace.
+func (c *Cluster) currentRevision(ctx context.Context, clientURLs []string) (int64, error) {
+	etcdcli, err := c.newEtcdClient(clientURLs)
+	if err != nil {
+		return 0, err
+	}
+	defer etcdcli.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, constants.DefaultRequestTimeout)
+	defer cancel()
+	resp, err := etcdcli.Get(ctx, "/", clientv3.WithSerializable())
+	if err != nil {
+		return 0, fmt.Errorf("failed to get current revision: %v", err)
+	}
+	return resp.Header.Revision, nil
+}
+
+// compact compacts the etcd keyspace of the cluster clusterName up to revision rev.
+// A keyspace already compacted beyond rev is left as is.
+func (c *Cluster) compact(ctx context.Context, clusterName string, clientURLs []string, rev int64) error {
+	if c.config.DryRun {
+		c.planClusterAction(clusterName, fmt.Sprintf("compact to revision %d", rev), clusterName)
+		return nil
+	}
+	etcdcli, err := c.newEtcdClient(clientURLs)
+	if err != nil {
+		return err
+	}
+	defer etcdcli.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, constants.DefaultRequestTimeout)
+	defer cancel()
+	_, err = etcdcli.Compact(ctx, rev, clientv3.WithCompactPhysical())
+	switch err {
+	case nil:
+		c.logger.Infof("compacted etcd keyspace to revision (%d)", rev)
+	case rpctypes.ErrCompacted:
+		c.logger.Infof("etcd keyspace is already compacted beyond revision (%d)", rev)
+	default:
+		return fmt.Errorf("failed to compact to revision (%d): %v", rev, err)
+	}
+	return nil
+}
+
+func (c *Cluster) newEtcdClient(clientURLs []string) (*clientv3.Client, error) {
+	etcdcli, err := clientv3.New(c.etcdClientConfig(clientURLs))
+	if err != nil {
+		return nil, fmt.Errorf("creating etcd client failed: %v", err)
+	}
+	return etcdcli, nil
+}
+
+// memberDBSize scrapes the db size of the member from its metrics endpoint.
+func memberDBSize(hc *http.Client, clientURL string) (int64, error) {
+	resp, err := hc.Get(clientURL + "/metrics")
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status code (%d) from metrics endpoint", resp.StatusCode)
+	}
+
+	var parser expfmt.TextParser
+	mfs, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse metrics: %v", err)
+	}
+	for _, name := range dbSizeMetrics {
+		mf, ok := mfs[name]
+		if !ok || len(mf.GetMetric()) == 0 {
+			continue
+		}
+		return int64(mf.GetMetric()[0].GetGauge().GetValue()), nil
+	}
+	return 0, fmt.Errorf("no db size metric found")
+}
+
+// quotaBackendBytes returns the backend quota of the members,
+// which can be overridden through the etcd environment variables of the pod policy.
+func quotaBackendBytes(p *api.PodPolicy) int64 {
+	if p != nil {
+		for _, e := range p.EtcdEnv {
+			if e.Name != envQuotaBackendBytes {
+				continue
+			}
+			if q, err := strconv.ParseInt(e.Value, 10, 64); err == nil && q > 0 {
+				return q
+			}
+		}
+	}
+	return defaultQuotaBackendBytes
+}
@@ -0,0 +1,70 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestShouldCompact(t *testing.T) {
+	now := time.Now()
+	enabled := api.ClusterSpec{CompactionEnabled: true}
+	tests := []struct {
+		spec api.ClusterSpec
+		high bool
+		last time.Time
+		want bool
+	}{
+		{spec: enabled, high: true, want: true},
+		{spec: enabled, high: false},
+		{spec: api.ClusterSpec{}, high: true},
+		// within the default interval of 10 minutes
+		{spec: enabled, high: true, last: now.Add(-5 * time.Minute)},
+		{spec: enabled, high: true, last: now.Add(-10 * time.Minute), want: true},
+		{
+			spec: api.ClusterSpec{CompactionEnabled: true, CompactionIntervalMinutes: 2},
+			high: true, last: now.Add(-5 * time.Minute), want: true,
+		},
+	}
+	for i, tt := range tests {
+		if got := shouldCompact(tt.spec, tt.high, tt.last, now); got != tt.want {
+			t.Errorf("#%d: shouldCompact = %v, want %v", i, got, tt.want)
+		}
+	}
+}
+
+// monitorDiskUsage compacts beside the reconciliation, so the dry-run plan is
+// recorded for its snapshot of the cluster and not for c.cluster.
+func TestCompactToRevisionDryRunUsesSnapshot(t *testing.T) {
+	c := &Cluster{logger: logrus.WithField("pkg", "cluster"), config: Config{DryRun: true}}
+	cl := &api.EtcdCluster{ObjectMeta: metav1.ObjectMeta{Name: "compact-dry-run", Namespace: metav1.NamespaceDefault}}
+	defer deleteDryRunPlan(cl.Name)
+	ms := etcdutil.NewMemberSet(&etcdutil.Member{Name: "compact-dry-run-0000"})
+	if err := c.compactToRevision(context.Background(), cl, ms, 42); err != nil {
+		t.Fatal(err)
+	}
+	plan := DryRunPlan(cl.Name)
+	if len(plan) != 2 || plan[0].Action != "compact to revision 42" || plan[0].Target != cl.Name {
+		t.Errorf("plan = %v, want the compaction and the defragmentation", plan)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DryRunHTTPPath is the path prefix under which the actions planned for a
+// cluster in dry-run mode are served, followed by the cluster name.
+const DryRunHTTPPath = "/debug/dry-run/"
+
+// maxPlannedActions is the number of most recent actions kept per cluster.
+const maxPlannedActions = 100
+
+// PlannedAction is an action a cluster in dry-run mode would have taken.
+type PlannedAction struct {
+	// Time is when the action was last planned.
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	Target string    `json:"target"`
+}
+
+var dryRunPlans = struct {
+	sync.Mutex
+	m map[string][]PlannedAction
+}{m: map[string][]PlannedAction{}}
+
+// planAction logs and records an action instead of taking it in dry-run mode.
+// An action planned again on every reconciliation is recorded once.
+func (c *Cluster) planAction(action, target string) {
+	c.planClusterAction(c.cluster.Name, action, target)
+}
+
+// planClusterAction is planAction for the goroutines running beside the
+// reconciliation, which must not read c.cluster; they pass the name of their
+// snapshot of the cluster.
+func (c *Cluster) planClusterAction(clusterName, action, target string) {
+	c.logger.Infof("dry run: would %s (%s)", action, target)
+
+	dryRunPlans.Lock()
+	defer dryRunPlans.Unlock()
+	plan := dryRunPlans.m[clusterName]
+	if n := len(plan); n != 0 && plan[n-1].Action == action && plan[n-1].Target == target {
+		plan[n-1].Time = time.Now()
+		return
+	}
+	plan = append(plan, PlannedAction{Time: time.Now(), Action: action, Target: target})
+	if len(plan) > maxPlannedActions {
+		plan = plan[len(plan)-maxPlannedActions:]
+	}
+	dryRunPlans.m[clusterName] = plan
+}
+
+// deleteDryRunPlan forgets the actions planned for a deleted cluster.
+func deleteDryRunPlan(clusterName string) {
+	dryRunPlans.Lock()
+	defer dryRunPlans.Unlock()
+	delete(dryRunPlans.m, clusterName)
+}
+
+// DryRunPlan returns the actions planned for the cluster in dry-run mode.
+func DryRunPlan(clusterName string) []PlannedAction {
+	dryRunPlans.Lock()
+	defer dryRunPlans.Unlock()
+	return append([]PlannedAction(nil), dryRunPlans.m[clusterName]...)
+}
+
+// ServeDryRunPlan serves the actions planned for the cluster named in the path as JSON.
+func ServeDryRunPlan(w http.ResponseWriter, req *http.Request) {
+	name := strings.TrimPrefix(req.URL.Path, DryRunHTTPPath)
+	if len(name) == 0 {
+		http.Error(w, "cluster name is required", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(DryRunPlan(name)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDryRunPlan(t *testing.T) {
+	c := &Cluster{
+		logger:  logrus.WithField("pkg", "cluster"),
+		config:  Config{DryRun: true},
+		cluster: &api.EtcdCluster{ObjectMeta: metav1.ObjectMeta{Name: "dry-run-test"}},
+	}
+	// planned again on the next reconciliation
+	for i := 0; i < 2; i++ {
+		if err := c.removePod("dry-run-test-0000"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.planAction("add member", "dry-run-test-0003")
+
+	rec := httptest.NewRecorder()
+	ServeDryRunPlan(rec, httptest.NewRequest("GET", DryRunHTTPPath+"dry-run-test", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status code = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var plan []PlannedAction
+	if err := json.NewDecoder(rec.Body).Decode(&plan); err != nil {
+		t.Fatal(err)
+	}
+	want := []PlannedAction{
+		{Action: "delete pod", Target: "dry-run-test-0000"},
+		{Action: "add member", Target: "dry-run-test-0003"},
+	}
+	if len(plan) != len(want) {
+		t.Fatalf("plan = %v, want %v", plan, want)
+	}
+	for i := range want {
+		if plan[i].Action != want[i].Action || plan[i].Target != want[i].Target {
+			t.Errorf("#%d: action = %s (%s), want %s (%s)", i, plan[i].Action, plan[i].Target, want[i].Action, want[i].Target)
+		}
+	}
+}
+
+func TestDryRunNoWrites(t *testing.T) {
+	kubecli := fake.NewSimpleClientset()
+	// EtcdCRCli is nil: a CR update would panic.
+	c := &Cluster{
+		logger: logrus.WithField("pkg", "cluster"),
+		config: Config{KubeCli: kubecli, DryRun: true},
+		cluster: &api.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "dry-run-writes", Namespace: metav1.NamespaceDefault},
+			Spec:       api.ClusterSpec{Pod: &api.PodPolicy{Annotations: map[string]string{"example.com/owner": "storage"}}},
+		},
+		status: api.ClusterStatus{Phase: api.ClusterPhaseRunning},
+	}
+
+	if err := c.updateCRStatus(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.reconcileConfigMap(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.annotatePod("dry-run-writes-0000"); err != nil {
+		t.Fatal(err)
+	}
+	c.updatePeerService()
+	for _, a := range kubecli.Actions() {
+		if a.GetVerb() != "get" && a.GetVerb() != "list" {
+			t.Errorf("dry run sent a %s request for %s", a.GetVerb(), a.GetResource().Resource)
+		}
+	}
+	if len(DryRunPlan(c.cluster.Name)) == 0 {
+		t.Error("no actions were planned")
+	}
+
+	deleteDryRunPlan(c.cluster.Name)
+	if plan := DryRunPlan(c.cluster.Name); len(plan) != 0 {
+		t.Errorf("plan of the deleted cluster = %v, want none", plan)
+	}
+}
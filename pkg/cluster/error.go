@@ -16,6 +16,7 @@ package cluster
 
 import (
 	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 )
 
 var (
@@ -42,3 +43,13 @@ func isFatalError(err error) bool {
 		return false
 	}
 }
+
+// isTransientError returns true if err is caused by an API server error that is
+// expected to go away by itself, e.g. throttling or a server timeout.
+func isTransientError(err error) bool {
+	cause := errors.Cause(err)
+	return apierrors.IsTooManyRequests(cause) ||
+		apierrors.IsServerTimeout(cause) ||
+		apierrors.IsTimeout(cause) ||
+		apierrors.IsInternalError(cause)
+}
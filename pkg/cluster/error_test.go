@@ -18,6 +18,8 @@ import (
 	"testing"
 
 	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 func TestWrapFatalError(t *testing.T) {
@@ -46,3 +48,30 @@ func TestWrapFatalError(t *testing.T) {
 		}
 	}
 }
+
+func TestIsTransientError(t *testing.T) {
+	gr := schema.GroupResource{Resource: "pods"}
+	tests := []struct {
+		err         error
+		isTransient bool
+	}{{
+		err:         apierrors.NewTooManyRequests("throttled", 1),
+		isTransient: true,
+	}, {
+		err:         errors.Wrap(apierrors.NewServerTimeout(gr, "list", 1), "wrap"),
+		isTransient: true,
+	}, {
+		err:         apierrors.NewNotFound(gr, "pod"),
+		isTransient: false,
+	}, {
+		err:         errors.New("not transient"),
+		isTransient: false,
+	}}
+
+	for i, tt := range tests {
+		tr := isTransientError(tt.err)
+		if tr != tt.isTransient {
+			t.Errorf("#%d: isTransient want=%v, get=%v", i, tt.isTransient, tr)
+		}
+	}
+}
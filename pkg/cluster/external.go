@@ -0,0 +1,87 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/coreos/etcd-operator/pkg/util/constants"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"github.com/coreos/etcd/clientv3"
+)
+
+// joinExternalCluster adds the first member of a new cluster to the existing
+// etcd cluster at spec.externalEndpoints.
+func (c *Cluster) joinExternalCluster() error {
+	etcdcli, err := clientv3.New(c.etcdClientConfig(c.cluster.Spec.ExternalEndpoints))
+	if err != nil {
+		return fmt.Errorf("join external cluster failed: creating etcd client failed %v", err)
+	}
+	defer etcdcli.Close()
+
+	m := c.newMember(c.memberCounter)
+	ctx, cancel := context.WithTimeout(context.Background(), constants.DefaultRequestTimeout)
+	resp, err := etcdcli.MemberAdd(ctx, []string{m.PeerURL()})
+	cancel()
+	if err != nil {
+		return fmt.Errorf("fail to add member (%s) to external cluster: %v", m.Name, err)
+	}
+	m.ID = resp.Member.ID
+
+	ms := etcdutil.NewMemberSet(m)
+	if err := c.createPod(ms, m, "existing"); err != nil {
+		return fmt.Errorf("failed to create member (%s) of external cluster: %v", m.Name, err)
+	}
+	c.memberCounter++
+	c.members = ms
+	c.logger.Infof("cluster created with member (%s) joining external cluster (%v)", m.Name, c.cluster.Spec.ExternalEndpoints)
+	_, err = c.eventsCli.Create(k8sutil.NewMemberAddEvent(m.Name, c.cluster))
+	if err != nil {
+		c.logger.Errorf("failed to create new member add event: %v", err)
+	}
+	return nil
+}
+
+// externalInitialCluster returns the initial cluster of member m joining a
+// cluster with external members. etcd requires it to list every member, so it
+// is built from the current membership rather than from c.members.
+func (c *Cluster) externalInitialCluster(m *etcdutil.Member) ([]string, error) {
+	endpoints := append([]string{}, c.cluster.Spec.ExternalEndpoints...)
+	endpoints = append(endpoints, c.members.ClientURLs()...)
+	resp, err := etcdutil.ListMembers(endpoints, c.tlsConfig, c.etcdCredentials())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list members of external cluster: %v", err)
+	}
+
+	var initialCluster []string
+	for _, mem := range resp.Members {
+		name := mem.Name
+		for _, purl := range mem.PeerURLs {
+			if purl == m.PeerURL() {
+				name = m.Name
+			}
+		}
+		if len(name) == 0 {
+			return nil, fmt.Errorf("member (%x) has not started yet", mem.ID)
+		}
+		for _, purl := range mem.PeerURLs {
+			initialCluster = append(initialCluster, fmt.Sprintf("%s=%s", name, purl))
+		}
+	}
+	return initialCluster, nil
+}
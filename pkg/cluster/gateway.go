@@ -0,0 +1,53 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+)
+
+// syncGateway creates the etcd gateway of the cluster and updates its replicas
+// and image if it is enabled, and deletes it otherwise.
+func (c *Cluster) syncGateway() error {
+	name := k8sutil.GatewayName(c.cluster.Name)
+	if c.config.DryRun {
+		c.planAction("sync gateway", name)
+		return nil
+	}
+	if !c.cluster.Spec.GatewayEnabled {
+		if err := k8sutil.DeleteGateway(c.config.KubeCli, c.cluster.Name, c.cluster.Namespace); err != nil {
+			return err
+		}
+		c.logger.Infof("deleted etcd gateway (%s)", name)
+		return nil
+	}
+	if err := k8sutil.CreateGateway(c.config.KubeCli, c.cluster.Name, c.cluster.Namespace, c.cluster.Spec, c.cluster.AsOwner()); err != nil {
+		return err
+	}
+	return k8sutil.UpdateGateway(c.config.KubeCli, c.cluster.Name, c.cluster.Namespace, c.cluster.Spec)
+}
+
+func isGatewaySpecEqual(s1, s2 api.ClusterSpec) bool {
+	if s1.GatewayEnabled != s2.GatewayEnabled {
+		return false
+	}
+	if !s1.GatewayEnabled {
+		return true
+	}
+	return k8sutil.GatewayReplicas(s1) == k8sutil.GatewayReplicas(s2) &&
+		k8sutil.ImageName(s1.Repository, s1.Version) == k8sutil.ImageName(s2.Repository, s2.Version) &&
+		s1.ImagePullPolicy == s2.ImagePullPolicy
+}
@@ -0,0 +1,74 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/coreos/etcd-operator/pkg/util/constants"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+
+	"github.com/coreos/etcd/clientv3"
+)
+
+// identifyEtcdLeader returns the member that is the etcd leader, asking the members
+// for their status in turn. The leader is cached in c.leaderMember until the next
+// reconcile tick.
+func (c *Cluster) identifyEtcdLeader(ctx context.Context) (*etcdutil.Member, error) {
+	if c.leaderMember != nil {
+		return c.leaderMember, nil
+	}
+
+	etcdcli, err := clientv3.New(c.etcdClientConfig(c.members.ClientURLs()))
+	if err != nil {
+		return nil, fmt.Errorf("creating etcd client failed: %v", err)
+	}
+	defer etcdcli.Close()
+
+	for _, m := range c.members {
+		sctx, cancel := context.WithTimeout(ctx, constants.DefaultRequestTimeout)
+		resp, err := etcdcli.Status(sctx, m.ClientURL())
+		cancel()
+		if err != nil {
+			c.logger.Warningf("failed to get status of member (%s): %v", m.Name, err)
+			continue
+		}
+		if leader := leaderFromStatus(c.members, m, resp.Header.MemberId, resp.Leader); leader != nil {
+			c.leaderMember = leader
+			return leader, nil
+		}
+	}
+	return nil, errors.New("no etcd leader found")
+}
+
+// leaderFromStatus returns the leader given the status reported by member m:
+// m itself if it is the leader, otherwise the member with the leader ID.
+// It returns nil if there is no leader or its ID is not known yet.
+func leaderFromStatus(ms etcdutil.MemberSet, m *etcdutil.Member, memberID, leaderID uint64) *etcdutil.Member {
+	if leaderID == 0 {
+		return nil
+	}
+	if memberID == leaderID {
+		return m
+	}
+	for _, lm := range ms {
+		if lm.ID == leaderID {
+			return lm
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"testing"
+
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+)
+
+func TestLeaderFromStatus(t *testing.T) {
+	m0 := &etcdutil.Member{Name: "test-0000", ID: 1}
+	m1 := &etcdutil.Member{Name: "test-0001", ID: 2}
+	m2 := &etcdutil.Member{Name: "test-0002"}
+	ms := etcdutil.NewMemberSet(m0, m1, m2)
+
+	tests := []struct {
+		queried  *etcdutil.Member
+		memberID uint64
+		leaderID uint64
+		want     *etcdutil.Member
+	}{
+		// the queried member is the leader, even if its ID is not known
+		{m2, 3, 3, m2},
+		{m0, 1, 2, m1},
+		// leader ID not known in the member set
+		{m0, 1, 3, nil},
+		// no leader
+		{m0, 1, 0, nil},
+	}
+	for i, tt := range tests {
+		if got := leaderFromStatus(ms, tt.queried, tt.memberID, tt.leaderID); got != tt.want {
+			t.Errorf("#%d: leader = %v, want %v", i, got, tt.want)
+		}
+	}
+}
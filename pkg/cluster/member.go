@@ -20,19 +20,42 @@ import (
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
 	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
 	"github.com/coreos/etcd/etcdserver/etcdserverpb"
 	"github.com/pkg/errors"
 
 	"k8s.io/api/core/v1"
 )
 
+// listEtcdMembers and removeEtcdMember are the etcd membership calls of
+// updateMembers, rotateMemberName and removeMember. Tests replace them.
+var (
+	listEtcdMembers  = etcdutil.ListMembers
+	removeEtcdMember = etcdutil.RemoveMember
+)
+
 func (c *Cluster) updateMembers(known etcdutil.MemberSet) error {
-	resp, err := etcdutil.ListMembers(known.ClientURLs(), c.tlsConfig)
+	resp, err := listEtcdMembers(known.ClientURLs(), c.tlsConfig, c.etcdCredentials())
 	if err != nil {
 		return err
 	}
+	if len(resp.Members) > c.desiredSize() {
+		removed, err := c.checkAndRemoveDuplicateMembers(known)
+		if err != nil {
+			c.logger.Warningf("failed to remove duplicate members: %v", err)
+		}
+		if removed != 0 {
+			resp, err = listEtcdMembers(known.ClientURLs(), c.tlsConfig, c.etcdCredentials())
+			if err != nil {
+				return err
+			}
+		}
+	}
 	members := etcdutil.MemberSet{}
 	for _, m := range resp.Members {
+		if len(c.cluster.Spec.ExternalEndpoints) != 0 && !c.isManagedMember(m) {
+			continue
+		}
 		name, err := getMemberName(m, c.cluster.GetName(), c.cluster.Spec.SelfHosted)
 		if err != nil {
 			return errors.Wrap(err, "get member name failed")
@@ -46,31 +69,191 @@ func (c *Cluster) updateMembers(known etcdutil.MemberSet) error {
 		}
 
 		members[name] = &etcdutil.Member{
-			Name:         name,
-			Namespace:    c.cluster.Namespace,
-			ID:           m.ID,
-			SecurePeer:   c.isSecurePeer(),
-			SecureClient: c.isSecureClient(),
+			Name:          name,
+			Namespace:     c.cluster.Namespace,
+			ID:            m.ID,
+			SecurePeer:    c.isSecurePeer(),
+			SecureClient:  c.isSecureClient(),
+			ClusterDomain: c.cluster.Spec.DNSDomain,
 		}
 	}
 	c.members = members
 	return nil
 }
 
+// checkAndRemoveDuplicateMembers removes the etcd members that share their
+// member name with another member, e.g. after two reconciliations added the
+// same member, and returns how many were removed. Only the etcd membership is
+// removed; the pod of the name belongs to the member that is kept.
+func (c *Cluster) checkAndRemoveDuplicateMembers(known etcdutil.MemberSet) (int, error) {
+	resp, err := listEtcdMembers(known.ClientURLs(), c.tlsConfig, c.etcdCredentials())
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, m := range c.pickDuplicateMembers(resp.Members) {
+		if c.config.DryRun {
+			c.planAction("remove duplicate member", fmt.Sprintf("%x", m.ID))
+			continue
+		}
+		if err := removeEtcdMember(known.ClientURLs(), c.tlsConfig, c.etcdCredentials(), m.ID); err != nil && err != rpctypes.ErrMemberNotFound {
+			return removed, fmt.Errorf("failed to remove duplicate member (%x): %v", m.ID, err)
+		}
+		c.logger.Infof("removed duplicate member (%x) with peer URLs %v", m.ID, m.PeerURLs)
+		removed++
+	}
+	return removed, nil
+}
+
+// pickDuplicateMembers returns the members to remove among the members of ms
+// that share a member name. Of each name, the newest member is kept: the one
+// that has started, as the other never joined, or else the one with the peer
+// URL the operator would add the member with now. Members that cannot be told
+// apart this way are left for the user to resolve.
+func (c *Cluster) pickDuplicateMembers(ms []*etcdserverpb.Member) []*etcdserverpb.Member {
+	var names []string
+	byName := map[string][]*etcdserverpb.Member{}
+	for _, m := range ms {
+		if len(c.cluster.Spec.ExternalEndpoints) != 0 && !c.isManagedMember(m) {
+			continue
+		}
+		name, err := getMemberName(m, c.cluster.GetName(), c.cluster.Spec.SelfHosted)
+		if err != nil {
+			continue
+		}
+		if _, ok := byName[name]; !ok {
+			names = append(names, name)
+		}
+		byName[name] = append(byName[name], m)
+	}
+
+	var dups []*etcdserverpb.Member
+	for _, name := range names {
+		group := byName[name]
+		if len(group) < 2 {
+			continue
+		}
+		expected := &etcdutil.Member{
+			Name:          name,
+			Namespace:     c.cluster.Namespace,
+			SecurePeer:    c.isSecurePeer(),
+			ClusterDomain: c.cluster.Spec.DNSDomain,
+		}
+		keep := newestMember(group, expected.PeerURL())
+		if keep == nil {
+			c.logger.Warningf("cannot tell which of the %d members named (%s) to keep", len(group), name)
+			continue
+		}
+		for _, m := range group {
+			if m != keep {
+				dups = append(dups, m)
+			}
+		}
+	}
+	return dups
+}
+
+// newestMember returns the only started member of group, or else the only one
+// with peerURL, or nil.
+func newestMember(group []*etcdserverpb.Member, peerURL string) *etcdserverpb.Member {
+	var started []*etcdserverpb.Member
+	for _, m := range group {
+		if len(m.Name) != 0 {
+			started = append(started, m)
+		}
+	}
+	if len(started) == 1 {
+		return started[0]
+	}
+	if len(started) > 1 {
+		group = started
+	}
+	var keep *etcdserverpb.Member
+	for _, m := range group {
+		if len(m.PeerURLs) == 0 || m.PeerURLs[0] != peerURL {
+			continue
+		}
+		if keep != nil {
+			return nil
+		}
+		keep = m
+	}
+	return keep
+}
+
 func (c *Cluster) newMember(id int) *etcdutil.Member {
 	name := etcdutil.CreateMemberName(c.cluster.Name, id)
 	return &etcdutil.Member{
-		Name:         name,
-		Namespace:    c.cluster.Namespace,
-		SecurePeer:   c.isSecurePeer(),
-		SecureClient: c.isSecureClient(),
+		Name:          name,
+		Namespace:     c.cluster.Namespace,
+		SecurePeer:    c.isSecurePeer(),
+		SecureClient:  c.isSecureClient(),
+		ClusterDomain: c.cluster.Spec.DNSDomain,
+	}
+}
+
+// rotateMemberName removes the member named oldName from the etcd cluster and
+// verifies that the member named newName, which replaces it, is in the member list.
+// The membership is queried through the new member.
+func (c *Cluster) rotateMemberName(oldName, newName string) error {
+	nm := &etcdutil.Member{
+		Name:          newName,
+		Namespace:     c.cluster.Namespace,
+		SecureClient:  c.isSecureClient(),
+		ClusterDomain: c.cluster.Spec.DNSDomain,
+	}
+	clientURLs := []string{nm.ClientURL()}
+
+	resp, err := listEtcdMembers(clientURLs, c.tlsConfig, c.etcdCredentials())
+	if err != nil {
+		return fmt.Errorf("rotate member name (%s -> %s): list members failed: %v", oldName, newName, err)
+	}
+	for _, m := range resp.Members {
+		if m.Name != oldName {
+			continue
+		}
+		err = removeEtcdMember(clientURLs, c.tlsConfig, c.etcdCredentials(), m.ID)
+		if err != nil && err != rpctypes.ErrMemberNotFound {
+			return fmt.Errorf("rotate member name (%s -> %s): remove member failed: %v", oldName, newName, err)
+		}
+		c.logger.Infof("removed member (%s) with ID (%d), replaced by (%s)", oldName, m.ID, newName)
+	}
+
+	resp, err = listEtcdMembers(clientURLs, c.tlsConfig, c.etcdCredentials())
+	if err != nil {
+		return fmt.Errorf("rotate member name (%s -> %s): list members failed: %v", oldName, newName, err)
+	}
+	for _, m := range resp.Members {
+		if m.Name == newName {
+			return nil
+		}
+	}
+	return fmt.Errorf("rotate member name (%s -> %s): new member not found in member list", oldName, newName)
+}
+
+// isManagedMember returns true if the peer URL of the etcd member m is the one of
+// a member pod of the cluster, i.e. the member is not one of the external members.
+func (c *Cluster) isManagedMember(m *etcdserverpb.Member) bool {
+	if len(m.PeerURLs) == 0 {
+		return false
+	}
+	name, err := etcdutil.MemberNameFromPeerURL(m.PeerURLs[0])
+	if err != nil || !strings.HasPrefix(name, c.cluster.Name+"-") {
+		return false
+	}
+	pm := &etcdutil.Member{
+		Name:          name,
+		Namespace:     c.cluster.Namespace,
+		SecurePeer:    c.isSecurePeer(),
+		ClusterDomain: c.cluster.Spec.DNSDomain,
 	}
+	return m.PeerURLs[0] == pm.PeerURL()
 }
 
-func podsToMemberSet(pods []*v1.Pod, sc bool) etcdutil.MemberSet {
+func podsToMemberSet(pods []*v1.Pod, sc bool, domain string) etcdutil.MemberSet {
 	members := etcdutil.MemberSet{}
 	for _, pod := range pods {
-		m := &etcdutil.Member{Name: pod.Name, Namespace: pod.Namespace, SecureClient: sc}
+		m := &etcdutil.Member{Name: pod.Name, Namespace: pod.Namespace, SecureClient: sc, ClusterDomain: domain}
 		members.Add(m)
 	}
 	return members
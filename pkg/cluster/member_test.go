@@ -0,0 +1,242 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"crypto/tls"
+	"fmt"
+	"reflect"
+	"testing"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/etcdserverpb"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeMembership is an in-memory etcd membership that records the calls made to it.
+type fakeMembership struct {
+	members []*etcdserverpb.Member
+	calls   []string
+}
+
+func (f *fakeMembership) list(clientURLs []string, tc *tls.Config, cred *etcdutil.Credentials) (*clientv3.MemberListResponse, error) {
+	f.calls = append(f.calls, "list")
+	return &clientv3.MemberListResponse{Members: f.members}, nil
+}
+
+func (f *fakeMembership) remove(clientURLs []string, tc *tls.Config, cred *etcdutil.Credentials, id uint64) error {
+	f.calls = append(f.calls, fmt.Sprintf("remove %d", id))
+	for i, m := range f.members {
+		if m.ID == id {
+			f.members = append(f.members[:i], f.members[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("member %d not found", id)
+}
+
+func (f *fakeMembership) add(clientURLs []string, tc *tls.Config, cred *etcdutil.Credentials, peerURL string) (uint64, error) {
+	f.calls = append(f.calls, "add")
+	var id uint64
+	for _, m := range f.members {
+		if m.ID > id {
+			id = m.ID
+		}
+	}
+	id++
+	f.members = append(f.members, &etcdserverpb.Member{ID: id, PeerURLs: []string{peerURL}})
+	return id, nil
+}
+
+func TestRotateMemberName(t *testing.T) {
+	tests := []struct {
+		members   []*etcdserverpb.Member
+		wantCalls []string
+		wantErr   bool
+	}{
+		// the old member is removed and the new member is verified
+		{
+			members:   []*etcdserverpb.Member{{ID: 1, Name: "boot"}, {ID: 2, Name: "test-0000"}},
+			wantCalls: []string{"list", "remove 1", "list"},
+		},
+		// the old member is already gone
+		{
+			members:   []*etcdserverpb.Member{{ID: 2, Name: "test-0000"}},
+			wantCalls: []string{"list", "list"},
+		},
+		// the new member never joined
+		{
+			members:   []*etcdserverpb.Member{{ID: 1, Name: "boot"}},
+			wantCalls: []string{"list", "remove 1", "list"},
+			wantErr:   true,
+		},
+	}
+
+	origList, origRemove := listEtcdMembers, removeEtcdMember
+	defer func() {
+		listEtcdMembers, removeEtcdMember = origList, origRemove
+	}()
+
+	for i, tt := range tests {
+		f := &fakeMembership{members: tt.members}
+		listEtcdMembers = f.list
+		removeEtcdMember = f.remove
+
+		c := &Cluster{
+			logger: logrus.WithField("pkg", "cluster"),
+			cluster: &api.EtcdCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: metav1.NamespaceDefault},
+			},
+		}
+		err := c.rotateMemberName("boot", "test-0000")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("#%d: want error %v, get %v", i, tt.wantErr, err)
+		}
+		if !reflect.DeepEqual(f.calls, tt.wantCalls) {
+			t.Errorf("#%d: want calls %v, get %v", i, tt.wantCalls, f.calls)
+		}
+	}
+}
+
+func TestIsManagedMember(t *testing.T) {
+	tests := []struct {
+		peerURL string
+		want    bool
+	}{
+		{"http://test-0001.test.default.svc:2380", true},
+		{"http://10.0.0.5:2380", false},
+		{"http://test-1.example.com:2380", false},
+		{"http://other-0000.other.default.svc:2380", false},
+		{"https://test-0001.test.default.svc:2380", false},
+	}
+	c := &Cluster{
+		cluster: &api.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: metav1.NamespaceDefault},
+		},
+	}
+	for i, tt := range tests {
+		m := &etcdserverpb.Member{PeerURLs: []string{tt.peerURL}}
+		if get := c.isManagedMember(m); get != tt.want {
+			t.Errorf("#%d: isManagedMember(%s) = %v, want %v", i, tt.peerURL, get, tt.want)
+		}
+	}
+}
+
+func TestStaleMembers(t *testing.T) {
+	newSet := func(ids ...int) etcdutil.MemberSet {
+		ms := etcdutil.MemberSet{}
+		for _, id := range ids {
+			ms.Add(&etcdutil.Member{Name: etcdutil.CreateMemberName("test", id)})
+		}
+		return ms
+	}
+	tests := []struct {
+		members etcdutil.MemberSet
+		running etcdutil.MemberSet
+		want    etcdutil.MemberSet
+	}{
+		{newSet(0, 1, 2), newSet(0, 1, 2), etcdutil.MemberSet{}},
+		{newSet(0, 1, 2), newSet(0, 1), newSet(2)},
+		{newSet(0, 1, 2, 3, 4), newSet(0, 1, 2), newSet(3, 4)},
+		// an unexpected running pod does not count towards the majority
+		{newSet(0, 1, 2), newSet(0, 3), nil},
+		// lost quorum
+		{newSet(0, 1, 2), newSet(0), nil},
+	}
+	for i, tt := range tests {
+		got := staleMembers(tt.members, tt.running)
+		if !got.IsEqual(tt.want) {
+			t.Errorf("#%d: stale members = %v, want %v", i, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateMembersRemovesDuplicates(t *testing.T) {
+	peerURL := func(scheme string, id int) []string {
+		return []string{fmt.Sprintf("%s://test-%04d.test.default.svc:2380", scheme, id)}
+	}
+	tests := []struct {
+		members   []*etcdserverpb.Member
+		wantCalls []string
+		wantIDs   map[string]uint64
+	}{
+		// the duplicate that never started is removed
+		{
+			members: []*etcdserverpb.Member{
+				{ID: 1, Name: "test-0000", PeerURLs: peerURL("http", 0)},
+				{ID: 2, Name: "test-0001", PeerURLs: peerURL("http", 1)},
+				{ID: 3, PeerURLs: peerURL("https", 1)},
+			},
+			wantCalls: []string{"list", "list", "remove 3", "list"},
+			wantIDs:   map[string]uint64{"test-0000": 1, "test-0001": 2},
+		},
+		// neither started; the one with the expected peer URL is kept
+		{
+			members: []*etcdserverpb.Member{
+				{ID: 1, Name: "test-0000", PeerURLs: peerURL("http", 0)},
+				{ID: 2, PeerURLs: peerURL("https", 1)},
+				{ID: 3, PeerURLs: peerURL("http", 1)},
+			},
+			wantCalls: []string{"list", "list", "remove 2", "list"},
+			wantIDs:   map[string]uint64{"test-0000": 1, "test-0001": 3},
+		},
+		// no duplicates
+		{
+			members: []*etcdserverpb.Member{
+				{ID: 1, Name: "test-0000", PeerURLs: peerURL("http", 0)},
+				{ID: 2, Name: "test-0001", PeerURLs: peerURL("http", 1)},
+				{ID: 3, Name: "test-0002", PeerURLs: peerURL("http", 2)},
+			},
+			wantCalls: []string{"list", "list"},
+			wantIDs:   map[string]uint64{"test-0000": 1, "test-0001": 2, "test-0002": 3},
+		},
+	}
+
+	origList, origRemove := listEtcdMembers, removeEtcdMember
+	defer func() {
+		listEtcdMembers, removeEtcdMember = origList, origRemove
+	}()
+
+	for i, tt := range tests {
+		f := &fakeMembership{members: tt.members}
+		listEtcdMembers = f.list
+		removeEtcdMember = f.remove
+
+		c := &Cluster{
+			logger: logrus.WithField("pkg", "cluster"),
+			cluster: &api.EtcdCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: metav1.NamespaceDefault},
+				Spec:       api.ClusterSpec{Size: 2},
+			},
+		}
+		if err := c.updateMembers(etcdutil.MemberSet{}); err != nil {
+			t.Fatalf("#%d: update members failed: %v", i, err)
+		}
+		if !reflect.DeepEqual(f.calls, tt.wantCalls) {
+			t.Errorf("#%d: want calls %v, get %v", i, tt.wantCalls, f.calls)
+		}
+		ids := map[string]uint64{}
+		for name, m := range c.members {
+			ids[name] = m.ID
+		}
+		if !reflect.DeepEqual(ids, tt.wantIDs) {
+			t.Errorf("#%d: want members %v, get %v", i, tt.wantIDs, ids)
+		}
+	}
+}
@@ -15,6 +15,8 @@
 package cluster
 
 import (
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -25,7 +27,16 @@ var reconcileHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
 	Help:      "Reconcile duration histogram in second",
 	Buckets:   prometheus.ExponentialBuckets(0.1, 2, 10),
 },
-	[]string{"ClusterName"},
+	[]string{"ClusterName", "Namespace"},
+)
+
+var reconcileLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "etcd_operator",
+	Subsystem: "cluster",
+	Name:      "reconcile_lag_seconds",
+	Help:      "Seconds since the last reconciliation without errors",
+},
+	[]string{"ClusterName", "Namespace"},
 )
 
 var reconcileFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
@@ -37,7 +48,49 @@ var reconcileFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
 	[]string{"Reason"},
 )
 
+var defragTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "etcd_defrag_total",
+	Help: "Total number of etcd member defragmentations",
+},
+	[]string{"ClusterName", "Result"},
+)
+
+var podCreationTimeouts = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "etcd_pod_creation_timeout_total",
+	Help: "Total number of etcd pod creations that timed out",
+},
+	[]string{"ClusterName", "Namespace"},
+)
+
+var concurrentReconciles = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "etcd_operator_concurrent_reconciles",
+	Help: "Number of clusters being reconciled at the same time",
+})
+
 func init() {
 	prometheus.MustRegister(reconcileHistogram)
+	prometheus.MustRegister(reconcileLag)
 	prometheus.MustRegister(reconcileFailed)
+	prometheus.MustRegister(defragTotal)
+	prometheus.MustRegister(podCreationTimeouts)
+	prometheus.MustRegister(concurrentReconciles)
+}
+
+// reportReconcileDuration observes the duration of a reconciliation that
+// started at start.
+func (c *Cluster) reportReconcileDuration(start time.Time) {
+	reconcileHistogram.WithLabelValues(c.name(), c.cluster.Namespace).Observe(time.Since(start).Seconds())
+}
+
+// resetReconcileLag resets the reconcile lag after a reconciliation without
+// errors, including the update of the cluster status.
+func (c *Cluster) resetReconcileLag() {
+	c.lastReconciled = time.Now()
+	reconcileLag.WithLabelValues(c.name(), c.cluster.Namespace).Set(0)
+}
+
+// reportReconcileLag sets the reconcile lag to the time since the last
+// reconciliation without errors, which keeps growing while reconciliations fail.
+func (c *Cluster) reportReconcileLag() {
+	reconcileLag.WithLabelValues(c.name(), c.cluster.Namespace).Set(time.Since(c.lastReconciled).Seconds())
 }
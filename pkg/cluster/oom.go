@@ -0,0 +1,113 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// memoryAutoAdjustPercent is how much the memory limit is raised after an OOM kill.
+const memoryAutoAdjustPercent = 25
+
+// handleOOMEvent raises the memory limit of the pod policy by
+// memoryAutoAdjustPercent, up to AutoAdjustMemoryMax, if AutoAdjustMemory is set
+// and an etcd container was OOM killed with the current limit.
+func (c *Cluster) handleOOMEvent(pods []*v1.Pod) {
+	policy := c.cluster.Spec.Pod
+	if policy == nil || !policy.AutoAdjustMemory {
+		return
+	}
+	limit, ok := policy.Resources.Limits[v1.ResourceMemory]
+	if !ok {
+		return
+	}
+	pod, finishedAt := pickOneOOMKilledPod(pods, limit, c.lastOOMKill)
+	if pod == nil {
+		return
+	}
+	c.lastOOMKill = finishedAt
+
+	newLimit, ok := raisedMemoryLimit(limit, policy.AutoAdjustMemoryMax)
+	if !ok {
+		c.logger.Warningf("pod (%s) was OOM killed but the memory limit (%s) is already at autoAdjustMemoryMax", pod.Name, limit.String())
+		return
+	}
+	if c.config.DryRun {
+		c.planAction("raise memory limit to "+newLimit.String(), pod.Name)
+		return
+	}
+
+	cl := c.cluster.DeepCopy()
+	cl.Spec.Pod.Resources.Limits[v1.ResourceMemory] = newLimit
+	cl.Status = c.status
+	cl, err := c.config.EtcdCRCli.EtcdV1beta2().EtcdClusters(cl.Namespace).Update(cl)
+	if err != nil {
+		c.logger.Errorf("failed to raise memory limit from %s to %s: %v", limit.String(), newLimit.String(), err)
+		return
+	}
+	c.cluster = cl
+	c.logger.Infof("pod (%s) was OOM killed, raised memory limit from %s to %s", pod.Name, limit.String(), newLimit.String())
+	_, err = c.eventsCli.Create(k8sutil.OOMAutoAdjustedEvent(pod.Name, limit.String(), newLimit.String(), c.cluster))
+	if err != nil {
+		c.logger.Errorf("failed to create OOM auto adjusted event: %v", err)
+	}
+}
+
+// pickOneOOMKilledPod returns a pod whose etcd container was OOM killed after
+// since with a memory limit of at least limit, and when it was killed.
+// Pods created with a lower limit are ignored since the limit was already raised
+// for them.
+func pickOneOOMKilledPod(pods []*v1.Pod, limit resource.Quantity, since time.Time) (*v1.Pod, time.Time) {
+	for _, pod := range pods {
+		var podLimit resource.Quantity
+		for _, ct := range pod.Spec.Containers {
+			if ct.Name == "etcd" {
+				podLimit = ct.Resources.Limits[v1.ResourceMemory]
+			}
+		}
+		if podLimit.Cmp(limit) < 0 {
+			continue
+		}
+		for _, cs := range pod.Status.ContainerStatuses {
+			t := cs.LastTerminationState.Terminated
+			if cs.Name != "etcd" || t == nil || t.Reason != "OOMKilled" {
+				continue
+			}
+			if t.FinishedAt.Time.After(since) {
+				return pod, t.FinishedAt.Time
+			}
+		}
+	}
+	return nil, time.Time{}
+}
+
+// raisedMemoryLimit returns limit raised by memoryAutoAdjustPercent and capped
+// at max, or false if limit is already at max.
+func raisedMemoryLimit(limit resource.Quantity, max *resource.Quantity) (resource.Quantity, bool) {
+	v := limit.Value()
+	raised := resource.NewQuantity(v+v*memoryAutoAdjustPercent/100, limit.Format)
+	if max == nil || raised.Cmp(*max) <= 0 {
+		return *raised, true
+	}
+	if limit.Cmp(*max) >= 0 {
+		return limit, false
+	}
+	return max.DeepCopy(), true
+}
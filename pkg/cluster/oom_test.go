@@ -0,0 +1,93 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRaisedMemoryLimit(t *testing.T) {
+	max := resource.MustParse("1Gi")
+	tests := []struct {
+		limit  string
+		max    *resource.Quantity
+		want   string
+		wantOK bool
+	}{
+		{limit: "512Mi", want: "640Mi", wantOK: true},
+		{limit: "512Mi", max: &max, want: "640Mi", wantOK: true},
+		{limit: "900Mi", max: &max, want: "1Gi", wantOK: true},
+		{limit: "1Gi", max: &max, wantOK: false},
+	}
+	for i, tt := range tests {
+		got, ok := raisedMemoryLimit(resource.MustParse(tt.limit), tt.max)
+		if ok != tt.wantOK {
+			t.Errorf("#%d: ok = %v, want %v", i, ok, tt.wantOK)
+			continue
+		}
+		if ok && got.Cmp(resource.MustParse(tt.want)) != 0 {
+			t.Errorf("#%d: raised limit = %s, want %s", i, got.String(), tt.want)
+		}
+	}
+}
+
+func TestPickOneOOMKilledPod(t *testing.T) {
+	killedAt := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	newPod := func(limit, reason string) *v1.Pod {
+		pod := &v1.Pod{}
+		pod.Name = "example-0000"
+		pod.Spec.Containers = []v1.Container{{
+			Name: "etcd",
+			Resources: v1.ResourceRequirements{
+				Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse(limit)},
+			},
+		}}
+		pod.Status.ContainerStatuses = []v1.ContainerStatus{{
+			Name: "etcd",
+			LastTerminationState: v1.ContainerState{
+				Terminated: &v1.ContainerStateTerminated{Reason: reason, FinishedAt: metav1.NewTime(killedAt)},
+			},
+		}}
+		return pod
+	}
+
+	tests := []struct {
+		pod   *v1.Pod
+		since time.Time
+		want  bool
+	}{
+		{pod: newPod("512Mi", "OOMKilled"), want: true},
+		{pod: newPod("512Mi", "Error"), want: false},
+		// the pod was created before the limit was raised
+		{pod: newPod("256Mi", "OOMKilled"), want: false},
+		// the OOM kill was already handled
+		{pod: newPod("512Mi", "OOMKilled"), since: killedAt, want: false},
+	}
+	for i, tt := range tests {
+		pod, finishedAt := pickOneOOMKilledPod([]*v1.Pod{tt.pod}, resource.MustParse("512Mi"), tt.since)
+		if got := pod != nil; got != tt.want {
+			t.Errorf("#%d: picked = %v, want %v", i, got, tt.want)
+			continue
+		}
+		if tt.want && !finishedAt.Equal(killedAt) {
+			t.Errorf("#%d: finished at = %v, want %v", i, finishedAt, killedAt)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/util/probe"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+// heartbeatInterval is the interval of the heartbeats the workers report to
+// the health probe, well within probe.HeartbeatTimeout.
+const heartbeatInterval = 10 * time.Second
+
+// heartbeat reports that a worker took an item off the queue. It is a
+// variable so that tests can observe it.
+var heartbeat = probe.Heartbeat
+
+// poolHeartbeat is queued every heartbeatInterval along with the clusters, so
+// the operator is only reported healthy while the workers make progress.
+type poolHeartbeat struct{}
+
+// ClusterPool handles the events and reconciliations of clusters with a fixed
+// number of workers that share a work queue, instead of a goroutine per cluster.
+// A cluster is handled by one worker at a time and queues itself again for its
+// next reconciliation.
+type ClusterPool struct {
+	queue   workqueue.RateLimitingInterface
+	workers int
+}
+
+// NewClusterPool creates a ClusterPool with the given number of workers,
+// at least one.
+func NewClusterPool(workers int) *ClusterPool {
+	if workers < 1 {
+		workers = 1
+	}
+	return &ClusterPool{
+		queue:   workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "etcd-clusters"),
+		workers: workers,
+	}
+}
+
+// Add queues a cluster to be handled right away.
+func (p *ClusterPool) Add(c *Cluster) {
+	p.queue.Add(c)
+}
+
+// Run starts the workers and blocks until stopCh is closed.
+func (p *ClusterPool) Run(stopCh <-chan struct{}) {
+	defer p.queue.ShutDown()
+	p.queue.Add(poolHeartbeat{})
+	for i := 0; i < p.workers; i++ {
+		go p.worker()
+	}
+	<-stopCh
+}
+
+func (p *ClusterPool) worker() {
+	for p.processNext() {
+	}
+}
+
+// processNext handles the next queued cluster. It returns false once the queue
+// is shut down.
+func (p *ClusterPool) processNext() bool {
+	item, shutdown := p.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer p.queue.Done(item)
+
+	if _, ok := item.(poolHeartbeat); ok {
+		heartbeat()
+		p.queue.AddAfter(item, heartbeatInterval)
+		return true
+	}
+
+	c := item.(*Cluster)
+	if !c.handle() {
+		p.queue.Forget(item)
+		c.finish()
+		return true
+	}
+	p.queue.AddAfter(item, c.untilNextReconcile())
+	return true
+}
@@ -0,0 +1,127 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newPoolTestCluster() *Cluster {
+	return &Cluster{
+		logger:        logrus.WithField("pkg", "cluster"),
+		cluster:       &api.EtcdCluster{ObjectMeta: metav1.ObjectMeta{Name: "example", Namespace: "default"}},
+		eventCh:       make(chan *clusterEvent, 1),
+		stopCh:        make(chan struct{}),
+		nextReconcile: time.Now().Add(time.Hour),
+	}
+}
+
+func TestClusterPoolRequeuesRunningCluster(t *testing.T) {
+	p := NewClusterPool(1)
+	c := newPoolTestCluster()
+	p.Add(c)
+	if !p.processNext() {
+		t.Fatal("pool shut down unexpectedly")
+	}
+	if c.stopped {
+		t.Error("running cluster is stopped")
+	}
+	// the cluster waits for its next reconciliation
+	if n := p.queue.Len(); n != 0 {
+		t.Errorf("queue length = %d, want 0", n)
+	}
+}
+
+func TestClusterPoolFinishesDeletedCluster(t *testing.T) {
+	p := NewClusterPool(1)
+	c := newPoolTestCluster()
+	close(c.stopCh)
+	p.Add(c)
+	p.processNext()
+	if !c.stopped {
+		t.Error("deleted cluster is not stopped")
+	}
+
+	// a late event of the deleted cluster is ignored
+	p.Add(c)
+	p.processNext()
+	if n := p.queue.Len(); n != 0 {
+		t.Errorf("queue length = %d, want 0", n)
+	}
+}
+
+func TestClusterPoolInterleavesEventsAndReconciliations(t *testing.T) {
+	p := NewClusterPool(1)
+	c := newPoolTestCluster()
+	// A paused cluster marks its status on every reconciliation and does nothing else.
+	c.cluster.Spec.Paused = true
+	c.config.Pool = p
+	c.started = 1
+
+	// An event is handled right away, without a reconciliation before the tick.
+	c.Update(c.cluster.DeepCopy())
+	if n := p.queue.Len(); n != 1 {
+		t.Fatalf("queue length = %d after an event, want 1", n)
+	}
+	p.processNext()
+	if len(c.eventCh) != 0 {
+		t.Error("event is not handled")
+	}
+	if c.status.ControlPaused {
+		t.Error("cluster is reconciled before its next reconciliation")
+	}
+
+	// On the tick, the pending event is applied before the reconciliation.
+	updated := c.cluster.DeepCopy()
+	updated.Annotations = map[string]string{"example.com/updated": "true"}
+	c.Update(updated)
+	c.nextReconcile = time.Now().Add(-time.Second)
+	p.processNext()
+	if c.cluster.Annotations["example.com/updated"] != "true" {
+		t.Error("event is not applied")
+	}
+	if !c.status.ControlPaused {
+		t.Error("cluster is not reconciled on its tick")
+	}
+	if !c.nextReconcile.After(time.Now()) {
+		t.Error("next reconciliation is not scheduled")
+	}
+}
+
+func TestClusterPoolHeartbeat(t *testing.T) {
+	beats := 0
+	old := heartbeat
+	heartbeat = func() { beats++ }
+	defer func() { heartbeat = old }()
+
+	p := NewClusterPool(1)
+	p.queue.Add(poolHeartbeat{})
+	if !p.processNext() {
+		t.Fatal("pool shut down unexpectedly")
+	}
+	if beats != 1 {
+		t.Errorf("heartbeats = %d, want 1", beats)
+	}
+	// the heartbeat waits for the next interval
+	if n := p.queue.Len(); n != 0 {
+		t.Errorf("queue length = %d, want 0", n)
+	}
+}
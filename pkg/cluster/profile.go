@@ -0,0 +1,180 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/constants"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// profileSeconds is the duration of a captured CPU profile.
+	profileSeconds = 30
+	// maxProfileBytes keeps the base64 encoded profile below the 1MiB size
+	// limit of a ConfigMap.
+	maxProfileBytes = 700 * 1024
+
+	profileDataKey       = "cpu.pprof"
+	profileCapturedAtKey = "capturedAt"
+)
+
+type profileResult struct {
+	data []byte
+	err  error
+}
+
+// profileConfigMapName returns the name of the ConfigMap the last CPU profile
+// of the cluster is saved in.
+func profileConfigMapName(clusterName string) string {
+	return clusterName + "-cpu-profile"
+}
+
+// handleCaptureProfile starts capturing a CPU profile of the etcd leader when the
+// cluster has the capture-profile annotation, and saves the result once done.
+// The annotation of a finished capture is removed before another capture can
+// start, so that a failed removal is retried instead of capturing again.
+func (c *Cluster) handleCaptureProfile() {
+	select {
+	case res := <-c.profileCh:
+		c.profiling = false
+		c.saveProfile(res)
+		c.profileCaptured = true
+	default:
+	}
+
+	if c.profileCaptured {
+		if err := c.removeCaptureProfileAnnotation(); err != nil {
+			c.logger.Warningf("%v", err)
+			return
+		}
+		c.profileCaptured = false
+		return
+	}
+
+	if c.profiling || c.cluster.Annotations[api.CaptureProfileAnnotation] != "true" {
+		return
+	}
+	if c.config.DryRun {
+		c.planAction("capture CPU profile", c.cluster.Name)
+		return
+	}
+	leader, err := c.identifyEtcdLeader(context.Background())
+	if err != nil {
+		c.logger.Errorf("failed to capture CPU profile: %v", err)
+		return
+	}
+	c.profiling = true
+	leaderURL := leader.ClientURL()
+	tlsConfig := c.tlsConfig
+	go func() {
+		data, err := fetchEtcdCPUProfile(tlsConfig, leaderURL)
+		c.profileCh <- profileResult{data: data, err: err}
+	}()
+}
+
+// saveProfile saves a captured profile in the profile ConfigMap of the cluster
+// and its name in the status.
+func (c *Cluster) saveProfile(res profileResult) {
+	if res.err != nil {
+		c.logger.Errorf("failed to capture CPU profile: %v", res.err)
+		return
+	}
+
+	cm := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   profileConfigMapName(c.cluster.Name),
+			Labels: k8sutil.LabelsForCluster(c.cluster.Name),
+		},
+		Data: map[string]string{
+			profileDataKey:       base64.StdEncoding.EncodeToString(res.data),
+			profileCapturedAtKey: time.Now().UTC().Format(time.RFC3339),
+		},
+	}
+	cm.SetOwnerReferences([]metav1.OwnerReference{c.cluster.AsOwner()})
+
+	cms := c.config.KubeCli.CoreV1().ConfigMaps(c.cluster.Namespace)
+	old, err := cms.Get(cm.Name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		_, err = cms.Create(cm)
+	case err == nil:
+		old.Data = cm.Data
+		_, err = cms.Update(old)
+	}
+	if err != nil {
+		c.logger.Errorf("failed to save CPU profile: %v", err)
+		return
+	}
+	c.logger.Infof("saved CPU profile of etcd leader in ConfigMap (%s)", cm.Name)
+	c.status.LastProfileConfigMap = cm.Name
+}
+
+// removeCaptureProfileAnnotation removes the capture-profile annotation, so
+// that a new profile can be requested.
+func (c *Cluster) removeCaptureProfileAnnotation() error {
+	if _, ok := c.cluster.Annotations[api.CaptureProfileAnnotation]; !ok {
+		return nil
+	}
+	newCluster := c.cluster.DeepCopy()
+	delete(newCluster.Annotations, api.CaptureProfileAnnotation)
+	newCluster.Status = c.status
+	newCluster, err := c.config.EtcdCRCli.EtcdV1beta2().EtcdClusters(c.cluster.Namespace).Update(newCluster)
+	if err != nil {
+		return fmt.Errorf("failed to remove capture profile annotation: %v", err)
+	}
+	c.cluster = newCluster
+	return nil
+}
+
+// fetchEtcdCPUProfile fetches a CPU profile from the pprof endpoint of the etcd
+// leader. The etcd members must run with pprof enabled, e.g. with
+// ETCD_ENABLE_PPROF=true in the pod policy etcd environment variables.
+func fetchEtcdCPUProfile(tlsConfig *tls.Config, leaderURL string) ([]byte, error) {
+	hc := &http.Client{
+		Timeout:   profileSeconds*time.Second + constants.DefaultRequestTimeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+	resp, err := hc.Get(fmt.Sprintf("%s/debug/pprof/profile?seconds=%d", leaderURL, profileSeconds))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get CPU profile from (%s): %v", leaderURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code (%d) from pprof endpoint of (%s), is pprof enabled?", resp.StatusCode, leaderURL)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxProfileBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CPU profile: %v", err)
+	}
+	if len(data) > maxProfileBytes {
+		return nil, fmt.Errorf("CPU profile exceeds %d bytes", maxProfileBytes)
+	}
+	return data, nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	fakeetcd "github.com/coreos/etcd-operator/pkg/generated/clientset/versioned/fake"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	ktesting "k8s.io/client-go/testing"
+)
+
+func TestSaveProfile(t *testing.T) {
+	kubecli := fake.NewSimpleClientset()
+	c := &Cluster{
+		logger: logrus.WithField("pkg", "cluster"),
+		config: Config{KubeCli: kubecli},
+		cluster: &api.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: metav1.NamespaceDefault},
+		},
+	}
+
+	// The second profile replaces the first one.
+	for _, data := range []string{"first", "second"} {
+		c.saveProfile(profileResult{data: []byte(data)})
+
+		cm, err := kubecli.CoreV1().ConfigMaps(metav1.NamespaceDefault).Get(profileConfigMapName("test"), metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := base64.StdEncoding.DecodeString(cm.Data[profileDataKey])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != data {
+			t.Errorf("profile = %q, want %q", got, data)
+		}
+		if c.status.LastProfileConfigMap != cm.Name {
+			t.Errorf("status.lastProfileConfigMap = %q, want %q", c.status.LastProfileConfigMap, cm.Name)
+		}
+	}
+
+	c.status.LastProfileConfigMap = ""
+	c.saveProfile(profileResult{err: errors.New("pprof disabled")})
+	if c.status.LastProfileConfigMap != "" {
+		t.Errorf("status.lastProfileConfigMap = %q after a failed capture, want it unset", c.status.LastProfileConfigMap)
+	}
+}
+
+func TestHandleCaptureProfileRetriesAnnotationRemoval(t *testing.T) {
+	cl := &api.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "test",
+			Namespace:   metav1.NamespaceDefault,
+			Annotations: map[string]string{api.CaptureProfileAnnotation: "true"},
+		},
+	}
+	etcdcli := fakeetcd.NewSimpleClientset(cl)
+	failUpdate := true
+	etcdcli.PrependReactor("update", "etcdclusters", func(ktesting.Action) (bool, runtime.Object, error) {
+		if failUpdate {
+			return true, nil, errors.New("conflict")
+		}
+		return false, nil, nil
+	})
+	c := &Cluster{
+		logger:    logrus.WithField("pkg", "cluster"),
+		config:    Config{KubeCli: fake.NewSimpleClientset(), EtcdCRCli: etcdcli},
+		cluster:   cl.DeepCopy(),
+		profileCh: make(chan profileResult, 1),
+	}
+	c.profiling = true
+	c.profileCh <- profileResult{data: []byte("profile")}
+
+	// The removal fails: the annotation is kept and no new capture starts.
+	c.handleCaptureProfile()
+	c.handleCaptureProfile()
+	if c.profiling || !c.profileCaptured {
+		t.Fatalf("profiling = %v, profileCaptured = %v, want a pending annotation removal", c.profiling, c.profileCaptured)
+	}
+	if _, ok := c.cluster.Annotations[api.CaptureProfileAnnotation]; !ok {
+		t.Error("expect the annotation to be kept until it is removed from the CR")
+	}
+
+	failUpdate = false
+	c.handleCaptureProfile()
+	if c.profileCaptured {
+		t.Error("expect the annotation removal to be done")
+	}
+	if _, ok := c.cluster.Annotations[api.CaptureProfileAnnotation]; ok {
+		t.Error("expect the annotation to be removed")
+	}
+	if c.cluster.Status.LastProfileConfigMap != profileConfigMapName("test") {
+		t.Errorf("status.lastProfileConfigMap = %q, want it saved with the CR", c.cluster.Status.LastProfileConfigMap)
+	}
+}
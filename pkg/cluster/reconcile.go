@@ -15,23 +15,39 @@
 package cluster
 
 import (
-	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
-	"github.com/coreos/etcd-operator/pkg/util/constants"
 	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
 	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
 
-	"github.com/coreos/etcd/clientv3"
 	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
 	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 // ErrLostQuorum indicates that the etcd cluster lost its quorum.
 var ErrLostQuorum = errors.New("lost quorum")
 
+// addEtcdMember and checkEtcdQuorum are the etcd calls of the reconciliation
+// besides removeEtcdMember. Tests replace them.
+var (
+	addEtcdMember   = etcdutil.AddMember
+	checkEtcdQuorum = etcdutil.CheckQuorum
+)
+
+const (
+	// seedQuorumTimeout is how long the operator waits for the seed member to serve
+	// requests before scaling up, e.g. while it restores a large snapshot.
+	seedQuorumTimeout      = 5 * time.Minute
+	quorumProgressInterval = 30 * time.Second
+	// quorumCheckKey is the key read to check quorum, the same as the liveness probe.
+	quorumCheckKey = "foo"
+)
+
 // reconcile reconciles cluster current state to desired state specified by spec.
 // - it tries to reconcile the cluster to desired size.
 // - if the cluster needs for upgrade, it tries to upgrade old member one by one.
@@ -43,27 +59,151 @@ func (c *Cluster) reconcile(pods []*v1.Pod) error {
 		c.status.Size = c.members.Size()
 	}()
 
+	c.ensureMinimumMemberCount()
+
+	if c.selfHostedJoin != nil {
+		return c.checkSelfHostedJoin()
+	}
+
 	sp := c.cluster.Spec
-	running := podsToMemberSet(pods, c.isSecureClient())
-	if !running.IsEqual(c.members) || c.members.Size() != sp.Size {
+	if v := c.status.RolledBackVersion; len(v) != 0 && v != sp.Version {
+		c.status.RolledBackVersion = ""
+	}
+	sp.Version = c.desiredVersion()
+	running := podsToMemberSet(pods, c.isSecureClient(), c.cluster.Spec.DNSDomain)
+	if !running.IsEqual(c.members) || c.members.Size() != c.desiredSize() {
 		return c.reconcileMembers(running)
 	}
 	c.status.ClearCondition(api.ClusterConditionScaling)
+	c.checkPeerConnectivity()
+
+	if len(c.upgradedMember) != 0 {
+		return c.checkUpgradedMember(pods)
+	}
+
+	if pod := pickOnePodOnInterruptedNode(pods, sp, c.config.InterruptedNodes); pod != nil {
+		return c.moveOffInterruptedNode(pod)
+	}
 
 	if needUpgrade(pods, sp) {
+		if !sp.MaintenanceWindow.InWindow(time.Now()) {
+			c.logger.Infof("deferring upgrade to %s until the maintenance window (%s)", sp.Version, sp.MaintenanceWindow)
+			return nil
+		}
+		if c.status.TargetVersion != sp.Version {
+			c.status.PreviousVersion = c.status.CurrentVersion
+		}
 		c.status.UpgradeVersionTo(sp.Version)
 
 		m := pickOneOldMember(pods, sp.Version)
-		return c.upgradeOneMember(m.Name)
+		if err := c.upgradeOneMember(m.Name, sp.Version); err != nil {
+			return err
+		}
+		c.upgradedMember = m.Name
+		c.upgradedAt = time.Now()
+		return nil
 	}
 	c.status.ClearCondition(api.ClusterConditionUpgrading)
 
+	if m := pickOneSelfHostedMember(pods, sp); m != nil {
+		if !sp.MaintenanceWindow.InWindow(time.Now()) {
+			c.logger.Infof("deferring migration of self-hosted member (%s) until the maintenance window (%s)", m.Name, sp.MaintenanceWindow)
+			return nil
+		}
+		return c.migrateFromSelfHosted(m)
+	}
+	c.status.ClearCondition(api.ClusterConditionMigrationBlocked)
+	if c.status.Phase == api.ClusterPhaseMigrating {
+		c.finishSelfHostedMigration()
+	}
+
+	if r := c.status.PeerCertRotation; r != nil {
+		r.MembersRotated, r.Total = countPeerSecret(pods, r.Secret), c.desiredSize()
+		if m := pickOneMemberWithOldPeerSecret(pods, r.Secret); m != nil {
+			if !sp.MaintenanceWindow.InWindow(time.Now()) {
+				c.logger.Infof("deferring peer certificate rotation of member (%s) until the maintenance window (%s)", m.Name, sp.MaintenanceWindow)
+				return nil
+			}
+			return c.rotateOneMemberPeerCert(m)
+		}
+		return c.finishPeerCertRotation()
+	}
+
+	if m := pickOneMemberWithStaleAnnotations(pods, sp.Pod); m != nil {
+		if sp.MaintenanceWindow.InWindow(time.Now()) {
+			return c.replaceMemberForAnnotations(m)
+		}
+		c.logger.Infof("deferring replacement of member (%s) until the maintenance window (%s)", m.Name, sp.MaintenanceWindow)
+	}
+
+	// A single member cannot be replaced without losing the data; pollPods
+	// reports its outdated pod.
+	if pod := pickOnePodWithOutdatedSpec(pods, sp); pod != nil && c.members.Size() > 1 {
+		if sp.MaintenanceWindow.InWindow(time.Now()) {
+			return c.syncPodSpec(pod)
+		}
+		c.logger.Infof("deferring replacement of member (%s) until the maintenance window (%s)", pod.Name, sp.MaintenanceWindow)
+	}
+
 	c.status.SetVersion(sp.Version)
 	c.status.SetReadyCondition()
 
 	return nil
 }
 
+// isValidSize returns false for a size below 1, which would remove every
+// member, or an even size, which tolerates no more failures than the odd size
+// below it.
+func isValidSize(size int) bool {
+	return size >= 1 && size%2 == 1
+}
+
+// ensureMinimumMemberCount records the spec size if it is valid. An invalid
+// size is rejected with an event, once per size, and the cluster keeps the last
+// valid size, see desiredSize. Without a last valid size, e.g. after an operator
+// restart, it keeps the largest odd size not above the spec size, but never
+// fewer members than the cluster has. The spec itself is left as is.
+func (c *Cluster) ensureMinimumMemberCount() {
+	size := c.cluster.Spec.Size
+	if isValidSize(size) {
+		c.lastValidSize = size
+		c.rejectedSize = nil
+		return
+	}
+	if c.rejectedSize != nil && *c.rejectedSize == size {
+		return
+	}
+
+	if c.lastValidSize == 0 {
+		keep := size
+		if keep%2 == 0 {
+			keep--
+		}
+		if n := c.members.Size(); keep < n {
+			keep = n
+		}
+		if keep < 1 {
+			keep = 1
+		}
+		c.lastValidSize = keep
+	}
+	c.rejectedSize = &size
+	c.logger.Warningf("rejected invalid size (%d), keeping size (%d)", size, c.lastValidSize)
+	_, err := c.eventsCli.Create(k8sutil.InvalidSizeRejectedEvent(size, c.lastValidSize, c.cluster))
+	if err != nil {
+		c.logger.Errorf("failed to create invalid size rejected event: %v", err)
+	}
+}
+
+// desiredSize returns the size the cluster is reconciled to: the spec size if
+// it is valid, otherwise the size kept by ensureMinimumMemberCount.
+func (c *Cluster) desiredSize() int {
+	if size := c.cluster.Spec.Size; isValidSize(size) || c.lastValidSize == 0 {
+		return size
+	}
+	return c.lastValidSize
+}
+
 // reconcileMembers reconciles
 // - running pods on k8s and cluster membership
 // - cluster membership and expected size of etcd cluster
@@ -77,7 +217,7 @@ func (c *Cluster) reconcileMembers(running etcdutil.MemberSet) error {
 	c.logger.Infof("running members: %s", running)
 	c.logger.Infof("cluster membership: %s", c.members)
 
-	unknownMembers := running.Diff(c.members)
+	unknownMembers, _ := c.members.Diff(running)
 	if unknownMembers.Size() > 0 {
 		c.logger.Infof("removing unexpected pods: %v", unknownMembers)
 		for _, m := range unknownMembers {
@@ -86,7 +226,7 @@ func (c *Cluster) reconcileMembers(running etcdutil.MemberSet) error {
 			}
 		}
 	}
-	L := running.Diff(unknownMembers)
+	_, L := running.Diff(unknownMembers)
 
 	if L.Size() == c.members.Size() {
 		return c.resize()
@@ -99,15 +239,22 @@ func (c *Cluster) reconcileMembers(running etcdutil.MemberSet) error {
 
 	c.logger.Infof("removing one dead member")
 	// remove dead members that doesn't have any running pods before doing resizing.
-	return c.removeDeadMember(c.members.Diff(L).PickOne())
+	_, dead := c.members.Diff(L)
+	return c.removeDeadMember(dead.PickOne())
 }
 
 func (c *Cluster) resize() error {
-	if c.members.Size() == c.cluster.Spec.Size {
+	if c.members.Size() == c.desiredSize() {
 		return nil
 	}
 
-	if c.members.Size() < c.cluster.Spec.Size {
+	if c.members.Size() < c.desiredSize() {
+		// A seed member restored from a backup might still be loading the snapshot.
+		if c.members.Size() == 1 {
+			if ok, err := c.seedHasQuorum(seedQuorumTimeout); !ok {
+				return err
+			}
+		}
 		if c.cluster.Spec.SelfHosted != nil {
 			return c.addOneSelfHostedMember()
 		}
@@ -118,35 +265,61 @@ func (c *Cluster) resize() error {
 	return c.removeOneMember()
 }
 
-func (c *Cluster) addOneMember() error {
-	c.status.SetScalingUpCondition(c.members.Size(), c.cluster.Spec.Size)
+// seedHasQuorum checks with a linearizable get of quorumCheckKey whether the
+// seed member serves requests. It does not wait: while the seed member does not
+// serve requests, it returns false and the next reconciliation checks again.
+// It emits a progress event every quorumProgressInterval while waiting, and an
+// error once the member did not serve requests for timeout.
+func (c *Cluster) seedHasQuorum(timeout time.Duration) (bool, error) {
+	err := checkEtcdQuorum(c.members.ClientURLs(), c.tlsConfig, c.etcdCredentials(), quorumCheckKey)
+	if err == nil {
+		c.quorumWaitStart = time.Time{}
+		return true, nil
+	}
 
-	cfg := clientv3.Config{
-		Endpoints:   c.members.ClientURLs(),
-		DialTimeout: constants.DefaultDialTimeout,
-		TLS:         c.tlsConfig,
+	now := time.Now()
+	if c.quorumWaitStart.IsZero() {
+		c.quorumWaitStart, c.lastQuorumProgress = now, now
 	}
-	etcdcli, err := clientv3.New(cfg)
-	if err != nil {
-		return fmt.Errorf("add one member failed: creating etcd client failed %v", err)
+	waited := now.Sub(c.quorumWaitStart)
+	if waited > timeout {
+		c.quorumWaitStart = time.Time{}
+		return false, fmt.Errorf("cluster has no quorum after %v: %v", timeout, err)
 	}
-	defer etcdcli.Close()
+	if now.Sub(c.lastQuorumProgress) >= quorumProgressInterval {
+		c.lastQuorumProgress = now
+		c.logger.Infof("waiting for quorum for %v: %v", waited, err)
+		_, err = c.eventsCli.Create(k8sutil.WaitingForQuorumEvent(waited.Truncate(time.Second), c.cluster))
+		if err != nil {
+			c.logger.Errorf("failed to create waiting for quorum event: %v", err)
+		}
+	}
+	return false, nil
+}
+
+func (c *Cluster) addOneMember() error {
+	c.status.SetScalingUpCondition(c.members.Size(), c.desiredSize())
 
 	newMember := c.newMember(c.memberCounter)
-	ctx, cancel := context.WithTimeout(context.Background(), constants.DefaultRequestTimeout)
-	resp, err := etcdcli.MemberAdd(ctx, []string{newMember.PeerURL()})
-	cancel()
+	if c.config.DryRun {
+		c.planAction("add member", newMember.Name)
+		return nil
+	}
+	id, err := addEtcdMember(c.members.ClientURLs(), c.tlsConfig, c.etcdCredentials(), newMember.PeerURL())
 	if err != nil {
 		return fmt.Errorf("fail to add new member (%s): %v", newMember.Name, err)
 	}
-	newMember.ID = resp.Member.ID
+	newMember.ID = id
 	c.members.Add(newMember)
 
 	if err := c.createPod(c.members, newMember, "existing"); err != nil {
 		return fmt.Errorf("fail to create member's pod (%s): %v", newMember.Name, err)
 	}
 	c.memberCounter++
+	c.membershipChanged = true
+	c.updatePeerService()
 	c.logger.Infof("added member (%s)", newMember.Name)
+	c.debugLogger.LogEvent(fmt.Sprintf("added member (%s)", newMember.Name))
 	_, err = c.eventsCli.Create(k8sutil.NewMemberAddEvent(newMember.Name, c.cluster))
 	if err != nil {
 		c.logger.Errorf("failed to create new member add event: %v", err)
@@ -155,11 +328,35 @@ func (c *Cluster) addOneMember() error {
 }
 
 func (c *Cluster) removeOneMember() error {
-	c.status.SetScalingDownCondition(c.members.Size(), c.cluster.Spec.Size)
+	c.status.SetScalingDownCondition(c.members.Size(), c.desiredSize())
 
 	return c.removeMember(c.members.PickOne())
 }
 
+// pruneStaleMembers removes the etcd members whose pods no longer exist, e.g.
+// pods force deleted on a failed node, before replacements are added.
+func (c *Cluster) pruneStaleMembers(running []*v1.Pod) error {
+	stale := staleMembers(c.members, podsToMemberSet(running, c.isSecureClient(), c.cluster.Spec.DNSDomain))
+	for _, m := range stale {
+		if err := c.removeDeadMember(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// staleMembers returns the members without a running pod. It returns nothing
+// unless a majority of the members run, since the removals could not be
+// committed; the lost quorum is handled by the reconciliation.
+func staleMembers(members, running etcdutil.MemberSet) etcdutil.MemberSet {
+	unknown, stale := members.Diff(running)
+	alive := running.Size() - unknown.Size()
+	if alive < members.Size()/2+1 {
+		return nil
+	}
+	return stale
+}
+
 func (c *Cluster) removeDeadMember(toRemove *etcdutil.Member) error {
 	if c.cluster.Spec.SelfHosted != nil {
 		selectedNodes, err := c.selectSchedulableNodes()
@@ -177,8 +374,8 @@ func (c *Cluster) removeDeadMember(toRemove *etcdutil.Member) error {
 		// or experiencing temporary network partition. When it comes back, it will recover itself
 		// since we persist data for self hosted case.
 
-		if nodeNum := len(selectedNodes); nodeNum < c.cluster.Spec.Size {
-			c.logger.Warningf("ignored removing failed member (%s). Not enough master nodes (%v) to recover, want at least %d", toRemove.Name, selectedNodes, c.cluster.Spec.Size)
+		if nodeNum := len(selectedNodes); nodeNum < c.desiredSize() {
+			c.logger.Warningf("ignored removing failed member (%s). Not enough master nodes (%v) to recover, want at least %d", toRemove.Name, selectedNodes, c.desiredSize())
 			c.logger.Infof("waiting for the failed master node to recover, or more master nodes")
 			return nil
 		}
@@ -194,7 +391,11 @@ func (c *Cluster) removeDeadMember(toRemove *etcdutil.Member) error {
 }
 
 func (c *Cluster) removeMember(toRemove *etcdutil.Member) error {
-	err := etcdutil.RemoveMember(c.members.ClientURLs(), c.tlsConfig, toRemove.ID)
+	if c.config.DryRun {
+		c.planAction("remove member", toRemove.Name)
+		return nil
+	}
+	err := removeEtcdMember(c.members.ClientURLs(), c.tlsConfig, c.etcdCredentials(), toRemove.ID)
 	if err != nil {
 		switch err {
 		case rpctypes.ErrMemberNotFound:
@@ -212,7 +413,9 @@ func (c *Cluster) removeMember(toRemove *etcdutil.Member) error {
 	if err := c.removePod(toRemove.Name); err != nil {
 		return err
 	}
+	c.updatePeerService()
 	c.logger.Infof("removed member (%v) with ID (%d)", toRemove.Name, toRemove.ID)
+	c.debugLogger.LogEvent(fmt.Sprintf("removed member (%s)", toRemove.Name))
 	return nil
 }
 
@@ -229,3 +432,84 @@ func pickOneOldMember(pods []*v1.Pod, newVersion string) *etcdutil.Member {
 	}
 	return nil
 }
+
+// pickOneMemberWithStaleAnnotations returns a member whose pod lacks an
+// annotation of the pod policy, or nil if all pods are up to date.
+func pickOneMemberWithStaleAnnotations(pods []*v1.Pod, policy *api.PodPolicy) *etcdutil.Member {
+	for _, pod := range pods {
+		if !k8sutil.HasPodPolicyAnnotations(pod, policy) {
+			return &etcdutil.Member{Name: pod.Name, Namespace: pod.Namespace}
+		}
+	}
+	return nil
+}
+
+// replaceMemberForAnnotations removes the member so that a new member is added
+// with the pod policy annotations on the next reconciliation.
+// Replacing the member of a single member cluster loses the data, so its pod is
+// annotated in place instead.
+func (c *Cluster) replaceMemberForAnnotations(m *etcdutil.Member) error {
+	if c.members.Size() == 1 {
+		return c.annotatePod(m.Name)
+	}
+	toRemove, ok := c.members[m.Name]
+	if !ok {
+		return fmt.Errorf("member (%s) not found", m.Name)
+	}
+	c.logger.Infof("replacing member (%s) to apply the pod annotations", m.Name)
+	return c.removeMember(toRemove)
+}
+
+// pickOnePodWithOutdatedSpec returns a pod created from an older cluster spec,
+// e.g. before its pod policy changed, or nil if all pods are up to date.
+// Pods without a spec hash, created by older operators, are left alone.
+func pickOnePodWithOutdatedSpec(pods []*v1.Pod, cs api.ClusterSpec) *v1.Pod {
+	specHash := k8sutil.SpecHash(cs)
+	for _, pod := range pods {
+		if h := k8sutil.GetSpecHash(pod); len(h) != 0 && h != specHash {
+			return pod
+		}
+	}
+	return nil
+}
+
+// syncPodSpec removes the member of pod, which was created from an older
+// cluster spec, so that a new member is added from the current spec on the
+// next reconciliation. Pods are thus replaced one at a time.
+func (c *Cluster) syncPodSpec(pod *v1.Pod) error {
+	toRemove, ok := c.members[pod.Name]
+	if !ok {
+		return fmt.Errorf("member (%s) not found", pod.Name)
+	}
+	c.logger.Infof("replacing member (%s) to apply the current spec", pod.Name)
+	return c.removeMember(toRemove)
+}
+
+func (c *Cluster) annotatePod(name string) error {
+	if c.config.DryRun {
+		c.planAction("set annotations", name)
+		return nil
+	}
+	ns := c.cluster.Namespace
+	pod, err := c.config.KubeCli.CoreV1().Pods(ns).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("fail to get pod (%s): %v", name, err)
+	}
+	oldpod := pod.DeepCopy()
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	for k, v := range k8sutil.PodPolicyAnnotations(c.cluster.Spec.Pod) {
+		pod.Annotations[k] = v
+	}
+	patchdata, err := k8sutil.CreatePatch(oldpod, pod, v1.Pod{})
+	if err != nil {
+		return fmt.Errorf("error creating patch: %v", err)
+	}
+	_, err = c.config.KubeCli.CoreV1().Pods(ns).Patch(name, types.StrategicMergePatchType, patchdata)
+	if err != nil {
+		return fmt.Errorf("fail to annotate pod (%s): %v", name, err)
+	}
+	c.logger.Infof("updated the annotations of pod (%s)", name)
+	return nil
+}
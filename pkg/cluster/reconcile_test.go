@@ -0,0 +1,312 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"github.com/coreos/etcd/etcdserver/etcdserverpb"
+	"github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	ktesting "k8s.io/client-go/testing"
+)
+
+func TestReconcile(t *testing.T) {
+	tests := []struct {
+		desc    string
+		size    int
+		members []string
+		pods    []string
+		// wantActions are the kubernetes API calls of each reconcile.
+		wantActions [][]string
+		wantMembers int
+		wantErr     error
+	}{{
+		desc:    "scale up from 1 to 3",
+		size:    3,
+		members: []string{"test-0000"},
+		pods:    []string{"test-0000"},
+		wantActions: [][]string{
+			{"create pods", "get services", "create events"},
+			{"create pods", "get services", "create events"},
+		},
+		wantMembers: 3,
+	}, {
+		desc:    "scale down from 5 to 3",
+		size:    3,
+		members: []string{"test-0000", "test-0001", "test-0002", "test-0003", "test-0004"},
+		pods:    []string{"test-0000", "test-0001", "test-0002", "test-0003", "test-0004"},
+		wantActions: [][]string{
+			{"create events", "delete pods", "get services"},
+			{"create events", "delete pods", "get services"},
+		},
+		wantMembers: 3,
+	}, {
+		desc:    "replace the member without a running pod",
+		size:    3,
+		members: []string{"test-0000", "test-0001", "test-0002"},
+		pods:    []string{"test-0000", "test-0001"},
+		wantActions: [][]string{
+			{"create events", "create events", "delete pods", "get services"},
+			{"create pods", "get services", "create events"},
+		},
+		wantMembers: 3,
+	}, {
+		desc:    "remove the pod that is not a member",
+		size:    3,
+		members: []string{"test-0000", "test-0001", "test-0002"},
+		pods:    []string{"test-0000", "test-0001", "test-0002", "test-0003"},
+		wantActions: [][]string{
+			{"delete pods"},
+		},
+		wantMembers: 3,
+	}, {
+		desc:    "lost quorum",
+		size:    3,
+		members: []string{"test-0000", "test-0001", "test-0002"},
+		pods:    []string{"test-0000"},
+		wantActions: [][]string{
+			{},
+		},
+		wantMembers: 3,
+		wantErr:     ErrLostQuorum,
+	}}
+
+	origAdd, origRemove, origQuorum := addEtcdMember, removeEtcdMember, checkEtcdQuorum
+	defer func() {
+		addEtcdMember, removeEtcdMember, checkEtcdQuorum = origAdd, origRemove, origQuorum
+	}()
+	checkEtcdQuorum = func(clientURLs []string, tc *tls.Config, cred *etcdutil.Credentials, key string) error { return nil }
+
+	for i, tt := range tests {
+		cl := &api.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: metav1.NamespaceDefault},
+			Spec:       api.ClusterSpec{Size: tt.size},
+		}
+		var objs []runtime.Object
+		for _, name := range tt.pods {
+			objs = append(objs, &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: cl.Namespace}})
+		}
+		kubecli := fake.NewSimpleClientset(objs...)
+
+		f := &fakeMembership{}
+		members := etcdutil.MemberSet{}
+		for j, name := range tt.members {
+			id := uint64(j + 1)
+			f.members = append(f.members, &etcdserverpb.Member{ID: id, Name: name})
+			members.Add(&etcdutil.Member{Name: name, Namespace: cl.Namespace, ID: id})
+		}
+		addEtcdMember = f.add
+		removeEtcdMember = f.remove
+
+		c := &Cluster{
+			logger:        logrus.WithField("pkg", "cluster"),
+			config:        Config{KubeCli: kubecli},
+			cluster:       cl,
+			members:       members,
+			memberCounter: len(tt.members),
+			eventsCli:     kubecli.CoreV1().Events(cl.Namespace),
+		}
+
+		for j, want := range tt.wantActions {
+			podList, err := kubecli.CoreV1().Pods(cl.Namespace).List(metav1.ListOptions{})
+			if err != nil {
+				t.Fatalf("%s: failed to list pods: %v", tt.desc, err)
+			}
+			var running []*v1.Pod
+			for k := range podList.Items {
+				running = append(running, &podList.Items[k])
+			}
+			kubecli.ClearActions()
+
+			err = c.reconcile(running)
+			if j == len(tt.wantActions)-1 && err != tt.wantErr {
+				t.Errorf("#%d (%s): want error %v, get %v", i, tt.desc, tt.wantErr, err)
+			}
+			actions := []string{}
+			for _, a := range kubecli.Actions() {
+				actions = append(actions, fmt.Sprintf("%s %s", a.GetVerb(), a.GetResource().Resource))
+			}
+			if !reflect.DeepEqual(actions, want) {
+				t.Errorf("#%d (%s): reconcile %d: want actions %v, get %v", i, tt.desc, j, want, actions)
+			}
+		}
+		if c.members.Size() != tt.wantMembers {
+			t.Errorf("#%d (%s): want %d members, get %d", i, tt.desc, tt.wantMembers, c.members.Size())
+		}
+		if len(f.members) != tt.wantMembers {
+			t.Errorf("#%d (%s): want %d etcd members, get %d", i, tt.desc, tt.wantMembers, len(f.members))
+		}
+	}
+}
+
+func TestPickOnePodWithOutdatedSpec(t *testing.T) {
+	m := &etcdutil.Member{Name: "test-0000", Namespace: metav1.NamespaceDefault}
+	oldSpec := api.ClusterSpec{Size: 3, Version: "3.2.13"}
+	newSpec := api.ClusterSpec{Size: 3, Version: "3.2.13", Pod: &api.PodPolicy{EtcdEnv: []v1.EnvVar{{Name: "ETCD_QUOTA_BACKEND_BYTES", Value: "4294967296"}}}}
+	outdated := k8sutil.NewEtcdPod(m, []string{m.Name}, "test", "new", "token", oldSpec, metav1.OwnerReference{})
+	// pods created by older operators have no spec hash
+	unknown := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "test-0001", Namespace: metav1.NamespaceDefault}}
+
+	tests := []struct {
+		spec     api.ClusterSpec
+		wantName string
+	}{
+		{spec: newSpec, wantName: "test-0000"},
+		{spec: oldSpec},
+		// size and version changes do not replace pods
+		{spec: api.ClusterSpec{Size: 5, Version: "3.3.0"}},
+		// neither do fields only the operator reads
+		{spec: api.ClusterSpec{Size: 3, Version: "3.2.13", DefragEnabled: true, MaintenanceWindow: &api.MaintenanceWindow{StartHour: 1, EndHour: 3}}},
+		{spec: api.ClusterSpec{Size: 3, Version: "3.2.13", Pod: &api.PodPolicy{AutoAdjustMemory: true}}},
+		// annotations are applied by replaceMemberForAnnotations
+		{spec: api.ClusterSpec{Size: 3, Version: "3.2.13", Pod: &api.PodPolicy{Annotations: map[string]string{"example.com/owner": "storage"}}}},
+	}
+	for i, tt := range tests {
+		got := pickOnePodWithOutdatedSpec([]*v1.Pod{unknown, outdated}, tt.spec)
+		var gotName string
+		if got != nil {
+			gotName = got.Name
+		}
+		if gotName != tt.wantName {
+			t.Errorf("#%d: picked pod %q, want %q", i, gotName, tt.wantName)
+		}
+	}
+}
+
+func TestPickOnePodWithOutdatedSpecMemoryRaised(t *testing.T) {
+	m := &etcdutil.Member{Name: "test-0000", Namespace: metav1.NamespaceDefault}
+	newSpec := func(limit string) api.ClusterSpec {
+		return api.ClusterSpec{Size: 3, Version: "3.2.13", Pod: &api.PodPolicy{
+			Resources:        v1.ResourceRequirements{Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse(limit)}},
+			AutoAdjustMemory: true,
+		}}
+	}
+	pod := k8sutil.NewEtcdPod(m, []string{m.Name}, "test", "new", "token", newSpec("512Mi"), metav1.OwnerReference{})
+	// the memory limit raised by handleOOMEvent only applies to new pods
+	if got := pickOnePodWithOutdatedSpec([]*v1.Pod{pod}, newSpec("640Mi")); got != nil {
+		t.Errorf("picked pod %q after the memory limit was raised, want none", got.Name)
+	}
+}
+
+func TestAnnotatePodKeepsReservedAnnotations(t *testing.T) {
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:        "test-0000",
+		Namespace:   metav1.NamespaceDefault,
+		Annotations: map[string]string{"etcd.version": "3.2.13"},
+	}}
+	kubecli := fake.NewSimpleClientset(pod)
+	kubecli.PrependReactor("patch", "pods", func(ktesting.Action) (bool, runtime.Object, error) {
+		return true, pod, nil
+	})
+	c := &Cluster{
+		logger: logrus.WithField("pkg", "cluster"),
+		config: Config{KubeCli: kubecli},
+		cluster: &api.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: metav1.NamespaceDefault},
+			Spec: api.ClusterSpec{Pod: &api.PodPolicy{Annotations: map[string]string{
+				"etcd.version":      "3.1.0",
+				"example.com/owner": "storage",
+			}}},
+		},
+	}
+	if err := c.annotatePod(pod.Name); err != nil {
+		t.Fatal(err)
+	}
+
+	var patch []byte
+	for _, a := range kubecli.Actions() {
+		if pa, ok := a.(ktesting.PatchActionImpl); ok {
+			patch = pa.Patch
+		}
+	}
+	var got struct {
+		Metadata struct {
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal(patch, &got); err != nil {
+		t.Fatalf("failed to decode patch %q: %v", patch, err)
+	}
+	if v := got.Metadata.Annotations["example.com/owner"]; v != "storage" {
+		t.Errorf("patched annotation example.com/owner = %q, want %q", v, "storage")
+	}
+	if v, ok := got.Metadata.Annotations["etcd.version"]; ok {
+		t.Errorf("patch overwrites the reserved etcd.version annotation with %q", v)
+	}
+}
+
+func TestSeedHasQuorumDoesNotBlock(t *testing.T) {
+	origQuorum := checkEtcdQuorum
+	defer func() { checkEtcdQuorum = origQuorum }()
+	var quorumErr error
+	checkEtcdQuorum = func(clientURLs []string, tc *tls.Config, cred *etcdutil.Credentials, key string) error {
+		return quorumErr
+	}
+
+	kubecli := fake.NewSimpleClientset()
+	c := &Cluster{
+		logger:    logrus.WithField("pkg", "cluster"),
+		config:    Config{KubeCli: kubecli},
+		eventsCli: kubecli.CoreV1().Events(metav1.NamespaceDefault),
+		cluster:   &api.EtcdCluster{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: metav1.NamespaceDefault}},
+		members:   etcdutil.NewMemberSet(&etcdutil.Member{Name: "test-0000", Namespace: metav1.NamespaceDefault}),
+	}
+
+	// The seed member is still loading a snapshot: the check returns at once.
+	quorumErr = fmt.Errorf("context deadline exceeded")
+	ok, err := c.seedHasQuorum(seedQuorumTimeout)
+	if ok || err != nil {
+		t.Fatalf("seedHasQuorum = %v, %v, want false without error while waiting", ok, err)
+	}
+	if c.quorumWaitStart.IsZero() {
+		t.Fatal("expect the wait to be recorded")
+	}
+
+	// A progress event is emitted once quorumProgressInterval passed.
+	c.lastQuorumProgress = c.lastQuorumProgress.Add(-quorumProgressInterval)
+	if ok, err = c.seedHasQuorum(seedQuorumTimeout); ok || err != nil {
+		t.Fatalf("seedHasQuorum = %v, %v, want false without error while waiting", ok, err)
+	}
+	if n := len(kubecli.Actions()); n != 1 {
+		t.Errorf("%d actions, want one waiting for quorum event", n)
+	}
+
+	c.quorumWaitStart = c.quorumWaitStart.Add(-seedQuorumTimeout - time.Second)
+	if _, err = c.seedHasQuorum(seedQuorumTimeout); err == nil {
+		t.Error("expect error after the timeout")
+	}
+
+	quorumErr = nil
+	if ok, err = c.seedHasQuorum(seedQuorumTimeout); !ok || err != nil {
+		t.Errorf("seedHasQuorum = %v, %v, want true", ok, err)
+	}
+	if !c.quorumWaitStart.IsZero() {
+		t.Error("expect the wait to be reset once the seed member serves requests")
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	etcdReleasesURL        = "https://api.github.com/repos/coreos/etcd/releases?per_page=100"
+	releasesCheckInterval  = time.Hour
+	releasesRequestTimeout = 30 * time.Second
+	// maxReleasesPages bounds the pages fetched in case of a Link header loop.
+	maxReleasesPages = 20
+)
+
+// nextPageRegexp matches the URL of the next page in a GitHub Link header.
+var nextPageRegexp = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// EtcdReleases caches the versions of the published etcd releases for all the
+// clusters of the operator, so that GitHub is queried once per
+// releasesCheckInterval instead of once per cluster.
+type EtcdReleases struct {
+	logger *logrus.Entry
+	hc     *http.Client
+	url    string
+	// token authenticates the requests to the GitHub API, which raises the
+	// rate limit. It is optional.
+	token string
+
+	mu       sync.RWMutex
+	versions []string
+}
+
+// NewEtcdReleases returns an empty EtcdReleases that fetches the releases with
+// the optional GitHub token once Run is called.
+func NewEtcdReleases(logger *logrus.Logger, token string) *EtcdReleases {
+	if logger == nil {
+		logger = logrus.StandardLogger()
+	}
+	return &EtcdReleases{
+		logger: logger.WithField("pkg", "cluster"),
+		hc:     &http.Client{Timeout: releasesRequestTimeout},
+		url:    etcdReleasesURL,
+		token:  token,
+	}
+}
+
+// Run refreshes the releases every releasesCheckInterval until stopCh is closed.
+func (r *EtcdReleases) Run(stopCh <-chan struct{}) {
+	for {
+		if err := r.refresh(); err != nil {
+			r.logger.Warningf("failed to list etcd releases: %v", err)
+		}
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(releasesCheckInterval):
+		}
+	}
+}
+
+// Versions returns the versions of the published etcd releases, or nil if
+// they were not fetched yet.
+func (r *EtcdReleases) Versions() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.versions
+}
+
+func (r *EtcdReleases) refresh() error {
+	versions, err := r.fetch()
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.versions = versions
+	r.mu.Unlock()
+	return nil
+}
+
+// fetch lists the releases page by page, following the Link headers.
+// Drafts and pre-releases are skipped.
+func (r *EtcdReleases) fetch() ([]string, error) {
+	var versions []string
+	url := r.url
+	for page := 0; len(url) != 0; page++ {
+		if page == maxReleasesPages {
+			return nil, fmt.Errorf("more than %d pages of etcd releases", maxReleasesPages)
+		}
+		vs, next, err := r.fetchPage(url)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, vs...)
+		url = next
+	}
+	return versions, nil
+}
+
+func (r *EtcdReleases) fetchPage(url string) ([]string, string, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	if len(r.token) != 0 {
+		req.Header.Set("Authorization", "token "+r.token)
+	}
+	resp, err := r.hc.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("unexpected status (%s) from %s", resp.Status, url)
+	}
+
+	var releases []struct {
+		TagName    string `json:"tag_name"`
+		Draft      bool   `json:"draft"`
+		Prerelease bool   `json:"prerelease"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&releases); err != nil {
+		return nil, "", fmt.Errorf("failed to decode etcd releases: %v", err)
+	}
+	var versions []string
+	for _, rl := range releases {
+		if rl.Draft || rl.Prerelease {
+			continue
+		}
+		versions = append(versions, strings.TrimPrefix(rl.TagName, "v"))
+	}
+
+	var next string
+	if m := nextPageRegexp.FindStringSubmatch(resp.Header.Get("Link")); m != nil {
+		next = m[1]
+	}
+	return versions, next, nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestEtcdReleasesFetchPages(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "token secret" {
+			t.Errorf("Authorization = %q, want the token", got)
+		}
+		switch r.URL.Query().Get("page") {
+		case "":
+			w.Header().Set("Link", fmt.Sprintf(`<%s?page=2>; rel="next", <%s?page=2>; rel="last"`, srv.URL, srv.URL))
+			fmt.Fprint(w, `[{"tag_name": "v3.3.1"}, {"tag_name": "v3.3.2-rc.0", "prerelease": true}]`)
+		case "2":
+			w.Header().Set("Link", fmt.Sprintf(`<%s?page=1>; rel="first"`, srv.URL))
+			fmt.Fprint(w, `[{"tag_name": "v3.2.18"}, {"tag_name": "v3.2.19", "draft": true}]`)
+		default:
+			t.Errorf("unexpected page %q", r.URL.Query().Get("page"))
+		}
+	}))
+	defer srv.Close()
+
+	r := NewEtcdReleases(nil, "secret")
+	r.url = srv.URL
+	if v := r.Versions(); v != nil {
+		t.Errorf("versions = %v before the first refresh, want nil", v)
+	}
+	if err := r.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := r.Versions(), []string{"3.3.1", "3.2.18"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("versions = %v, want %v", got, want)
+	}
+}
+
+func TestEtcdReleasesKeepsVersionsOnFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "rate limit exceeded", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	r := NewEtcdReleases(nil, "")
+	r.url = srv.URL
+	r.versions = []string{"3.2.18"}
+	if err := r.refresh(); err == nil {
+		t.Error("expect error when GitHub rejects the request")
+	}
+	if got := r.Versions(); !reflect.DeepEqual(got, []string{"3.2.18"}) {
+		t.Errorf("versions = %v, want the cached versions", got)
+	}
+}
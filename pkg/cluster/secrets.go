@@ -0,0 +1,66 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+	"strings"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// expectedSecrets returns the secrets the etcd pods and the operator need to
+// run the cluster.
+func (c *Cluster) expectedSecrets() []string {
+	var secrets []string
+	tp := c.cluster.Spec.TLS
+	if tp.IsSecurePeer() {
+		secrets = append(secrets, tp.PeerSecret(c.cluster.Name))
+	}
+	if tp.IsSecureClient() {
+		secrets = append(secrets, tp.ServerSecret(c.cluster.Name), tp.OperatorSecret(c.cluster.Name))
+	}
+	if c.cluster.Spec.Auth.IsEnabled() {
+		secrets = append(secrets, c.cluster.Spec.Auth.RootPasswordSecret)
+	}
+	return secrets
+}
+
+// syncSecrets checks that the expected secrets exist. If any is missing, it sets
+// the SecretMissing condition and returns an error, so that the reconciliation
+// is skipped instead of treating the members that cannot start as dead.
+func (c *Cluster) syncSecrets() error {
+	var missing []string
+	for _, se := range c.expectedSecrets() {
+		_, err := c.config.KubeCli.CoreV1().Secrets(c.cluster.Namespace).Get(se, metav1.GetOptions{})
+		if k8sutil.IsKubernetesResourceNotFoundError(err) {
+			missing = append(missing, se)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get secret (%s): %v", se, err)
+		}
+	}
+	if len(missing) != 0 {
+		msg := "missing secrets: " + strings.Join(missing, ",")
+		c.status.SetSecretMissingCondition(msg)
+		return fmt.Errorf("%s", msg)
+	}
+	c.status.ClearCondition(api.ClusterConditionSecretMissing)
+	return nil
+}
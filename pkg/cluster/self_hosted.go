@@ -16,18 +16,23 @@ package cluster
 
 import (
 	"fmt"
-	"math"
 	"time"
 
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
 	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
 	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
-	"github.com/coreos/etcd-operator/pkg/util/retryutil"
 
 	"github.com/pborman/uuid"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 )
 
+// selfHostedJoinTimeout is how long a new self-hosted member may take to add
+// itself to the etcd cluster before it is inspected.
+const selfHostedJoinTimeout = 60 * time.Second
+
 // selectSchedulableNodes finds all nodes that the etcd pod can be placed.
 // The selected nodes must satisfy the node selector and are in ready state.
 func (c *Cluster) selectSchedulableNodes() ([]string, error) {
@@ -52,69 +57,67 @@ func (c *Cluster) selectSchedulableNodes() ([]string, error) {
 	return ns, nil
 }
 
-func (c *Cluster) waitNewMember(oldN, retries int, name string) error {
-	return retryutil.Retry(10*time.Second, retries, func() (bool, error) {
-		err := c.updateMembers(c.members)
-		if err != nil {
-			c.logger.Warningf("unable to update members: %v", err)
-			return false, nil
-		}
-		if c.members.Size() > oldN {
-			return true, nil
-		}
-		c.logger.Infof("still waiting for the new self hosted member (%s) to start...", name)
-		return false, nil
-	})
+// selfHostedJoin is the self-hosted member created last, until it adds itself
+// to the etcd cluster or its pod is removed.
+type selfHostedJoin struct {
+	name string
+	// oldN is the number of members before the member was created.
+	oldN int
+	// deadline is when the member is inspected if it did not join yet.
+	deadline time.Time
 }
 
-func (c *Cluster) changePodToNoopIfNotScheduled(name, ns string) string {
-	var nodeName string
-	retryutil.Retry(10*time.Second, math.MaxInt64, func() (bool, error) {
-		pod, err := c.config.KubeCli.CoreV1().Pods(ns).Get(name, metav1.GetOptions{})
-		if err != nil {
-			c.logger.Errorf("failed to check if pod (%s) is scheduled: %v", name, err)
-			return false, nil
-		}
-		nodeName = pod.Spec.NodeName
-		if len(nodeName) != 0 {
-			return true, nil
-		}
-		// If the pod hasn't bound to any node, we should delete the pod with version to make sure no kubelet
-		// would run it. But current API doesn't provide that. We need to CAS the pod's command to make sure it won't
-		// add member.
-		pod.Spec.Containers[0].Image = "busybox"
-		_, err = c.config.KubeCli.CoreV1().Pods(ns).Update(pod)
-		if err != nil {
-			c.logger.Errorf("failed to updated the unscheduled pod (%s) to noop pod: %v", name, err)
-			return false, nil
-		}
-		return true, nil
-	})
-	return nodeName
-}
+// checkSelfHostedJoin checks whether the self-hosted member created last added
+// itself to the etcd cluster, without waiting for it. A member that did not join
+// within selfHostedJoinTimeout is inspected: the pod of a member that was never
+// scheduled is made a no-op and removed, while a scheduled member is awaited.
+func (c *Cluster) checkSelfHostedJoin() error {
+	j := c.selfHostedJoin
+	if err := c.updateMembers(c.members); err != nil {
+		c.logger.Warningf("unable to update members: %v", err)
+		return nil
+	}
+	if c.members.Size() > j.oldN {
+		c.logger.Infof("added a self-hosted member (%s)", j.name)
+		c.selfHostedJoin = nil
+		return nil
+	}
+	if time.Now().Before(j.deadline) {
+		c.logger.Infof("still waiting for the new self hosted member (%s) to start...", j.name)
+		return nil
+	}
 
-func (c *Cluster) inspectSelfHostedMember(memberName, podName, ns string, oldN int) {
-	nodeName := c.changePodToNoopIfNotScheduled(podName, ns)
+	ns := c.cluster.Namespace
+	pod, err := c.config.KubeCli.CoreV1().Pods(ns).Get(j.name, metav1.GetOptions{})
+	if err != nil {
+		c.logger.Errorf("failed to check if pod (%s) is scheduled: %v", j.name, err)
+		return nil
+	}
 	// If a pod has been bound to a node, we could not know whether it had been run by kubelet.
-	if len(nodeName) != 0 {
-		c.logger.Infof("pod (%s) has been scheduled to node (%s), waiting for the pod to come up...", podName, nodeName)
-		c.waitNewMember(oldN, math.MaxInt64, memberName)
-		return
+	if len(pod.Spec.NodeName) != 0 {
+		c.logger.Infof("pod (%s) has been scheduled to node (%s), waiting for the pod to come up...", j.name, pod.Spec.NodeName)
+		return nil
+	}
+	// If the pod hasn't bound to any node, we should delete the pod with version to make sure no kubelet
+	// would run it. But current API doesn't provide that. We need to CAS the pod's command to make sure it won't
+	// add member.
+	pod.Spec.Containers[0].Image = "busybox"
+	if _, err = c.config.KubeCli.CoreV1().Pods(ns).Update(pod); err != nil {
+		c.logger.Errorf("failed to updated the unscheduled pod (%s) to noop pod: %v", j.name, err)
+		return nil
 	}
 
-	c.logger.Warningf("failed to add member (%s) due to scheduling failure. Removing its pod (%s)", memberName, podName)
+	c.logger.Warningf("failed to add member (%s) due to scheduling failure. Removing its pod", j.name)
 	// Our reconcile loop assumes that no new member is added without control.
 	// When we come to this point, we have assumed that the new member won't be added by any case.
 	// Thus, it is safe to remove the pod.
-	retryutil.Retry(10*time.Second, math.MaxInt64, func() (bool, error) {
-		err := c.removePod(memberName)
-		if err != nil {
-			c.logger.Errorf("failed to delete pod (%s), retry later: %v", memberName, err)
-			return false, nil
-		}
-		c.logger.Infof("pod (%s) has been removed", podName)
-		return true, nil
-	})
+	if err := c.removePod(j.name); err != nil {
+		c.logger.Errorf("failed to delete pod (%s), retry later: %v", j.name, err)
+		return nil
+	}
+	c.logger.Infof("pod (%s) has been removed", j.name)
+	c.selfHostedJoin = nil
+	return nil
 }
 
 func (c *Cluster) addOneSelfHostedMember() error {
@@ -122,14 +125,18 @@ func (c *Cluster) addOneSelfHostedMember() error {
 	if err != nil {
 		return err
 	}
-	if nodeNum := len(selectedNodes); nodeNum < c.cluster.Spec.Size {
-		c.logger.Warningf("cannot scale to size (%d), only have %d nodes (%v)", c.cluster.Spec.Size, nodeNum, selectedNodes)
+	if nodeNum := len(selectedNodes); nodeNum < c.desiredSize() {
+		c.logger.Warningf("cannot scale to size (%d), only have %d nodes (%v)", c.desiredSize(), nodeNum, selectedNodes)
 		return nil
 	}
 
-	c.status.SetScalingUpCondition(c.members.Size(), c.cluster.Spec.Size)
+	c.status.SetScalingUpCondition(c.members.Size(), c.desiredSize())
 
 	newMember := c.newMember(c.memberCounter)
+	if c.config.DryRun {
+		c.planAction("create self-hosted pod", newMember.Name)
+		return nil
+	}
 	c.memberCounter++
 	peerURL := newMember.PeerURL()
 	initialCluster := append(c.members.PeerURLPairs(), newMember.Name+"="+peerURL)
@@ -141,25 +148,24 @@ func (c *Cluster) addOneSelfHostedMember() error {
 	if err != nil {
 		return err
 	}
-	if c.isDebugLoggerEnabled() {
-		c.debugLogger.LogPodCreation(pod)
-	}
+	c.debugLogger.LogPodCreation(pod)
 
-	// wait for the new pod to start and add itself into the etcd cluster.
-	oldN := c.members.Size()
-	err = c.waitNewMember(oldN, 6, newMember.Name)
-	if err != nil {
-		c.logger.Warningf("new member (%s) is still not added. Doing more inspection...", newMember.Name)
-		c.inspectSelfHostedMember(newMember.Name, pod.Name, ns, oldN)
-		return nil
+	// The next reconciliations wait for the new pod to start and add itself
+	// into the etcd cluster, see checkSelfHostedJoin.
+	c.selfHostedJoin = &selfHostedJoin{
+		name:     newMember.Name,
+		oldN:     c.members.Size(),
+		deadline: time.Now().Add(selfHostedJoinTimeout),
 	}
-
-	c.logger.Infof("added a self-hosted member (%s)", newMember.Name)
 	return nil
 }
 
 func (c *Cluster) newSelfHostedSeedMember() error {
 	newMember := c.newMember(c.memberCounter)
+	if c.config.DryRun {
+		c.planAction("create self-hosted seed pod", newMember.Name)
+		return nil
+	}
 	c.memberCounter++
 	initialCluster := []string{newMember.Name + "=" + newMember.PeerURL()}
 
@@ -168,20 +174,63 @@ func (c *Cluster) newSelfHostedSeedMember() error {
 	if err != nil {
 		return err
 	}
-	if c.isDebugLoggerEnabled() {
-		c.debugLogger.LogPodCreation(pod)
+	c.debugLogger.LogPodCreation(pod)
+
+	if name := c.cluster.Spec.SelfHosted.StaticPodManifestConfigMap; len(name) != 0 {
+		if err := c.saveStaticPodManifest(name, newMember); err != nil {
+			return err
+		}
 	}
 
 	c.logger.Infof("self-hosted cluster created with seed member (%s)", newMember.Name)
 	return nil
 }
 
+// saveStaticPodManifest saves the static pod manifest of the seed member m in the ConfigMap of name.
+func (c *Cluster) saveStaticPodManifest(name string, m *etcdutil.Member) error {
+	manifest, err := k8sutil.GenerateEtcdStaticPodManifest(c.cluster.Spec, m)
+	if err != nil {
+		return fmt.Errorf("failed to generate static pod manifest: %v", err)
+	}
+	key := m.Name + ".json"
+
+	cms := c.config.KubeCli.CoreV1().ConfigMaps(c.cluster.Namespace)
+	cm, err := cms.Get(name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		cm = &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: k8sutil.LabelsForCluster(c.cluster.Name),
+			},
+			Data: map[string]string{key: string(manifest)},
+		}
+		cm.SetOwnerReferences([]metav1.OwnerReference{c.cluster.AsOwner()})
+		_, err = cms.Create(cm)
+	case err == nil:
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[key] = string(manifest)
+		_, err = cms.Update(cm)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save static pod manifest in ConfigMap (%s): %v", name, err)
+	}
+	c.logger.Infof("saved static pod manifest of seed member (%s) in ConfigMap (%s)", m.Name, name)
+	return nil
+}
+
 func (c *Cluster) migrateBootMember() error {
 	endpoint := c.cluster.Spec.SelfHosted.BootMemberClientEndpoint
 
 	c.logger.Infof("migrating boot member (%s)", endpoint)
+	if c.config.DryRun {
+		c.planAction("migrate boot member", endpoint)
+		return nil
+	}
 
-	resp, err := etcdutil.ListMembers([]string{endpoint}, c.tlsConfig)
+	resp, err := etcdutil.ListMembers([]string{endpoint}, c.tlsConfig, c.etcdCredentials())
 	if err != nil {
 		return fmt.Errorf("failed to list members from boot member (%v)", err)
 	}
@@ -208,9 +257,7 @@ func (c *Cluster) migrateBootMember() error {
 	if err != nil {
 		return err
 	}
-	if c.isDebugLoggerEnabled() {
-		c.debugLogger.LogPodCreation(pod)
-	}
+	c.debugLogger.LogPodCreation(pod)
 
 	if c.cluster.Spec.SelfHosted.SkipBootMemberRemoval {
 		c.logger.Infof("skipping boot member (%s) removal; you will need to remove it yourself", endpoint)
@@ -225,7 +272,7 @@ func (c *Cluster) migrateBootMember() error {
 			c.logger.Infof("waiting %v before removing the boot member", delay)
 			time.Sleep(delay)
 
-			err = etcdutil.RemoveMember([]string{newMember.ClientURL()}, c.tlsConfig, bootMember.ID)
+			err := c.rotateMemberName(bootMember.Name, newMember.Name)
 			if err != nil {
 				c.logger.Errorf("boot member migration: failed to remove the boot member (%v)", err)
 			}
@@ -236,3 +283,56 @@ func (c *Cluster) migrateBootMember() error {
 
 	return nil
 }
+
+// pickOneSelfHostedMember returns a member with a self-hosted pod if the
+// cluster is no longer self-hosted, or nil if there is nothing to migrate.
+func pickOneSelfHostedMember(pods []*v1.Pod, cs api.ClusterSpec) *etcdutil.Member {
+	if cs.SelfHosted != nil {
+		return nil
+	}
+	for _, pod := range pods {
+		if k8sutil.IsSelfHostedPod(pod) {
+			return &etcdutil.Member{Name: pod.Name, Namespace: pod.Namespace}
+		}
+	}
+	return nil
+}
+
+// migrateFromSelfHosted removes the self-hosted member m so that a regular
+// member is added in its place on the next reconciliation. etcd replicates the
+// data to the new member, so the cluster keeps serving during the migration.
+// The data directory of the removed member is left on its node.
+// A single member cluster cannot be migrated this way without losing its data.
+func (c *Cluster) migrateFromSelfHosted(m *etcdutil.Member) error {
+	if c.members.Size() == 1 {
+		msg := "cannot migrate the single member self-hosted cluster without losing data; scale it up first"
+		c.logger.Warning(msg)
+		c.status.SetMigrationBlockedCondition(msg)
+		return nil
+	}
+	c.status.ClearCondition(api.ClusterConditionMigrationBlocked)
+	toRemove, ok := c.members[m.Name]
+	if !ok {
+		return fmt.Errorf("member (%s) not found", m.Name)
+	}
+	if c.status.Phase != api.ClusterPhaseMigrating {
+		c.status.SetPhase(api.ClusterPhaseMigrating)
+		_, err := c.eventsCli.Create(k8sutil.SelfHostedMigrationEvent(false, c.cluster))
+		if err != nil {
+			c.logger.Errorf("failed to create self-hosted migration event: %v", err)
+		}
+	}
+	c.logger.Infof("replacing self-hosted member (%s) by a regular member", m.Name)
+	return c.removeMember(toRemove)
+}
+
+// finishSelfHostedMigration moves the cluster back to the running phase once
+// all self-hosted members are replaced.
+func (c *Cluster) finishSelfHostedMigration() {
+	c.status.SetPhase(api.ClusterPhaseRunning)
+	c.logger.Infof("migrated all self-hosted members to regular pods")
+	_, err := c.eventsCli.Create(k8sutil.SelfHostedMigrationEvent(true, c.cluster))
+	if err != nil {
+		c.logger.Errorf("failed to create self-hosted migration event: %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"strings"
+	"testing"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPickOneSelfHostedMember(t *testing.T) {
+	m := &etcdutil.Member{Name: "test-0000", Namespace: metav1.NamespaceDefault}
+	selfHosted := k8sutil.NewSelfHostedEtcdPod(m, []string{m.Name}, nil, "test", "new", "token", api.ClusterSpec{Size: 1}, metav1.OwnerReference{})
+	regular := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "test-0001", Namespace: metav1.NamespaceDefault}}
+
+	tests := []struct {
+		pods     []*v1.Pod
+		spec     api.ClusterSpec
+		wantName string
+	}{
+		{pods: []*v1.Pod{regular, selfHosted}, spec: api.ClusterSpec{}, wantName: "test-0000"},
+		// a self-hosted cluster is not migrated
+		{pods: []*v1.Pod{regular, selfHosted}, spec: api.ClusterSpec{SelfHosted: &api.SelfHostedPolicy{}}},
+		{pods: []*v1.Pod{regular}, spec: api.ClusterSpec{}},
+	}
+	for i, tt := range tests {
+		got := pickOneSelfHostedMember(tt.pods, tt.spec)
+		var gotName string
+		if got != nil {
+			gotName = got.Name
+		}
+		if gotName != tt.wantName {
+			t.Errorf("#%d: picked member %q, want %q", i, gotName, tt.wantName)
+		}
+	}
+}
+
+func TestSaveStaticPodManifest(t *testing.T) {
+	existing := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "manifests", Namespace: metav1.NamespaceDefault},
+		Data:       map[string]string{"other.json": "{}"},
+	}
+	tests := []struct {
+		objs []runtime.Object
+	}{
+		{},
+		{objs: []runtime.Object{existing}},
+	}
+	for i, tt := range tests {
+		kubecli := fake.NewSimpleClientset(tt.objs...)
+		c := &Cluster{
+			logger: logrus.WithField("pkg", "cluster"),
+			config: Config{KubeCli: kubecli},
+			cluster: &api.EtcdCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: metav1.NamespaceDefault},
+				Spec:       api.ClusterSpec{Size: 1, SelfHosted: &api.SelfHostedPolicy{StaticPodManifestConfigMap: "manifests"}},
+			},
+		}
+		m := &etcdutil.Member{Name: "test-0000", Namespace: metav1.NamespaceDefault}
+
+		if err := c.saveStaticPodManifest("manifests", m); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		cm, err := kubecli.CoreV1().ConfigMaps(metav1.NamespaceDefault).Get("manifests", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if !strings.Contains(cm.Data["test-0000.json"], `"name": "test-0000"`) {
+			t.Errorf("#%d: manifest of the seed member is not saved: %v", i, cm.Data)
+		}
+		if len(tt.objs) != 0 && cm.Data["other.json"] != "{}" {
+			t.Errorf("#%d: other manifests are not kept: %v", i, cm.Data)
+		}
+	}
+}
+
+func TestSelfHostedMigrationPhases(t *testing.T) {
+	kubecli := fake.NewSimpleClientset()
+	c := &Cluster{
+		logger:    logrus.WithField("pkg", "cluster"),
+		config:    Config{KubeCli: kubecli, DryRun: true},
+		eventsCli: kubecli.CoreV1().Events(metav1.NamespaceDefault),
+		cluster: &api.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-migration", Namespace: metav1.NamespaceDefault},
+			Spec:       api.ClusterSpec{Size: 1},
+		},
+		status: api.ClusterStatus{Phase: api.ClusterPhaseRunning},
+	}
+	m0 := &etcdutil.Member{Name: "test-migration-0000", Namespace: metav1.NamespaceDefault}
+	m1 := &etcdutil.Member{Name: "test-migration-0001", Namespace: metav1.NamespaceDefault}
+
+	// The single member cannot be replaced: the migration is blocked.
+	c.members = etcdutil.NewMemberSet(m0)
+	if err := c.migrateFromSelfHosted(m0); err != nil {
+		t.Fatal(err)
+	}
+	if c.status.Phase != api.ClusterPhaseRunning {
+		t.Errorf("phase = %s, want %s", c.status.Phase, api.ClusterPhaseRunning)
+	}
+	if !hasCondition(c.status, api.ClusterConditionMigrationBlocked) {
+		t.Error("expect the migration blocked condition")
+	}
+
+	// Once scaled up, the migration starts.
+	c.members = etcdutil.NewMemberSet(m0, m1)
+	if err := c.migrateFromSelfHosted(m0); err != nil {
+		t.Fatal(err)
+	}
+	if c.status.Phase != api.ClusterPhaseMigrating {
+		t.Errorf("phase = %s, want %s", c.status.Phase, api.ClusterPhaseMigrating)
+	}
+	if hasCondition(c.status, api.ClusterConditionMigrationBlocked) {
+		t.Error("expect the migration blocked condition to be cleared")
+	}
+
+	c.finishSelfHostedMigration()
+	if c.status.Phase != api.ClusterPhaseRunning {
+		t.Errorf("phase = %s, want %s", c.status.Phase, api.ClusterPhaseRunning)
+	}
+	// the migration started and completed events
+	if n := len(kubecli.Actions()); n != 2 {
+		t.Errorf("%d actions, want 2 events", n)
+	}
+}
+
+func hasCondition(cs api.ClusterStatus, t api.ClusterConditionType) bool {
+	for _, c := range cs.Conditions {
+		if c.Type == t {
+			return true
+		}
+	}
+	return false
+}
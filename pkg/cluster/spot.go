@@ -0,0 +1,93 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+	"sync"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"k8s.io/api/core/v1"
+)
+
+// InterruptedNodes is the set of spot nodes that are about to be interrupted.
+// The node watcher of the controller fills it and the clusters read it.
+type InterruptedNodes struct {
+	mu    sync.Mutex
+	nodes map[string]bool
+}
+
+func NewInterruptedNodes() *InterruptedNodes {
+	return &InterruptedNodes{nodes: map[string]bool{}}
+}
+
+func (n *InterruptedNodes) Add(name string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.nodes[name] = true
+}
+
+func (n *InterruptedNodes) Delete(name string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.nodes, name)
+}
+
+// Has returns true if the node is about to be interrupted. A nil set is empty.
+func (n *InterruptedNodes) Has(name string) bool {
+	if n == nil {
+		return false
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.nodes[name]
+}
+
+// pickOnePodOnInterruptedNode returns a pod running on an interrupted node if
+// the cluster tolerates spot interruptions, or nil if there is none.
+func pickOnePodOnInterruptedNode(pods []*v1.Pod, cs api.ClusterSpec, nodes *InterruptedNodes) *v1.Pod {
+	if cs.Pod == nil || !cs.Pod.TolerateSpotInterruption {
+		return nil
+	}
+	for _, pod := range pods {
+		if nodes.Has(pod.Spec.NodeName) {
+			return pod
+		}
+	}
+	return nil
+}
+
+// moveOffInterruptedNode removes the member of pod, which runs on a node that
+// is about to be interrupted, so that a new member is added on another node on
+// the next reconciliation. The interrupted node is cordoned by the node watcher.
+// A single member cluster cannot be moved this way without losing its data.
+func (c *Cluster) moveOffInterruptedNode(pod *v1.Pod) error {
+	if c.members.Size() == 1 {
+		c.logger.Warningf("node (%s) of the single member (%s) is about to be interrupted; the member cannot be moved without losing data", pod.Spec.NodeName, pod.Name)
+		return nil
+	}
+	toRemove, ok := c.members[pod.Name]
+	if !ok {
+		return fmt.Errorf("member (%s) not found", pod.Name)
+	}
+	c.logger.Infof("replacing member (%s) on interrupted spot node (%s)", pod.Name, pod.Spec.NodeName)
+	_, err := c.eventsCli.Create(k8sutil.SpotInterruptionEvent(pod.Name, pod.Spec.NodeName, c.cluster))
+	if err != nil {
+		c.logger.Errorf("failed to create spot interruption event: %v", err)
+	}
+	return c.removeMember(toRemove)
+}
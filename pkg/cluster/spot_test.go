@@ -0,0 +1,57 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"testing"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPickOnePodOnInterruptedNode(t *testing.T) {
+	newPod := func(name, node string) *v1.Pod {
+		return &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name}, Spec: v1.PodSpec{NodeName: node}}
+	}
+	pods := []*v1.Pod{newPod("test-0000", "node-1"), newPod("test-0001", "node-2")}
+	nodes := NewInterruptedNodes()
+	nodes.Add("node-2")
+	tolerant := api.ClusterSpec{Pod: &api.PodPolicy{TolerateSpotInterruption: true}}
+
+	tests := []struct {
+		spec     api.ClusterSpec
+		nodes    *InterruptedNodes
+		wantName string
+	}{
+		{spec: tolerant, nodes: nodes, wantName: "test-0001"},
+		// spot interruptions are not handled for this cluster
+		{spec: api.ClusterSpec{}, nodes: nodes},
+		// spot interruptions are not watched
+		{spec: tolerant, nodes: nil},
+		{spec: tolerant, nodes: NewInterruptedNodes()},
+	}
+	for i, tt := range tests {
+		got := pickOnePodOnInterruptedNode(pods, tt.spec, tt.nodes)
+		var gotName string
+		if got != nil {
+			gotName = got.Name
+		}
+		if gotName != tt.wantName {
+			t.Errorf("#%d: picked pod %q, want %q", i, gotName, tt.wantName)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	stateMemberCounterKey = "memberCounter"
+	stateMembersKey       = "members"
+)
+
+// stateConfigMapName returns the name of the ConfigMap the operator persists
+// the in memory state of the cluster in.
+func stateConfigMapName(clusterName string) string {
+	return clusterName + "-operator-state"
+}
+
+// reconcileConfigMap persists the member counter and the member names in the
+// state ConfigMap, if they changed since they were last persisted.
+func (c *Cluster) reconcileConfigMap() error {
+	cm := c.newStateConfigMap()
+	if c.persistedState != nil && c.persistedState[stateMemberCounterKey] == cm.Data[stateMemberCounterKey] &&
+		c.persistedState[stateMembersKey] == cm.Data[stateMembersKey] {
+		return nil
+	}
+	if c.config.DryRun {
+		c.planAction("save operator state", cm.Name)
+		return nil
+	}
+
+	cms := c.config.KubeCli.CoreV1().ConfigMaps(c.cluster.Namespace)
+	old, err := cms.Get(cm.Name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		_, err = cms.Create(cm)
+	case err == nil:
+		old.Data = cm.Data
+		_, err = cms.Update(old)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save operator state: %v", err)
+	}
+	c.persistedState = cm.Data
+	return nil
+}
+
+// loadState restores the member counter from the state ConfigMap, so that a
+// restarted operator does not reuse the names of removed members.
+// The members themselves are listed from etcd by updateMembers.
+func (c *Cluster) loadState() {
+	cm, err := c.config.KubeCli.CoreV1().ConfigMaps(c.cluster.Namespace).Get(stateConfigMapName(c.cluster.Name), metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			c.logger.Warningf("failed to load operator state: %v", err)
+		}
+		return
+	}
+	c.restoreState(cm)
+}
+
+func (c *Cluster) restoreState(cm *v1.ConfigMap) {
+	ct, err := strconv.Atoi(cm.Data[stateMemberCounterKey])
+	if err != nil {
+		c.logger.Warningf("invalid member counter in operator state: %v", err)
+		return
+	}
+	if ct > c.memberCounter {
+		c.memberCounter = ct
+	}
+	c.persistedState = cm.Data
+	c.logger.Infof("loaded operator state: member counter (%d), members (%s)", ct, cm.Data[stateMembersKey])
+}
+
+func (c *Cluster) newStateConfigMap() *v1.ConfigMap {
+	var names []string
+	for name := range c.members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cm := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   stateConfigMapName(c.cluster.Name),
+			Labels: k8sutil.LabelsForCluster(c.cluster.Name),
+		},
+		Data: map[string]string{
+			stateMemberCounterKey: strconv.Itoa(c.memberCounter),
+			stateMembersKey:       strings.Join(names, ","),
+		},
+	}
+	cm.SetOwnerReferences([]metav1.OwnerReference{c.cluster.AsOwner()})
+	return cm
+}
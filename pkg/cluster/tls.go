@@ -0,0 +1,260 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"crypto/tls"
+	"fmt"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+	"github.com/coreos/etcd-operator/pkg/util/retryutil"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// certificateIssueTimeout is how long setup waits for cert-manager to issue
+	// the operator client certificate of a new cluster.
+	certificateIssueTimeout      = 2 * time.Minute
+	certificateIssuePollInterval = 5 * time.Second
+)
+
+func (c *Cluster) isCertManagerTLS() bool {
+	return c.cluster.Spec.TLS != nil && c.cluster.Spec.TLS.CertManager != nil
+}
+
+// ensureCertificates creates the cert-manager Certificates of the cluster and
+// waits until the operator client certificate is issued. The Certificates are
+// garbage collected with the EtcdCluster.
+func (c *Cluster) ensureCertificates() error {
+	ns := c.cluster.Namespace
+	if c.config.DryRun {
+		c.planAction("create certificates", c.cluster.Name)
+		return nil
+	}
+	err := k8sutil.CreateCertificates(c.config.KubeCli, c.cluster.Name, ns, c.cluster.Spec.DNSDomain, c.cluster.Spec.TLS, c.cluster.AsOwner())
+	if err != nil {
+		return err
+	}
+
+	se := c.cluster.Spec.TLS.OperatorSecret(c.cluster.Name)
+	err = retryutil.Retry(certificateIssuePollInterval, int(certificateIssueTimeout/certificateIssuePollInterval), func() (bool, error) {
+		_, err := c.config.KubeCli.CoreV1().Secrets(ns).Get(se, metav1.GetOptions{})
+		if err == nil {
+			return true, nil
+		}
+		if k8sutil.IsKubernetesResourceNotFoundError(err) {
+			return false, nil
+		}
+		return false, err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to wait for certificate secret (%s): %v", se, err)
+	}
+	return nil
+}
+
+// loadTLSConfig loads the TLS config the operator uses to talk to the cluster
+// from the operator secret.
+func (c *Cluster) loadTLSConfig() error {
+	d, err := k8sutil.GetTLSDataFromSecret(c.config.KubeCli, c.cluster.Namespace, c.cluster.Spec.TLS.OperatorSecret(c.cluster.Name))
+	if err != nil {
+		return err
+	}
+	tc, err := etcdutil.NewTLSConfig(d.CertData, d.KeyData, d.CAData)
+	if err != nil {
+		return err
+	}
+	if !c.isCertManagerTLS() {
+		c.tlsConfig = tc
+		return nil
+	}
+
+	// The client certificate is renewed while the cluster runs. tlsConfig is
+	// shared with the goroutines running beside the reconcile loop, so it is not
+	// replaced; the certificate is served from clientCert instead.
+	cert := tc.Certificates[0]
+	c.clientCert.Store(&cert)
+	if c.tlsConfig == nil {
+		tc.Certificates = nil
+		tc.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return c.clientCert.Load().(*tls.Certificate), nil
+		}
+		c.tlsConfig = tc
+	}
+	return nil
+}
+
+// checkCertificateRenewal calls rotateMemberTLS for every TLS secret of the
+// cluster that was updated by cert-manager since the last check.
+func (c *Cluster) checkCertificateRenewal() {
+	if c.tlsSecretVersions == nil {
+		c.tlsSecretVersions = map[string]string{}
+	}
+	tp := c.cluster.Spec.TLS
+	for _, se := range []string{tp.PeerSecret(c.cluster.Name), tp.ServerSecret(c.cluster.Name), tp.OperatorSecret(c.cluster.Name)} {
+		secret, err := c.config.KubeCli.CoreV1().Secrets(c.cluster.Namespace).Get(se, metav1.GetOptions{})
+		if err != nil {
+			c.logger.Warningf("failed to get TLS secret (%s): %v", se, err)
+			continue
+		}
+		last, seen := c.tlsSecretVersions[se]
+		if seen && last != secret.ResourceVersion {
+			if err := c.rotateMemberTLS(se); err != nil {
+				c.logger.Errorf("failed to rotate TLS certificate in secret (%s): %v", se, err)
+				continue
+			}
+		}
+		c.tlsSecretVersions[se] = secret.ResourceVersion
+	}
+}
+
+// rotateMemberTLS makes the cluster use the renewed certificate in secret se.
+// Kubelet updates the secret volumes of the member pods in place and etcd loads
+// its certificates for every new connection, so only the operator client
+// certificate needs to be reloaded.
+func (c *Cluster) rotateMemberTLS(se string) error {
+	if se == c.cluster.Spec.TLS.OperatorSecret(c.cluster.Name) {
+		if err := c.loadTLSConfig(); err != nil {
+			return err
+		}
+	}
+	c.logger.Infof("TLS certificate in secret (%s) was renewed", se)
+	_, err := c.eventsCli.Create(k8sutil.MemberTLSRotatedEvent(se, c.cluster))
+	if err != nil {
+		c.logger.Errorf("failed to create member TLS rotated event: %v", err)
+	}
+	return nil
+}
+
+// handlePeerCertRotation starts a peer certificate rotation when the cluster has
+// the rotate-peer-secret annotation and no rotation is in progress.
+func (c *Cluster) handlePeerCertRotation() {
+	se := c.cluster.Annotations[api.RotatePeerSecretAnnotation]
+	if len(se) == 0 || c.status.PeerCertRotation != nil {
+		return
+	}
+	if err := c.rotatePeerCerts(se); err != nil {
+		c.logger.Errorf("failed to rotate peer certificates: %v", err)
+	}
+}
+
+// rotatePeerCerts starts rotating the peer certificates of the members to the
+// ones in secret newPeerSecret. The members are replaced one at a time by
+// members mounting the new secret, see rotateOneMemberPeerCert, so the cluster
+// keeps its quorum. The CA certificates of both the old and the new secret must
+// trust the peer certificates of the other secret during the rotation.
+func (c *Cluster) rotatePeerCerts(newPeerSecret string) error {
+	tp := c.cluster.Spec.TLS
+	if c.isCertManagerTLS() || !tp.IsSecurePeer() {
+		return fmt.Errorf("peer certificates can only be rotated for static peer TLS")
+	}
+	if newPeerSecret == tp.PeerSecret(c.cluster.Name) {
+		return fmt.Errorf("members already use peer secret (%s)", newPeerSecret)
+	}
+	if c.desiredSize() == 1 {
+		return fmt.Errorf("cannot rotate the peer certificate of a single member cluster without losing data; scale it up first")
+	}
+	if err := k8sutil.ValidatePeerSecret(c.config.KubeCli, c.cluster.Namespace, newPeerSecret); err != nil {
+		return err
+	}
+
+	c.status.PeerCertRotation = &api.RotationStatus{Secret: newPeerSecret, Total: c.desiredSize()}
+	c.logger.Infof("rotating peer certificates to secret (%s)", newPeerSecret)
+	_, err := c.eventsCli.Create(k8sutil.PeerCertRotationEvent(newPeerSecret, false, c.cluster))
+	if err != nil {
+		c.logger.Errorf("failed to create peer cert rotation event: %v", err)
+	}
+	return nil
+}
+
+// podSpec returns the cluster spec new member pods are created from. During a
+// peer certificate rotation, new members mount the new peer secret. After a
+// rolled back upgrade, they run the version the cluster was rolled back to.
+func (c *Cluster) podSpec() api.ClusterSpec {
+	cs := c.cluster.Spec
+	cs.Version = c.desiredVersion()
+	if r := c.status.PeerCertRotation; r != nil {
+		cs.TLS = cs.TLS.DeepCopy()
+		cs.TLS.Static.Member.PeerSecret = r.Secret
+	}
+	return cs
+}
+
+// pickOneMemberWithOldPeerSecret returns a member whose pod does not mount the
+// peer secret se, or nil if all pods do.
+func pickOneMemberWithOldPeerSecret(pods []*v1.Pod, se string) *etcdutil.Member {
+	for _, pod := range pods {
+		if k8sutil.GetPeerSecret(pod) != se {
+			return &etcdutil.Member{Name: pod.Name, Namespace: pod.Namespace}
+		}
+	}
+	return nil
+}
+
+// countPeerSecret returns the number of pods mounting the peer secret se.
+func countPeerSecret(pods []*v1.Pod, se string) int {
+	n := 0
+	for _, pod := range pods {
+		if k8sutil.GetPeerSecret(pod) == se {
+			n++
+		}
+	}
+	return n
+}
+
+// rotateOneMemberPeerCert removes member m so that a member mounting the new
+// peer secret is added in its place on the next reconciliation. The next member
+// is only rotated once the new member has joined and the cluster is back to its
+// full size.
+func (c *Cluster) rotateOneMemberPeerCert(m *etcdutil.Member) error {
+	toRemove, ok := c.members[m.Name]
+	if !ok {
+		return fmt.Errorf("member (%s) not found", m.Name)
+	}
+	c.logger.Infof("replacing member (%s) to rotate its peer certificate", m.Name)
+	return c.removeMember(toRemove)
+}
+
+// finishPeerCertRotation saves the new peer secret in the cluster spec and
+// removes the rotate-peer-secret annotation once all members use the new secret.
+func (c *Cluster) finishPeerCertRotation() error {
+	r := c.status.PeerCertRotation
+	if c.config.DryRun {
+		c.planAction("set peer secret to "+r.Secret, c.cluster.Name)
+		return nil
+	}
+	newCluster := c.cluster.DeepCopy()
+	newCluster.Spec.TLS.Static.Member.PeerSecret = r.Secret
+	delete(newCluster.Annotations, api.RotatePeerSecretAnnotation)
+	c.status.PeerCertRotation = nil
+	newCluster.Status = c.status
+	newCluster, err := c.config.EtcdCRCli.EtcdV1beta2().EtcdClusters(c.cluster.Namespace).Update(newCluster)
+	if err != nil {
+		c.status.PeerCertRotation = r
+		return fmt.Errorf("failed to save the rotated peer secret (%s): %v", r.Secret, err)
+	}
+	c.cluster = newCluster
+	c.logger.Infof("rotated the peer certificates of all members to secret (%s)", r.Secret)
+	_, err = c.eventsCli.Create(k8sutil.PeerCertRotationEvent(r.Secret, true, c.cluster))
+	if err != nil {
+		c.logger.Errorf("failed to create peer cert rotation event: %v", err)
+	}
+	return nil
+}
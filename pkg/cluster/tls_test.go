@@ -0,0 +1,83 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"testing"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newPodWithPeerSecret(name, se string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: metav1.NamespaceDefault},
+		Spec: v1.PodSpec{Volumes: []v1.Volume{{
+			Name:         "member-peer-tls",
+			VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: se}},
+		}}},
+	}
+}
+
+func TestPickOneMemberWithOldPeerSecret(t *testing.T) {
+	tests := []struct {
+		pods        []*v1.Pod
+		wantName    string
+		wantRotated int
+	}{
+		{
+			pods:        []*v1.Pod{newPodWithPeerSecret("test-0000", "peer-new"), newPodWithPeerSecret("test-0001", "peer-old")},
+			wantName:    "test-0001",
+			wantRotated: 1,
+		},
+		{
+			pods:        []*v1.Pod{newPodWithPeerSecret("test-0000", "peer-new"), newPodWithPeerSecret("test-0001", "peer-new")},
+			wantRotated: 2,
+		},
+	}
+	for i, tt := range tests {
+		got := pickOneMemberWithOldPeerSecret(tt.pods, "peer-new")
+		var gotName string
+		if got != nil {
+			gotName = got.Name
+		}
+		if gotName != tt.wantName {
+			t.Errorf("#%d: picked member %q, want %q", i, gotName, tt.wantName)
+		}
+		if n := countPeerSecret(tt.pods, "peer-new"); n != tt.wantRotated {
+			t.Errorf("#%d: rotated members = %d, want %d", i, n, tt.wantRotated)
+		}
+	}
+}
+
+func TestPodSpecDuringPeerCertRotation(t *testing.T) {
+	c := &Cluster{cluster: &api.EtcdCluster{Spec: api.ClusterSpec{
+		Size: 3,
+		TLS:  &api.TLSPolicy{Static: &api.StaticTLS{Member: &api.MemberSecret{PeerSecret: "peer-old"}}},
+	}}}
+	if se := c.podSpec().TLS.Static.Member.PeerSecret; se != "peer-old" {
+		t.Errorf("peer secret without rotation = %q, want %q", se, "peer-old")
+	}
+
+	c.status.PeerCertRotation = &api.RotationStatus{Secret: "peer-new", Total: 3}
+	if se := c.podSpec().TLS.Static.Member.PeerSecret; se != "peer-new" {
+		t.Errorf("peer secret during rotation = %q, want %q", se, "peer-new")
+	}
+	if se := c.cluster.Spec.TLS.Static.Member.PeerSecret; se != "peer-old" {
+		t.Errorf("cluster spec peer secret = %q, want %q", se, "peer-old")
+	}
+}
@@ -16,7 +16,9 @@ package cluster
 
 import (
 	"fmt"
+	"time"
 
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
 	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
 
 	"k8s.io/api/core/v1"
@@ -24,35 +26,117 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 )
 
-func (c *Cluster) upgradeOneMember(memberName string) error {
-	c.status.SetUpgradingCondition(c.cluster.Spec.Version)
+// defaultUpgradeTimeout is how long an upgraded member may stay unready
+// before the upgrade is rolled back, if spec.upgradeTimeoutSeconds is not set.
+const defaultUpgradeTimeout = 5 * time.Minute
 
+func (c *Cluster) upgradeOneMember(memberName, version string) error {
+	c.status.SetUpgradingCondition(version)
+
+	oldVersion, err := c.setMemberVersion(memberName, version)
+	if err != nil {
+		return err
+	}
+	c.logger.Infof("finished upgrading the etcd member %v", memberName)
+	_, err = c.eventsCli.Create(k8sutil.MemberUpgradedEvent(memberName, oldVersion, version, c.cluster))
+	if err != nil {
+		c.logger.Errorf("failed to create member upgraded event: %v", err)
+	}
+
+	return nil
+}
+
+// setMemberVersion patches the image of the member's pod to the given etcd version
+// and returns the version it ran before.
+func (c *Cluster) setMemberVersion(memberName, version string) (string, error) {
 	ns := c.cluster.Namespace
 
 	pod, err := c.config.KubeCli.CoreV1().Pods(ns).Get(memberName, metav1.GetOptions{})
 	if err != nil {
-		return fmt.Errorf("fail to get pod (%s): %v", memberName, err)
+		return "", fmt.Errorf("fail to get pod (%s): %v", memberName, err)
 	}
 	oldpod := pod.DeepCopy()
+	if c.config.DryRun {
+		c.planAction("change version to "+version, memberName)
+		return k8sutil.GetEtcdVersion(oldpod), nil
+	}
 
-	c.logger.Infof("upgrading the etcd member %v from %s to %s", memberName, k8sutil.GetEtcdVersion(pod), c.cluster.Spec.Version)
-	pod.Spec.Containers[0].Image = k8sutil.ImageName(c.cluster.Spec.Repository, c.cluster.Spec.Version)
-	k8sutil.SetEtcdVersion(pod, c.cluster.Spec.Version)
+	c.logger.Infof("changing the etcd member %v from %s to %s", memberName, k8sutil.GetEtcdVersion(pod), version)
+	pod.Spec.Containers[0].Image = k8sutil.ImageName(c.cluster.Spec.Repository, version)
+	k8sutil.SetEtcdVersion(pod, version)
 
 	patchdata, err := k8sutil.CreatePatch(oldpod, pod, v1.Pod{})
 	if err != nil {
-		return fmt.Errorf("error creating patch: %v", err)
+		return "", fmt.Errorf("error creating patch: %v", err)
 	}
 
 	_, err = c.config.KubeCli.CoreV1().Pods(ns).Patch(pod.GetName(), types.StrategicMergePatchType, patchdata)
 	if err != nil {
-		return fmt.Errorf("fail to update the etcd member (%s): %v", memberName, err)
+		return "", fmt.Errorf("fail to update the etcd member (%s): %v", memberName, err)
 	}
-	c.logger.Infof("finished upgrading the etcd member %v", memberName)
-	_, err = c.eventsCli.Create(k8sutil.MemberUpgradedEvent(memberName, k8sutil.GetEtcdVersion(oldpod), c.cluster.Spec.Version, c.cluster))
+	return k8sutil.GetEtcdVersion(oldpod), nil
+}
+
+// desiredVersion returns the etcd version the members should run: the spec
+// version, unless the upgrade to it was rolled back.
+func (c *Cluster) desiredVersion() string {
+	if v := c.cluster.Spec.Version; v != c.status.RolledBackVersion || len(c.status.CurrentVersion) == 0 {
+		return v
+	}
+	return c.status.CurrentVersion
+}
+
+// checkUpgradedMember waits for the last upgraded member to become ready before
+// the next member is upgraded, and rolls the upgrade back if it does not become
+// ready within the upgrade timeout.
+func (c *Cluster) checkUpgradedMember(pods []*v1.Pod) error {
+	var pod *v1.Pod
+	for _, p := range pods {
+		if p.Name == c.upgradedMember {
+			pod = p
+		}
+	}
+	if pod == nil || k8sutil.IsPodReady(pod) {
+		// The member was upgraded, or replaced with a new member.
+		c.upgradedMember = ""
+		return nil
+	}
+
+	timeout := defaultUpgradeTimeout
+	if c.cluster.Spec.UpgradeTimeoutSeconds > 0 {
+		timeout = time.Duration(c.cluster.Spec.UpgradeTimeoutSeconds) * time.Second
+	}
+	if time.Since(c.upgradedAt) < timeout {
+		c.logger.Infof("waiting for the upgraded member (%s) to become ready", c.upgradedMember)
+		return nil
+	}
+	if len(c.status.PreviousVersion) == 0 {
+		c.logger.Warningf("upgraded member (%s) is not ready, but the version to roll back to is unknown", c.upgradedMember)
+		return nil
+	}
+	return c.rollbackVersion(c.status.PreviousVersion)
+}
+
+// rollbackVersion puts the last upgraded member back on previousVersion and
+// records the spec version as rolled back, so that the upgrade is not retried
+// until the spec version changes. The rollback is safe
+// as long as not all members are upgraded, since etcd only raises the cluster
+// version once all members run the new version.
+func (c *Cluster) rollbackVersion(previousVersion string) error {
+	memberName := c.upgradedMember
+	failedVersion, err := c.setMemberVersion(memberName, previousVersion)
 	if err != nil {
-		c.logger.Errorf("failed to create member upgraded event: %v", err)
+		return fmt.Errorf("fail to roll back member (%s): %v", memberName, err)
+	}
+	c.logger.Warningf("rolled back the etcd member %v from %s to %s", memberName, failedVersion, previousVersion)
+	_, err = c.eventsCli.Create(k8sutil.MemberRolledBackEvent(memberName, failedVersion, previousVersion, c.cluster))
+	if err != nil {
+		c.logger.Errorf("failed to create member rolled back event: %v", err)
 	}
 
+	c.upgradedMember = ""
+	c.status.SetVersion(previousVersion)
+	c.status.RolledBackVersion = c.cluster.Spec.Version
+	c.status.ClearCondition(api.ClusterConditionUpgrading)
 	return nil
 }
@@ -0,0 +1,132 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	ktesting "k8s.io/client-go/testing"
+)
+
+func TestCheckUpgradedMemberWaitsForReadiness(t *testing.T) {
+	tests := []struct {
+		podName    string
+		ready      bool
+		upgradedAt time.Time
+		// wantWaiting is true if the upgraded member is still awaited.
+		wantWaiting bool
+	}{
+		{podName: "test-0000", ready: true, upgradedAt: time.Now(), wantWaiting: false},
+		{podName: "test-0000", ready: false, upgradedAt: time.Now(), wantWaiting: true},
+		// the upgraded member was replaced
+		{podName: "test-0001", ready: false, upgradedAt: time.Now(), wantWaiting: false},
+		// timed out, but there is no version to roll back to
+		{podName: "test-0000", ready: false, upgradedAt: time.Now().Add(-time.Hour), wantWaiting: true},
+	}
+	for i, tt := range tests {
+		status := v1.ConditionFalse
+		if tt.ready {
+			status = v1.ConditionTrue
+		}
+		pod := &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: tt.podName},
+			Status:     v1.PodStatus{Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: status}}},
+		}
+		c := &Cluster{
+			logger:         logrus.WithField("pkg", "cluster"),
+			cluster:        &api.EtcdCluster{Spec: api.ClusterSpec{Size: 3, Version: "3.2.13"}},
+			upgradedMember: "test-0000",
+			upgradedAt:     tt.upgradedAt,
+		}
+		if err := c.checkUpgradedMember([]*v1.Pod{pod}); err != nil {
+			t.Fatalf("#%d: unexpected error: %v", i, err)
+		}
+		if waiting := len(c.upgradedMember) != 0; waiting != tt.wantWaiting {
+			t.Errorf("#%d: waiting = %v, want %v", i, waiting, tt.wantWaiting)
+		}
+	}
+}
+
+func TestCheckUpgradedMemberRollsBack(t *testing.T) {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-0000", Namespace: metav1.NamespaceDefault, Annotations: map[string]string{}},
+		Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "etcd", Image: k8sutil.ImageName("", "3.2.13")}}},
+		Status:     v1.PodStatus{Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionFalse}}},
+	}
+	k8sutil.SetEtcdVersion(pod, "3.2.13")
+	kubecli := fake.NewSimpleClientset(pod)
+	kubecli.PrependReactor("patch", "pods", func(ktesting.Action) (bool, runtime.Object, error) {
+		return true, pod, nil
+	})
+	c := &Cluster{
+		logger:    logrus.WithField("pkg", "cluster"),
+		config:    Config{KubeCli: kubecli},
+		eventsCli: kubecli.CoreV1().Events(metav1.NamespaceDefault),
+		cluster: &api.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: metav1.NamespaceDefault},
+			Spec:       api.ClusterSpec{Size: 3, Version: "3.2.13"},
+		},
+		status:         api.ClusterStatus{CurrentVersion: "3.2.12", TargetVersion: "3.2.13", PreviousVersion: "3.2.12"},
+		upgradedMember: "test-0000",
+		upgradedAt:     time.Now().Add(-time.Hour),
+	}
+	if err := c.checkUpgradedMember([]*v1.Pod{pod}); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.cluster.Spec.Version != "3.2.13" {
+		t.Errorf("spec version = %s, want it unchanged", c.cluster.Spec.Version)
+	}
+	if c.status.RolledBackVersion != "3.2.13" || c.status.CurrentVersion != "3.2.12" {
+		t.Errorf("status = %+v, want rolled back from 3.2.13 to 3.2.12", c.status)
+	}
+	var patch []byte
+	for _, a := range kubecli.Actions() {
+		if pa, ok := a.(ktesting.PatchActionImpl); ok {
+			patch = pa.Patch
+		}
+	}
+	var got v1.Pod
+	if err := json.Unmarshal(patch, &got); err != nil {
+		t.Fatalf("failed to decode patch %q: %v", patch, err)
+	}
+	if v := k8sutil.GetEtcdVersion(&got); v != "3.2.12" {
+		t.Errorf("member version = %s, want 3.2.12", v)
+	}
+
+	// The rolled back version is not retried, and new members run the previous version.
+	if v := c.desiredVersion(); v != "3.2.12" {
+		t.Errorf("desired version = %s, want 3.2.12", v)
+	}
+	if v := c.podSpec().Version; v != "3.2.12" {
+		t.Errorf("pod spec version = %s, want 3.2.12", v)
+	}
+
+	// A new spec version is upgraded to again.
+	c.cluster.Spec.Version = "3.2.14"
+	if v := c.desiredVersion(); v != "3.2.14" {
+		t.Errorf("desired version = %s, want 3.2.14", v)
+	}
+}
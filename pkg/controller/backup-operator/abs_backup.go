@@ -17,21 +17,27 @@ package controller
 import (
 	"crypto/tls"
 	"fmt"
+	"time"
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
 	"github.com/coreos/etcd-operator/pkg/backup"
+	"github.com/coreos/etcd-operator/pkg/backup/reader"
+	backuputil "github.com/coreos/etcd-operator/pkg/backup/util"
 	"github.com/coreos/etcd-operator/pkg/backup/writer"
 	"github.com/coreos/etcd-operator/pkg/util/azureutil/absfactory"
 	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
 	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
 
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
 // TODO: replace this with generic backend interface for other options (PV, Azure)
 // handleABS saves etcd cluster's backup to specificed ABS path.
-func handleABS(kubecli kubernetes.Interface, s *api.ABSBackupSource, sch api.BackupSchedule, endpoints []string, clientTLSSecret, namespace string) (*api.BackupStatus, error) {
-	cli, err := absfactory.NewClientFromSecret(kubecli, namespace, s.ABSSecret)
+func handleABS(kubecli kubernetes.Interface, s *api.ABSBackupSource, sch api.BackupSchedule, endpoints []string, preferredEndpoint, clientTLSSecret, namespace string, hooks api.BackupHooks, rt *api.BackupReplicationConfig, tags map[string]string, limiter *rate.Limiter, retry func(func() error) error) (*api.BackupStatus, error) {
+	cli, err := newABSClient(kubecli, namespace, s)
 	if err != nil {
 		return nil, err
 	}
@@ -49,18 +55,64 @@ func handleABS(kubecli kubernetes.Interface, s *api.ABSBackupSource, sch api.Bac
 	}
 
 	bm := backup.NewBackupManagerFromWriter(kubecli, writer.NewABSWriter(cli.ABS), tlsConfig, endpoints, namespace)
+	bm.SetPreferredEndpoint(preferredEndpoint)
+	bm.SetUploadLimiter(limiter)
+	bm.SetRetry(retry)
 	appendRev := false
 	if sch.BackupIntervalInSecond > 0 {
 		appendRev = true
 	}
-	rev, etcdVersion, err := bm.SaveSnap(s.Path, appendRev)
+	rev, etcdVersion, err := bm.SaveSnapWithHooks(s.Path, appendRev, hooks.PreBackupHook, hooks.PostBackupHook)
+	if backup.IsPreBackupHookError(err) {
+		return nil, err
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to save snapshot (%v)", err)
 	}
+	backupPath := backup.AppendRevToPath(appendRev, rev, s.Path)
+	// The backup is saved: a tagging failure must not fail and retry it.
+	if err := bm.TagBackup(backupPath, backupTags(tags, etcdVersion, rev)); err != nil {
+		logrus.Warningf("failed to tag backup (%v): %v", backupPath, err)
+	}
 
-	err = bm.PurgeBackup(s.Path, sch.MaxBackups)
+	bs := &api.BackupStatus{
+		EtcdVersion:      etcdVersion,
+		EtcdRevision:     rev,
+		BackupPath:       backupPath,
+		StorageUsedBytes: bm.StorageUsedBytes(),
+	}
+	if rt != nil {
+		replicateBackup(kubecli, namespace, bm, reader.NewABSReader(cli.ABS), rt, s.Path, rev, appendRev, bs)
+	}
+
+	err = bm.PurgeBackup(s.Path, sch.MaxBackups, time.Duration(sch.MaxBackupAgeInSecond)*time.Second)
 	if err != nil {
 		return nil, fmt.Errorf("failed to purge backups (%v)", err)
 	}
-	return &api.BackupStatus{EtcdVersion: etcdVersion, EtcdRevision: rev}, nil
+	return bs, nil
+}
+
+// newABSClient creates an ABS client from the SAS token secret if it is set,
+// and from the storage account key secret otherwise.
+func newABSClient(kubecli kubernetes.Interface, namespace string, s *api.ABSBackupSource) (*absfactory.ABSClient, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	if len(s.SASTokenSecret) == 0 {
+		return absfactory.NewClientFromSecret(kubecli, namespace, s.ABSSecret, s.PrivateEndpointURL)
+	}
+
+	se, err := kubecli.CoreV1().Secrets(namespace).Get(s.SASTokenSecret, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SAS token secret (%s): %v", s.SASTokenSecret, err)
+	}
+	container, _, err := backuputil.ParseBucketAndKey(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := string(se.Data[api.AzureSecretSASEndpoint])
+	if len(s.PrivateEndpointURL) != 0 {
+		endpoint = s.PrivateEndpointURL
+	}
+	return absfactory.NewClientFromSASToken(endpoint, container, string(se.Data[api.AzureSecretSASToken]))
 }
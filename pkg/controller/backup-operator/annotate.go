@@ -0,0 +1,53 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"encoding/json"
+	"strconv"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// annotateBackupToCluster links the backup of bs to the EtcdCluster clusterName
+// so that users can find the backup to restore from. It patches the annotations
+// instead of updating the CR to not conflict with spec updates of the cluster.
+// A failure is only logged since the annotations are informational.
+func (b *Backup) annotateBackupToCluster(clusterName string, bs *api.BackupStatus) {
+	data, err := lastBackupPatch(bs)
+	if err != nil {
+		b.logger.Warningf("failed to create last backup patch for cluster %v: %v", clusterName, err)
+		return
+	}
+	_, err = b.backupCRCli.EtcdV1beta2().EtcdClusters(b.namespace).Patch(clusterName, types.MergePatchType, data)
+	if err != nil {
+		b.logger.Warningf("failed to annotate cluster %v with its last backup: %v", clusterName, err)
+	}
+}
+
+// lastBackupPatch returns the merge patch setting the last backup annotations to bs.
+func lastBackupPatch(bs *api.BackupStatus) ([]byte, error) {
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				api.LastBackupPathAnnotation:     bs.BackupPath,
+				api.LastBackupRevisionAnnotation: strconv.FormatInt(bs.EtcdRevision, 10),
+			},
+		},
+	}
+	return json.Marshal(patch)
+}
@@ -0,0 +1,49 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"encoding/json"
+	"testing"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestLastBackupPatch(t *testing.T) {
+	data, err := lastBackupPatch(&api.BackupStatus{BackupPath: "bucket/etcd.backup_0000000000000010", EtcdRevision: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var patch struct {
+		Metadata metav1.ObjectMeta `json:"metadata"`
+	}
+	if err := json.Unmarshal(data, &patch); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		api.LastBackupPathAnnotation:     "bucket/etcd.backup_0000000000000010",
+		api.LastBackupRevisionAnnotation: "16",
+	}
+	if len(patch.Metadata.Annotations) != len(want) {
+		t.Fatalf("annotations = %v, want %v", patch.Metadata.Annotations, want)
+	}
+	for k, v := range want {
+		if patch.Metadata.Annotations[k] != v {
+			t.Errorf("annotation %v = %q, want %q", k, patch.Metadata.Annotations[k], v)
+		}
+	}
+}
@@ -15,21 +15,27 @@
 package controller
 
 import (
+	"fmt"
+	"strconv"
 	"time"
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/backup"
 
 	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
 )
 
-// Note BackupStatus returned here is from the first round run
-func (b *Backup) handle(spec *api.BackupSpec) (*api.BackupStatus, error) {
-	status, err := b.handleBackup(spec)
-	b.handleBackupSchedule(spec)
+// Note BackupStatus returned here is from the first round run.
+// The backups of the EtcdBackup of key share its upload limiter.
+func (b *Backup) handle(key string, spec *api.BackupSpec) (*api.BackupStatus, error) {
+	limiter := b.uploadLimiter(key, spec.UploadRateLimitBytesPerSec)
+	status, err := b.handleBackup(spec, limiter)
+	b.handleBackupSchedule(spec, limiter)
 	return status, err
 }
 
-func (b *Backup) handleBackupSchedule(spec *api.BackupSpec) {
+func (b *Backup) handleBackupSchedule(spec *api.BackupSpec, limiter *rate.Limiter) {
 	interval := spec.BackupSchedule.BackupIntervalInSecond
 	if interval >= 0 {
 		// we can only support BackupInterval greater than a certain value
@@ -44,29 +50,101 @@ func (b *Backup) handleBackupSchedule(spec *api.BackupSpec) {
 			for {
 				select {
 				case <-time.After(time.Duration(interval) * time.Second):
-					b.handleBackup(spec)
+					b.handleBackup(spec, limiter)
 				}
 			}
 		}()
 	}
 }
 
-func (b *Backup) handleBackup(spec *api.BackupSpec) (*api.BackupStatus, error) {
+// handleBackup saves a backup to the storage of the spec, retrying transient storage failures.
+// The returned status is never nil and records the attempts made, even on error.
+// The uploads are limited by limiter unless it is nil.
+func (b *Backup) handleBackup(spec *api.BackupSpec, limiter *rate.Limiter) (*api.BackupStatus, error) {
+	if err := spec.ValidateTags(); err != nil {
+		return &api.BackupStatus{}, err
+	}
+	if spec.UploadRateLimitBytesPerSec < 0 {
+		return &api.BackupStatus{}, fmt.Errorf("uploadRateLimitBytesPerSec must not be negative, got %d", spec.UploadRateLimitBytesPerSec)
+	}
+	var (
+		bs       *api.BackupStatus
+		attempts int
+		lastErr  string
+	)
+	// Only saving the snapshot is retried; the backup hooks run once.
+	retry := func(save func() error) error {
+		return retryWithBackoff(backupMaxRetries, func() error {
+			attempts++
+			err := save()
+			if err != nil {
+				logrus.Warningf("backup attempt %d failed: %v", attempts, err)
+			}
+			return err
+		})
+	}
+	var err error
 	switch spec.StorageType {
 	case api.BackupStorageTypeS3:
-		bs, err := handleS3(b.kubecli, spec.S3, spec.EtcdEndpoints, spec.ClientTLSSecret, b.namespace)
-		if err != nil {
-			return nil, err
-		}
-		return bs, nil
+		bs, err = handleS3(b.kubecli, spec.S3, spec.BackupSchedule, spec.EtcdEndpoints, spec.PreferredEndpoint, spec.ClientTLSSecret, b.namespace, spec.BackupHooks, spec.ReplicationTarget, specTags(spec), limiter, retry)
 	case api.BackupStorageTypeABS:
-		bs, err := handleABS(b.kubecli, spec.ABS, spec.BackupSchedule, spec.EtcdEndpoints, spec.ClientTLSSecret, b.namespace)
-		if err != nil {
-			return nil, err
-		}
-		return bs, nil
+		bs, err = handleABS(b.kubecli, spec.ABS, spec.BackupSchedule, spec.EtcdEndpoints, spec.PreferredEndpoint, spec.ClientTLSSecret, b.namespace, spec.BackupHooks, spec.ReplicationTarget, specTags(spec), limiter, retry)
 	default:
 		logrus.Fatalf("unknown StorageType: %v", spec.StorageType)
 	}
-	return nil, nil
+	if bs == nil {
+		bs = &api.BackupStatus{}
+	}
+	if err != nil {
+		lastErr = err.Error()
+		// the backup failed before the snapshot was attempted.
+		if attempts == 0 {
+			attempts = 1
+		}
+	}
+	if err == nil && len(spec.ClusterName) != 0 {
+		b.annotateBackupToCluster(spec.ClusterName, bs)
+	}
+	bs.Attempts = attempts
+	bs.LastError = lastErr
+	return bs, err
+}
+
+// specTags returns the tags of the backup spec together with the cluster tag.
+func specTags(spec *api.BackupSpec) map[string]string {
+	tags := map[string]string{}
+	for k, v := range spec.Tags {
+		tags[k] = v
+	}
+	if len(spec.ClusterName) != 0 {
+		tags[api.BackupTagCluster] = spec.ClusterName
+	}
+	return tags
+}
+
+// backupTags returns the tags to set on the backup of the etcd version and revision.
+func backupTags(tags map[string]string, etcdVersion string, rev int64) map[string]string {
+	bt := map[string]string{
+		api.BackupTagVersion:  etcdVersion,
+		api.BackupTagRevision: strconv.FormatInt(rev, 10),
+	}
+	for k, v := range tags {
+		bt[k] = v
+	}
+	return bt
+}
+
+// retryWithBackoff calls fn until it succeeds or has been retried maxRetries times,
+// doubling the wait between calls from backupRetryBaseDelay.
+// Only transient storage errors are retried; others, e.g. a denied request, would fail again.
+func retryWithBackoff(maxRetries int, fn func() error) error {
+	delay := backupRetryBaseDelay
+	for i := 0; ; i++ {
+		err := fn()
+		if err == nil || !backup.IsTransientError(err) || i >= maxRetries {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
 }
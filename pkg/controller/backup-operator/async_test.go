@@ -0,0 +1,93 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/backup"
+)
+
+func TestRetryWithBackoff(t *testing.T) {
+	defer func(d time.Duration) { backupRetryBaseDelay = d }(backupRetryBaseDelay)
+	backupRetryBaseDelay = 0
+
+	transient := &backup.TransientError{Err: errors.New("503 service unavailable")}
+	tests := []struct {
+		errs      []error
+		wantCalls int
+		wantErr   error
+	}{
+		{errs: nil, wantCalls: 1},
+		{errs: []error{transient, transient}, wantCalls: 3},
+		{errs: []error{transient, transient, transient, transient, transient}, wantCalls: 4, wantErr: transient},
+	}
+	for i, tt := range tests {
+		calls := 0
+		err := retryWithBackoff(3, func() error {
+			calls++
+			if calls <= len(tt.errs) {
+				return tt.errs[calls-1]
+			}
+			return nil
+		})
+		if err != tt.wantErr {
+			t.Errorf("#%d: err = %v, want %v", i, err, tt.wantErr)
+		}
+		if calls != tt.wantCalls {
+			t.Errorf("#%d: calls = %d, want %d", i, calls, tt.wantCalls)
+		}
+	}
+
+	for _, perr := range []error{
+		errors.New("403 access denied"),
+		&backup.PreBackupHookError{Err: transient},
+	} {
+		calls := 0
+		err := retryWithBackoff(3, func() error {
+			calls++
+			return perr
+		})
+		if err != perr || calls != 1 {
+			t.Errorf("%v: err = %v, calls = %d, want no retry", perr, err, calls)
+		}
+	}
+}
+
+func TestBackupTags(t *testing.T) {
+	spec := &api.BackupSpec{ClusterName: "example", Tags: map[string]string{"team": "storage"}}
+	got := backupTags(specTags(spec), "3.2.13", 42)
+	want := map[string]string{
+		"team":                "storage",
+		api.BackupTagCluster:  "example",
+		api.BackupTagVersion:  "3.2.13",
+		api.BackupTagRevision: "42",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tags = %v, want %v", got, want)
+	}
+	if len(spec.Tags) != 1 {
+		t.Errorf("spec tags were modified: %v", spec.Tags)
+	}
+
+	// the cluster tag requires the cluster name
+	if _, ok := specTags(&api.BackupSpec{})[api.BackupTagCluster]; ok {
+		t.Errorf("expect no cluster tag without cluster name")
+	}
+}
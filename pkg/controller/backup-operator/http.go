@@ -0,0 +1,174 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/backup/writer"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	// etcdBackupsHTTPPath is the prefix of the paths of the EtcdBackup
+	// subresources the backup operator serves:
+	// <etcdBackupsHTTPPath><namespace>/etcdbackups/<backup-name>/files and
+	// <etcdBackupsHTTPPath><namespace>/etcdbackups/<backup-name>/metadata.
+	etcdBackupsHTTPPath = "/apis/" + api.SchemeGroupVersion.String() + "/namespaces/"
+
+	// newBackupWriter returns the writer of the storage of a backup CR. It is a
+	// variable so that tests can replace the storage.
+	newBackupWriter = (*Backup).backupWriter
+)
+
+const listenAddr = "0.0.0.0:19999"
+
+func (b *Backup) startHTTP() {
+	http.HandleFunc(etcdBackupsHTTPPath, b.handleEtcdBackups)
+	http.Handle("/metrics", prometheus.Handler())
+	logrus.Infof("listening on %v", listenAddr)
+	panic(http.ListenAndServe(listenAddr, nil))
+}
+
+// handleEtcdBackups serves the files and metadata subresources of the
+// EtcdBackups in the namespace of the backup operator.
+func (b *Backup) handleEtcdBackups(w http.ResponseWriter, req *http.Request) {
+	parts := strings.Split(req.URL.Path[len(etcdBackupsHTTPPath):], "/")
+	if len(parts) != 4 || parts[0] != b.namespace || parts[1] != api.EtcdBackupResourcePlural || len(parts[2]) == 0 {
+		http.NotFound(w, req)
+		return
+	}
+	backupName := parts[2]
+
+	var err error
+	switch parts[3] {
+	case "files":
+		err = b.listBackupFiles(w, backupName)
+	case "metadata":
+		err = b.backupMetadata(w, backupName, req.URL.Query().Get("path"))
+	default:
+		http.NotFound(w, req)
+		return
+	}
+	if err != nil {
+		logrus.Error(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// listBackupFiles returns the list of backup files saved under the path of
+// the named backup CR as JSON.
+func (b *Backup) listBackupFiles(w http.ResponseWriter, backupName string) error {
+	backupWriter, path, closeWriter, err := newBackupWriter(b, backupName)
+	if err != nil {
+		return err
+	}
+	defer closeWriter()
+
+	files, err := backupWriter.List(path)
+	if err != nil {
+		return fmt.Errorf("failed to list backup files (%v): %v", path, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(files)
+}
+
+// backupMetadata returns the metadata of the backup file at filePath, which
+// must be under the path of the named backup CR, as JSON. If filePath is
+// empty, the metadata of the file at the backup path is returned.
+func (b *Backup) backupMetadata(w http.ResponseWriter, backupName, filePath string) error {
+	backupWriter, path, closeWriter, err := newBackupWriter(b, backupName)
+	if err != nil {
+		return err
+	}
+	defer closeWriter()
+
+	if len(filePath) != 0 {
+		if !strings.HasPrefix(filePath, path) {
+			return fmt.Errorf("path (%s) is not under the backup path (%s)", filePath, path)
+		}
+		path = filePath
+	}
+	md, err := backupWriter.Head(path)
+	if err != nil {
+		return fmt.Errorf("failed to get backup metadata (%v): %v", path, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(md)
+}
+
+// backupWriter returns the writer of the storage of the named backup CR, the
+// backup path, and a function that closes the storage client.
+func (b *Backup) backupWriter(backupName string) (writer.Writer, string, func(), error) {
+	obj := &api.EtcdBackup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      backupName,
+			Namespace: b.namespace,
+		},
+	}
+	v, exists, err := b.indexer.Get(obj)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed to get backup CR for backup-name (%v): %v", backupName, err)
+	}
+	if !exists {
+		return nil, "", nil, fmt.Errorf("no backup CR found for backup-name (%v)", backupName)
+	}
+	eb := v.(*api.EtcdBackup)
+
+	var (
+		backupWriter writer.Writer
+		path         string
+		closeWriter  = func() {}
+	)
+
+	switch eb.Spec.StorageType {
+	case api.BackupStorageTypeS3:
+		if eb.Spec.S3 == nil {
+			return nil, "", nil, errors.New("empty s3 backup source")
+		}
+		s3Cli, err := newS3Client(b.kubecli, b.namespace, eb.Spec.S3)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("failed to create S3 client: %v", err)
+		}
+		backupWriter = writer.NewS3Writer(s3Cli.S3)
+		closeWriter = s3Cli.Close
+		path = eb.Spec.S3.Path
+	case api.BackupStorageTypeABS:
+		if eb.Spec.ABS == nil {
+			return nil, "", nil, errors.New("empty abs backup source")
+		}
+		absCli, err := newABSClient(b.kubecli, b.namespace, eb.Spec.ABS)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("failed to create ABS client: %v", err)
+		}
+
+		backupWriter = writer.NewABSWriter(absCli.ABS)
+		path = eb.Spec.ABS.Path
+	default:
+		return nil, "", nil, fmt.Errorf("unknown backup storage type (%s) for backup CR (%v)", eb.Spec.StorageType, backupName)
+	}
+
+	return backupWriter, path, closeWriter, nil
+}
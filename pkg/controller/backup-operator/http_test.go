@@ -0,0 +1,108 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/backup/writer"
+)
+
+// fakeWriter serves the backup files it holds by path.
+type fakeWriter struct {
+	files map[string]writer.BackupFile
+}
+
+func (f *fakeWriter) Write(path string, r io.Reader) (int64, error) {
+	return 0, errors.New("read-only")
+}
+func (f *fakeWriter) WriteMultipart(path string, r io.Reader, partSize int64) (int64, error) {
+	return 0, errors.New("read-only")
+}
+func (f *fakeWriter) Purge(path string, maxBackups int, maxAge time.Duration) error { return nil }
+func (f *fakeWriter) TotalSize(path string) (int64, error)                          { return 0, nil }
+func (f *fakeWriter) Tag(path string, tags map[string]string) error                 { return nil }
+
+func (f *fakeWriter) List(path string) ([]writer.BackupFile, error) {
+	files := []writer.BackupFile{}
+	for _, bf := range f.files {
+		files = append(files, bf)
+	}
+	return files, nil
+}
+
+func (f *fakeWriter) Head(path string) (*writer.BackupMetadata, error) {
+	bf, ok := f.files[path]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return &writer.BackupMetadata{BackupFile: bf, EtcdVersion: "3.2.13"}, nil
+}
+
+func TestHandleEtcdBackups(t *testing.T) {
+	bf := writer.BackupFile{Name: "bucket/etcd.backup_0000000000000010", Size: 10, EtcdRevision: 16}
+	fw := &fakeWriter{files: map[string]writer.BackupFile{bf.Name: bf}}
+	old := newBackupWriter
+	newBackupWriter = func(b *Backup, backupName string) (writer.Writer, string, func(), error) {
+		if backupName != "example" {
+			return nil, "", nil, errors.New("no backup CR found")
+		}
+		return fw, "bucket/etcd.backup", func() {}, nil
+	}
+	defer func() { newBackupWriter = old }()
+
+	b := &Backup{namespace: "default"}
+	prefix := "/apis/etcd.database.coreos.com/v1beta2/namespaces/"
+	tests := []struct {
+		path       string
+		wantStatus int
+		want       interface{}
+	}{
+		{path: prefix + "default/etcdbackups/example/files", wantStatus: http.StatusOK, want: []writer.BackupFile{bf}},
+		{path: prefix + "default/etcdbackups/example/metadata?path=" + bf.Name, wantStatus: http.StatusOK,
+			want: &writer.BackupMetadata{BackupFile: bf, EtcdVersion: "3.2.13"}},
+		// the path must be under the backup path
+		{path: prefix + "default/etcdbackups/example/metadata?path=bucket/other", wantStatus: http.StatusInternalServerError},
+		{path: prefix + "default/etcdbackups/missing/files", wantStatus: http.StatusInternalServerError},
+		{path: prefix + "other/etcdbackups/example/files", wantStatus: http.StatusNotFound},
+		{path: prefix + "default/etcdbackups/example/status", wantStatus: http.StatusNotFound},
+		{path: prefix + "default/etcdbackups//files", wantStatus: http.StatusNotFound},
+	}
+	for i, tt := range tests {
+		rec := httptest.NewRecorder()
+		b.handleEtcdBackups(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != tt.wantStatus {
+			t.Errorf("#%d: status = %d, want %d", i, rec.Code, tt.wantStatus)
+			continue
+		}
+		if tt.want == nil {
+			continue
+		}
+		got := reflect.New(reflect.TypeOf(tt.want)).Interface()
+		if err := json.Unmarshal(rec.Body.Bytes(), got); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if got := reflect.ValueOf(got).Elem().Interface(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("#%d: response = %+v, want %+v", i, got, tt.want)
+		}
+	}
+}
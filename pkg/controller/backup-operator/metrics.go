@@ -0,0 +1,30 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var backupStorageBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "etcd_backup_storage_bytes",
+	Help: "Total size of the backup files under the backup path after the last backup",
+},
+	[]string{"backup", "storage_type"},
+)
+
+func init() {
+	prometheus.MustRegister(backupStorageBytes)
+}
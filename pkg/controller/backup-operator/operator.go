@@ -18,6 +18,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"sync"
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
 	"github.com/coreos/etcd-operator/pkg/client"
@@ -26,6 +27,7 @@ import (
 	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
 
 	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
 	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
@@ -46,6 +48,10 @@ type Backup struct {
 	kubeExtCli  apiextensionsclient.Interface
 
 	createCRD bool
+
+	// uploadLimiters are the upload limiters of the EtcdBackups by key.
+	uploadLimitersMu sync.Mutex
+	uploadLimiters   map[string]*rate.Limiter
 }
 
 // New creates a backup operator.
@@ -69,6 +75,7 @@ func (b *Backup) Start(ctx context.Context) error {
 	}
 
 	go b.run(ctx)
+	go b.startHTTP()
 	<-ctx.Done()
 	return ctx.Err()
 }
@@ -0,0 +1,49 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"github.com/coreos/etcd-operator/pkg/backup"
+
+	"golang.org/x/time/rate"
+)
+
+// uploadLimiter returns the limiter shared by all the uploads of the EtcdBackup
+// of key, or nil if they are unlimited. The limiter is recreated when the limit changes.
+func (b *Backup) uploadLimiter(key string, bytesPerSec int64) *rate.Limiter {
+	b.uploadLimitersMu.Lock()
+	defer b.uploadLimitersMu.Unlock()
+
+	if bytesPerSec <= 0 {
+		delete(b.uploadLimiters, key)
+		return nil
+	}
+	if l, ok := b.uploadLimiters[key]; ok && l.Limit() == rate.Limit(bytesPerSec) {
+		return l
+	}
+	if b.uploadLimiters == nil {
+		b.uploadLimiters = make(map[string]*rate.Limiter)
+	}
+	l := backup.NewUploadLimiter(bytesPerSec)
+	b.uploadLimiters[key] = l
+	return l
+}
+
+// deleteUploadLimiter forgets the upload limiter of the deleted EtcdBackup of key.
+func (b *Backup) deleteUploadLimiter(key string) {
+	b.uploadLimitersMu.Lock()
+	defer b.uploadLimitersMu.Unlock()
+	delete(b.uploadLimiters, key)
+}
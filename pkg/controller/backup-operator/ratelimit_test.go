@@ -0,0 +1,43 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import "testing"
+
+func TestUploadLimiter(t *testing.T) {
+	b := &Backup{}
+	if l := b.uploadLimiter("default/backup", 0); l != nil {
+		t.Fatalf("want nil limiter for no limit, got %v", l)
+	}
+
+	l := b.uploadLimiter("default/backup", 1000)
+	if l == nil {
+		t.Fatal("want limiter, got nil")
+	}
+	if got := b.uploadLimiter("default/backup", 1000); got != l {
+		t.Error("backups of the same EtcdBackup do not share the limiter")
+	}
+	if got := b.uploadLimiter("default/other", 1000); got == l {
+		t.Error("backups of different EtcdBackups share the limiter")
+	}
+	if got := b.uploadLimiter("default/backup", 2000); got == l || got.Burst() != 2000 {
+		t.Error("limiter is not recreated after the limit changes")
+	}
+
+	b.deleteUploadLimiter("default/backup")
+	if _, ok := b.uploadLimiters["default/backup"]; ok {
+		t.Error("limiter of deleted EtcdBackup is kept")
+	}
+}
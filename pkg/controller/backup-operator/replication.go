@@ -0,0 +1,79 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"errors"
+	"fmt"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/backup"
+	"github.com/coreos/etcd-operator/pkg/backup/reader"
+	"github.com/coreos/etcd-operator/pkg/backup/writer"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/kubernetes"
+)
+
+// replicateBackup copies the backup bm saved at revision rev under path to the
+// replication target rt and records the outcome in bs. The backup is read back
+// with br. A failed replication does not fail the backup, which is saved already.
+func replicateBackup(kubecli kubernetes.Interface, namespace string, bm *backup.BackupManager, br reader.Reader, rt *api.BackupReplicationConfig, path string, rev int64, appendRev bool, bs *api.BackupStatus) {
+	err := replicate(kubecli, namespace, bm, br, rt, path, rev, appendRev)
+	if err != nil {
+		logrus.Warningf("failed to replicate backup (%v): %v", bs.BackupPath, err)
+		bs.ReplicationReason = err.Error()
+		return
+	}
+	bs.ReplicationSucceeded = true
+}
+
+func replicate(kubecli kubernetes.Interface, namespace string, bm *backup.BackupManager, br reader.Reader, rt *api.BackupReplicationConfig, path string, rev int64, appendRev bool) error {
+	rw, rPath, closeRW, err := newReplicationWriter(kubecli, namespace, rt)
+	if err != nil {
+		return fmt.Errorf("failed to create replication writer: %v", err)
+	}
+	defer closeRW()
+	bm.EnableReplication(br, rw, rPath)
+	return bm.ReplicateSnap(path, rev, appendRev)
+}
+
+// newReplicationWriter creates the writer of the replication target and returns
+// it with the replication path and a func to release the writer's client.
+func newReplicationWriter(kubecli kubernetes.Interface, namespace string, rt *api.BackupReplicationConfig) (writer.Writer, string, func(), error) {
+	switch rt.StorageType {
+	case api.BackupStorageTypeS3:
+		if rt.S3 == nil {
+			return nil, "", nil, errors.New("empty s3 replication target")
+		}
+		cli, err := newS3Client(kubecli, namespace, rt.S3)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		return writer.NewS3Writer(cli.S3), rt.S3.Path, cli.Close, nil
+	case api.BackupStorageTypeABS:
+		if rt.ABS == nil {
+			return nil, "", nil, errors.New("empty abs replication target")
+		}
+		cli, err := newABSClient(kubecli, namespace, rt.ABS)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		// Nothing to Close for absCli yet
+		return writer.NewABSWriter(cli.ABS), rt.ABS.Path, func() {}, nil
+	default:
+		return nil, "", nil, fmt.Errorf("unknown replication storage type: %v", rt.StorageType)
+	}
+}
@@ -17,21 +17,26 @@ package controller
 import (
 	"crypto/tls"
 	"fmt"
+	"time"
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
 	"github.com/coreos/etcd-operator/pkg/backup"
+	"github.com/coreos/etcd-operator/pkg/backup/reader"
 	"github.com/coreos/etcd-operator/pkg/backup/writer"
 	"github.com/coreos/etcd-operator/pkg/util/awsutil/s3factory"
 	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
 	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
 	"k8s.io/client-go/kubernetes"
 )
 
 // TODO: replace this with generic backend interface for other options (PV, Azure)
 // handleS3 saves etcd cluster's backup to specificed S3 path.
-func handleS3(kubecli kubernetes.Interface, s *api.S3BackupSource, endpoints []string, clientTLSSecret, namespace string) (*api.BackupStatus, error) {
-	cli, err := s3factory.NewClientFromSecret(kubecli, namespace, s.AWSSecret)
+func handleS3(kubecli kubernetes.Interface, s *api.S3BackupSource, sch api.BackupSchedule, endpoints []string, preferredEndpoint, clientTLSSecret, namespace string, hooks api.BackupHooks, rt *api.BackupReplicationConfig, tags map[string]string, limiter *rate.Limiter, retry func(func() error) error) (*api.BackupStatus, error) {
+	cli, err := newS3Client(kubecli, namespace, s)
 	if err != nil {
 		return nil, err
 	}
@@ -50,9 +55,67 @@ func handleS3(kubecli kubernetes.Interface, s *api.S3BackupSource, endpoints []s
 	}
 
 	bm := backup.NewBackupManagerFromWriter(kubecli, writer.NewS3Writer(cli.S3), tlsConfig, endpoints, namespace)
-	rev, etcdVersion, err := bm.SaveSnap(s.Path, false)
+	bm.SetPreferredEndpoint(preferredEndpoint)
+	bm.SetUploadLimiter(limiter)
+	bm.SetRetry(retry)
+	appendRev := false
+	if sch.BackupIntervalInSecond > 0 {
+		appendRev = true
+	}
+	rev, etcdVersion, err := bm.SaveSnapWithHooks(s.Path, appendRev, hooks.PreBackupHook, hooks.PostBackupHook)
+	if backup.IsPreBackupHookError(err) {
+		return nil, err
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to save snapshot (%v)", err)
 	}
-	return &api.BackupStatus{EtcdVersion: etcdVersion, EtcdRevision: rev}, nil
+	backupPath := backup.AppendRevToPath(appendRev, rev, s.Path)
+	// The backup is saved: a tagging failure, e.g. for lack of the
+	// s3:PutObjectTagging permission, must not fail and retry it.
+	if err := bm.TagBackup(backupPath, backupTags(tags, etcdVersion, rev)); err != nil {
+		logrus.Warningf("failed to tag backup (%v): %v", backupPath, err)
+	}
+
+	bs := &api.BackupStatus{
+		EtcdVersion:      etcdVersion,
+		EtcdRevision:     rev,
+		BackupPath:       backupPath,
+		StorageUsedBytes: bm.StorageUsedBytes(),
+	}
+	if rt != nil {
+		replicateBackup(kubecli, namespace, bm, reader.NewS3Reader(cli.S3), rt, s.Path, rev, appendRev, bs)
+	}
+
+	err = bm.PurgeBackup(s.Path, sch.MaxBackups, time.Duration(sch.MaxBackupAgeInSecond)*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to purge backups (%v)", err)
+	}
+	return bs, nil
+}
+
+// newS3Client creates an S3 client from the service account's web identity if
+// IRSA is used, and from the AWS secret otherwise.
+func newS3Client(kubecli kubernetes.Interface, namespace string, s *api.S3BackupSource) (*s3factory.S3Client, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	cfg := s3Config(s)
+	if s.UseIRSA {
+		return s3factory.NewClientFromWebIdentity(cfg)
+	}
+	return s3factory.NewClientFromSecret(kubecli, namespace, s.AWSSecret, cfg)
+}
+
+// s3Config returns the S3 client configuration for the custom endpoint and
+// transfer acceleration settings of the backup source.
+func s3Config(s *api.S3BackupSource) *aws.Config {
+	cfg := &aws.Config{}
+	if len(s.Endpoint) != 0 {
+		cfg.Endpoint = aws.String(s.Endpoint)
+		cfg.S3ForcePathStyle = aws.Bool(true)
+	}
+	if s.EnableTransferAcceleration {
+		cfg.S3UseAccelerate = aws.Bool(true)
+	}
+	return cfg
 }
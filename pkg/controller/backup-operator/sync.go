@@ -15,7 +15,14 @@
 package controller
 
 import (
+	"fmt"
+	"time"
+
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/backup"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 )
 
 const (
@@ -28,8 +35,14 @@ const (
 	maxRetries = 15
 	// Minimal backup interval we can use
 	minBackupIntervalInSecond = 60
+	// backupMaxRetries is the number of times a failed backup is retried
+	// in place before the error is reported, e.g. on S3 503 or ABS 429 errors.
+	backupMaxRetries = 3
 )
 
+// backupRetryBaseDelay is the wait before the first retry of a failed backup.
+var backupRetryBaseDelay = time.Second
+
 func (b *Backup) runWorker() {
 	for b.processNextItem() {
 	}
@@ -57,29 +70,57 @@ func (b *Backup) processItem(key string) error {
 		return err
 	}
 	if !exists {
+		b.deleteUploadLimiter(key)
 		return nil
 	}
 
-	eb := obj.(*api.EtcdBackup)
+	eb := obj.(*api.EtcdBackup).DeepCopy()
 	// don't process the CR if it has a status since
 	// having a status means that the backup is either made or failed.
 	if eb.Status.Succeeded || len(eb.Status.Reason) != 0 {
 		return nil
 	}
-	bs, err := b.handle(&eb.Spec)
+	// A backup left Running by an operator restart is taken again.
+	eb.Status.Phase = api.BackupPhaseRunning
+	eb, err = b.backupCRCli.EtcdV1beta2().EtcdBackups(b.namespace).Update(eb)
+	if apierrors.IsConflict(err) {
+		// The cached CR is stale; the newer version is processed on its update event.
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set backup CR %v running: %v", key, err)
+	}
+	bs, err := b.handle(key, &eb.Spec)
+	if backup.IsPreBackupHookError(err) {
+		_, eerr := b.kubecli.CoreV1().Events(b.namespace).Create(k8sutil.PreBackupHookFailedEvent(eb, err))
+		if eerr != nil {
+			b.logger.Errorf("failed to create event for backup CR %v: %v", eb.Name, eerr)
+		}
+	}
 	// Report backup status
 	b.reportBackupStatus(bs, err, eb)
 	return err
 }
 
 func (b *Backup) reportBackupStatus(bs *api.BackupStatus, berr error, eb *api.EtcdBackup) {
+	if bs != nil {
+		eb.Status.Attempts = bs.Attempts
+		eb.Status.LastError = bs.LastError
+	}
 	if berr != nil {
+		eb.Status.Phase = api.BackupPhaseFailed
 		eb.Status.Succeeded = false
 		eb.Status.Reason = berr.Error()
 	} else {
+		eb.Status.Phase = api.BackupPhaseSucceeded
 		eb.Status.Succeeded = true
 		eb.Status.EtcdRevision = bs.EtcdRevision
 		eb.Status.EtcdVersion = bs.EtcdVersion
+		eb.Status.BackupPath = bs.BackupPath
+		eb.Status.StorageUsedBytes = bs.StorageUsedBytes
+		eb.Status.ReplicationSucceeded = bs.ReplicationSucceeded
+		eb.Status.ReplicationReason = bs.ReplicationReason
+		backupStorageBytes.WithLabelValues(eb.Name, string(eb.Spec.StorageType)).Set(float64(bs.StorageUsedBytes))
 	}
 	_, err := b.backupCRCli.EtcdV1beta2().EtcdBackups(b.namespace).Update(eb)
 	if err != nil {
@@ -40,6 +40,14 @@ type Controller struct {
 	logger *logrus.Entry
 	Config
 
+	// pool handles the events and reconciliations of all clusters.
+	pool *cluster.ClusterPool
+	// releases caches the etcd releases for auto upgrades. It is nil unless
+	// Config.AutoUpgrade is set.
+	releases *cluster.EtcdReleases
+	// interruptedNodes is nil unless the controller watches spot interruptions.
+	interruptedNodes *cluster.InterruptedNodes
+
 	clusters map[string]*cluster.Cluster
 }
 
@@ -50,20 +58,54 @@ type Config struct {
 	KubeExtCli     apiextensionsclient.Interface
 	EtcdCRCli      versioned.Interface
 	CreateCRD      bool
+	// Logger is the logger of the controller and the clusters it manages.
+	// If nil, the logrus standard logger is used.
+	Logger *logrus.Logger
+	// Workers is the number of workers handling the clusters, i.e. the maximum
+	// number of clusters reconciling at the same time. Defaults to 1 if not positive.
+	Workers int
+	// DryRun makes the clusters plan their actions instead of applying them.
+	DryRun bool
+	// AutoUpgrade lets the clusters that allow it upgrade to the latest etcd patch release.
+	AutoUpgrade bool
+	// GitHubToken optionally authenticates the requests for the etcd releases
+	// of AutoUpgrade to the GitHub API.
+	GitHubToken string
+	// PodCreationTimeoutSeconds is how long the clusters wait for the API server
+	// to create a member pod.
+	PodCreationTimeoutSeconds int
+	// WatchSpotInterruptions makes the controller watch the nodes for spot
+	// interruptions. It needs the permission to list, watch and patch nodes.
+	WatchSpotInterruptions bool
 }
 
 func New(cfg Config) *Controller {
-	return &Controller{
-		logger: logrus.WithField("pkg", "controller"),
+	if cfg.Logger == nil {
+		cfg.Logger = logrus.StandardLogger()
+	}
+	c := &Controller{
+		logger: cfg.Logger.WithField("pkg", "controller"),
+		pool:   cluster.NewClusterPool(cfg.Workers),
 
 		Config:   cfg,
 		clusters: make(map[string]*cluster.Cluster),
 	}
+	if cfg.WatchSpotInterruptions {
+		c.interruptedNodes = cluster.NewInterruptedNodes()
+	}
+	if cfg.AutoUpgrade {
+		c.releases = cluster.NewEtcdReleases(cfg.Logger, cfg.GitHubToken)
+	}
+	return c
 }
 
 func (c *Controller) handleClusterEvent(event *Event) error {
 	clus := event.Object
 
+	if event.Type != kwatch.Deleted && clus.DeletionTimestamp != nil {
+		return c.handleClusterDeletion(clus)
+	}
+
 	if clus.Status.IsFailed() {
 		clustersFailed.Inc()
 		if event.Type == kwatch.Deleted {
@@ -101,6 +143,10 @@ func (c *Controller) handleClusterEvent(event *Event) error {
 
 	case kwatch.Deleted:
 		if _, ok := c.clusters[clus.Name]; !ok {
+			if clus.DeletionTimestamp != nil {
+				// already stopped by handleClusterDeletion
+				return nil
+			}
 			return fmt.Errorf("unsafe state. cluster (%s) was never created but we received event (%s)", clus.Name, event.Type)
 		}
 		c.clusters[clus.Name].Delete()
@@ -116,6 +162,13 @@ func (c *Controller) makeClusterConfig() cluster.Config {
 		ServiceAccount: c.Config.ServiceAccount,
 		KubeCli:        c.Config.KubeCli,
 		EtcdCRCli:      c.Config.EtcdCRCli,
+		Logger:         c.Config.Logger,
+		Pool:           c.pool,
+		DryRun:         c.Config.DryRun,
+		Releases:       c.releases,
+
+		PodCreationTimeoutSeconds: c.Config.PodCreationTimeoutSeconds,
+		InterruptedNodes:          c.interruptedNodes,
 	}
 }
 
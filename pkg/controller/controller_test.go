@@ -15,14 +15,25 @@
 package controller
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
 
+	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	ktesting "k8s.io/client-go/testing"
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
 	"github.com/coreos/etcd-operator/pkg/cluster"
+	"github.com/coreos/etcd-operator/pkg/debug"
+	crfake "github.com/coreos/etcd-operator/pkg/generated/clientset/versioned/fake"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
 )
 
 func TestHandleClusterEventUpdateFailedCluster(t *testing.T) {
@@ -73,3 +84,95 @@ func TestHandleClusterEventDeleteFailedCluster(t *testing.T) {
 		t.Errorf("failed cluster not cleaned up after delete event, cluster struct: %v", c.clusters[name])
 	}
 }
+
+func TestHandleClusterDeletion(t *testing.T) {
+	ns := metav1.NamespaceDefault
+	clus := &api.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "example",
+			Namespace:  ns,
+			Finalizers: []string{"example.com/keep", api.CleanupFinalizer},
+		},
+		Spec: api.ClusterSpec{Size: 1, Version: "3.2.13", GatewayEnabled: true},
+	}
+	clusterLabels := k8sutil.LabelsForCluster(clus.Name)
+	kubecli := fake.NewSimpleClientset(
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "example-0000", Namespace: ns, Labels: clusterLabels}},
+		&v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "example", Namespace: ns, Labels: clusterLabels}},
+		&v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "example-client", Namespace: ns, Labels: clusterLabels}},
+		&v1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "example-0000", Namespace: ns, Labels: clusterLabels}},
+	)
+	if err := k8sutil.CreateGateway(kubecli, clus.Name, ns, clus.Spec, clus.AsOwner()); err != nil {
+		t.Fatal(err)
+	}
+	// The object tracker of the fake clientset does not delete collections;
+	// the selectors they are deleted by are checked instead.
+	deletedCollections := map[string]string{}
+	kubecli.PrependReactor("delete-collection", "*", func(action ktesting.Action) (bool, runtime.Object, error) {
+		a := action.(ktesting.DeleteCollectionAction)
+		deletedCollections[a.GetResource().Resource] = a.GetListRestrictions().Labels.String()
+		return true, nil, nil
+	})
+	crcli := crfake.NewSimpleClientset(clus)
+
+	c := New(Config{KubeCli: kubecli, EtcdCRCli: crcli})
+	// The running cluster reports its status with its own clients, so that it
+	// does not race with the deletion below.
+	running := clus.DeepCopy()
+	running.Status.Phase = api.ClusterPhaseRunning
+	c.clusters[clus.Name] = cluster.New(cluster.Config{KubeCli: fake.NewSimpleClientset(), EtcdCRCli: crfake.NewSimpleClientset()}, running)
+	if code := serveEvents(clus.Name); code != http.StatusOK {
+		t.Fatalf("events of the running cluster: status = %d, want %d", code, http.StatusOK)
+	}
+
+	now := metav1.Now()
+	clus.DeletionTimestamp = &now
+	if err := c.handleClusterDeletion(clus); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := c.clusters[clus.Name]; ok {
+		t.Error("deleted cluster is still managed")
+	}
+	// Cluster.Delete stops serving the events of the cluster.
+	if code := serveEvents(clus.Name); code != http.StatusNotFound {
+		t.Errorf("events of the deleted cluster: status = %d, want %d", code, http.StatusNotFound)
+	}
+
+	selector := labels.SelectorFromSet(clusterLabels).String()
+	for _, r := range []string{"pods", "persistentvolumeclaims"} {
+		if got := deletedCollections[r]; got != selector {
+			t.Errorf("%s deleted by selector %q, want %q", r, got, selector)
+		}
+	}
+	svcs, err := kubecli.CoreV1().Services(ns).List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(svcs.Items) != 0 {
+		t.Errorf("services not deleted: %v", svcs.Items)
+	}
+	if _, err := kubecli.AppsV1beta1().Deployments(ns).Get(k8sutil.GatewayName(clus.Name), metav1.GetOptions{}); !k8sutil.IsKubernetesResourceNotFoundError(err) {
+		t.Errorf("gateway deployment not deleted: %v", err)
+	}
+
+	cl, err := crcli.EtcdV1beta2().EtcdClusters(ns).Get(clus.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"example.com/keep"}; !reflect.DeepEqual(cl.Finalizers, want) {
+		t.Errorf("finalizers = %v, want %v", cl.Finalizers, want)
+	}
+
+	// The CR may be gone by the time the finalizer is to be removed.
+	gone := New(Config{KubeCli: kubecli, EtcdCRCli: crfake.NewSimpleClientset()})
+	if err := gone.handleClusterDeletion(clus); err != nil {
+		t.Errorf("deletion of a cluster that is gone: %v", err)
+	}
+}
+
+func serveEvents(clusterName string) int {
+	rec := httptest.NewRecorder()
+	debug.ServeEvents(rec, httptest.NewRequest("GET", debug.EventsHTTPPath+clusterName, nil))
+	return rec.Code
+}
@@ -0,0 +1,71 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"fmt"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// handleClusterDeletion stops managing an EtcdCluster that is being deleted, deletes
+// its resources and removes the cleanup finalizer so that the deletion can complete.
+// This also cleans up the clusters deleted while the operator was down.
+func (c *Controller) handleClusterDeletion(clus *api.EtcdCluster) error {
+	if nc, ok := c.clusters[clus.Name]; ok {
+		nc.Delete()
+		delete(c.clusters, clus.Name)
+		clustersDeleted.Inc()
+		clustersTotal.Dec()
+	}
+	if !clus.HasFinalizer(api.CleanupFinalizer) {
+		return nil
+	}
+
+	c.logger.Infof("cleaning up resources of deleted cluster (%s)", clus.Name)
+	// The PodDisruptionBudget goes first so that it does not hold up node drains.
+	if clus.Spec.EnablePodDisruptionBudget {
+		if err := k8sutil.DeleteEtcdPodDisruptionBudget(c.KubeCli, clus.Name, clus.Namespace); err != nil {
+			return fmt.Errorf("failed to delete PodDisruptionBudget of cluster (%s): %v", clus.Name, err)
+		}
+	}
+	if err := k8sutil.DeleteClusterResources(c.KubeCli, clus.Name, clus.Namespace); err != nil {
+		return fmt.Errorf("failed to clean up cluster (%s): %v", clus.Name, err)
+	}
+
+	cl, err := c.EtcdCRCli.EtcdV1beta2().EtcdClusters(clus.Namespace).Get(clus.Name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to get cluster (%s): %v", clus.Name, err)
+	}
+	var finalizers []string
+	for _, f := range cl.Finalizers {
+		if f != api.CleanupFinalizer {
+			finalizers = append(finalizers, f)
+		}
+	}
+	cl.Finalizers = finalizers
+	_, err = c.EtcdCRCli.EtcdV1beta2().EtcdClusters(clus.Namespace).Update(cl)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to remove cleanup finalizer of cluster (%s): %v", clus.Name, err)
+	}
+	return nil
+}
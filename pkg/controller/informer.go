@@ -15,11 +15,11 @@
 package controller
 
 import (
-	"context"
 	"fmt"
 	"time"
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/garbagecollection"
 	"github.com/coreos/etcd-operator/pkg/util/probe"
 
 	"k8s.io/apimachinery/pkg/fields"
@@ -34,7 +34,8 @@ func init() {
 	pt = newPanicTimer(time.Minute, "unexpected long blocking (> 1 Minute) when handling cluster event")
 }
 
-func (c *Controller) Start() error {
+// Start runs the controller until stop is closed.
+func (c *Controller) Start(stop <-chan struct{}) error {
 	// TODO: get rid of this init code. CRD and storage class will be managed outside of operator.
 	for {
 		err := c.initResource()
@@ -46,12 +47,18 @@ func (c *Controller) Start() error {
 		time.Sleep(initRetryWaitTime)
 	}
 
-	probe.SetReady()
-	c.run()
-	panic("unreachable")
+	c.collectOrphanedResources()
+
+	go c.pool.Run(stop)
+	if c.releases != nil {
+		go c.releases.Run(stop)
+	}
+
+	c.run(stop)
+	return nil
 }
 
-func (c *Controller) run() {
+func (c *Controller) run(stopCh <-chan struct{}) {
 	source := cache.NewListWatchFromClient(
 		c.Config.EtcdCRCli.EtcdV1beta2().RESTClient(),
 		api.EtcdClusterResourcePlural,
@@ -64,9 +71,33 @@ func (c *Controller) run() {
 		DeleteFunc: c.onDeleteEtcdClus,
 	}, cache.Indexers{})
 
-	ctx := context.TODO()
 	// TODO: use workqueue to avoid blocking
-	informer.Run(ctx.Done())
+	go informer.Run(stopCh)
+	if c.interruptedNodes != nil {
+		go c.watchSpotInterruptions(stopCh)
+	}
+
+	// The operator is ready once the existing clusters have been listed.
+	// The health probe is fed by the workers of the cluster pool.
+	if !cache.WaitForCacheSync(stopCh, informer.HasSynced) {
+		c.logger.Infof("stopped before the EtcdClusters were listed")
+		return
+	}
+	probe.SetReady()
+
+	<-stopCh
+}
+
+// collectOrphanedResources deletes the resources left behind by clusters that
+// were deleted while the operator was down.
+func (c *Controller) collectOrphanedResources() {
+	if c.Config.DryRun {
+		return
+	}
+	gc := garbagecollection.New(c.Config.KubeCli, c.Config.EtcdCRCli, c.Config.Namespace)
+	if err := gc.CollectOrphanedServices(""); err != nil {
+		c.logger.Warningf("failed to collect orphaned services: %v", err)
+	}
 }
 
 func (c *Controller) initResource() error {
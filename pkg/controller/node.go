@@ -0,0 +1,74 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/tools/cache"
+)
+
+// watchSpotInterruptions watches the nodes until stopCh is closed and records
+// the spot nodes that are about to be interrupted, so that the clusters move
+// their members off them.
+func (c *Controller) watchSpotInterruptions(stopCh <-chan struct{}) {
+	source := cache.NewListWatchFromClient(
+		c.Config.KubeCli.CoreV1().RESTClient(),
+		"nodes",
+		metav1.NamespaceAll,
+		fields.Everything())
+
+	_, informer := cache.NewInformer(source, &v1.Node{}, 0, cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			c.onNodeUpdate(obj.(*v1.Node))
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			c.onNodeUpdate(newObj.(*v1.Node))
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if node, ok := obj.(*v1.Node); ok {
+				c.interruptedNodes.Delete(node.Name)
+			}
+		},
+	})
+	informer.Run(stopCh)
+}
+
+// onNodeUpdate records whether the node is about to be interrupted. A newly
+// interrupted node is cordoned, so that the replaced members and other new
+// pods are scheduled to other nodes.
+func (c *Controller) onNodeUpdate(node *v1.Node) {
+	if !k8sutil.IsNodeInterrupted(node) {
+		c.interruptedNodes.Delete(node.Name)
+		return
+	}
+	if c.interruptedNodes.Has(node.Name) {
+		return
+	}
+	c.logger.Infof("spot node (%s) is about to be interrupted", node.Name)
+	c.interruptedNodes.Add(node.Name)
+	if c.Config.DryRun || node.Spec.Unschedulable {
+		return
+	}
+	if err := k8sutil.CordonNode(c.Config.KubeCli, node.Name); err != nil {
+		c.logger.Errorf("failed to cordon interrupted node (%s): %v", node.Name, err)
+	}
+}
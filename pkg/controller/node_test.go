@@ -0,0 +1,53 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"testing"
+
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestOnNodeUpdate(t *testing.T) {
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}
+	kubecli := fake.NewSimpleClientset(node)
+	c := New(Config{KubeCli: kubecli, WatchSpotInterruptions: true})
+
+	c.onNodeUpdate(node)
+	if c.interruptedNodes.Has(node.Name) || len(kubecli.Actions()) != 0 {
+		t.Fatalf("node without spot interruption was recorded or cordoned")
+	}
+
+	interrupted := node.DeepCopy()
+	interrupted.Annotations = map[string]string{k8sutil.SpotInterruptionAnnotation: "2018-06-01T10:00:00Z"}
+	c.onNodeUpdate(interrupted)
+	c.onNodeUpdate(interrupted)
+	if !c.interruptedNodes.Has(node.Name) {
+		t.Errorf("interrupted node was not recorded")
+	}
+	actions := kubecli.Actions()
+	if len(actions) != 1 || actions[0].GetVerb() != "patch" || actions[0].GetResource().Resource != "nodes" {
+		t.Errorf("want interrupted node to be cordoned once, get actions %v", actions)
+	}
+
+	c.onNodeUpdate(node)
+	if c.interruptedNodes.Has(node.Name) {
+		t.Errorf("node is still recorded after the interruption annotation was removed")
+	}
+}
@@ -19,8 +19,11 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/backup"
 	"github.com/coreos/etcd-operator/pkg/backup/backupapi"
 	"github.com/coreos/etcd-operator/pkg/backup/reader"
 	"github.com/coreos/etcd-operator/pkg/util/awsutil/s3factory"
@@ -75,61 +78,98 @@ func (r *Restore) serveBackup(w http.ResponseWriter, req *http.Request) error {
 	logrus.Infof("serving backup for restore CR %v", restoreName)
 	cr := v.(*api.EtcdRestore)
 
+	bm, path, closeCli, err := r.newBackupManager(cr)
+	if err != nil {
+		return err
+	}
+	defer closeCli()
+
+	rc, size, err := bm.LoadSnap(path)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	if size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+	_, err = io.Copy(w, rc)
+	if err != nil {
+		return fmt.Errorf("failed to write backup to %s: %v", req.RemoteAddr, err)
+	}
+	return nil
+}
+
+// verifyBackup checks that the backup of the restore CR is a complete etcd snapshot.
+func (r *Restore) verifyBackup(cr *api.EtcdRestore) error {
+	bm, path, closeCli, err := r.newBackupManager(cr)
+	if err != nil {
+		return err
+	}
+	defer closeCli()
+	return bm.VerifySnap(path)
+}
+
+// newBackupManager returns the BackupManager that loads the backup of the
+// restore CR from its storage, the path of the backup, and a func that closes
+// the storage client.
+func (r *Restore) newBackupManager(cr *api.EtcdRestore) (*backup.BackupManager, string, func(), error) {
 	var (
 		backupReader reader.Reader
 		path         string
+		closeCli     = func() {}
 	)
 
 	switch cr.Spec.BackupStorageType {
 	case api.BackupStorageTypeS3:
 		restoreSource := cr.Spec.RestoreSource
 		if restoreSource.S3 == nil {
-			return errors.New("empty s3 restore source")
+			return nil, "", nil, errors.New("empty s3 restore source")
 		}
 		s3RestoreSource := restoreSource.S3
 		if len(s3RestoreSource.AWSSecret) == 0 || len(s3RestoreSource.Path) == 0 {
-			return errors.New("invalid s3 restore source field (spec.s3), must specify all required subfields")
+			return nil, "", nil, errors.New("invalid s3 restore source field (spec.s3), must specify all required subfields")
 		}
 
 		s3Cli, err := s3factory.NewClientFromSecret(r.kubecli, r.namespace, s3RestoreSource.AWSSecret)
 		if err != nil {
-			return fmt.Errorf("failed to create S3 client: %v", err)
+			return nil, "", nil, fmt.Errorf("failed to create S3 client: %v", err)
 		}
-		defer s3Cli.Close()
+		closeCli = s3Cli.Close
 
 		backupReader = reader.NewS3Reader(s3Cli.S3)
 		path = s3RestoreSource.Path
 	case api.BackupStorageTypeABS:
 		restoreSource := cr.Spec.RestoreSource
 		if restoreSource.ABS == nil {
-			return errors.New("empty abs restore source")
+			return nil, "", nil, errors.New("empty abs restore source")
 		}
 		absRestoreSource := restoreSource.ABS
 		if len(absRestoreSource.ABSSecret) == 0 || len(absRestoreSource.Path) == 0 {
-			return errors.New("invalid abs restore source field (spec.abs), must specify all required subfields")
+			return nil, "", nil, errors.New("invalid abs restore source field (spec.abs), must specify all required subfields")
 		}
 
-		absCli, err := absfactory.NewClientFromSecret(r.kubecli, r.namespace, absRestoreSource.ABSSecret)
+		absCli, err := absfactory.NewClientFromSecret(r.kubecli, r.namespace, absRestoreSource.ABSSecret, "")
 		if err != nil {
-			return fmt.Errorf("failed to create ABS client: %v", err)
+			return nil, "", nil, fmt.Errorf("failed to create ABS client: %v", err)
 		}
 		// Nothing to Close for absCli yet
 
 		backupReader = reader.NewABSReader(absCli.ABS)
 		path = absRestoreSource.Path
 	default:
-		return fmt.Errorf("unknown backup storage type (%s) for restore CR (%v)", cr.Spec.BackupStorageType, restoreName)
-	}
-
-	rc, err := backupReader.Open(path)
-	if err != nil {
-		return fmt.Errorf("failed to read backup file(%v): %v", path, err)
+		return nil, "", nil, fmt.Errorf("unknown backup storage type (%s) for restore CR (%v)", cr.Spec.BackupStorageType, cr.Name)
 	}
-	defer rc.Close()
 
-	_, err = io.Copy(w, rc)
-	if err != nil {
-		return fmt.Errorf("failed to write backup to %s: %v", req.RemoteAddr, err)
+	// A path ending with "/" refers to the backups saved under it; the latest one is restored.
+	if strings.HasSuffix(path, "/") {
+		latest, err := reader.LatestBackupPath(backupReader, path)
+		if err != nil {
+			closeCli()
+			return nil, "", nil, fmt.Errorf("failed to find latest backup file: %v", err)
+		}
+		path = latest
+		logrus.Infof("restoring latest backup file (%v) for restore CR %v", path, cr.Name)
 	}
-	return nil
+	return backup.NewBackupManagerFromReader(backupReader), path, closeCli, nil
 }
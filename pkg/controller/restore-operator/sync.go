@@ -16,6 +16,7 @@ package controller
 
 import (
 	"fmt"
+	"time"
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
 	"github.com/coreos/etcd-operator/pkg/backup/backupapi"
@@ -154,6 +155,10 @@ func (r *Restore) prepareSeed(er *api.EtcdRestore) (err error) {
 	if err := ec.Spec.Validate(); err != nil {
 		return fmt.Errorf("invalid cluster spec: %v", err)
 	}
+	// The reference EtcdCluster is deleted below, so the backup must be usable.
+	if err := r.verifyBackup(er); err != nil {
+		return fmt.Errorf("invalid backup: %v", err)
+	}
 
 	// Delete reference EtcdCluster
 	err = r.etcdCRCli.EtcdV1beta2().EtcdClusters(r.namespace).Delete(ecRef.Name, &metav1.DeleteOptions{})
@@ -162,6 +167,18 @@ func (r *Restore) prepareSeed(er *api.EtcdRestore) (err error) {
 	}
 	// Need to delete etcd pods, etc. completely before creating new cluster.
 	r.deleteClusterResourcesCompletely(ecRef.Name)
+	// The etcd operator removes the cleanup finalizer of the reference EtcdCluster
+	// before it is gone.
+	err = retryutil.Retry(time.Second, 60, func() (bool, error) {
+		_, err := r.etcdCRCli.EtcdV1beta2().EtcdClusters(r.namespace).Get(ecRef.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to wait for deletion of reference EtcdCluster (%s/%s): %v", r.namespace, ecRef.Name, err)
+	}
 
 	// Create the restored EtcdCluster with the same metadata and spec as reference EtcdCluster
 	clusterName := ecRef.Name
@@ -171,6 +188,7 @@ func (r *Restore) prepareSeed(er *api.EtcdRestore) (err error) {
 			Labels:          ec.ObjectMeta.Labels,
 			Annotations:     ec.ObjectMeta.Annotations,
 			OwnerReferences: ec.ObjectMeta.OwnerReferences,
+			Finalizers:      []string{api.CleanupFinalizer},
 		},
 		Spec: ec.Spec,
 	}
@@ -211,10 +229,11 @@ func (r *Restore) prepareSeed(er *api.EtcdRestore) (err error) {
 
 func (r *Restore) createSeedMember(ec *api.EtcdCluster, svcAddr, clusterName string, owner metav1.OwnerReference) error {
 	m := &etcdutil.Member{
-		Name:         etcdutil.CreateMemberName(clusterName, 0),
-		Namespace:    r.namespace,
-		SecurePeer:   ec.Spec.TLS.IsSecurePeer(),
-		SecureClient: ec.Spec.TLS.IsSecureClient(),
+		Name:          etcdutil.CreateMemberName(clusterName, 0),
+		Namespace:     r.namespace,
+		SecurePeer:    ec.Spec.TLS.IsSecurePeer(),
+		SecureClient:  ec.Spec.TLS.IsSecureClient(),
+		ClusterDomain: ec.Spec.DNSDomain,
 	}
 	ms := etcdutil.NewMemberSet(m)
 	backupURL := backupapi.BackupURLForRestore("http", svcAddr, clusterName)
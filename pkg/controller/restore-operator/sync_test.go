@@ -0,0 +1,55 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/generated/clientset/versioned/fake"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// A stored EtcdCluster with a "v" prefixed version passes the spec validation
+// of the restore; the restore below fails later on its missing backup storage.
+func TestPrepareSeedAcceptsVPrefixedVersion(t *testing.T) {
+	ec := &api.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "example", Namespace: metav1.NamespaceDefault},
+		Spec:       api.ClusterSpec{Size: 3, Version: "v3.2.13"},
+	}
+	r := &Restore{
+		logger:    logrus.WithField("pkg", "controller"),
+		namespace: metav1.NamespaceDefault,
+		etcdCRCli: fake.NewSimpleClientset(ec),
+	}
+	er := &api.EtcdRestore{
+		ObjectMeta: metav1.ObjectMeta{Name: "example", Namespace: metav1.NamespaceDefault},
+		Spec:       api.RestoreSpec{EtcdCluster: api.EtcdClusterRef{Name: "example"}},
+	}
+
+	err := r.prepareSeed(er)
+	if err == nil {
+		t.Fatal("expect error for the restore without backup storage, got nil")
+	}
+	if strings.Contains(err.Error(), "invalid cluster spec") {
+		t.Errorf("cluster spec with version %q is rejected: %v", ec.Spec.Version, err)
+	}
+	if !strings.Contains(err.Error(), "invalid backup") {
+		t.Errorf("err = %v, want an invalid backup error", err)
+	}
+}
@@ -15,8 +15,14 @@
 package debug
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
 	"os"
 	"path"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
 
@@ -24,61 +30,194 @@ import (
 	"k8s.io/api/core/v1"
 )
 
+// EventsHTTPPath is the path prefix under which the recent events of a
+// cluster are served, followed by the cluster name.
+const EventsHTTPPath = "/debug/events/"
+
 var (
 	// This flag should be set to enable debug logging
 	DebugFilePath string
+
+	// EventBufferSize is the number of most recent events kept per cluster.
+	EventBufferSize = 1000
 )
 
+// Event is an entry of the event history of a cluster.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
 type DebugLogger struct {
+	clusterName string
+
 	// regular log to stdout
 	logger *logrus.Entry
 	// log to file for debugging self hosted clusters
 	fileLogger *logrus.Logger
+	// logFile is the file fileLogger writes to, closed by Close.
+	logFile *os.File
+
+	mu sync.Mutex
+	// events is a ring buffer of the most recent events; next is the index
+	// the next event is written to.
+	events []Event
+	next   int
+	full   bool
 }
 
-func New(clusterName string) *DebugLogger {
-	if len(DebugFilePath) == 0 {
-		return nil
+var loggers = struct {
+	sync.Mutex
+	m map[string]*DebugLogger
+}{m: map[string]*DebugLogger{}}
+
+// New creates the DebugLogger of a cluster, which keeps its most recent
+// events in memory. For a self hosted cluster, it also logs to DebugFilePath
+// if it is set.
+func New(clusterName string, selfHosted bool) *DebugLogger {
+	size := EventBufferSize
+	if size < 1 {
+		size = 1
+	}
+	dl := &DebugLogger{
+		clusterName: clusterName,
+		logger:      logrus.WithField("pkg", "debug"),
+		events:      make([]Event, size),
+	}
+	if selfHosted && len(DebugFilePath) != 0 {
+		dl.fileLogger, dl.logFile = newFileLogger(dl.logger, clusterName)
 	}
 
-	logger := logrus.WithField("pkg", "debug")
+	loggers.Lock()
+	loggers.m[clusterName] = dl
+	loggers.Unlock()
+	return dl
+}
+
+func newFileLogger(logger *logrus.Entry, clusterName string) (*logrus.Logger, *os.File) {
 	err := os.MkdirAll(path.Dir(DebugFilePath), 0755)
 	if err != nil {
 		logger.Errorf("Could not create debug log directory (%v), debug logging will not be performed: %v", path.Dir(DebugFilePath), err)
-		return nil
+		return nil, nil
 	}
 
 	logFile, err := os.OpenFile(DebugFilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 	if err != nil {
 		logger.Errorf("failed to open debug log file(%v): %v", DebugFilePath, err)
-		return nil
+		return nil, nil
 	}
 
 	l := logrus.New()
 	l.Out = logFile
 	l.Infof("Starting debug logs for self-hosted etcd cluster: %v", clusterName)
-	return &DebugLogger{
-		logger:     logrus.WithField("pkg", "debug"),
-		fileLogger: l,
+	return l, logFile
+}
+
+// Close stops serving the events of the cluster and closes the debug log file.
+// It may be called more than once.
+func (dl *DebugLogger) Close() {
+	if dl == nil {
+		return
+	}
+	loggers.Lock()
+	if loggers.m[dl.clusterName] == dl {
+		delete(loggers.m, dl.clusterName)
+	}
+	loggers.Unlock()
+
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	if dl.logFile != nil {
+		if err := dl.logFile.Close(); err != nil {
+			dl.logger.Warningf("failed to close debug log file (%v): %v", DebugFilePath, err)
+		}
+		dl.logFile = nil
 	}
 }
 
+// LogEvent records an event in the event history of the cluster.
+// The methods of a nil DebugLogger do nothing.
+func (dl *DebugLogger) LogEvent(message string) {
+	if dl == nil {
+		return
+	}
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	dl.events[dl.next] = Event{Time: time.Now(), Message: message}
+	dl.next = (dl.next + 1) % len(dl.events)
+	if dl.next == 0 {
+		dl.full = true
+	}
+}
+
+// fileLog returns the file logger, which is nil unless the cluster is self hosted.
+func (dl *DebugLogger) fileLog() *logrus.Logger {
+	if dl == nil {
+		return nil
+	}
+	return dl.fileLogger
+}
+
+// Events returns the event history of the cluster, oldest first.
+func (dl *DebugLogger) Events() []Event {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	if !dl.full {
+		return append([]Event(nil), dl.events[:dl.next]...)
+	}
+	return append(append([]Event(nil), dl.events[dl.next:]...), dl.events[:dl.next]...)
+}
+
 func (dl *DebugLogger) LogPodCreation(pod *v1.Pod) {
+	dl.LogEvent(fmt.Sprintf("created pod (%s)", pod.Name))
+	fl := dl.fileLog()
+	if fl == nil {
+		return
+	}
 	podSpec, err := k8sutil.PodSpecToPrettyJSON(pod)
 	if err != nil {
-		dl.fileLogger.Infof("failed to get readable spec for pod(%v): %v ", pod.Name, err)
+		fl.Infof("failed to get readable spec for pod(%v): %v ", pod.Name, err)
 	}
-	dl.fileLogger.Infof("created pod (%s) with spec: %s\n", pod.Name, podSpec)
+	fl.Infof("created pod (%s) with spec: %s\n", pod.Name, podSpec)
 }
 
 func (dl *DebugLogger) LogPodDeletion(podName string) {
-	dl.fileLogger.Infof("deleted pod (%s)", podName)
+	dl.LogEvent(fmt.Sprintf("deleted pod (%s)", podName))
+	if fl := dl.fileLog(); fl != nil {
+		fl.Infof("deleted pod (%s)", podName)
+	}
 }
 
 func (dl *DebugLogger) LogClusterSpecUpdate(oldSpec, newSpec string) {
-	dl.fileLogger.Infof("spec update: \nOld:\n%v \nNew:\n%v\n", oldSpec, newSpec)
+	dl.LogEvent("spec updated")
+	if fl := dl.fileLog(); fl != nil {
+		fl.Infof("spec update: \nOld:\n%v \nNew:\n%v\n", oldSpec, newSpec)
+	}
 }
 
 func (dl *DebugLogger) LogMessage(msg string) {
-	dl.fileLogger.Infof(msg)
+	dl.LogEvent(msg)
+	if fl := dl.fileLog(); fl != nil {
+		fl.Infof(msg)
+	}
+}
+
+// ServeEvents serves the event history of the cluster named in the path as JSON.
+func ServeEvents(w http.ResponseWriter, req *http.Request) {
+	name := strings.TrimPrefix(req.URL.Path, EventsHTTPPath)
+	if len(name) == 0 {
+		http.Error(w, "cluster name is required", http.StatusBadRequest)
+		return
+	}
+	loggers.Lock()
+	dl, ok := loggers.m[name]
+	loggers.Unlock()
+	if !ok {
+		http.Error(w, fmt.Sprintf("cluster (%s) not found", name), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(dl.Events()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
 }
@@ -0,0 +1,102 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package debug
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestEventHistory(t *testing.T) {
+	defer func(size int) { EventBufferSize = size }(EventBufferSize)
+	EventBufferSize = 3
+
+	tests := []struct {
+		logged int
+		want   []string
+	}{
+		{0, nil},
+		{2, []string{"e0", "e1"}},
+		{3, []string{"e0", "e1", "e2"}},
+		{5, []string{"e2", "e3", "e4"}},
+		{7, []string{"e4", "e5", "e6"}},
+	}
+	for i, tt := range tests {
+		dl := New("test-cluster", false)
+		for j := 0; j < tt.logged; j++ {
+			dl.LogEvent(fmt.Sprintf("e%d", j))
+		}
+		var got []string
+		for _, e := range dl.Events() {
+			got = append(got, e.Message)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("#%d: events = %v, want %v", i, got, tt.want)
+		}
+		dl.Close()
+	}
+}
+
+func TestServeEvents(t *testing.T) {
+	dl := New("test-cluster", false)
+	dl.LogEvent("reconciled")
+
+	rec := httptest.NewRecorder()
+	ServeEvents(rec, httptest.NewRequest("GET", EventsHTTPPath+"test-cluster", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	dl.Close()
+	rec = httptest.NewRecorder()
+	ServeEvents(rec, httptest.NewRequest("GET", EventsHTTPPath+"test-cluster", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status after Close = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	// The methods of a nil DebugLogger must not panic.
+	var nilLogger *DebugLogger
+	nilLogger.LogEvent("ignored")
+	nilLogger.LogPodDeletion("ignored")
+	nilLogger.Close()
+}
+
+func TestCloseClosesLogFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "debug-logger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(p string) { DebugFilePath = p }(DebugFilePath)
+	DebugFilePath = filepath.Join(dir, "debug.log")
+
+	dl := New("test-cluster", true)
+	f := dl.logFile
+	if f == nil {
+		t.Fatal("debug log file is not opened")
+	}
+	dl.Close()
+	if _, err := f.Write([]byte("x")); err == nil {
+		t.Error("debug log file is not closed")
+	}
+	// Close is called on every exit path of a cluster, e.g. on a failure and then on deletion.
+	dl.Close()
+}
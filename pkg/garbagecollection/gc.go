@@ -0,0 +1,101 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package garbagecollection
+
+import (
+	"fmt"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/generated/clientset/versioned"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// GC deletes the resources of etcd clusters whose EtcdCluster CR no longer exists.
+type GC struct {
+	logger *logrus.Entry
+
+	kubecli   kubernetes.Interface
+	etcdCRCli versioned.Interface
+	ns        string
+}
+
+func New(kubecli kubernetes.Interface, etcdCRCli versioned.Interface, ns string) *GC {
+	return &GC{
+		logger:    logrus.WithField("pkg", "gc"),
+		kubecli:   kubecli,
+		etcdCRCli: etcdCRCli,
+		ns:        ns,
+	}
+}
+
+// CollectOrphanedServices deletes the services of the given cluster, or of all
+// clusters if clusterName is empty, whose owning EtcdCluster CR no longer exists.
+// A CR recreated with the same name does not own the services of the old one.
+func (gc *GC) CollectOrphanedServices(clusterName string) error {
+	selector := labels.SelectorFromSet(map[string]string{"app": "etcd"}).String() + ",etcd_cluster"
+	if len(clusterName) != 0 {
+		selector = labels.SelectorFromSet(k8sutil.LabelsForCluster(clusterName)).String()
+	}
+	svcs, err := gc.kubecli.CoreV1().Services(gc.ns).List(metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return fmt.Errorf("failed to list services: %v", err)
+	}
+
+	// owners caches the UID of the existing clusters, or "" for the missing ones.
+	owners := map[string]types.UID{}
+	for i := range svcs.Items {
+		svc := &svcs.Items[i]
+		name, uid := ownerCluster(svc.ObjectMeta)
+		if _, ok := owners[name]; !ok {
+			cl, err := gc.etcdCRCli.EtcdV1beta2().EtcdClusters(gc.ns).Get(name, metav1.GetOptions{})
+			switch {
+			case err == nil:
+				owners[name] = cl.UID
+			case k8sutil.IsKubernetesResourceNotFoundError(err):
+				owners[name] = ""
+			default:
+				return fmt.Errorf("failed to get cluster (%s): %v", name, err)
+			}
+		}
+		if existing := owners[name]; len(existing) != 0 && (len(uid) == 0 || uid == existing) {
+			continue
+		}
+
+		err := gc.kubecli.CoreV1().Services(gc.ns).Delete(svc.Name, nil)
+		if err != nil && !k8sutil.IsKubernetesResourceNotFoundError(err) {
+			return fmt.Errorf("failed to delete orphaned service (%s): %v", svc.Name, err)
+		}
+		gc.logger.Infof("deleted orphaned service (%s) of cluster (%s)", svc.Name, name)
+	}
+	return nil
+}
+
+// ownerCluster returns the name and UID of the EtcdCluster owning an object.
+// Objects without an EtcdCluster owner reference belong to the cluster in their
+// etcd_cluster label, whose UID is unknown.
+func ownerCluster(om metav1.ObjectMeta) (string, types.UID) {
+	for _, ref := range om.OwnerReferences {
+		if ref.Kind == api.EtcdClusterResourceKind {
+			return ref.Name, ref.UID
+		}
+	}
+	return om.Labels["etcd_cluster"], ""
+}
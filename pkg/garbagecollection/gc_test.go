@@ -0,0 +1,85 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package garbagecollection
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	fakeetcd "github.com/coreos/etcd-operator/pkg/generated/clientset/versioned/fake"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCollectOrphanedServices(t *testing.T) {
+	alive := &api.EtcdCluster{ObjectMeta: metav1.ObjectMeta{Name: "alive", Namespace: "default", UID: "uid-alive"}}
+	newService := func(name, clusterName string, ownerUID types.UID) runtime.Object {
+		svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels:    k8sutil.LabelsForCluster(clusterName),
+		}}
+		if len(ownerUID) != 0 {
+			owner := &api.EtcdCluster{ObjectMeta: metav1.ObjectMeta{Name: clusterName, UID: ownerUID}}
+			svc.OwnerReferences = []metav1.OwnerReference{owner.AsOwner()}
+		}
+		return svc
+	}
+	services := []runtime.Object{
+		newService("alive", "alive", "uid-alive"),
+		newService("alive-client", "alive", ""),
+		// owned by a deleted cluster of the same name
+		newService("alive-old", "alive", "uid-old"),
+		newService("deleted", "deleted", "uid-deleted"),
+		newService("deleted-client", "deleted", ""),
+		&v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "unrelated", Namespace: "default"}},
+	}
+
+	tests := []struct {
+		clusterName string
+		want        []string
+	}{
+		{"", []string{"alive", "alive-client", "unrelated"}},
+		{"alive", []string{"alive", "alive-client", "deleted", "deleted-client", "unrelated"}},
+		{"deleted", []string{"alive", "alive-client", "alive-old", "unrelated"}},
+	}
+	for i, tt := range tests {
+		kubecli := fake.NewSimpleClientset(services...)
+		gc := New(kubecli, fakeetcd.NewSimpleClientset(alive), "default")
+		if err := gc.CollectOrphanedServices(tt.clusterName); err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+			continue
+		}
+		svcs, err := kubecli.CoreV1().Services("default").List(metav1.ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, svc := range svcs.Items {
+			got = append(got, svc.Name)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("#%d: remaining services = %v, want %v", i, got, tt.want)
+		}
+	}
+}
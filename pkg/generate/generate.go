@@ -0,0 +1,340 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package generate generates the Kubernetes manifests to get started with an etcd cluster.
+package generate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/api/core/v1"
+	rbacv1beta1 "k8s.io/api/rbac/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// operatorName is the name of the service account of the operator and the
+	// prefix of its cluster role and cluster role binding.
+	operatorName = "etcd-operator"
+	// placeholderValue is set to the secret data the user has to fill in.
+	placeholderValue = "<FILL-ME-IN>"
+)
+
+// Options are the options of the generated manifests.
+type Options struct {
+	// Name is the name of the etcd cluster.
+	Name string
+	// Namespace is the namespace of all the namespaced manifests.
+	Namespace string
+	// Size is the size of the etcd cluster.
+	Size int
+	// Version is the etcd version of the cluster. The default version is used if empty.
+	Version string
+	// BackupType is the storage type of the backup, S3 or ABS. No backup is generated if empty.
+	BackupType string
+	// TLS enables static TLS for the cluster, with placeholder secrets.
+	TLS bool
+}
+
+func (o *Options) validate() error {
+	if len(o.Name) == 0 {
+		return fmt.Errorf("name must be set")
+	}
+	if len(o.Namespace) == 0 {
+		return fmt.Errorf("namespace must be set")
+	}
+	if o.Size < 1 {
+		return fmt.Errorf("size must be at least 1, got %d", o.Size)
+	}
+	switch api.BackupStorageType(strings.ToUpper(o.BackupType)) {
+	case "", api.BackupStorageTypeS3, api.BackupStorageTypeABS:
+	default:
+		return fmt.Errorf("unknown backup type (%s), must be one of S3 or ABS", o.BackupType)
+	}
+	return nil
+}
+
+func (o *Options) peerSecret() string     { return o.Name + "-peer-tls" }
+func (o *Options) serverSecret() string   { return o.Name + "-server-tls" }
+func (o *Options) operatorSecret() string { return o.Name + "-operator-tls" }
+func (o *Options) backupSecret() string   { return o.Name + "-backup-credentials" }
+
+// clusterRoleName is the name of the cluster role and cluster role binding of
+// the operator, which are not namespaced.
+func (o *Options) clusterRoleName() string { return operatorName + "-" + o.Namespace }
+
+// Manifests returns the RBAC, the TLS secret placeholders, the EtcdCluster and
+// the EtcdBackup for o, in the order they should be created.
+func Manifests(o Options) ([]runtime.Object, error) {
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+	objs := []runtime.Object{newServiceAccount(o), newClusterRole(o), newClusterRoleBinding(o)}
+	if o.TLS {
+		objs = append(objs,
+			newSecret(o, o.peerSecret(), "peer.crt", "peer.key", "peer-ca.crt"),
+			newSecret(o, o.serverSecret(), "server.crt", "server.key", "server-ca.crt"),
+			newSecret(o, o.operatorSecret(), etcdutil.CliCertFile, etcdutil.CliKeyFile, etcdutil.CliCAFile),
+		)
+	}
+	cl := newEtcdCluster(o)
+	if err := cl.Spec.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid cluster spec: %v", err)
+	}
+	objs = append(objs, cl)
+	switch api.BackupStorageType(strings.ToUpper(o.BackupType)) {
+	case api.BackupStorageTypeS3:
+		objs = append(objs,
+			newSecret(o, o.backupSecret(), api.AWSSecretCredentialsFileName, api.AWSSecretConfigFileName),
+			newEtcdBackup(o, api.BackupSource{S3: &api.S3BackupSource{
+				Path:      "<s3-bucket-name>/" + o.Name + ".backup",
+				AWSSecret: o.backupSecret(),
+			}}))
+	case api.BackupStorageTypeABS:
+		objs = append(objs,
+			newSecret(o, o.backupSecret(), api.AzureSecretStorageAccount, api.AzureSecretStorageKey),
+			newEtcdBackup(o, api.BackupSource{ABS: &api.ABSBackupSource{
+				Path:      "<abs-container-name>/" + o.Name + ".backup",
+				ABSSecret: o.backupSecret(),
+			}}))
+	}
+	return objs, nil
+}
+
+// WriteYAML writes objs to w as a multi-document YAML stream.
+// The status and the creation timestamp of the objects are left out.
+func WriteYAML(w io.Writer, objs []runtime.Object) error {
+	for i, obj := range objs {
+		b, err := json.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		m := map[string]interface{}{}
+		if err := json.Unmarshal(b, &m); err != nil {
+			return err
+		}
+		delete(m, "status")
+		if md, ok := m["metadata"].(map[string]interface{}); ok {
+			delete(md, "creationTimestamp")
+		}
+		b, err = yaml.Marshal(m)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			if _, err := io.WriteString(w, "---\n"); err != nil {
+				return err
+			}
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newEtcdCluster(o Options) *api.EtcdCluster {
+	cl := &api.EtcdCluster{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: api.SchemeGroupVersion.String(),
+			Kind:       api.EtcdClusterResourceKind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      o.Name,
+			Namespace: o.Namespace,
+		},
+		Spec: api.ClusterSpec{
+			Size:    o.Size,
+			Version: o.Version,
+		},
+	}
+	if o.TLS {
+		cl.Spec.TLS = &api.TLSPolicy{
+			Static: &api.StaticTLS{
+				Member: &api.MemberSecret{
+					PeerSecret:   o.peerSecret(),
+					ServerSecret: o.serverSecret(),
+				},
+				OperatorSecret: o.operatorSecret(),
+			},
+		}
+	}
+	return cl
+}
+
+func newEtcdBackup(o Options, source api.BackupSource) *api.EtcdBackup {
+	scheme := "http"
+	clientTLSSecret := ""
+	if o.TLS {
+		scheme = "https"
+		clientTLSSecret = o.operatorSecret()
+	}
+	storageType := api.BackupStorageTypeS3
+	if source.ABS != nil {
+		storageType = api.BackupStorageTypeABS
+	}
+	return &api.EtcdBackup{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: api.SchemeGroupVersion.String(),
+			Kind:       api.EtcdBackupResourceKind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      o.Name + "-backup",
+			Namespace: o.Namespace,
+		},
+		Spec: api.BackupSpec{
+			EtcdEndpoints:   []string{fmt.Sprintf("%s://%s-client.%s.svc:2379", scheme, o.Name, o.Namespace)},
+			StorageType:     storageType,
+			BackupSource:    source,
+			ClientTLSSecret: clientTLSSecret,
+			ClusterName:     o.Name,
+		},
+	}
+}
+
+// newSecret returns a secret named name with placeholders for the data keys.
+func newSecret(o Options, name string, keys ...string) *v1.Secret {
+	s := &v1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Secret",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: o.Namespace,
+		},
+		StringData: map[string]string{},
+	}
+	for _, k := range keys {
+		s.StringData[k] = placeholderValue
+	}
+	return s
+}
+
+// operatorRules are the rules of example/rbac/cluster-role-template.yaml.
+var operatorRules = []rbacv1beta1.PolicyRule{
+	{
+		APIGroups: []string{api.SchemeGroupVersion.Group},
+		Resources: []string{api.EtcdClusterResourcePlural, api.EtcdBackupResourcePlural, api.EtcdRestoreResourcePlural},
+		Verbs:     []string{"*"},
+	},
+	{
+		APIGroups: []string{"apiextensions.k8s.io"},
+		Resources: []string{"customresourcedefinitions"},
+		Verbs:     []string{"*"},
+	},
+	{
+		APIGroups: []string{""},
+		Resources: []string{"pods", "pods/exec", "services", "endpoints", "persistentvolumeclaims", "configmaps", "events"},
+		Verbs:     []string{"*"},
+	},
+	{
+		APIGroups: []string{"apps"},
+		Resources: []string{"deployments"},
+		Verbs:     []string{"*"},
+	},
+	// --watch-spot-interruptions
+	{
+		APIGroups: []string{""},
+		Resources: []string{"nodes"},
+		Verbs:     []string{"list", "watch", "patch"},
+	},
+	// spec.enableNetworkPolicy
+	{
+		APIGroups: []string{"networking.k8s.io"},
+		Resources: []string{"networkpolicies"},
+		Verbs:     []string{"create"},
+	},
+	// spec.enablePodDisruptionBudget
+	{
+		APIGroups: []string{"policy"},
+		Resources: []string{"poddisruptionbudgets"},
+		Verbs:     []string{"create", "delete"},
+	},
+	// spec.prometheusMonitoring
+	{
+		APIGroups: []string{"monitoring.coreos.com"},
+		Resources: []string{"servicemonitors"},
+		Verbs:     []string{"get", "create"},
+	},
+	// spec.TLS.certManager
+	{
+		APIGroups: []string{"cert-manager.io"},
+		Resources: []string{"certificates"},
+		Verbs:     []string{"create"},
+	},
+	// S3 backup and TLS
+	{
+		APIGroups: []string{""},
+		Resources: []string{"secrets"},
+		Verbs:     []string{"get"},
+	},
+}
+
+func newServiceAccount(o Options) *v1.ServiceAccount {
+	return &v1.ServiceAccount{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "ServiceAccount",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      operatorName,
+			Namespace: o.Namespace,
+		},
+	}
+}
+
+// newClusterRole returns a cluster role since the operator lists the nodes.
+func newClusterRole(o Options) *rbacv1beta1.ClusterRole {
+	return &rbacv1beta1.ClusterRole{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: rbacv1beta1.SchemeGroupVersion.String(),
+			Kind:       "ClusterRole",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: o.clusterRoleName(),
+		},
+		Rules: operatorRules,
+	}
+}
+
+func newClusterRoleBinding(o Options) *rbacv1beta1.ClusterRoleBinding {
+	return &rbacv1beta1.ClusterRoleBinding{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: rbacv1beta1.SchemeGroupVersion.String(),
+			Kind:       "ClusterRoleBinding",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: o.clusterRoleName(),
+		},
+		RoleRef: rbacv1beta1.RoleRef{
+			APIGroup: rbacv1beta1.GroupName,
+			Kind:     "ClusterRole",
+			Name:     o.clusterRoleName(),
+		},
+		Subjects: []rbacv1beta1.Subject{{
+			Kind:      rbacv1beta1.ServiceAccountKind,
+			Name:      operatorName,
+			Namespace: o.Namespace,
+		}},
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generate
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+
+	"github.com/ghodss/yaml"
+	rbacv1beta1 "k8s.io/api/rbac/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func kinds(objs []runtime.Object) []string {
+	var ks []string
+	for _, obj := range objs {
+		ks = append(ks, obj.GetObjectKind().GroupVersionKind().Kind)
+	}
+	return ks
+}
+
+func TestManifests(t *testing.T) {
+	tests := []struct {
+		opts      Options
+		wantKinds []string
+		wantErr   bool
+	}{{
+		opts:      Options{Name: "c", Namespace: "ns", Size: 3},
+		wantKinds: []string{"ServiceAccount", "ClusterRole", "ClusterRoleBinding", "EtcdCluster"},
+	}, {
+		opts:      Options{Name: "c", Namespace: "ns", Size: 3, TLS: true, BackupType: "s3"},
+		wantKinds: []string{"ServiceAccount", "ClusterRole", "ClusterRoleBinding", "Secret", "Secret", "Secret", "EtcdCluster", "Secret", "EtcdBackup"},
+	}, {
+		opts:      Options{Name: "c", Namespace: "ns", Size: 1, BackupType: "ABS"},
+		wantKinds: []string{"ServiceAccount", "ClusterRole", "ClusterRoleBinding", "EtcdCluster", "Secret", "EtcdBackup"},
+	}, {
+		opts:    Options{Namespace: "ns", Size: 3},
+		wantErr: true,
+	}, {
+		opts:    Options{Name: "c", Namespace: "ns", Size: 0},
+		wantErr: true,
+	}, {
+		opts:    Options{Name: "c", Namespace: "ns", Size: 3, BackupType: "gcs"},
+		wantErr: true,
+	}}
+	for i, tt := range tests {
+		objs, err := Manifests(tt.opts)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("#%d: err = %v, want error %v", i, err, tt.wantErr)
+			continue
+		}
+		if got := kinds(objs); !reflect.DeepEqual(got, tt.wantKinds) {
+			t.Errorf("#%d: kinds = %v, want %v", i, got, tt.wantKinds)
+		}
+	}
+}
+
+func TestManifestsTLSBackup(t *testing.T) {
+	objs, err := Manifests(Options{Name: "c", Namespace: "ns", Size: 3, TLS: true, BackupType: "S3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl := objs[6].(*api.EtcdCluster)
+	eb := objs[8].(*api.EtcdBackup)
+	if !cl.Spec.TLS.IsSecureClient() {
+		t.Errorf("expect cluster with operator TLS secret, got %+v", cl.Spec.TLS)
+	}
+	if eb.Spec.ClientTLSSecret != cl.Spec.TLS.Static.OperatorSecret {
+		t.Errorf("backup client TLS secret = %q, want %q", eb.Spec.ClientTLSSecret, cl.Spec.TLS.Static.OperatorSecret)
+	}
+	if want := "https://c-client.ns.svc:2379"; len(eb.Spec.EtcdEndpoints) != 1 || eb.Spec.EtcdEndpoints[0] != want {
+		t.Errorf("backup endpoints = %v, want [%v]", eb.Spec.EtcdEndpoints, want)
+	}
+	if eb.Spec.ClusterName != "c" {
+		t.Errorf("backup cluster name = %q, want c", eb.Spec.ClusterName)
+	}
+}
+
+func TestOperatorRulesMatchTemplate(t *testing.T) {
+	b, err := ioutil.ReadFile("../../example/rbac/cluster-role-template.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	role := &rbacv1beta1.ClusterRole{}
+	if err := yaml.Unmarshal(b, role); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(operatorRules, role.Rules) {
+		t.Errorf("rules = %+v, want the rules of the cluster role template %+v", operatorRules, role.Rules)
+	}
+}
+
+func TestWriteYAML(t *testing.T) {
+	objs, err := Manifests(Options{Name: "c", Namespace: "ns", Size: 3, Version: "3.2.13"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteYAML(&buf, objs); err != nil {
+		t.Fatal(err)
+	}
+	docs := strings.Split(buf.String(), "---\n")
+	if len(docs) != len(objs) {
+		t.Fatalf("got %d YAML documents, want %d", len(docs), len(objs))
+	}
+	cl := &api.EtcdCluster{}
+	if err := yaml.Unmarshal([]byte(docs[3]), cl); err != nil {
+		t.Fatal(err)
+	}
+	if cl.Name != "c" || cl.Namespace != "ns" || cl.Spec.Size != 3 || cl.Spec.Version != "3.2.13" {
+		t.Errorf("unexpected EtcdCluster: %+v", cl)
+	}
+	if strings.Contains(docs[3], "status:") || strings.Contains(docs[3], "creationTimestamp") {
+		t.Errorf("expect no status and creation timestamp, got:\n%s", docs[3])
+	}
+}
@@ -22,8 +22,11 @@ import (
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sts"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
@@ -39,7 +42,8 @@ type S3Client struct {
 }
 
 // NewClientFromSecret returns a S3 client based on given k8s secret containing aws credentials.
-func NewClientFromSecret(kubecli kubernetes.Interface, namespace, awsSecret string) (w *S3Client, err error) {
+// The optional cfgs are applied on top of the session configuration.
+func NewClientFromSecret(kubecli kubernetes.Interface, namespace, awsSecret string, cfgs ...*aws.Config) (w *S3Client, err error) {
 	defer func() {
 		if err != nil {
 			err = fmt.Errorf("new S3 client failed: %v", err)
@@ -58,12 +62,33 @@ func NewClientFromSecret(kubecli kubernetes.Interface, namespace, awsSecret stri
 	if err != nil {
 		return nil, fmt.Errorf("new AWS session failed: %v", err)
 	}
-	w.S3 = s3.New(sess)
+	w.S3 = s3.New(sess, cfgs...)
 	return w, nil
 }
 
+// NewClientFromWebIdentity returns a S3 client that is authenticated with the
+// IAM role of the pod's service account (IRSA), using the role ARN and web
+// identity token file that EKS injects into the pod's environment.
+func NewClientFromWebIdentity(cfgs ...*aws.Config) (*S3Client, error) {
+	sess, err := session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("new S3 client failed: new AWS session failed: %v", err)
+	}
+	p, err := newWebIdentityProviderFromEnv(sts.New(sess))
+	if err != nil {
+		return nil, fmt.Errorf("new S3 client failed: %v", err)
+	}
+	cfgs = append([]*aws.Config{{Credentials: credentials.NewCredentials(p)}}, cfgs...)
+	return &S3Client{S3: s3.New(sess, cfgs...)}, nil
+}
+
 // Close cleans up all intermediate resources for creating S3 client.
 func (w *S3Client) Close() {
+	if len(w.configDir) == 0 {
+		return
+	}
 	os.RemoveAll(w.configDir)
 }
 
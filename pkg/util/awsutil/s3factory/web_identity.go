@@ -0,0 +1,103 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3factory
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+const (
+	// Environment variables that EKS injects into pods whose service account
+	// is annotated with an IAM role.
+	envRoleARN              = "AWS_ROLE_ARN"
+	envWebIdentityTokenFile = "AWS_WEB_IDENTITY_TOKEN_FILE"
+	envRoleSessionName      = "AWS_ROLE_SESSION_NAME"
+
+	defaultRoleSessionName = "etcd-backup-operator"
+
+	// webIdentityExpiryWindow makes the credentials expire early so that they
+	// are refreshed before a long running upload is signed with them.
+	webIdentityExpiryWindow = 5 * time.Minute
+
+	webIdentityProviderName = "WebIdentityProvider"
+)
+
+// assumeRoleWithWebIdentityAPI is the part of the STS API used by webIdentityProvider.
+type assumeRoleWithWebIdentityAPI interface {
+	AssumeRoleWithWebIdentity(*sts.AssumeRoleWithWebIdentityInput) (*sts.AssumeRoleWithWebIdentityOutput, error)
+}
+
+// webIdentityProvider retrieves credentials by assuming roleARN with the web
+// identity token in tokenFile. The vendored AWS SDK predates web identity
+// support in the default credential chain.
+type webIdentityProvider struct {
+	credentials.Expiry
+
+	client      assumeRoleWithWebIdentityAPI
+	roleARN     string
+	sessionName string
+	tokenFile   string
+}
+
+// newWebIdentityProviderFromEnv returns a webIdentityProvider configured from
+// the environment variables that EKS injects for IRSA.
+func newWebIdentityProviderFromEnv(client assumeRoleWithWebIdentityAPI) (*webIdentityProvider, error) {
+	roleARN := os.Getenv(envRoleARN)
+	tokenFile := os.Getenv(envWebIdentityTokenFile)
+	if len(roleARN) == 0 || len(tokenFile) == 0 {
+		return nil, fmt.Errorf("%s and %s must be set to use IRSA", envRoleARN, envWebIdentityTokenFile)
+	}
+	sessionName := os.Getenv(envRoleSessionName)
+	if len(sessionName) == 0 {
+		sessionName = defaultRoleSessionName
+	}
+	return &webIdentityProvider{
+		client:      client,
+		roleARN:     roleARN,
+		sessionName: sessionName,
+		tokenFile:   tokenFile,
+	}, nil
+}
+
+// Retrieve reads the token file, which is rotated by the kubelet, and
+// exchanges the token for temporary credentials of the role.
+func (p *webIdentityProvider) Retrieve() (credentials.Value, error) {
+	token, err := ioutil.ReadFile(p.tokenFile)
+	if err != nil {
+		return credentials.Value{ProviderName: webIdentityProviderName}, fmt.Errorf("read web identity token failed: %v", err)
+	}
+	resp, err := p.client.AssumeRoleWithWebIdentity(&sts.AssumeRoleWithWebIdentityInput{
+		RoleArn:          aws.String(p.roleARN),
+		RoleSessionName:  aws.String(p.sessionName),
+		WebIdentityToken: aws.String(string(token)),
+	})
+	if err != nil {
+		return credentials.Value{ProviderName: webIdentityProviderName}, fmt.Errorf("assume role with web identity failed: %v", err)
+	}
+	p.SetExpiration(aws.TimeValue(resp.Credentials.Expiration), webIdentityExpiryWindow)
+	return credentials.Value{
+		AccessKeyID:     aws.StringValue(resp.Credentials.AccessKeyId),
+		SecretAccessKey: aws.StringValue(resp.Credentials.SecretAccessKey),
+		SessionToken:    aws.StringValue(resp.Credentials.SessionToken),
+		ProviderName:    webIdentityProviderName,
+	}, nil
+}
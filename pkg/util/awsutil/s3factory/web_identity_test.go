@@ -0,0 +1,105 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3factory
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+type fakeSTS struct {
+	input *sts.AssumeRoleWithWebIdentityInput
+	err   error
+}
+
+func (f *fakeSTS) AssumeRoleWithWebIdentity(in *sts.AssumeRoleWithWebIdentityInput) (*sts.AssumeRoleWithWebIdentityOutput, error) {
+	f.input = in
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &sts.AssumeRoleWithWebIdentityOutput{
+		Credentials: &sts.Credentials{
+			AccessKeyId:     aws.String("id"),
+			SecretAccessKey: aws.String("secret"),
+			SessionToken:    aws.String("session"),
+			Expiration:      aws.Time(time.Now().Add(time.Hour)),
+		},
+	}, nil
+}
+
+func TestWebIdentityProviderRetrieve(t *testing.T) {
+	dir, err := ioutil.TempDir("", "web-identity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tokenFile := filepath.Join(dir, "token")
+	if err = ioutil.WriteFile(tokenFile, []byte("token"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fakeSTS{}
+	p := &webIdentityProvider{client: f, roleARN: "arn:aws:iam::123456789012:role/backup", sessionName: "s", tokenFile: tokenFile}
+	v, err := p.Retrieve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.AccessKeyID != "id" || v.SecretAccessKey != "secret" || v.SessionToken != "session" {
+		t.Errorf("unexpected credentials: %+v", v)
+	}
+	if aws.StringValue(f.input.WebIdentityToken) != "token" || aws.StringValue(f.input.RoleArn) != p.roleARN {
+		t.Errorf("unexpected request: %v", f.input)
+	}
+	if p.IsExpired() {
+		t.Error("expect credentials not to be expired")
+	}
+
+	f.err = errors.New("denied")
+	if _, err = p.Retrieve(); err == nil {
+		t.Error("expect error when STS rejects the token")
+	}
+	p.tokenFile = filepath.Join(dir, "missing")
+	if _, err = p.Retrieve(); err == nil {
+		t.Error("expect error when the token file is missing")
+	}
+}
+
+func TestNewWebIdentityProviderFromEnv(t *testing.T) {
+	for _, k := range []string{envRoleARN, envWebIdentityTokenFile, envRoleSessionName} {
+		defer os.Setenv(k, os.Getenv(k))
+		os.Unsetenv(k)
+	}
+
+	if _, err := newWebIdentityProviderFromEnv(&fakeSTS{}); err == nil {
+		t.Error("expect error without the IRSA environment")
+	}
+
+	os.Setenv(envRoleARN, "arn")
+	os.Setenv(envWebIdentityTokenFile, "/token")
+	p, err := newWebIdentityProviderFromEnv(&fakeSTS{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.roleARN != "arn" || p.tokenFile != "/token" || p.sessionName != defaultRoleSessionName {
+		t.Errorf("unexpected provider: %+v", p)
+	}
+}
@@ -16,6 +16,8 @@ package absfactory
 
 import (
 	"fmt"
+	"net/http"
+	"net/url"
 
 	"github.com/Azure/azure-sdk-for-go/storage"
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
@@ -34,7 +36,9 @@ type ABSClient struct {
 }
 
 // NewClientFromSecret returns a ABS client based on given k8s secret containing azure credentials.
-func NewClientFromSecret(kubecli kubernetes.Interface, namespace, absSecret string) (w *ABSClient, err error) {
+// If privateEndpointURL is not empty, the requests are sent to it instead of the
+// public endpoint of the storage account.
+func NewClientFromSecret(kubecli kubernetes.Interface, namespace, absSecret, privateEndpointURL string) (w *ABSClient, err error) {
 	defer func() {
 		if err != nil {
 			err = fmt.Errorf("new ABS client failed: %v", err)
@@ -56,8 +60,60 @@ func NewClientFromSecret(kubecli kubernetes.Interface, namespace, absSecret stri
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Azure storage client: %v", err)
 	}
+	if len(privateEndpointURL) != 0 {
+		u, err := url.Parse(privateEndpointURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid private endpoint URL (%s): %v", privateEndpointURL, err)
+		}
+		bc.HTTPClient = &http.Client{Transport: &endpointTransport{endpoint: u, rt: http.DefaultTransport}}
+	}
 
 	abs := bc.GetBlobService()
 	w.ABS = &abs
 	return w, nil
 }
+
+// endpointTransport sends the requests to the scheme and host of endpoint.
+// The shared key signature of a request does not cover the host, so the
+// signed requests for the public endpoint are also valid for a private endpoint.
+type endpointTransport struct {
+	endpoint *url.URL
+	rt       http.RoundTripper
+}
+
+func (t *endpointTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := new(http.Request)
+	*r = *req
+	u := *req.URL
+	u.Scheme = t.endpoint.Scheme
+	u.Host = t.endpoint.Host
+	r.URL = &u
+	r.Host = ""
+	return t.rt.RoundTrip(r)
+}
+
+// NewClientFromSASToken returns a ABS client for the given blob service endpoint
+// that authenticates with a Shared Access Signature token.
+// The token must grant access to the given container.
+func NewClientFromSASToken(endpoint, containerName, sasToken string) (w *ABSClient, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("new ABS client failed: %v", err)
+		}
+	}()
+
+	bc, err := storage.NewAccountSASClientFromEndpointToken(endpoint, sasToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Azure storage client: %v", err)
+	}
+
+	abs := bc.GetBlobService()
+	exists, err := abs.GetContainerReference(containerName).Exists()
+	if err != nil {
+		return nil, fmt.Errorf("failed to access container (%s) with SAS token: %v", containerName, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("container (%s) does not exist", containerName)
+	}
+	return &ABSClient{ABS: &abs}, nil
+}
@@ -23,13 +23,30 @@ import (
 	"github.com/coreos/etcd/clientv3"
 )
 
-func ListMembers(clientURLs []string, tc *tls.Config) (*clientv3.MemberListResponse, error) {
+// Credentials are the user name and password an etcd client authenticates with
+// once etcd authentication is enabled.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// NewClientConfig returns the config of an etcd client of clientURLs. tc and
+// cred may be nil for clusters without TLS or authentication.
+func NewClientConfig(clientURLs []string, tc *tls.Config, cred *Credentials) clientv3.Config {
 	cfg := clientv3.Config{
 		Endpoints:   clientURLs,
 		DialTimeout: constants.DefaultDialTimeout,
 		TLS:         tc,
 	}
-	etcdcli, err := clientv3.New(cfg)
+	if cred != nil {
+		cfg.Username = cred.Username
+		cfg.Password = cred.Password
+	}
+	return cfg
+}
+
+func ListMembers(clientURLs []string, tc *tls.Config, cred *Credentials) (*clientv3.MemberListResponse, error) {
+	etcdcli, err := clientv3.New(NewClientConfig(clientURLs, tc, cred))
 	if err != nil {
 		return nil, fmt.Errorf("list members failed: creating etcd client failed: %v", err)
 	}
@@ -41,13 +58,8 @@ func ListMembers(clientURLs []string, tc *tls.Config) (*clientv3.MemberListRespo
 	return resp, err
 }
 
-func RemoveMember(clientURLs []string, tc *tls.Config, id uint64) error {
-	cfg := clientv3.Config{
-		Endpoints:   clientURLs,
-		DialTimeout: constants.DefaultDialTimeout,
-		TLS:         tc,
-	}
-	etcdcli, err := clientv3.New(cfg)
+func RemoveMember(clientURLs []string, tc *tls.Config, cred *Credentials, id uint64) error {
+	etcdcli, err := clientv3.New(NewClientConfig(clientURLs, tc, cred))
 	if err != nil {
 		return err
 	}
@@ -58,3 +70,108 @@ func RemoveMember(clientURLs []string, tc *tls.Config, id uint64) error {
 	cancel()
 	return err
 }
+
+// AddMember adds a member with the given peer URL to the etcd cluster and
+// returns the ID of the new member.
+func AddMember(clientURLs []string, tc *tls.Config, cred *Credentials, peerURL string) (uint64, error) {
+	etcdcli, err := clientv3.New(NewClientConfig(clientURLs, tc, cred))
+	if err != nil {
+		return 0, fmt.Errorf("add member failed: creating etcd client failed: %v", err)
+	}
+	defer etcdcli.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), constants.DefaultRequestTimeout)
+	resp, err := etcdcli.MemberAdd(ctx, []string{peerURL})
+	cancel()
+	if err != nil {
+		return 0, err
+	}
+	return resp.Member.ID, nil
+}
+
+// CheckQuorum does a linearizable get of key, which only succeeds if the
+// etcd cluster has quorum.
+func CheckQuorum(clientURLs []string, tc *tls.Config, cred *Credentials, key string) error {
+	etcdcli, err := clientv3.New(NewClientConfig(clientURLs, tc, cred))
+	if err != nil {
+		return fmt.Errorf("creating etcd client failed: %v", err)
+	}
+	defer etcdcli.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), constants.DefaultRequestTimeout)
+	_, err = etcdcli.Get(ctx, key)
+	cancel()
+	return err
+}
+
+// ClusterStats are cluster-wide statistics of an etcd cluster.
+type ClusterStats struct {
+	// Leader is the name of the leader member.
+	Leader string
+	// Term is the raft term of the leader.
+	Term uint64
+	// Revision is the current revision of the key-value store.
+	Revision int64
+	// TotalKeys is the number of keys in the key-value store.
+	TotalKeys int64
+	// DBSizeBytes is the size of the backend database of the leader.
+	DBSizeBytes int64
+	// MembersHealthy is the number of members that answered the status request.
+	MembersHealthy int
+}
+
+// GetClusterStats gathers the cluster statistics from the status of every
+// member and a key count. It fails if the leader did not answer.
+func GetClusterStats(clientURLs []string, tc *tls.Config, cred *Credentials) (*ClusterStats, error) {
+	etcdcli, err := clientv3.New(NewClientConfig(clientURLs, tc, cred))
+	if err != nil {
+		return nil, fmt.Errorf("get cluster stats failed: creating etcd client failed: %v", err)
+	}
+	defer etcdcli.Close()
+	return GetClusterStatsWithClient(etcdcli, clientURLs)
+}
+
+// GetClusterStatsWithClient is GetClusterStats with an existing etcd client.
+func GetClusterStatsWithClient(etcdcli *clientv3.Client, clientURLs []string) (*ClusterStats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), constants.DefaultRequestTimeout)
+	mresp, err := etcdcli.MemberList(ctx)
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list members: %v", err)
+	}
+
+	stats := &ClusterStats{}
+	var leaderID uint64
+	for _, ep := range clientURLs {
+		ctx, cancel := context.WithTimeout(context.Background(), constants.DefaultRequestTimeout)
+		resp, err := etcdcli.Status(ctx, ep)
+		cancel()
+		if err != nil {
+			continue
+		}
+		stats.MembersHealthy++
+		if resp.Header.MemberId == resp.Leader {
+			leaderID = resp.Leader
+			stats.Term = resp.RaftTerm
+			stats.DBSizeBytes = resp.DbSize
+		}
+	}
+	if leaderID == 0 {
+		return nil, fmt.Errorf("no etcd leader found")
+	}
+	for _, m := range mresp.Members {
+		if m.ID == leaderID {
+			stats.Leader = m.Name
+		}
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), constants.DefaultRequestTimeout)
+	gresp, err := etcdcli.Get(ctx, "\x00", clientv3.WithFromKey(), clientv3.WithCountOnly())
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to count keys: %v", err)
+	}
+	stats.TotalKeys = gresp.Count
+	stats.Revision = gresp.Header.Revision
+	return stats, nil
+}
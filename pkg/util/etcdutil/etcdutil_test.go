@@ -63,3 +63,18 @@ func TestMemberNameFromPeerURL(t *testing.T) {
 		}
 	}
 }
+
+func TestNewClientConfig(t *testing.T) {
+	urls := []string{"http://test-0000.test.default.svc:2379"}
+	cfg := NewClientConfig(urls, nil, nil)
+	if len(cfg.Username) != 0 || len(cfg.Password) != 0 {
+		t.Errorf("credentials = %q/%q, want none", cfg.Username, cfg.Password)
+	}
+	cfg = NewClientConfig(urls, nil, &Credentials{Username: "root", Password: "secret"})
+	if cfg.Username != "root" || cfg.Password != "secret" {
+		t.Errorf("credentials = %q/%q, want %q/%q", cfg.Username, cfg.Password, "root", "secret")
+	}
+	if len(cfg.Endpoints) != 1 || cfg.Endpoints[0] != urls[0] {
+		t.Errorf("endpoints = %v, want %v", cfg.Endpoints, urls)
+	}
+}
@@ -34,10 +34,23 @@ type Member struct {
 
 	SecurePeer   bool
 	SecureClient bool
+
+	// ClusterDomain is the DNS domain of the Kubernetes cluster, e.g. "cluster.local".
+	// If empty, the member address is relative to the domain of the resolver.
+	ClusterDomain string
 }
 
 func (m *Member) Addr() string {
-	return fmt.Sprintf("%s.%s.%s.svc", m.Name, clusterNameFromMemberName(m.Name), m.Namespace)
+	addr := fmt.Sprintf("%s.%s.%s.svc", m.Name, clusterNameFromMemberName(m.Name), m.Namespace)
+	if len(m.ClusterDomain) != 0 {
+		addr += "." + m.ClusterDomain
+	}
+	return addr
+}
+
+// ClusterName is the name of the cluster of this member.
+func (m *Member) ClusterName() string {
+	return clusterNameFromMemberName(m.Name)
 }
 
 // ClientURL is the client URL for this member
@@ -80,15 +93,21 @@ func NewMemberSet(ms ...*Member) MemberSet {
 	return res
 }
 
-// the set of all members of s1 that are not members of s2
-func (ms MemberSet) Diff(other MemberSet) MemberSet {
-	diff := MemberSet{}
+// Diff returns the members of other that are not in ms as added, and the
+// members of ms that are not in other as removed. Members are compared by Name.
+func (ms MemberSet) Diff(other MemberSet) (added, removed MemberSet) {
+	added, removed = MemberSet{}, MemberSet{}
+	for n, m := range other {
+		if _, ok := ms[n]; !ok {
+			added[n] = m
+		}
+	}
 	for n, m := range ms {
 		if _, ok := other[n]; !ok {
-			diff[n] = m
+			removed[n] = m
 		}
 	}
-	return diff
+	return added, removed
 }
 
 // IsEqual tells whether two member sets are equal by checking
@@ -54,3 +54,70 @@ func TestMemberSetIsEqual(t *testing.T) {
 		}
 	}
 }
+
+func TestMemberSetDiff(t *testing.T) {
+	ma := &Member{Name: "a"}
+	mb := &Member{Name: "b"}
+	mc := &Member{Name: "c"}
+	tests := []struct {
+		ms, other        MemberSet
+		wAdded, wRemoved MemberSet
+	}{{
+		ms:       NewMemberSet(),
+		other:    NewMemberSet(),
+		wAdded:   NewMemberSet(),
+		wRemoved: NewMemberSet(),
+	}, {
+		ms:       NewMemberSet(ma, mb),
+		other:    NewMemberSet(ma, mb),
+		wAdded:   NewMemberSet(),
+		wRemoved: NewMemberSet(),
+	}, {
+		ms:       NewMemberSet(),
+		other:    NewMemberSet(ma, mb),
+		wAdded:   NewMemberSet(ma, mb),
+		wRemoved: NewMemberSet(),
+	}, {
+		ms:       NewMemberSet(ma, mb),
+		other:    NewMemberSet(),
+		wAdded:   NewMemberSet(),
+		wRemoved: NewMemberSet(ma, mb),
+	}, {
+		ms:       NewMemberSet(ma, mb),
+		other:    NewMemberSet(mb, mc),
+		wAdded:   NewMemberSet(mc),
+		wRemoved: NewMemberSet(ma),
+	}, {
+		ms:       nil,
+		other:    NewMemberSet(ma),
+		wAdded:   NewMemberSet(ma),
+		wRemoved: NewMemberSet(),
+	}}
+	for i, tt := range tests {
+		added, removed := tt.ms.Diff(tt.other)
+		if !added.IsEqual(tt.wAdded) {
+			t.Errorf("#%d: added = %v, want %v", i, added, tt.wAdded)
+		}
+		if !removed.IsEqual(tt.wRemoved) {
+			t.Errorf("#%d: removed = %v, want %v", i, removed, tt.wRemoved)
+		}
+	}
+}
+
+func TestMemberAddr(t *testing.T) {
+	tests := []struct {
+		m     *Member
+		wAddr string
+	}{{
+		m:     &Member{Name: "example-0000", Namespace: "default"},
+		wAddr: "example-0000.example.default.svc",
+	}, {
+		m:     &Member{Name: "example-0000", Namespace: "default", ClusterDomain: "cluster.example.com"},
+		wAddr: "example-0000.example.default.svc.cluster.example.com",
+	}}
+	for i, tt := range tests {
+		if addr := tt.m.Addr(); addr != tt.wAddr {
+			t.Errorf("#%d: addr get=%v, want=%v", i, addr, tt.wAddr)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sutil
+
+import (
+	"encoding/json"
+	"fmt"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// The cert-manager client is not vendored. Certificates are sent as raw JSON
+// with the subset of the cert-manager.io/v1 types below.
+const certManagerV1GroupVersion = "cert-manager.io/v1"
+
+type certificate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              certificateSpec `json:"spec"`
+}
+
+type certificateSpec struct {
+	SecretName  string        `json:"secretName"`
+	CommonName  string        `json:"commonName"`
+	DNSNames    []string      `json:"dnsNames,omitempty"`
+	Duration    string        `json:"duration,omitempty"`
+	RenewBefore string        `json:"renewBefore,omitempty"`
+	Usages      []string      `json:"usages"`
+	IssuerRef   issuerRefSpec `json:"issuerRef"`
+}
+
+type issuerRefSpec struct {
+	Name  string `json:"name"`
+	Kind  string `json:"kind,omitempty"`
+	Group string `json:"group"`
+}
+
+// CreateCertificates creates the cert-manager Certificates of the peer, server
+// and operator client certs of the etcd cluster. The certificates are issued
+// into the secrets named by the cluster's TLS policy.
+func CreateCertificates(kubecli kubernetes.Interface, clusterName, ns, clusterDomain string, tp *api.TLSPolicy, owner metav1.OwnerReference) error {
+	for _, cert := range newCertificateManifests(clusterName, ns, clusterDomain, tp) {
+		addOwnerRefToObject(cert.GetObjectMeta(), owner)
+		body, err := json.Marshal(cert)
+		if err != nil {
+			return err
+		}
+		err = kubecli.CoreV1().RESTClient().Post().
+			AbsPath("/apis", certManagerV1GroupVersion, "namespaces", ns, "certificates").
+			Body(body).
+			Do().
+			Error()
+		if err != nil && !IsKubernetesResourceAlreadyExistError(err) {
+			return fmt.Errorf("failed to create certificate (%s): %v", cert.Name, err)
+		}
+	}
+	return nil
+}
+
+func newCertificateManifests(clusterName, ns, clusterDomain string, tp *api.TLSPolicy) []*certificate {
+	cm := tp.CertManager
+	suffix := ""
+	if len(clusterDomain) != 0 {
+		suffix = "." + clusterDomain
+	}
+	memberDNSNames := []string{
+		fmt.Sprintf("*.%s.%s.svc%s", clusterName, ns, suffix),
+		fmt.Sprintf("%s.%s.svc%s", clusterName, ns, suffix),
+	}
+	clientDNSNames := []string{
+		ClientServiceName(clusterName),
+		fmt.Sprintf("%s.%s", ClientServiceName(clusterName), ns),
+		fmt.Sprintf("%s.%s.svc%s", ClientServiceName(clusterName), ns, suffix),
+		"localhost",
+	}
+
+	newCert := func(secretName, commonName string, dnsNames, usages []string) *certificate {
+		return &certificate{
+			TypeMeta: metav1.TypeMeta{APIVersion: certManagerV1GroupVersion, Kind: "Certificate"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   secretName,
+				Labels: LabelsForCluster(clusterName),
+			},
+			Spec: certificateSpec{
+				SecretName:  secretName,
+				CommonName:  commonName,
+				DNSNames:    dnsNames,
+				Duration:    cm.Duration,
+				RenewBefore: cm.RenewBefore,
+				Usages:      usages,
+				IssuerRef:   issuerRefSpec{Name: cm.IssuerRef.Name, Kind: cm.IssuerRef.Kind, Group: "cert-manager.io"},
+			},
+		}
+	}
+	return []*certificate{
+		newCert(tp.PeerSecret(clusterName), clusterName, memberDNSNames, []string{"server auth", "client auth"}),
+		newCert(tp.ServerSecret(clusterName), clusterName, append(memberDNSNames, clientDNSNames...), []string{"server auth", "client auth"}),
+		newCert(tp.OperatorSecret(clusterName), "etcd-operator", nil, []string{"client auth"}),
+	}
+}
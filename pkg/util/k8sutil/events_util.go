@@ -42,6 +42,57 @@ func MemberRemoveEvent(memberName string, cl *api.EtcdCluster) *v1.Event {
 	return event
 }
 
+func PeerConnectivityIssueEvent(source, memberName string, err error, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeWarning
+	event.Reason = "PeerConnectivityIssue"
+	event.Message = fmt.Sprintf("%s cannot reach the peer port of member %s: %v", source, memberName, err)
+	return event
+}
+
+func MemberRolledBackEvent(memberName, fromVersion, toVersion string, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeWarning
+	event.Reason = "Member Rolled Back"
+	event.Message = fmt.Sprintf("Member %s did not become ready on %s and was rolled back to %s", memberName, fromVersion, toVersion)
+	return event
+}
+
+// AutoUpgradeEvent is created when the operator sets the cluster version to a
+// newer patch release.
+func AutoUpgradeEvent(fromVersion, toVersion string, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeNormal
+	event.Reason = "Auto Upgrade"
+	event.Message = fmt.Sprintf("Version is auto upgraded from %s to %s", fromVersion, toVersion)
+	return event
+}
+
+// SelfHostedMigrationEvent is created when the operator starts or completes
+// replacing the self-hosted members by regular members.
+func SelfHostedMigrationEvent(completed bool, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeNormal
+	if completed {
+		event.Reason = "Self Hosted Migration Completed"
+		event.Message = "All self-hosted members were replaced by regular members"
+	} else {
+		event.Reason = "Self Hosted Migration Started"
+		event.Message = "Self-hosted members are replaced by regular members one at a time"
+	}
+	return event
+}
+
+// OOMAutoAdjustedEvent is created when the operator raises the memory limit of
+// the pod policy after an etcd container was OOM killed.
+func OOMAutoAdjustedEvent(podName, fromLimit, toLimit string, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeWarning
+	event.Reason = "OOM Auto Adjusted"
+	event.Message = fmt.Sprintf("Pod %s was OOM killed, memory limit is raised from %s to %s", podName, fromLimit, toLimit)
+	return event
+}
+
 func ReplacingDeadMemberEvent(memberName string, cl *api.EtcdCluster) *v1.Event {
 	event := newClusterEvent(cl)
 	event.Type = v1.EventTypeNormal
@@ -58,6 +109,98 @@ func MemberUpgradedEvent(memberName, oldVersion, newVersion string, cl *api.Etcd
 	return event
 }
 
+func DiskUsageWarningEvent(memberName string, percent float64, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeWarning
+	event.Reason = "High Disk Usage"
+	event.Message = fmt.Sprintf("Member %s uses %.1f%% of its backend quota", memberName, percent)
+	return event
+}
+
+func WaitingForQuorumEvent(waited time.Duration, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeNormal
+	event.Reason = "Waiting For Quorum"
+	event.Message = fmt.Sprintf("Waiting for the seed member to serve requests for %v", waited)
+	return event
+}
+
+func PreBackupHookFailedEvent(eb *api.EtcdBackup, err error) *v1.Event {
+	t := time.Now()
+	return &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: eb.Name + "-",
+			Namespace:    eb.Namespace,
+		},
+		InvolvedObject: v1.ObjectReference{
+			APIVersion:      api.SchemeGroupVersion.String(),
+			Kind:            api.EtcdBackupResourceKind,
+			Name:            eb.Name,
+			Namespace:       eb.Namespace,
+			UID:             eb.UID,
+			ResourceVersion: eb.ResourceVersion,
+		},
+		Source: v1.EventSource{
+			Component: os.Getenv(constants.EnvOperatorPodName),
+		},
+		Type:           v1.EventTypeWarning,
+		Reason:         "PreBackupHookFailed",
+		Message:        fmt.Sprintf("Backup skipped: %v", err),
+		FirstTimestamp: metav1.Time{Time: t},
+		LastTimestamp:  metav1.Time{Time: t},
+		Count:          int32(1),
+	}
+}
+
+func InvalidSizeRejectedEvent(size, keptSize int, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeWarning
+	event.Reason = "Invalid Size Rejected"
+	event.Message = fmt.Sprintf("Size %d is rejected: the size must be odd and at least 1. Keeping size %d", size, keptSize)
+	return event
+}
+
+func ClusterCorruptEvent(memberIDs string, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeWarning
+	event.Reason = "Data Corruption"
+	event.Message = fmt.Sprintf("etcd raised a corruption alarm for members %s; the cluster needs manual repair", memberIDs)
+	return event
+}
+
+func MemberTLSRotatedEvent(secretName string, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeNormal
+	event.Reason = "Member TLS Rotated"
+	event.Message = fmt.Sprintf("TLS certificate in secret %s was renewed", secretName)
+	return event
+}
+
+// SpotInterruptionEvent is created when a member is replaced because its spot
+// node is about to be interrupted.
+func SpotInterruptionEvent(memberName, nodeName string, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeNormal
+	event.Reason = "Spot Interruption"
+	event.Message = fmt.Sprintf("Member %s is replaced since its node %s is about to be interrupted", memberName, nodeName)
+	return event
+}
+
+// PeerCertRotationEvent is created when the operator starts or completes
+// rotating the peer certificates of the members to secret se.
+func PeerCertRotationEvent(se string, completed bool, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeNormal
+	if completed {
+		event.Reason = "Peer Cert Rotation Completed"
+		event.Message = fmt.Sprintf("All members use the peer certificates in secret %s", se)
+	} else {
+		event.Reason = "Peer Cert Rotation Started"
+		event.Message = fmt.Sprintf("Members are replaced one at a time to use the peer certificates in secret %s", se)
+	}
+	return event
+}
+
 func newClusterEvent(cl *api.EtcdCluster) *v1.Event {
 	t := time.Now()
 	return &v1.Event{
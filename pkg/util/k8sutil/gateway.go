@@ -0,0 +1,171 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sutil
+
+import (
+	"fmt"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+
+	appsv1beta1 "k8s.io/api/apps/v1beta1"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+// etcdGatewayPort is the port the etcd gateway listens on in its pods.
+const etcdGatewayPort = 23790
+
+// GatewayName returns the name of the deployment and service of the etcd gateway.
+func GatewayName(clusterName string) string {
+	return clusterName + "-gateway"
+}
+
+// gatewayLabels are the labels of the etcd gateway pods. They differ from the
+// labels of the etcd pods so that the gateway pods are not taken as members.
+func gatewayLabels(clusterName string) map[string]string {
+	return map[string]string{
+		"app":          "etcd-gateway",
+		"etcd_cluster": clusterName,
+	}
+}
+
+// GatewayReplicas returns the number of etcd gateway pods of the spec.
+func GatewayReplicas(cs api.ClusterSpec) int {
+	if cs.GatewayReplicas < 1 {
+		return 1
+	}
+	return cs.GatewayReplicas
+}
+
+// CreateGateway creates the deployment of etcd gateway pods, which proxy the
+// client traffic to the members published by the peer service, and the service
+// in front of them on the etcd client port.
+func CreateGateway(kubecli kubernetes.Interface, clusterName, ns string, cs api.ClusterSpec, owner metav1.OwnerReference) error {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   GatewayName(clusterName),
+			Labels: LabelsForCluster(clusterName),
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{{
+				Name:       "client",
+				Port:       EtcdClientPort,
+				TargetPort: intstr.FromInt(etcdGatewayPort),
+				Protocol:   v1.ProtocolTCP,
+			}},
+			Selector: gatewayLabels(clusterName),
+		},
+	}
+	addOwnerRefToObject(svc.GetObjectMeta(), owner)
+	_, err := kubecli.CoreV1().Services(ns).Create(svc)
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create gateway service: %v", err)
+	}
+
+	d := newGatewayDeployment(clusterName, ns, cs)
+	addOwnerRefToObject(d.GetObjectMeta(), owner)
+	_, err = kubecli.AppsV1beta1().Deployments(ns).Create(d)
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create gateway deployment: %v", err)
+	}
+	return nil
+}
+
+// gatewayPullPolicy returns the image pull policy of the etcd gateway pods.
+func gatewayPullPolicy(cs api.ClusterSpec) v1.PullPolicy {
+	if len(cs.ImagePullPolicy) == 0 {
+		return v1.PullIfNotPresent
+	}
+	return cs.ImagePullPolicy
+}
+
+func newGatewayDeployment(clusterName, ns string, cs api.ClusterSpec) *appsv1beta1.Deployment {
+	// The peer service resolves to the pods of all members.
+	endpoint := fmt.Sprintf("%s.%s.svc:%d", clusterName, ns, EtcdClientPort)
+	replicas := int32(GatewayReplicas(cs))
+	labels := gatewayLabels(clusterName)
+	return &appsv1beta1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   GatewayName(clusterName),
+			Labels: labels,
+		},
+		Spec: appsv1beta1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{{
+						Name:            "etcd-gateway",
+						Image:           ImageName(cs.Repository, cs.Version),
+						ImagePullPolicy: gatewayPullPolicy(cs),
+						Command: []string{
+							"/usr/local/bin/etcd", "gateway", "start",
+							"--endpoints=" + endpoint,
+							fmt.Sprintf("--listen-addr=0.0.0.0:%d", etcdGatewayPort),
+						},
+						Ports: []v1.ContainerPort{{
+							Name:          "client",
+							ContainerPort: etcdGatewayPort,
+							Protocol:      v1.ProtocolTCP,
+						}},
+						ReadinessProbe: &v1.Probe{
+							Handler: v1.Handler{
+								TCPSocket: &v1.TCPSocketAction{Port: intstr.FromInt(etcdGatewayPort)},
+							},
+							PeriodSeconds: 5,
+						},
+					}},
+				},
+			},
+		},
+	}
+}
+
+// UpdateGateway sets the number of etcd gateway pods and their image to the ones of the spec.
+func UpdateGateway(kubecli kubernetes.Interface, clusterName, ns string, cs api.ClusterSpec) error {
+	return PatchDeployment(kubecli, ns, GatewayName(clusterName), func(d *appsv1beta1.Deployment) {
+		updateGatewayDeployment(d, cs)
+	})
+}
+
+func updateGatewayDeployment(d *appsv1beta1.Deployment, cs api.ClusterSpec) {
+	r := int32(GatewayReplicas(cs))
+	d.Spec.Replicas = &r
+	for i := range d.Spec.Template.Spec.Containers {
+		c := &d.Spec.Template.Spec.Containers[i]
+		if c.Name == "etcd-gateway" {
+			c.Image = ImageName(cs.Repository, cs.Version)
+			c.ImagePullPolicy = gatewayPullPolicy(cs)
+		}
+	}
+}
+
+// DeleteGateway deletes the deployment, the pods and the service of the etcd gateway.
+func DeleteGateway(kubecli kubernetes.Interface, clusterName, ns string) error {
+	background := metav1.DeletePropagationBackground
+	err := kubecli.AppsV1beta1().Deployments(ns).Delete(GatewayName(clusterName), &metav1.DeleteOptions{PropagationPolicy: &background})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete gateway deployment: %v", err)
+	}
+	err = kubecli.CoreV1().Services(ns).Delete(GatewayName(clusterName), nil)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete gateway service: %v", err)
+	}
+	return nil
+}
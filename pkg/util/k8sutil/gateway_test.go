@@ -0,0 +1,89 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sutil
+
+import (
+	"reflect"
+	"testing"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCreateGateway(t *testing.T) {
+	kubecli := fake.NewSimpleClientset()
+	cs := api.ClusterSpec{Size: 3, Repository: "quay.io/coreos/etcd", Version: "3.2.13", GatewayEnabled: true, GatewayReplicas: 2}
+	if err := CreateGateway(kubecli, "example", "default", cs, metav1.OwnerReference{}); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := kubecli.AppsV1beta1().Deployments("default").Get("example-gateway", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *d.Spec.Replicas != 2 {
+		t.Errorf("replicas = %d, want 2", *d.Spec.Replicas)
+	}
+	// gateway pods must not be taken as members
+	if labels.SelectorFromSet(LabelsForCluster("example")).Matches(labels.Set(d.Spec.Template.Labels)) {
+		t.Errorf("gateway pod labels %v match the etcd pod labels", d.Spec.Template.Labels)
+	}
+
+	svc, err := kubecli.CoreV1().Services("default").Get("example-gateway", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(svc.Spec.Selector, d.Spec.Template.Labels) {
+		t.Errorf("service selector = %v, want %v", svc.Spec.Selector, d.Spec.Template.Labels)
+	}
+
+	// creating it again is a no-op
+	if err := CreateGateway(kubecli, "example", "default", cs, metav1.OwnerReference{}); err != nil {
+		t.Errorf("create existing gateway: %v", err)
+	}
+
+	if err := DeleteGateway(kubecli, "example", "default"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kubecli.AppsV1beta1().Deployments("default").Get("example-gateway", metav1.GetOptions{}); !IsKubernetesResourceNotFoundError(err) {
+		t.Errorf("gateway deployment not deleted: %v", err)
+	}
+	if err := DeleteGateway(kubecli, "example", "default"); err != nil {
+		t.Errorf("delete missing gateway: %v", err)
+	}
+}
+
+func TestUpdateGatewayDeployment(t *testing.T) {
+	cs := api.ClusterSpec{Size: 3, Repository: "quay.io/coreos/etcd", Version: "3.2.13", GatewayEnabled: true}
+	d := newGatewayDeployment("example", "default", cs)
+
+	cs.Version = "3.3.1"
+	cs.GatewayReplicas = 3
+	cs.ImagePullPolicy = "Always"
+	updateGatewayDeployment(d, cs)
+	if *d.Spec.Replicas != 3 {
+		t.Errorf("replicas = %d, want 3", *d.Spec.Replicas)
+	}
+	c := d.Spec.Template.Spec.Containers[0]
+	if want := ImageName(cs.Repository, cs.Version); c.Image != want {
+		t.Errorf("image = %s, want %s", c.Image, want)
+	}
+	if c.ImagePullPolicy != "Always" {
+		t.Errorf("image pull policy = %s, want Always", c.ImagePullPolicy)
+	}
+}
@@ -17,9 +17,12 @@ package k8sutil
 import (
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"net"
 	"net/url"
 	"os"
+	"reflect"
+	"strconv"
 	"strings"
 	"time"
 
@@ -32,6 +35,7 @@ import (
 	"k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
@@ -44,11 +48,14 @@ import (
 const (
 	// EtcdClientPort is the client port on client service and etcd nodes.
 	EtcdClientPort = 2379
+	// EtcdMetricsPort is the metrics port on metrics service and etcd nodes.
+	EtcdMetricsPort = 2381
 
 	etcdVolumeMountDir       = "/var/etcd"
 	dataDir                  = etcdVolumeMountDir + "/data"
 	backupFile               = "/var/etcd/latest.backup"
 	etcdVersionAnnotationKey = "etcd.version"
+	specHashAnnotationKey    = "etcd.coreos.com/spec-hash"
 	peerTLSDir               = "/etc/etcdtls/member/peer-tls"
 	peerTLSVolume            = "member-peer-tls"
 	serverTLSDir             = "/etc/etcdtls/member/server-tls"
@@ -57,6 +64,11 @@ const (
 	operatorEtcdTLSVolume    = "etcd-client-tls"
 )
 
+const (
+	podPollInitialInterval = 1 * time.Second
+	podPollMaxInterval     = 10 * time.Second
+)
+
 const TolerateUnreadyEndpointsAnnotation = "service.alpha.kubernetes.io/tolerate-unready-endpoints"
 
 func GetEtcdVersion(pod *v1.Pod) string {
@@ -67,6 +79,72 @@ func SetEtcdVersion(pod *v1.Pod, version string) {
 	pod.Annotations[etcdVersionAnnotationKey] = version
 }
 
+// podTemplateInputs are the parts of the cluster spec that the etcd pods are
+// created from. Fields only the operator reads, e.g. the defragmentation or
+// maintenance window settings, are left out so that changing them does not
+// replace the pods.
+type podTemplateInputs struct {
+	Repository                string         `json:"repository,omitempty"`
+	ImagePullPolicy           v1.PullPolicy  `json:"imagePullPolicy,omitempty"`
+	Pod                       *api.PodPolicy `json:"pod,omitempty"`
+	TLS                       *api.TLSPolicy `json:"TLS,omitempty"`
+	ExposeMetricsService      bool           `json:"exposeMetricsService,omitempty"`
+	HealthCheckTimeoutSeconds int            `json:"healthCheckTimeoutSeconds,omitempty"`
+	AuthEnabled               bool           `json:"authEnabled,omitempty"`
+}
+
+// SpecHash returns the hash of the parts of the cluster spec that the etcd pods
+// are created from. Size, Paused and Version are left out since changing them
+// does not require replacing the existing pods. So are the pod annotations,
+// which the members are replaced for separately, and the memory limit if the
+// operator raises it after OOM kills.
+func SpecHash(cs api.ClusterSpec) string {
+	in := podTemplateInputs{
+		Repository:                cs.Repository,
+		ImagePullPolicy:           cs.ImagePullPolicy,
+		Pod:                       podPolicyTemplateInputs(cs.Pod),
+		TLS:                       cs.TLS,
+		ExposeMetricsService:      cs.ExposeMetricsService,
+		HealthCheckTimeoutSeconds: cs.HealthCheckTimeoutSeconds,
+		AuthEnabled:               cs.Auth.IsEnabled(),
+	}
+	b, err := json.Marshal(in)
+	if err != nil {
+		panic("failed to marshal cluster spec: " + err.Error())
+	}
+	h := fnv.New32a()
+	h.Write(b)
+	return strconv.FormatUint(uint64(h.Sum32()), 16)
+}
+
+// podPolicyTemplateInputs returns a copy of policy without the fields that do
+// not require replacing the pods, or nil if no other field is set.
+func podPolicyTemplateInputs(policy *api.PodPolicy) *api.PodPolicy {
+	if policy == nil {
+		return nil
+	}
+	p := policy.DeepCopy()
+	p.Annotations = nil
+	if p.AutoAdjustMemory {
+		delete(p.Resources.Limits, v1.ResourceMemory)
+		if len(p.Resources.Limits) == 0 {
+			p.Resources.Limits = nil
+		}
+	}
+	p.AutoAdjustMemory = false
+	p.AutoAdjustMemoryMax = nil
+	if reflect.DeepEqual(p, &api.PodPolicy{}) {
+		return nil
+	}
+	return p
+}
+
+// GetSpecHash returns the spec hash the pod was created with.
+// It is empty for pods created by older operators.
+func GetSpecHash(pod *v1.Pod) string {
+	return pod.Annotations[specHashAnnotationKey]
+}
+
 func GetPodNames(pods []*v1.Pod) []string {
 	if len(pods) == 0 {
 		return nil
@@ -115,21 +193,79 @@ func PodWithNodeSelector(p *v1.Pod, ns map[string]string) *v1.Pod {
 	return p
 }
 
-func CreateClientService(kubecli kubernetes.Interface, clusterName, ns string, owner metav1.OwnerReference) error {
+func CreateClientService(kubecli kubernetes.Interface, clusterName, ns string, serviceType v1.ServiceType, owner metav1.OwnerReference) error {
 	ports := []v1.ServicePort{{
 		Name:       "client",
 		Port:       EtcdClientPort,
 		TargetPort: intstr.FromInt(EtcdClientPort),
 		Protocol:   v1.ProtocolTCP,
 	}}
-	return createService(kubecli, ClientServiceName(clusterName), clusterName, ns, "", ports, owner)
+	return createService(kubecli, ClientServiceName(clusterName), clusterName, ns, "", clientServiceType(serviceType), ports, owner)
+}
+
+// UpdateClientServiceType changes the type of the client service in place.
+// The allocated node ports are released when switching back to ClusterIP.
+func UpdateClientServiceType(kubecli kubernetes.Interface, clusterName, ns string, serviceType v1.ServiceType) error {
+	svc, err := kubecli.CoreV1().Services(ns).Get(ClientServiceName(clusterName), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	want := clientServiceType(serviceType)
+	if svc.Spec.Type == want {
+		return nil
+	}
+	svc.Spec.Type = want
+	if want == v1.ServiceTypeClusterIP {
+		for i := range svc.Spec.Ports {
+			svc.Spec.Ports[i].NodePort = 0
+		}
+	}
+	_, err = kubecli.CoreV1().Services(ns).Update(svc)
+	return err
+}
+
+func clientServiceType(serviceType v1.ServiceType) v1.ServiceType {
+	if len(serviceType) == 0 {
+		return v1.ServiceTypeClusterIP
+	}
+	return serviceType
 }
 
 func ClientServiceName(clusterName string) string {
 	return clusterName + "-client"
 }
 
+// CreatePeerService creates the headless peer service of the etcd cluster.
+// Members use the DNS names published by this service in their peer URLs,
+// see etcdutil.Member.PeerURL.
 func CreatePeerService(kubecli kubernetes.Interface, clusterName, ns string, owner metav1.OwnerReference) error {
+	svc := newPeerServiceManifest(clusterName)
+	addOwnerRefToObject(svc.GetObjectMeta(), owner)
+	_, err := kubecli.CoreV1().Services(ns).Create(svc)
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// UpdatePeerService resets the selector of the peer service to the labels of the
+// etcd cluster pods if it was changed, so that the service publishes the DNS
+// names of all members.
+func UpdatePeerService(kubecli kubernetes.Interface, clusterName, ns string) error {
+	svc, err := kubecli.CoreV1().Services(ns).Get(clusterName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	want := newPeerServiceManifest(clusterName).Spec.Selector
+	if reflect.DeepEqual(svc.Spec.Selector, want) {
+		return nil
+	}
+	svc.Spec.Selector = want
+	_, err = kubecli.CoreV1().Services(ns).Update(svc)
+	return err
+}
+
+func newPeerServiceManifest(clusterName string) *v1.Service {
 	ports := []v1.ServicePort{{
 		Name:       "client",
 		Port:       EtcdClientPort,
@@ -141,12 +277,36 @@ func CreatePeerService(kubecli kubernetes.Interface, clusterName, ns string, own
 		TargetPort: intstr.FromInt(2380),
 		Protocol:   v1.ProtocolTCP,
 	}}
+	return newEtcdServiceManifest(clusterName, clusterName, v1.ClusterIPNone, ports)
+}
+
+// CreateMetricsService creates the service exposing the metrics port of the etcd pods.
+// It is annotated to be discovered by Prometheus.
+func CreateMetricsService(kubecli kubernetes.Interface, clusterName, ns string, owner metav1.OwnerReference) error {
+	ports := []v1.ServicePort{{
+		Name:       "metrics",
+		Port:       EtcdMetricsPort,
+		TargetPort: intstr.FromInt(EtcdMetricsPort),
+		Protocol:   v1.ProtocolTCP,
+	}}
+	svc := newEtcdServiceManifest(MetricsServiceName(clusterName), clusterName, "", ports)
+	svc.Annotations["prometheus.io/scrape"] = "true"
+	svc.Annotations["prometheus.io/port"] = strconv.Itoa(EtcdMetricsPort)
+	addOwnerRefToObject(svc.GetObjectMeta(), owner)
+	_, err := kubecli.CoreV1().Services(ns).Create(svc)
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
 
-	return createService(kubecli, clusterName, clusterName, ns, v1.ClusterIPNone, ports, owner)
+func MetricsServiceName(clusterName string) string {
+	return clusterName + "-metrics"
 }
 
-func createService(kubecli kubernetes.Interface, svcName, clusterName, ns, clusterIP string, ports []v1.ServicePort, owner metav1.OwnerReference) error {
+func createService(kubecli kubernetes.Interface, svcName, clusterName, ns, clusterIP string, serviceType v1.ServiceType, ports []v1.ServicePort, owner metav1.OwnerReference) error {
 	svc := newEtcdServiceManifest(svcName, clusterName, clusterIP, ports)
+	svc.Spec.Type = serviceType
 	addOwnerRefToObject(svc.GetObjectMeta(), owner)
 	_, err := kubecli.CoreV1().Services(ns).Create(svc)
 	if err != nil && !apierrors.IsAlreadyExists(err) {
@@ -163,23 +323,7 @@ func CreateAndWaitPod(kubecli kubernetes.Interface, ns string, pod *v1.Pod, time
 		return nil, err
 	}
 
-	interval := 5 * time.Second
-	var retPod *v1.Pod
-	err = retryutil.Retry(interval, int(timeout/(interval)), func() (bool, error) {
-		retPod, err = kubecli.CoreV1().Pods(ns).Get(pod.Name, metav1.GetOptions{})
-		if err != nil {
-			return false, err
-		}
-		switch retPod.Status.Phase {
-		case v1.PodRunning:
-			return true, nil
-		case v1.PodPending:
-			return false, nil
-		default:
-			return false, fmt.Errorf("unexpected pod status.phase: %v", retPod.Status.Phase)
-		}
-	})
-
+	err = WaitForPodRunning(kubecli, ns, pod.Name, timeout)
 	if err != nil {
 		if retryutil.IsRetryFailure(err) {
 			return nil, fmt.Errorf("failed to wait pod running, it is still pending: %v", err)
@@ -187,7 +331,43 @@ func CreateAndWaitPod(kubecli kubernetes.Interface, ns string, pod *v1.Pod, time
 		return nil, fmt.Errorf("failed to wait pod running: %v", err)
 	}
 
-	return retPod, nil
+	return kubecli.CoreV1().Pods(ns).Get(pod.Name, metav1.GetOptions{})
+}
+
+// PodTerminatedError is returned by WaitForPodRunning when the pod reaches
+// a terminal phase (Failed or Succeeded) instead of Running.
+type PodTerminatedError struct {
+	Name  string
+	Phase v1.PodPhase
+}
+
+func (e *PodTerminatedError) Error() string {
+	return fmt.Sprintf("pod (%s) reached phase %v instead of %v", e.Name, e.Phase, v1.PodRunning)
+}
+
+func IsPodTerminatedError(err error) bool {
+	_, ok := err.(*PodTerminatedError)
+	return ok
+}
+
+// WaitForPodRunning waits until the given pod is running.
+// The pod is polled with exponential back-off, starting at 1s and capped at 10s.
+// It returns a retryutil.RetryError if the pod is still not running after timeout,
+// and a *PodTerminatedError if the pod has failed or succeeded.
+func WaitForPodRunning(kubecli kubernetes.Interface, ns, name string, timeout time.Duration) error {
+	return retryutil.RetryWithBackoff(podPollInitialInterval, podPollMaxInterval, timeout, func() (bool, error) {
+		pod, err := kubecli.CoreV1().Pods(ns).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		switch pod.Status.Phase {
+		case v1.PodRunning:
+			return true, nil
+		case v1.PodFailed, v1.PodSucceeded:
+			return false, &PodTerminatedError{Name: name, Phase: pod.Status.Phase}
+		}
+		return false, nil
+	})
 }
 
 func newEtcdServiceManifest(svcName, clusterName, clusterIP string, ports []v1.ServicePort) *v1.Service {
@@ -239,6 +419,12 @@ func NewEtcdPod(m *etcdutil.Member, initialCluster []string, clusterName, state,
 	if m.SecureClient {
 		commands += fmt.Sprintf(" --client-cert-auth=true --trusted-ca-file=%[1]s/server-ca.crt --cert-file=%[1]s/server.crt --key-file=%[1]s/server.key", serverTLSDir)
 	}
+	if cs.ExposeMetricsService {
+		commands += fmt.Sprintf(" --listen-metrics-urls=http://0.0.0.0:%d", EtcdMetricsPort)
+	}
+	if cs.Pod != nil {
+		commands += etcdLogFlags(cs.Pod)
+	}
 	if state == "new" {
 		commands = fmt.Sprintf("%s --initial-cluster-token=%s", commands, token)
 	}
@@ -249,17 +435,34 @@ func NewEtcdPod(m *etcdutil.Member, initialCluster []string, clusterName, state,
 		"etcd_cluster": clusterName,
 	}
 
-	livenessProbe := newEtcdProbe(cs.TLS.IsSecureClient())
-	readinessProbe := newEtcdProbe(cs.TLS.IsSecureClient())
+	livenessProbe := newEtcdProbe(cs.TLS.IsSecureClient(), cs.Auth.IsEnabled())
+	readinessProbe := newEtcdProbe(cs.TLS.IsSecureClient(), cs.Auth.IsEnabled())
 	readinessProbe.InitialDelaySeconds = 1
 	readinessProbe.TimeoutSeconds = 5
 	readinessProbe.PeriodSeconds = 5
 	readinessProbe.FailureThreshold = 3
+	if cs.HealthCheckTimeoutSeconds > 0 {
+		livenessProbe.TimeoutSeconds = int32(cs.HealthCheckTimeoutSeconds)
+		readinessProbe.TimeoutSeconds = int32(cs.HealthCheckTimeoutSeconds)
+	}
+	if cs.Pod != nil && cs.Pod.LivenessProbe != nil {
+		livenessProbe = cs.Pod.LivenessProbe.DeepCopy()
+	}
+	if cs.Pod != nil && cs.Pod.ReadinessProbe != nil {
+		readinessProbe = cs.Pod.ReadinessProbe.DeepCopy()
+	}
 
 	container := containerWithProbes(
-		etcdContainer(strings.Split(commands, " "), cs.Repository, cs.Version),
+		etcdContainer(strings.Split(commands, " "), cs.Repository, cs.Version, cs.ImagePullPolicy),
 		livenessProbe,
 		readinessProbe)
+	if cs.ExposeMetricsService {
+		container.Ports = append(container.Ports, v1.ContainerPort{
+			Name:          "metrics",
+			ContainerPort: int32(EtcdMetricsPort),
+			Protocol:      v1.ProtocolTCP,
+		})
+	}
 
 	if cs.Pod != nil {
 		container = containerWithRequirements(container, cs.Pod.Resources)
@@ -274,9 +477,10 @@ func NewEtcdPod(m *etcdutil.Member, initialCluster []string, clusterName, state,
 			MountPath: peerTLSDir,
 			Name:      peerTLSVolume,
 		})
-		volumes = append(volumes, v1.Volume{Name: peerTLSVolume, VolumeSource: v1.VolumeSource{
-			Secret: &v1.SecretVolumeSource{SecretName: cs.TLS.Static.Member.PeerSecret},
-		}})
+		volumes = append(volumes, v1.Volume{
+			Name:         peerTLSVolume,
+			VolumeSource: tlsSecretVolumeSource(cs.TLS, cs.TLS.PeerSecret(clusterName), "peer"),
+		})
 	}
 	if m.SecureClient {
 		container.VolumeMounts = append(container.VolumeMounts, v1.VolumeMount{
@@ -286,11 +490,22 @@ func NewEtcdPod(m *etcdutil.Member, initialCluster []string, clusterName, state,
 			MountPath: operatorEtcdTLSDir,
 			Name:      operatorEtcdTLSVolume,
 		})
-		volumes = append(volumes, v1.Volume{Name: serverTLSVolume, VolumeSource: v1.VolumeSource{
-			Secret: &v1.SecretVolumeSource{SecretName: cs.TLS.Static.Member.ServerSecret},
-		}}, v1.Volume{Name: operatorEtcdTLSVolume, VolumeSource: v1.VolumeSource{
-			Secret: &v1.SecretVolumeSource{SecretName: cs.TLS.Static.OperatorSecret},
-		}})
+		volumes = append(volumes, v1.Volume{
+			Name:         serverTLSVolume,
+			VolumeSource: tlsSecretVolumeSource(cs.TLS, cs.TLS.ServerSecret(clusterName), "server"),
+		}, v1.Volume{
+			Name:         operatorEtcdTLSVolume,
+			VolumeSource: tlsSecretVolumeSource(cs.TLS, cs.TLS.OperatorSecret(clusterName), "etcd-client"),
+		})
+	}
+
+	if cs.Pod != nil {
+		volumes = append(volumes, cs.Pod.AdditionalVolumes...)
+		container.VolumeMounts = append(container.VolumeMounts, cs.Pod.AdditionalVolumeMounts...)
+
+		logVolumes, logMounts := etcdLogVolumes(cs.Pod.EtcdLogOutputs)
+		volumes = append(volumes, logVolumes...)
+		container.VolumeMounts = append(container.VolumeMounts, logMounts...)
 	}
 
 	pod := &v1.Pod{
@@ -323,9 +538,14 @@ func NewEtcdPod(m *etcdutil.Member, initialCluster []string, clusterName, state,
 		},
 	}
 
+	if cs.Pod != nil && cs.Pod.PodTemplateSpec != nil {
+		pod = NewEtcdPodFromTemplate(cs.Pod.PodTemplateSpec, pod)
+	}
+
 	applyPodPolicy(clusterName, pod, cs.Pod)
 
 	SetEtcdVersion(pod, cs.Version)
+	pod.Annotations[specHashAnnotationKey] = SpecHash(cs)
 
 	addOwnerRefToObject(pod.GetObjectMeta(), owner)
 	return pod
@@ -364,10 +584,57 @@ func IsKubernetesResourceNotFoundError(err error) bool {
 }
 
 // We are using internal api types for cluster related.
-func ClusterListOpt(clusterName string) metav1.ListOptions {
-	return metav1.ListOptions{
+// DeleteClusterResources deletes the pods, services, persistent volume claims
+// and etcd gateway of the etcd cluster.
+func DeleteClusterResources(kubecli kubernetes.Interface, clusterName, ns string) error {
+	err := kubecli.CoreV1().Pods(ns).DeleteCollection(metav1.NewDeleteOptions(0), ClusterListOpt(clusterName))
+	if err != nil && !IsKubernetesResourceNotFoundError(err) {
+		return fmt.Errorf("failed to delete cluster pods: %v", err)
+	}
+
+	if err := DeleteGateway(kubecli, clusterName, ns); err != nil {
+		return err
+	}
+
+	// Services don't support DeleteCollection.
+	svcs, err := kubecli.CoreV1().Services(ns).List(ClusterListOpt(clusterName))
+	if err != nil {
+		return fmt.Errorf("failed to list cluster services: %v", err)
+	}
+	for _, svc := range svcs.Items {
+		err = kubecli.CoreV1().Services(ns).Delete(svc.Name, nil)
+		if err != nil && !IsKubernetesResourceNotFoundError(err) {
+			return fmt.Errorf("failed to delete cluster service (%s): %v", svc.Name, err)
+		}
+	}
+
+	err = kubecli.CoreV1().PersistentVolumeClaims(ns).DeleteCollection(metav1.NewDeleteOptions(0), ClusterListOpt(clusterName))
+	if err != nil && !IsKubernetesResourceNotFoundError(err) {
+		return fmt.Errorf("failed to delete cluster persistent volume claims: %v", err)
+	}
+	return nil
+}
+
+// ListOption modifies the list options returned by ClusterListOpt.
+type ListOption func(*metav1.ListOptions)
+
+// WithFieldSelector restricts the listed pods to the ones on the given node,
+// which the API server filters by field without a label lookup.
+func WithFieldSelector(nodeName string) ListOption {
+	return func(o *metav1.ListOptions) {
+		o.FieldSelector = fields.OneTermEqualSelector("spec.nodeName", nodeName).String()
+	}
+}
+
+// ClusterListOpt returns the list options selecting the resources of the cluster.
+func ClusterListOpt(clusterName string, opts ...ListOption) metav1.ListOptions {
+	o := metav1.ListOptions{
 		LabelSelector: labels.SelectorFromSet(LabelsForCluster(clusterName)).String(),
 	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
 }
 
 func LabelsForCluster(clusterName string) map[string]string {
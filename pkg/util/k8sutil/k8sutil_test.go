@@ -0,0 +1,105 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sutil
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coreos/etcd-operator/pkg/util/retryutil"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestClusterListOpt(t *testing.T) {
+	tests := []struct {
+		opts              []ListOption
+		wantFieldSelector string
+	}{
+		{nil, ""},
+		{[]ListOption{WithFieldSelector("node-1")}, "spec.nodeName=node-1"},
+	}
+	for i, tt := range tests {
+		o := ClusterListOpt("example", tt.opts...)
+		if o.LabelSelector != "app=etcd,etcd_cluster=example" {
+			t.Errorf("#%d: label selector = %q, want %q", i, o.LabelSelector, "app=etcd,etcd_cluster=example")
+		}
+		if o.FieldSelector != tt.wantFieldSelector {
+			t.Errorf("#%d: field selector = %q, want %q", i, o.FieldSelector, tt.wantFieldSelector)
+		}
+	}
+}
+
+func TestWaitForPodRunning(t *testing.T) {
+	tests := []struct {
+		phase   v1.PodPhase
+		missing bool
+		check   func(error) bool
+	}{
+		{phase: v1.PodRunning, check: func(err error) bool { return err == nil }},
+		{phase: v1.PodFailed, check: IsPodTerminatedError},
+		{phase: v1.PodSucceeded, check: IsPodTerminatedError},
+		// the timeout is shorter than the first poll interval
+		{phase: v1.PodPending, check: retryutil.IsRetryFailure},
+		{missing: true, check: IsKubernetesResourceNotFoundError},
+	}
+	for i, tt := range tests {
+		kubecli := fake.NewSimpleClientset()
+		if !tt.missing {
+			pod := &v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "example-0000", Namespace: "default"},
+				Status:     v1.PodStatus{Phase: tt.phase},
+			}
+			if _, err := kubecli.CoreV1().Pods("default").Create(pod); err != nil {
+				t.Fatal(err)
+			}
+		}
+		err := WaitForPodRunning(kubecli, "default", "example-0000", 0)
+		if !tt.check(err) {
+			t.Errorf("#%d: unexpected error %v for phase %q", i, err, tt.phase)
+		}
+	}
+}
+
+func TestCreateMetricsService(t *testing.T) {
+	kubecli := fake.NewSimpleClientset()
+	owner := metav1.OwnerReference{APIVersion: "etcd.database.coreos.com/v1beta2", Kind: "EtcdCluster", Name: "example", UID: "1234"}
+	if err := CreateMetricsService(kubecli, "example", "default", owner); err != nil {
+		t.Fatal(err)
+	}
+	// the service already exists
+	if err := CreateMetricsService(kubecli, "example", "default", owner); err != nil {
+		t.Fatal(err)
+	}
+
+	svc, err := kubecli.CoreV1().Services("default").Get(MetricsServiceName("example"), metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(svc.Spec.Ports) != 1 || svc.Spec.Ports[0].Port != 2381 || svc.Spec.Ports[0].TargetPort.IntValue() != 2381 {
+		t.Errorf("ports = %v, want the metrics port 2381", svc.Spec.Ports)
+	}
+	if svc.Annotations["prometheus.io/scrape"] != "true" {
+		t.Errorf("prometheus.io/scrape annotation = %q, want %q", svc.Annotations["prometheus.io/scrape"], "true")
+	}
+	if want := LabelsForCluster("example"); !reflect.DeepEqual(svc.Spec.Selector, want) {
+		t.Errorf("selector = %v, want %v", svc.Spec.Selector, want)
+	}
+	if want := []metav1.OwnerReference{owner}; !reflect.DeepEqual(svc.OwnerReferences, want) {
+		t.Errorf("owner references = %v, want %v", svc.OwnerReferences, want)
+	}
+}
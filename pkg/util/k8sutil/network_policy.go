@@ -0,0 +1,74 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sutil
+
+import (
+	"k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+// NetworkPolicyName returns the name of the NetworkPolicy of the etcd cluster.
+func NetworkPolicyName(clusterName string) string {
+	return clusterName + "-network-policy"
+}
+
+// CreateNetworkPolicy creates a NetworkPolicy for the etcd pods that only accepts
+// peer traffic from the members of the cluster. The client port, and the metrics
+// port if exposeMetrics is set, stay open to any pod, e.g. the etcd operator and
+// the etcd clients.
+func CreateNetworkPolicy(kubecli kubernetes.Interface, clusterName, ns string, exposeMetrics bool, owner metav1.OwnerReference) error {
+	np := newNetworkPolicyManifest(clusterName, exposeMetrics)
+	addOwnerRefToObject(np.GetObjectMeta(), owner)
+	_, err := kubecli.NetworkingV1().NetworkPolicies(ns).Create(np)
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+func newNetworkPolicyManifest(clusterName string, exposeMetrics bool) *networkingv1.NetworkPolicy {
+	openPorts := []networkingv1.NetworkPolicyPort{networkPolicyPort(EtcdClientPort)}
+	if exposeMetrics {
+		openPorts = append(openPorts, networkPolicyPort(EtcdMetricsPort))
+	}
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   NetworkPolicyName(clusterName),
+			Labels: LabelsForCluster(clusterName),
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: LabelsForCluster(clusterName)},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{{
+				Ports: []networkingv1.NetworkPolicyPort{networkPolicyPort(EtcdClientPort), networkPolicyPort(2380)},
+				From: []networkingv1.NetworkPolicyPeer{{
+					PodSelector: &metav1.LabelSelector{MatchLabels: LabelsForCluster(clusterName)},
+				}},
+			}, {
+				// no From allows traffic from all sources
+				Ports: openPorts,
+			}},
+		},
+	}
+}
+
+func networkPolicyPort(port int) networkingv1.NetworkPolicyPort {
+	proto := v1.ProtocolTCP
+	p := intstr.FromInt(port)
+	return networkingv1.NetworkPolicyPort{Protocol: &proto, Port: &p}
+}
@@ -0,0 +1,69 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sutil
+
+import (
+	"reflect"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestNetworkPolicyIngressRules(t *testing.T) {
+	tests := []struct {
+		exposeMetrics bool
+		wOpenPorts    []int
+	}{
+		{exposeMetrics: false, wOpenPorts: []int{EtcdClientPort}},
+		{exposeMetrics: true, wOpenPorts: []int{EtcdClientPort, EtcdMetricsPort}},
+	}
+	for i, tt := range tests {
+		np := newNetworkPolicyManifest("example", tt.exposeMetrics)
+		if !reflect.DeepEqual(np.Spec.PodSelector.MatchLabels, LabelsForCluster("example")) {
+			t.Errorf("#%d: pod selector = %v, want cluster labels", i, np.Spec.PodSelector.MatchLabels)
+		}
+		if len(np.Spec.Ingress) != 2 {
+			t.Fatalf("#%d: got %d ingress rules, want 2", i, len(np.Spec.Ingress))
+		}
+
+		members := np.Spec.Ingress[0]
+		if len(members.From) != 1 || members.From[0].PodSelector == nil ||
+			!reflect.DeepEqual(members.From[0].PodSelector.MatchLabels, LabelsForCluster("example")) {
+			t.Errorf("#%d: member rule sources = %v, want pods with the cluster labels", i, members.From)
+		}
+		if ports := policyPorts(members.Ports); !reflect.DeepEqual(ports, []int{EtcdClientPort, 2380}) {
+			t.Errorf("#%d: member rule ports = %v, want [%d 2380]", i, ports, EtcdClientPort)
+		}
+
+		open := np.Spec.Ingress[1]
+		if len(open.From) != 0 {
+			t.Errorf("#%d: open rule sources = %v, want none", i, open.From)
+		}
+		if ports := policyPorts(open.Ports); !reflect.DeepEqual(ports, tt.wOpenPorts) {
+			t.Errorf("#%d: open rule ports = %v, want %v", i, ports, tt.wOpenPorts)
+		}
+	}
+}
+
+func policyPorts(ps []networkingv1.NetworkPolicyPort) []int {
+	var ports []int
+	for _, p := range ps {
+		if p.Port.Type == intstr.Int {
+			ports = append(ports, p.Port.IntValue())
+		}
+	}
+	return ports
+}
@@ -16,6 +16,16 @@ package k8sutil
 
 import (
 	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// SpotTaintKey is the key of the taint of spot nodes.
+	SpotTaintKey = "aws.amazon.com/spot"
+	// SpotInterruptionAnnotation is set on a spot node about two minutes before
+	// it is interrupted.
+	SpotInterruptionAnnotation = "aws.amazon.com/spot-interruption"
 )
 
 // IsNodeReady checks if the Node condition is ready.
@@ -28,3 +38,15 @@ func IsNodeReady(n v1.Node) bool {
 
 	return false
 }
+
+// IsNodeInterrupted checks if the spot node is about to be interrupted.
+func IsNodeInterrupted(n *v1.Node) bool {
+	_, ok := n.Annotations[SpotInterruptionAnnotation]
+	return ok
+}
+
+// CordonNode marks the node unschedulable so that no new pods are scheduled to it.
+func CordonNode(kubecli kubernetes.Interface, name string) error {
+	_, err := kubecli.CoreV1().Nodes().Patch(name, types.StrategicMergePatchType, []byte(`{"spec":{"unschedulable":true}}`))
+	return err
+}
@@ -0,0 +1,123 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sutil
+
+import (
+	"encoding/json"
+	"fmt"
+
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+// policy/v1 is not part of the vendored client-go. PodDisruptionBudgets of
+// policy/v1 are sent as raw JSON, which is the same as policy/v1beta1 for the
+// fields the operator sets.
+const policyV1GroupVersion = "policy/v1"
+
+// PodDisruptionBudgetName returns the name of the PodDisruptionBudget of the etcd cluster.
+func PodDisruptionBudgetName(clusterName string) string {
+	return clusterName + "-pdb"
+}
+
+// CreateEtcdPodDisruptionBudget creates a PodDisruptionBudget that keeps at least
+// minAvailable etcd pods of the cluster running during voluntary disruptions.
+// It uses policy/v1 if the API server serves it and falls back to policy/v1beta1.
+func CreateEtcdPodDisruptionBudget(kubecli kubernetes.Interface, clusterName, ns string, minAvailable int, owner metav1.OwnerReference) error {
+	min := intstr.FromInt(minAvailable)
+	pdb := &policyv1beta1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   PodDisruptionBudgetName(clusterName),
+			Labels: LabelsForCluster(clusterName),
+		},
+		Spec: policyv1beta1.PodDisruptionBudgetSpec{
+			MinAvailable: &min,
+			Selector:     &metav1.LabelSelector{MatchLabels: LabelsForCluster(clusterName)},
+		},
+	}
+	addOwnerRefToObject(pdb.GetObjectMeta(), owner)
+
+	v1Supported, err := isPolicyV1Supported(kubecli)
+	if err != nil {
+		return err
+	}
+	if v1Supported {
+		pdb.TypeMeta = metav1.TypeMeta{APIVersion: policyV1GroupVersion, Kind: "PodDisruptionBudget"}
+		body, err := json.Marshal(pdb)
+		if err != nil {
+			return err
+		}
+		err = kubecli.CoreV1().RESTClient().Post().
+			AbsPath("/apis", policyV1GroupVersion, "namespaces", ns, "poddisruptionbudgets").
+			Body(body).
+			Do().
+			Error()
+		if err != nil && !apierrors.IsAlreadyExists(err) {
+			return err
+		}
+		return nil
+	}
+
+	_, err = kubecli.PolicyV1beta1().PodDisruptionBudgets(ns).Create(pdb)
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// DeleteEtcdPodDisruptionBudget deletes the PodDisruptionBudget of the etcd cluster.
+// It uses policy/v1 if the API server serves it and falls back to policy/v1beta1.
+func DeleteEtcdPodDisruptionBudget(kubecli kubernetes.Interface, clusterName, ns string) error {
+	v1Supported, err := isPolicyV1Supported(kubecli)
+	if err != nil {
+		return err
+	}
+	if v1Supported {
+		err = kubecli.CoreV1().RESTClient().Delete().
+			AbsPath("/apis", policyV1GroupVersion, "namespaces", ns, "poddisruptionbudgets", PodDisruptionBudgetName(clusterName)).
+			Do().
+			Error()
+	} else {
+		err = kubecli.PolicyV1beta1().PodDisruptionBudgets(ns).Delete(PodDisruptionBudgetName(clusterName), nil)
+	}
+	if err != nil && !IsKubernetesResourceNotFoundError(err) {
+		return err
+	}
+	return nil
+}
+
+func isPolicyV1Supported(kubecli kubernetes.Interface) (bool, error) {
+	groups, err := kubecli.Discovery().ServerGroups()
+	if err != nil {
+		return false, fmt.Errorf("failed to discover API groups: %v", err)
+	}
+	if groups == nil {
+		return false, nil
+	}
+	for _, g := range groups.Groups {
+		if g.Name != policyv1beta1.GroupName {
+			continue
+		}
+		for _, v := range g.Versions {
+			if v.GroupVersion == policyV1GroupVersion {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
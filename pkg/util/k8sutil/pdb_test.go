@@ -0,0 +1,56 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sutil
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestEtcdPodDisruptionBudget(t *testing.T) {
+	// The fake discovery does not serve policy/v1, so policy/v1beta1 is used.
+	kubecli := fake.NewSimpleClientset()
+	if err := CreateEtcdPodDisruptionBudget(kubecli, "example", "default", 2, metav1.OwnerReference{}); err != nil {
+		t.Fatal(err)
+	}
+	pdb, err := kubecli.PolicyV1beta1().PodDisruptionBudgets("default").Get("example-pdb", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := pdb.Spec.MinAvailable.IntValue(); got != 2 {
+		t.Errorf("minAvailable = %d, want 2", got)
+	}
+	if got := pdb.Spec.Selector.MatchLabels["etcd_cluster"]; got != "example" {
+		t.Errorf("selector etcd_cluster = %q, want example", got)
+	}
+
+	// creating it again is not an error
+	if err := CreateEtcdPodDisruptionBudget(kubecli, "example", "default", 2, metav1.OwnerReference{}); err != nil {
+		t.Errorf("create existing PodDisruptionBudget: %v", err)
+	}
+
+	if err := DeleteEtcdPodDisruptionBudget(kubecli, "example", "default"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kubecli.PolicyV1beta1().PodDisruptionBudgets("default").Get("example-pdb", metav1.GetOptions{}); !IsKubernetesResourceNotFoundError(err) {
+		t.Errorf("get deleted PodDisruptionBudget: want not found, got %v", err)
+	}
+	// deleting a missing one is not an error
+	if err := DeleteEtcdPodDisruptionBudget(kubecli, "example", "default"); err != nil {
+		t.Errorf("delete missing PodDisruptionBudget: %v", err)
+	}
+}
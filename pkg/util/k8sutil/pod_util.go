@@ -17,11 +17,15 @@ package k8sutil
 import (
 	"encoding/json"
 	"fmt"
+	"path"
+	"strings"
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
 	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
 
 	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 const (
@@ -34,11 +38,15 @@ func etcdVolumeMounts() []v1.VolumeMount {
 	}
 }
 
-func etcdContainer(cmd []string, repo, version string) v1.Container {
+func etcdContainer(cmd []string, repo, version string, pullPolicy v1.PullPolicy) v1.Container {
+	if len(pullPolicy) == 0 {
+		pullPolicy = v1.PullIfNotPresent
+	}
 	c := v1.Container{
-		Command: cmd,
-		Name:    "etcd",
-		Image:   ImageName(repo, version),
+		Command:         cmd,
+		Name:            "etcd",
+		Image:           ImageName(repo, version),
+		ImagePullPolicy: pullPolicy,
 		Ports: []v1.ContainerPort{
 			{
 				Name:          "server",
@@ -57,6 +65,47 @@ func etcdContainer(cmd []string, repo, version string) v1.Container {
 	return c
 }
 
+// etcdLogFlags returns the etcd flags of the log settings of the pod policy.
+// etcd 3.4 ignores the log level and rejects file outputs unless it runs the
+// zap logger, so any log setting switches to it.
+func etcdLogFlags(policy *api.PodPolicy) string {
+	if len(policy.EtcdLogLevel) == 0 && len(policy.EtcdLogOutputs) == 0 {
+		return ""
+	}
+	flags := " --logger=zap"
+	if len(policy.EtcdLogLevel) != 0 {
+		flags += " --log-level=" + policy.EtcdLogLevel
+	}
+	if len(policy.EtcdLogOutputs) != 0 {
+		flags += " --log-outputs=" + strings.Join(policy.EtcdLogOutputs, ",")
+	}
+	return flags
+}
+
+// etcdLogVolumes returns an empty dir volume and its mount for each directory
+// of the log output files.
+func etcdLogVolumes(outputs []string) ([]v1.Volume, []v1.VolumeMount) {
+	var (
+		volumes []v1.Volume
+		mounts  []v1.VolumeMount
+		seen    = map[string]bool{}
+	)
+	for _, o := range outputs {
+		if !path.IsAbs(o) {
+			continue
+		}
+		dir := path.Dir(o)
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		name := fmt.Sprintf("etcd-logs-%d", len(volumes))
+		volumes = append(volumes, v1.Volume{Name: name, VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}})
+		mounts = append(mounts, v1.VolumeMount{Name: name, MountPath: dir})
+	}
+	return volumes, mounts
+}
+
 func containerWithProbes(c v1.Container, lp *v1.Probe, rp *v1.Probe) v1.Container {
 	c.LivenessProbe = lp
 	c.ReadinessProbe = rp
@@ -68,8 +117,26 @@ func containerWithRequirements(c v1.Container, r v1.ResourceRequirements) v1.Con
 	return c
 }
 
-func newEtcdProbe(isSecure bool) *v1.Probe {
+func newEtcdProbe(isSecure, isAuthEnabled bool) *v1.Probe {
+	if isAuthEnabled && !isSecure {
+		// An unauthenticated get is rejected once etcd auth is enabled.
+		// Fall back to the health endpoint which is not subject to etcd auth.
+		return &v1.Probe{
+			Handler: v1.Handler{
+				HTTPGet: &v1.HTTPGetAction{
+					Path: "/health",
+					Port: intstr.FromInt(EtcdClientPort),
+				},
+			},
+			InitialDelaySeconds: 10,
+			TimeoutSeconds:      10,
+			PeriodSeconds:       60,
+			FailureThreshold:    3,
+		}
+	}
 	// etcd pod is alive only if a linearizable get succeeds.
+	// With client cert auth, the common name of the operator client cert is
+	// used as the etcd user once etcd auth is enabled.
 	cmd := "ETCDCTL_API=3 etcdctl get foo"
 	if isSecure {
 		tlsFlags := fmt.Sprintf("--cert=%[1]s/%[2]s --key=%[1]s/%[3]s --cacert=%[1]s/%[4]s", operatorEtcdTLSDir, etcdutil.CliCertFile, etcdutil.CliKeyFile, etcdutil.CliCAFile)
@@ -88,6 +155,87 @@ func newEtcdProbe(isSecure bool) *v1.Probe {
 	}
 }
 
+// NewEtcdPodFromTemplate returns a copy of the pod template tmpl with the fields
+// the operator depends on taken from the etcd pod p. See PodPolicy.PodTemplateSpec.
+func NewEtcdPodFromTemplate(tmpl *v1.PodTemplateSpec, p *v1.Pod) *v1.Pod {
+	pod := &v1.Pod{
+		ObjectMeta: *tmpl.ObjectMeta.DeepCopy(),
+		Spec:       *tmpl.Spec.DeepCopy(),
+	}
+	pod.Name = p.Name
+	pod.Labels = p.Labels
+	mergeLabels(pod.Labels, tmpl.Labels)
+	pod.Annotations = p.Annotations
+	mergeLabels(pod.Annotations, tmpl.Annotations)
+
+	pod.Spec.Hostname = p.Spec.Hostname
+	pod.Spec.Subdomain = p.Spec.Subdomain
+	pod.Spec.RestartPolicy = p.Spec.RestartPolicy
+	if pod.Spec.AutomountServiceAccountToken == nil {
+		pod.Spec.AutomountServiceAccountToken = p.Spec.AutomountServiceAccountToken
+	}
+	pod.Spec.InitContainers = append(p.Spec.InitContainers, pod.Spec.InitContainers...)
+	pod.Spec.Volumes = append(p.Spec.Volumes, pod.Spec.Volumes...)
+
+	// The etcd container is the first container; the upgrade path relies on it.
+	etcd := p.Spec.Containers[0]
+	containers := []v1.Container{etcd}
+	for _, c := range pod.Spec.Containers {
+		if c.Name != etcd.Name {
+			containers = append(containers, c)
+			continue
+		}
+		c.Image = etcd.Image
+		c.ImagePullPolicy = etcd.ImagePullPolicy
+		c.Command = etcd.Command
+		c.Ports = etcd.Ports
+		c.LivenessProbe = etcd.LivenessProbe
+		c.ReadinessProbe = etcd.ReadinessProbe
+		c.VolumeMounts = append(etcd.VolumeMounts, c.VolumeMounts...)
+		c.Env = append(c.Env, etcd.Env...)
+		if len(c.Resources.Limits) == 0 && len(c.Resources.Requests) == 0 {
+			c.Resources = etcd.Resources
+		}
+		containers[0] = c
+	}
+	pod.Spec.Containers = containers
+	return pod
+}
+
+// reservedPodAnnotations are the annotations the operator sets on the etcd pods.
+// The pod policy cannot override them.
+var reservedPodAnnotations = map[string]bool{
+	etcdVersionAnnotationKey:   true,
+	specHashAnnotationKey:      true,
+	shouldCheckpointAnnotation: true,
+}
+
+// PodPolicyAnnotations returns the annotations of the pod policy the etcd pods
+// carry, i.e. without the reserved ones.
+func PodPolicyAnnotations(policy *api.PodPolicy) map[string]string {
+	if policy == nil {
+		return nil
+	}
+	annotations := map[string]string{}
+	for k, v := range policy.Annotations {
+		if !reservedPodAnnotations[k] {
+			annotations[k] = v
+		}
+	}
+	return annotations
+}
+
+// HasPodPolicyAnnotations returns true if the pod has all the annotations of the pod policy.
+// Reserved annotations are ignored since they are never applied.
+func HasPodPolicyAnnotations(pod *v1.Pod, policy *api.PodPolicy) bool {
+	for k, v := range PodPolicyAnnotations(policy) {
+		if pod.Annotations[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
 func applyPodPolicy(clusterName string, pod *v1.Pod, policy *api.PodPolicy) {
 	if policy == nil {
 		return
@@ -97,18 +245,118 @@ func applyPodPolicy(clusterName string, pod *v1.Pod, policy *api.PodPolicy) {
 		pod.Spec.Affinity = policy.Affinity
 	}
 
+	if len(policy.PodAntiAffinity) != 0 {
+		applyPodAntiAffinity(clusterName, pod, policy.PodAntiAffinity)
+	}
+
+	if policy.HostNetwork {
+		applyHostNetwork(pod)
+	}
+
 	if len(policy.NodeSelector) != 0 {
 		pod = PodWithNodeSelector(pod, policy.NodeSelector)
 	}
 	if len(policy.Tolerations) != 0 {
 		pod.Spec.Tolerations = policy.Tolerations
 	}
+	if policy.TolerateSpotInterruption {
+		tolerations := append([]v1.Toleration(nil), pod.Spec.Tolerations...)
+		pod.Spec.Tolerations = append(tolerations, v1.Toleration{Key: SpotTaintKey, Operator: v1.TolerationOpExists})
+	}
 
 	mergeLabels(pod.Labels, policy.Labels)
+	mergeLabels(pod.Annotations, PodPolicyAnnotations(policy))
+
+	podSC, containerSC := securityContexts(policy)
+	if podSC != nil {
+		pod.Spec.SecurityContext = podSC
+	}
 
 	for i := range pod.Spec.Containers {
 		if pod.Spec.Containers[i].Name == "etcd" {
 			pod.Spec.Containers[i].Env = append(pod.Spec.Containers[i].Env, policy.EtcdEnv...)
+			if containerSC != nil {
+				pod.Spec.Containers[i].SecurityContext = containerSC
+			}
+		}
+	}
+}
+
+// nobodyID is the user and group ID of nobody, used by PodPolicy.SecureDefaults.
+const nobodyID int64 = 65534
+
+// securityContexts returns the pod and etcd container security contexts of
+// the policy, with the secure defaults filled in if enabled.
+func securityContexts(policy *api.PodPolicy) (*v1.PodSecurityContext, *v1.SecurityContext) {
+	podSC := policy.PodSecurityContext.DeepCopy()
+	containerSC := policy.ContainerSecurityContext.DeepCopy()
+	if !policy.SecureDefaults {
+		return podSC, containerSC
+	}
+	if podSC == nil {
+		podSC = &v1.PodSecurityContext{}
+	}
+	if podSC.RunAsUser == nil {
+		uid := nobodyID
+		podSC.RunAsUser = &uid
+	}
+	if podSC.FSGroup == nil {
+		gid := nobodyID
+		podSC.FSGroup = &gid
+	}
+	if containerSC == nil {
+		containerSC = &v1.SecurityContext{}
+	}
+	if containerSC.AllowPrivilegeEscalation == nil {
+		allow := false
+		containerSC.AllowPrivilegeEscalation = &allow
+	}
+	return podSC, containerSC
+}
+
+// applyHostNetwork runs the pod in the host network namespace and binds the etcd
+// ports on the node, so that the scheduler never puts two members on one node.
+func applyHostNetwork(pod *v1.Pod) {
+	pod.Spec.HostNetwork = true
+	// keep resolving the member DNS names from the cluster DNS.
+	pod.Spec.DNSPolicy = v1.DNSClusterFirstWithHostNet
+	for i := range pod.Spec.Containers {
+		for j := range pod.Spec.Containers[i].Ports {
+			p := &pod.Spec.Containers[i].Ports[j]
+			p.HostPort = p.ContainerPort
+		}
+	}
+}
+
+// applyPodAntiAffinity spreads the etcd pods of the same cluster across nodes.
+// It does not overwrite a pod anti-affinity given in the pod policy.
+func applyPodAntiAffinity(clusterName string, pod *v1.Pod, mode api.PodAntiAffinityMode) {
+	if pod.Spec.Affinity == nil {
+		pod.Spec.Affinity = &v1.Affinity{}
+	}
+	if pod.Spec.Affinity.PodAntiAffinity != nil {
+		return
+	}
+	// do not mutate the affinity shared with the cluster spec.
+	pod.Spec.Affinity = pod.Spec.Affinity.DeepCopy()
+
+	term := v1.PodAffinityTerm{
+		LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{
+			"etcd_cluster": clusterName,
+		}},
+		TopologyKey: "kubernetes.io/hostname",
+	}
+
+	switch mode {
+	case api.PodAntiAffinityRequired:
+		pod.Spec.Affinity.PodAntiAffinity = &v1.PodAntiAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: []v1.PodAffinityTerm{term},
+		}
+	case api.PodAntiAffinityPreferred:
+		pod.Spec.Affinity.PodAntiAffinity = &v1.PodAntiAffinity{
+			PreferredDuringSchedulingIgnoredDuringExecution: []v1.WeightedPodAffinityTerm{
+				{Weight: 100, PodAffinityTerm: term},
+			},
 		}
 	}
 }
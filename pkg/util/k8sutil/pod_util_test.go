@@ -0,0 +1,374 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sutil
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestNewEtcdPodHealthCheckTimeout(t *testing.T) {
+	tests := []struct {
+		timeout           int
+		wLivenessTimeout  int32
+		wReadinessTimeout int32
+	}{
+		{timeout: 0, wLivenessTimeout: 10, wReadinessTimeout: 5},
+		{timeout: 30, wLivenessTimeout: 30, wReadinessTimeout: 30},
+	}
+	for i, tt := range tests {
+		m := &etcdutil.Member{Name: "example-0000", Namespace: "default"}
+		cs := api.ClusterSpec{Size: 1, HealthCheckTimeoutSeconds: tt.timeout}
+		pod := NewEtcdPod(m, []string{m.Name}, "example", "new", "token", cs, metav1.OwnerReference{})
+		c := pod.Spec.Containers[0]
+		if c.LivenessProbe.TimeoutSeconds != tt.wLivenessTimeout {
+			t.Errorf("#%d: liveness probe timeout = %d, want %d", i, c.LivenessProbe.TimeoutSeconds, tt.wLivenessTimeout)
+		}
+		if c.ReadinessProbe.TimeoutSeconds != tt.wReadinessTimeout {
+			t.Errorf("#%d: readiness probe timeout = %d, want %d", i, c.ReadinessProbe.TimeoutSeconds, tt.wReadinessTimeout)
+		}
+	}
+}
+
+func TestPeerServiceSelectsMemberPods(t *testing.T) {
+	svc := newPeerServiceManifest("example")
+	selector := labels.SelectorFromSet(svc.Spec.Selector)
+
+	// scale from the seed member up to 5 members
+	var pods []*v1.Pod
+	for i := 0; i < 5; i++ {
+		m := &etcdutil.Member{Name: etcdutil.CreateMemberName("example", i), Namespace: "default"}
+		pods = append(pods, NewEtcdPod(m, []string{m.Name}, "example", "existing", "", api.ClusterSpec{Size: 5}, metav1.OwnerReference{}))
+		for _, pod := range pods {
+			if !selector.Matches(labels.Set(pod.Labels)) {
+				t.Errorf("#%d: peer service does not select member pod (%s)", i, pod.Name)
+			}
+		}
+	}
+
+	m := &etcdutil.Member{Name: etcdutil.CreateMemberName("other", 0), Namespace: "default"}
+	other := NewEtcdPod(m, []string{m.Name}, "other", "new", "token", api.ClusterSpec{Size: 1}, metav1.OwnerReference{})
+	if selector.Matches(labels.Set(other.Labels)) {
+		t.Errorf("peer service selects member pod (%s) of another cluster", other.Name)
+	}
+}
+
+func TestNewEtcdPodFromTemplateKeepsRequiredFields(t *testing.T) {
+	runAsNonRoot := true
+	tmpl := &v1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "custom",
+			Labels: map[string]string{"etcd_cluster": "other", "team": "storage"},
+		},
+		Spec: v1.PodSpec{
+			SecurityContext: &v1.PodSecurityContext{RunAsNonRoot: &runAsNonRoot},
+			RestartPolicy:   v1.RestartPolicyAlways,
+			Hostname:        "custom",
+			Containers: []v1.Container{
+				{Name: "sidecar", Image: "sidecar:latest"},
+				{Name: "etcd", Image: "custom-etcd:latest", Command: []string{"/bin/sh"}, WorkingDir: "/tmp"},
+			},
+			Volumes: []v1.Volume{{Name: "sidecar-config"}},
+		},
+	}
+	m := &etcdutil.Member{Name: "example-0000", Namespace: "default"}
+	cs := api.ClusterSpec{Size: 1, Version: "3.2.13", Pod: &api.PodPolicy{PodTemplateSpec: tmpl}}
+	pod := NewEtcdPod(m, []string{m.Name}, "example", "new", "token", cs, metav1.OwnerReference{})
+	base := NewEtcdPod(m, []string{m.Name}, "example", "new", "token", api.ClusterSpec{Size: 1, Version: "3.2.13"}, metav1.OwnerReference{})
+
+	if pod.Name != m.Name || pod.Spec.Hostname != m.Name || pod.Spec.Subdomain != "example" {
+		t.Errorf("pod name, hostname, subdomain = %s, %s, %s; want %s, %s, example", pod.Name, pod.Spec.Hostname, pod.Spec.Subdomain, m.Name, m.Name)
+	}
+	if pod.Spec.RestartPolicy != v1.RestartPolicyNever {
+		t.Errorf("restart policy = %s, want %s", pod.Spec.RestartPolicy, v1.RestartPolicyNever)
+	}
+	if pod.Labels["etcd_cluster"] != "example" || pod.Labels["etcd_node"] != m.Name || pod.Labels["team"] != "storage" {
+		t.Errorf("unexpected labels %v", pod.Labels)
+	}
+	if pod.Spec.SecurityContext == nil || pod.Spec.SecurityContext.RunAsNonRoot == nil {
+		t.Error("security context of the template is lost")
+	}
+
+	if len(pod.Spec.Containers) != 2 {
+		t.Fatalf("containers = %d, want 2", len(pod.Spec.Containers))
+	}
+	etcd, wantEtcd := pod.Spec.Containers[0], base.Spec.Containers[0]
+	if etcd.Name != "etcd" || etcd.Image != wantEtcd.Image || len(etcd.Command) != len(wantEtcd.Command) {
+		t.Errorf("etcd container = %s %s %v, want %s %s %v", etcd.Name, etcd.Image, etcd.Command, wantEtcd.Name, wantEtcd.Image, wantEtcd.Command)
+	}
+	if len(etcd.Ports) != len(wantEtcd.Ports) || etcd.LivenessProbe == nil || etcd.ReadinessProbe == nil {
+		t.Error("ports or probes of the etcd container are missing")
+	}
+	if etcd.WorkingDir != "/tmp" {
+		t.Errorf("working dir = %q, want the template's /tmp", etcd.WorkingDir)
+	}
+	if pod.Spec.Containers[1].Name != "sidecar" {
+		t.Errorf("second container = %s, want sidecar", pod.Spec.Containers[1].Name)
+	}
+
+	vols := map[string]bool{}
+	for _, v := range pod.Spec.Volumes {
+		vols[v.Name] = true
+	}
+	for _, v := range append(base.Spec.Volumes, v1.Volume{Name: "sidecar-config"}) {
+		if !vols[v.Name] {
+			t.Errorf("volume %s is missing", v.Name)
+		}
+	}
+	if len(pod.Spec.InitContainers) != len(base.Spec.InitContainers) {
+		t.Errorf("init containers = %d, want %d", len(pod.Spec.InitContainers), len(base.Spec.InitContainers))
+	}
+}
+
+func TestNewEtcdPodPolicyAnnotations(t *testing.T) {
+	m := &etcdutil.Member{Name: "example-0000", Namespace: "default"}
+	cs := api.ClusterSpec{
+		Size:    1,
+		Version: "3.2.13",
+		Pod: &api.PodPolicy{Annotations: map[string]string{
+			"example.com/team":       "storage",
+			etcdVersionAnnotationKey: "3.1.0",
+		}},
+	}
+	pod := NewEtcdPod(m, []string{m.Name}, "example", "new", "token", cs, metav1.OwnerReference{})
+	if v := pod.Annotations["example.com/team"]; v != "storage" {
+		t.Errorf("annotation example.com/team = %q, want %q", v, "storage")
+	}
+	if v := GetEtcdVersion(pod); v != "3.2.13" {
+		t.Errorf("etcd version annotation = %q, want %q", v, "3.2.13")
+	}
+	// the reserved etcd version annotation is never applied and is ignored
+	if !HasPodPolicyAnnotations(pod, cs.Pod) {
+		t.Errorf("pod does not have the pod policy annotations")
+	}
+
+	cs.Pod.Annotations["example.com/team"] = "platform"
+	if HasPodPolicyAnnotations(pod, cs.Pod) {
+		t.Errorf("pod with outdated annotation has the pod policy annotations")
+	}
+}
+
+func TestNewEtcdPodProbeOverrides(t *testing.T) {
+	m := &etcdutil.Member{Name: "example-0000", Namespace: "default"}
+	lp := &v1.Probe{
+		Handler:        v1.Handler{TCPSocket: &v1.TCPSocketAction{Port: intstr.FromInt(2379)}},
+		TimeoutSeconds: 20,
+	}
+	cs := api.ClusterSpec{Size: 1, HealthCheckTimeoutSeconds: 30, Pod: &api.PodPolicy{LivenessProbe: lp}}
+	pod := NewEtcdPod(m, []string{m.Name}, "example", "new", "token", cs, metav1.OwnerReference{})
+	c := pod.Spec.Containers[0]
+	if !reflect.DeepEqual(c.LivenessProbe, lp) {
+		t.Errorf("liveness probe = %+v, want %+v", c.LivenessProbe, lp)
+	}
+	// the readiness probe keeps the default
+	if c.ReadinessProbe.Exec == nil || c.ReadinessProbe.TimeoutSeconds != 30 {
+		t.Errorf("readiness probe = %+v, want default exec probe with timeout 30", c.ReadinessProbe)
+	}
+}
+
+func TestNewEtcdPodLogSettings(t *testing.T) {
+	m := &etcdutil.Member{Name: "example-0000", Namespace: "default"}
+	cs := api.ClusterSpec{Size: 1, Version: "3.4.3", Pod: &api.PodPolicy{
+		EtcdLogLevel:   "debug",
+		EtcdLogOutputs: []string{"stderr", "/var/log/etcd/etcd.log", "/var/log/etcd/audit.log"},
+	}}
+	pod := NewEtcdPod(m, []string{m.Name}, "example", "new", "token", cs, metav1.OwnerReference{})
+	c := pod.Spec.Containers[0]
+	cmd := strings.Join(c.Command, " ")
+	for _, flag := range []string{"--logger=zap", "--log-level=debug", "--log-outputs=stderr,/var/log/etcd/etcd.log,/var/log/etcd/audit.log"} {
+		if !strings.Contains(cmd, flag) {
+			t.Errorf("command %q does not contain %s", cmd, flag)
+		}
+	}
+
+	var mounts []v1.VolumeMount
+	for _, vm := range c.VolumeMounts {
+		if strings.HasPrefix(vm.Name, "etcd-logs-") {
+			mounts = append(mounts, vm)
+		}
+	}
+	want := []v1.VolumeMount{{Name: "etcd-logs-0", MountPath: "/var/log/etcd"}}
+	if !reflect.DeepEqual(mounts, want) {
+		t.Errorf("log volume mounts = %+v, want %+v", mounts, want)
+	}
+}
+
+func TestNewEtcdPodSecurityContexts(t *testing.T) {
+	m := &etcdutil.Member{Name: "example-0000", Namespace: "default"}
+	uid := int64(1000)
+	privileged := false
+	tests := []struct {
+		policy       *api.PodPolicy
+		wantUID      *int64
+		wantFSGroup  *int64
+		wantEscalate *bool
+	}{
+		{policy: &api.PodPolicy{}},
+		{
+			policy:       &api.PodPolicy{SecureDefaults: true},
+			wantUID:      func(i int64) *int64 { return &i }(nobodyID),
+			wantFSGroup:  func(i int64) *int64 { return &i }(nobodyID),
+			wantEscalate: &privileged,
+		},
+		{
+			// explicit settings take precedence over the secure defaults
+			policy: &api.PodPolicy{
+				SecureDefaults:           true,
+				PodSecurityContext:       &v1.PodSecurityContext{RunAsUser: &uid},
+				ContainerSecurityContext: &v1.SecurityContext{Privileged: &privileged},
+			},
+			wantUID:      &uid,
+			wantFSGroup:  func(i int64) *int64 { return &i }(nobodyID),
+			wantEscalate: &privileged,
+		},
+		{
+			policy:  &api.PodPolicy{PodSecurityContext: &v1.PodSecurityContext{RunAsUser: &uid}},
+			wantUID: &uid,
+		},
+	}
+	for i, tt := range tests {
+		cs := api.ClusterSpec{Size: 1, Pod: tt.policy}
+		pod := NewEtcdPod(m, []string{m.Name}, "example", "new", "token", cs, metav1.OwnerReference{})
+		var gotUID, gotFSGroup *int64
+		if sc := pod.Spec.SecurityContext; sc != nil {
+			gotUID, gotFSGroup = sc.RunAsUser, sc.FSGroup
+		}
+		if !reflect.DeepEqual(gotUID, tt.wantUID) {
+			t.Errorf("#%d: runAsUser = %v, want %v", i, gotUID, tt.wantUID)
+		}
+		if !reflect.DeepEqual(gotFSGroup, tt.wantFSGroup) {
+			t.Errorf("#%d: fsGroup = %v, want %v", i, gotFSGroup, tt.wantFSGroup)
+		}
+		var gotEscalate *bool
+		if sc := pod.Spec.Containers[0].SecurityContext; sc != nil {
+			gotEscalate = sc.AllowPrivilegeEscalation
+		}
+		if !reflect.DeepEqual(gotEscalate, tt.wantEscalate) {
+			t.Errorf("#%d: allowPrivilegeEscalation = %v, want %v", i, gotEscalate, tt.wantEscalate)
+		}
+	}
+}
+
+func TestNewEtcdPodSpotToleration(t *testing.T) {
+	m := &etcdutil.Member{Name: "example-0000", Namespace: "default"}
+	own := v1.Toleration{Key: "dedicated", Operator: v1.TolerationOpEqual, Value: "etcd"}
+	spot := v1.Toleration{Key: SpotTaintKey, Operator: v1.TolerationOpExists}
+	tests := []struct {
+		policy *api.PodPolicy
+		want   []v1.Toleration
+	}{
+		{policy: &api.PodPolicy{Tolerations: []v1.Toleration{own}}, want: []v1.Toleration{own}},
+		{policy: &api.PodPolicy{TolerateSpotInterruption: true}, want: []v1.Toleration{spot}},
+		{policy: &api.PodPolicy{Tolerations: []v1.Toleration{own}, TolerateSpotInterruption: true}, want: []v1.Toleration{own, spot}},
+	}
+	for i, tt := range tests {
+		cs := api.ClusterSpec{Size: 1, Pod: tt.policy}
+		pod := NewEtcdPod(m, []string{m.Name}, "example", "new", "token", cs, metav1.OwnerReference{})
+		if !reflect.DeepEqual(pod.Spec.Tolerations, tt.want) {
+			t.Errorf("#%d: tolerations = %v, want %v", i, pod.Spec.Tolerations, tt.want)
+		}
+	}
+}
+
+func TestApplyPodAntiAffinity(t *testing.T) {
+	term := v1.PodAffinityTerm{
+		LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"etcd_cluster": "example"}},
+		TopologyKey:   "kubernetes.io/hostname",
+	}
+	nodeAffinity := &v1.NodeAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{},
+	}
+	own := &v1.PodAntiAffinity{
+		PreferredDuringSchedulingIgnoredDuringExecution: []v1.WeightedPodAffinityTerm{
+			{Weight: 10, PodAffinityTerm: v1.PodAffinityTerm{TopologyKey: "failure-domain.beta.kubernetes.io/zone"}},
+		},
+	}
+	tests := []struct {
+		affinity *v1.Affinity
+		mode     api.PodAntiAffinityMode
+		want     *v1.PodAntiAffinity
+	}{
+		{
+			mode: api.PodAntiAffinityRequired,
+			want: &v1.PodAntiAffinity{RequiredDuringSchedulingIgnoredDuringExecution: []v1.PodAffinityTerm{term}},
+		},
+		{
+			mode: api.PodAntiAffinityPreferred,
+			want: &v1.PodAntiAffinity{PreferredDuringSchedulingIgnoredDuringExecution: []v1.WeightedPodAffinityTerm{
+				{Weight: 100, PodAffinityTerm: term},
+			}},
+		},
+		// an anti-affinity from the pod policy is left untouched
+		{affinity: &v1.Affinity{PodAntiAffinity: own}, mode: api.PodAntiAffinityRequired, want: own},
+		// the affinity shared with the cluster spec is not mutated
+		{
+			affinity: &v1.Affinity{NodeAffinity: nodeAffinity},
+			mode:     api.PodAntiAffinityRequired,
+			want:     &v1.PodAntiAffinity{RequiredDuringSchedulingIgnoredDuringExecution: []v1.PodAffinityTerm{term}},
+		},
+	}
+	for i, tt := range tests {
+		var shared *v1.Affinity
+		if tt.affinity != nil {
+			shared = tt.affinity.DeepCopy()
+		}
+		pod := &v1.Pod{Spec: v1.PodSpec{Affinity: tt.affinity}}
+		applyPodAntiAffinity("example", pod, tt.mode)
+		if !reflect.DeepEqual(pod.Spec.Affinity.PodAntiAffinity, tt.want) {
+			t.Errorf("#%d: pod anti-affinity = %+v, want %+v", i, pod.Spec.Affinity.PodAntiAffinity, tt.want)
+		}
+		if !reflect.DeepEqual(tt.affinity, shared) {
+			t.Errorf("#%d: spec affinity changed to %+v, want %+v", i, tt.affinity, shared)
+		}
+		if tt.affinity != nil && tt.affinity.NodeAffinity != nil && !reflect.DeepEqual(pod.Spec.Affinity.NodeAffinity, tt.affinity.NodeAffinity) {
+			t.Errorf("#%d: node affinity = %+v, want %+v", i, pod.Spec.Affinity.NodeAffinity, tt.affinity.NodeAffinity)
+		}
+	}
+}
+
+func TestNewEtcdPodHostNetwork(t *testing.T) {
+	m := &etcdutil.Member{Name: "example-0000", Namespace: "default"}
+	cs := api.ClusterSpec{Size: 1, Pod: &api.PodPolicy{HostNetwork: true}}
+	pod := NewEtcdPod(m, []string{m.Name}, "example", "new", "token", cs, metav1.OwnerReference{})
+	if !pod.Spec.HostNetwork {
+		t.Error("pod does not run in the host network")
+	}
+	if pod.Spec.DNSPolicy != v1.DNSClusterFirstWithHostNet {
+		t.Errorf("dns policy = %s, want %s", pod.Spec.DNSPolicy, v1.DNSClusterFirstWithHostNet)
+	}
+	hostPorts := map[int32]int32{}
+	for _, p := range pod.Spec.Containers[0].Ports {
+		hostPorts[p.ContainerPort] = p.HostPort
+	}
+	for _, port := range []int32{2379, 2380} {
+		hp, ok := hostPorts[port]
+		if !ok {
+			t.Errorf("container port %d not found", port)
+			continue
+		}
+		if hp != port {
+			t.Errorf("host port of container port %d = %d, want %d", port, hp, port)
+		}
+	}
+}
@@ -15,6 +15,7 @@
 package k8sutil
 
 import (
+	"encoding/json"
 	"fmt"
 	"path"
 	"strings"
@@ -37,7 +38,60 @@ func selfHostedDataDir(ns, name string) string {
 	return path.Join(etcdVolumeMountDir, ns+"-"+name)
 }
 
+// IsSelfHostedPod tells whether the pod was created for a self-hosted member.
+func IsSelfHostedPod(pod *v1.Pod) bool {
+	return pod.Annotations[shouldCheckpointAnnotation] == "true"
+}
+
 func NewSelfHostedEtcdPod(m *etcdutil.Member, initialCluster, endpoints []string, clusterName, state, token string, cs api.ClusterSpec, owner metav1.OwnerReference) *v1.Pod {
+	commands := selfHostedEtcdCommands(m, initialCluster, endpoints, state, token)
+
+	// When scaling from 1 -> 2 members, if DNS entry is not populated yet, the k8s control plane will go down
+	// and the etcd pod will not have any chance to talk to each other again. We need to make sure DNS entry ready.
+	// TODO: nslookup should timeout if blocked for a while (10s).
+	ft := `
+while ( ! nslookup %s )
+do
+	sleep 3
+done
+%s
+`
+	commands = fmt.Sprintf(ft, m.Addr(), commands)
+	pod := newSelfHostedEtcdPod(m, commands, clusterName, cs)
+	pod.Annotations[shouldCheckpointAnnotation] = "true"
+	// overwrites the antiAffinity setting for self hosted cluster.
+	applyAntiAffinityOnNodes(pod)
+	addOwnerRefToObject(pod.GetObjectMeta(), owner)
+	return pod
+}
+
+// GenerateEtcdStaticPodManifest returns the JSON manifest of a static pod that
+// runs m as the seed member of a new self-hosted cluster, for the kubelet to
+// start it before the Kubernetes API is available.
+// Unlike the pods of NewSelfHostedEtcdPod, the static pod has no owner, is not
+// checkpointed, scheduled or waiting for the cluster DNS; it shares the data
+// directory and the lock on the host with them. Static pods cannot mount
+// secrets, so TLS members are not supported.
+func GenerateEtcdStaticPodManifest(cs api.ClusterSpec, m *etcdutil.Member) ([]byte, error) {
+	if m.SecurePeer || m.SecureClient {
+		return nil, fmt.Errorf("static pod of member (%s) cannot mount TLS secrets", m.Name)
+	}
+	clusterName := m.ClusterName()
+	initialCluster := []string{m.Name + "=" + m.PeerURL()}
+	commands := selfHostedEtcdCommands(m, initialCluster, nil, "new", clusterName)
+	pod := newSelfHostedEtcdPod(m, commands, clusterName, cs)
+	pod.TypeMeta = metav1.TypeMeta{Kind: "Pod", APIVersion: "v1"}
+	pod.Namespace = m.Namespace
+	// The kubelet runs the static pod on its own node without the cluster DNS.
+	pod.Spec.Affinity = nil
+	pod.Spec.NodeSelector = nil
+	pod.Spec.DNSPolicy = v1.DNSDefault
+	return json.MarshalIndent(pod, "", "  ")
+}
+
+// selfHostedEtcdCommands returns the shell commands that start etcd for the
+// self-hosted member m, adding it to the cluster of endpoints first if they are given.
+func selfHostedEtcdCommands(m *etcdutil.Member, initialCluster, endpoints []string, state, token string) string {
 	hostDataDir := selfHostedDataDir(m.Namespace, m.Name)
 	commands := fmt.Sprintf("/usr/local/bin/etcd --data-dir=%s --name=%s --initial-advertise-peer-urls=%s "+
 		"--listen-peer-urls=%s --listen-client-urls=%s --advertise-client-urls=%s "+
@@ -53,12 +107,6 @@ func NewSelfHostedEtcdPod(m *etcdutil.Member, initialCluster, endpoints []string
 		commands += fmt.Sprintf(" --initial-cluster-token=%s", token)
 	}
 
-	labels := map[string]string{
-		"app":          "etcd",
-		"etcd_node":    m.Name,
-		"etcd_cluster": clusterName,
-	}
-
 	if len(endpoints) > 0 {
 		addMemberCmd := fmt.Sprintf("ETCDCTL_API=3 etcdctl --endpoints=%s member add %s --peer-urls=%s", strings.Join(endpoints, ","), m.Name, m.PeerURL())
 		if m.SecureClient {
@@ -67,21 +115,21 @@ func NewSelfHostedEtcdPod(m *etcdutil.Member, initialCluster, endpoints []string
 		}
 		commands = fmt.Sprintf("([ -d %s ] || %s); %s", hostDataDir, addMemberCmd, commands)
 	}
+	return commands
+}
+
+// newSelfHostedEtcdPod returns the pod of the self-hosted member m, which runs
+// commands on the host network under the etcd lock of the host.
+func newSelfHostedEtcdPod(m *etcdutil.Member, commands, clusterName string, cs api.ClusterSpec) *v1.Pod {
+	labels := map[string]string{
+		"app":          "etcd",
+		"etcd_node":    m.Name,
+		"etcd_cluster": clusterName,
+	}
 
-	// When scaling from 1 -> 2 members, if DNS entry is not populated yet, the k8s control plane will go down
-	// and the etcd pod will not have any chance to talk to each other again. We need to make sure DNS entry ready.
-	// TODO: nslookup should timeout if blocked for a while (10s).
-	ft := `
-while ( ! nslookup %s )
-do
-	sleep 3
-done
-%s
-`
-	commands = fmt.Sprintf(ft, m.Addr(), commands)
 	commands = fmt.Sprintf("%s; %s", appendHostsCommands(), commands)
 	commands = fmt.Sprintf("flock %s -c \"%s\"", etcdLockPath, commands)
-	c := etcdContainer([]string{"/bin/sh", "-ec", commands}, cs.Repository, cs.Version)
+	c := etcdContainer([]string{"/bin/sh", "-ec", commands}, cs.Repository, cs.Version, cs.ImagePullPolicy)
 	// On node reboot, there will be two copies of etcd pod: scheduled and checkpointed one.
 	// Checkpointed one will start first. But then the scheduler will detect host port conflict,
 	// and set the pod (in APIServer) failed. This further affects etcd service by removing the endpoints.
@@ -111,9 +159,10 @@ done
 			MountPath: peerTLSDir,
 			Name:      peerTLSVolume,
 		})
-		volumes = append(volumes, v1.Volume{Name: peerTLSVolume, VolumeSource: v1.VolumeSource{
-			Secret: &v1.SecretVolumeSource{SecretName: cs.TLS.Static.Member.PeerSecret},
-		}})
+		volumes = append(volumes, v1.Volume{
+			Name:         peerTLSVolume,
+			VolumeSource: tlsSecretVolumeSource(cs.TLS, cs.TLS.PeerSecret(clusterName), "peer"),
+		})
 	}
 	if m.SecureClient {
 		c.VolumeMounts = append(c.VolumeMounts, v1.VolumeMount{
@@ -123,20 +172,20 @@ done
 			MountPath: operatorEtcdTLSDir,
 			Name:      operatorEtcdTLSVolume,
 		})
-		volumes = append(volumes, v1.Volume{Name: serverTLSVolume, VolumeSource: v1.VolumeSource{
-			Secret: &v1.SecretVolumeSource{SecretName: cs.TLS.Static.Member.ServerSecret},
-		}}, v1.Volume{Name: operatorEtcdTLSVolume, VolumeSource: v1.VolumeSource{
-			Secret: &v1.SecretVolumeSource{SecretName: cs.TLS.Static.OperatorSecret},
-		}})
+		volumes = append(volumes, v1.Volume{
+			Name:         serverTLSVolume,
+			VolumeSource: tlsSecretVolumeSource(cs.TLS, cs.TLS.ServerSecret(clusterName), "server"),
+		}, v1.Volume{
+			Name:         operatorEtcdTLSVolume,
+			VolumeSource: tlsSecretVolumeSource(cs.TLS, cs.TLS.OperatorSecret(clusterName), "etcd-client"),
+		})
 	}
 
 	pod := &v1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:   m.Name,
-			Labels: labels,
-			Annotations: map[string]string{
-				shouldCheckpointAnnotation: "true",
-			},
+			Name:        m.Name,
+			Labels:      labels,
+			Annotations: map[string]string{},
 		},
 		Spec: v1.PodSpec{
 			// Self-hosted etcd pod need to endure node restart.
@@ -155,9 +204,6 @@ done
 	SetEtcdVersion(pod, cs.Version)
 
 	applyPodPolicy(clusterName, pod, cs.Pod)
-	// overwrites the antiAffinity setting for self hosted cluster.
-	applyAntiAffinityOnNodes(pod)
-	addOwnerRefToObject(pod.GetObjectMeta(), owner)
 	return pod
 }
 
@@ -0,0 +1,90 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sutil
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGenerateEtcdStaticPodManifest(t *testing.T) {
+	m := &etcdutil.Member{Name: "example-0000", Namespace: "kube-system"}
+	cs := api.ClusterSpec{Size: 1, Version: "3.2.13", Pod: &api.PodPolicy{NodeSelector: map[string]string{"master": "true"}}}
+
+	b, err := GenerateEtcdStaticPodManifest(cs, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pod := &v1.Pod{}
+	if err := json.Unmarshal(b, pod); err != nil {
+		t.Fatalf("failed to decode manifest: %v", err)
+	}
+	if pod.Kind != "Pod" || pod.APIVersion != "v1" {
+		t.Errorf("kind = %s, apiVersion = %s, want Pod, v1", pod.Kind, pod.APIVersion)
+	}
+	if pod.Name != m.Name || pod.Namespace != m.Namespace {
+		t.Errorf("pod = %s/%s, want %s/%s", pod.Namespace, pod.Name, m.Namespace, m.Name)
+	}
+	if len(pod.OwnerReferences) != 0 {
+		t.Errorf("want no owner references, got %v", pod.OwnerReferences)
+	}
+	if IsSelfHostedPod(pod) {
+		t.Error("static pod is checkpointed")
+	}
+	if pod.Spec.Affinity != nil || len(pod.Spec.NodeSelector) != 0 {
+		t.Errorf("want no scheduling constraints, got affinity %v, node selector %v", pod.Spec.Affinity, pod.Spec.NodeSelector)
+	}
+	if !pod.Spec.HostNetwork {
+		t.Error("static pod does not use the host network")
+	}
+	cmd := strings.Join(pod.Spec.Containers[0].Command, " ")
+	if strings.Contains(cmd, "nslookup") {
+		t.Errorf("static pod waits for the cluster DNS: %s", cmd)
+	}
+	if !strings.Contains(cmd, "--initial-cluster-state=new") {
+		t.Errorf("static pod does not start a new cluster: %s", cmd)
+	}
+
+	m.SecurePeer = true
+	if _, err := GenerateEtcdStaticPodManifest(cs, m); err == nil {
+		t.Error("want error for TLS member, got nil")
+	}
+}
+
+func TestNewSelfHostedEtcdPod(t *testing.T) {
+	m := &etcdutil.Member{Name: "example-0000", Namespace: "kube-system"}
+	owner := metav1.OwnerReference{Name: "example"}
+	pod := NewSelfHostedEtcdPod(m, []string{m.Name + "=" + m.PeerURL()}, nil, "example", "new", "token", api.ClusterSpec{Size: 1}, owner)
+
+	if !IsSelfHostedPod(pod) {
+		t.Error("self-hosted pod is not checkpointed")
+	}
+	if len(pod.OwnerReferences) != 1 || pod.OwnerReferences[0].Name != owner.Name {
+		t.Errorf("owner references = %v, want %v", pod.OwnerReferences, owner)
+	}
+	if pod.Spec.Affinity == nil || pod.Spec.Affinity.PodAntiAffinity == nil {
+		t.Error("self-hosted pod has no anti-affinity on nodes")
+	}
+	if cmd := strings.Join(pod.Spec.Containers[0].Command, " "); !strings.Contains(cmd, "nslookup "+m.Addr()) {
+		t.Errorf("self-hosted pod does not wait for its DNS entry: %s", cmd)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sutil
+
+import (
+	"encoding/json"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// The Prometheus Operator client is not vendored. ServiceMonitors are sent as
+// raw JSON with the subset of the monitoring.coreos.com/v1 types below.
+const monitoringV1GroupVersion = "monitoring.coreos.com/v1"
+
+type serviceMonitor struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              serviceMonitorSpec `json:"spec"`
+}
+
+type serviceMonitorSpec struct {
+	Selector          metav1.LabelSelector `json:"selector"`
+	NamespaceSelector namespaceSelector    `json:"namespaceSelector"`
+	Endpoints         []endpoint           `json:"endpoints"`
+}
+
+type namespaceSelector struct {
+	MatchNames []string `json:"matchNames"`
+}
+
+type endpoint struct {
+	Port     string `json:"port"`
+	Interval string `json:"interval,omitempty"`
+}
+
+// ServiceMonitorName returns the name of the ServiceMonitor of the etcd cluster.
+func ServiceMonitorName(clusterName string) string {
+	return clusterName
+}
+
+// CreateServiceMonitor creates a ServiceMonitor that makes the Prometheus Operator
+// scrape the metrics port of the etcd metrics service.
+func CreateServiceMonitor(kubecli kubernetes.Interface, clusterName, ns string, pm *api.PrometheusMonitoringConfig, owner metav1.OwnerReference) error {
+	sm := &serviceMonitor{
+		TypeMeta: metav1.TypeMeta{APIVersion: monitoringV1GroupVersion, Kind: "ServiceMonitor"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   ServiceMonitorName(clusterName),
+			Labels: LabelsForCluster(clusterName),
+		},
+		Spec: serviceMonitorSpec{
+			// The client and peer services have the same labels, but no metrics port.
+			Selector:          metav1.LabelSelector{MatchLabels: LabelsForCluster(clusterName)},
+			NamespaceSelector: namespaceSelector{MatchNames: []string{ns}},
+			Endpoints:         []endpoint{{Port: "metrics", Interval: pm.Interval}},
+		},
+	}
+	addOwnerRefToObject(sm.GetObjectMeta(), owner)
+
+	body, err := json.Marshal(sm)
+	if err != nil {
+		return err
+	}
+	return kubecli.CoreV1().RESTClient().Post().
+		AbsPath("/apis", monitoringV1GroupVersion, "namespaces", ns, "servicemonitors").
+		Body(body).
+		Do().
+		Error()
+}
+
+// ServiceMonitorExists returns true if the ServiceMonitor of the etcd cluster exists.
+func ServiceMonitorExists(kubecli kubernetes.Interface, clusterName, ns string) (bool, error) {
+	err := kubecli.CoreV1().RESTClient().Get().
+		AbsPath("/apis", monitoringV1GroupVersion, "namespaces", ns, "servicemonitors", ServiceMonitorName(clusterName)).
+		Do().
+		Error()
+	if err == nil {
+		return true, nil
+	}
+	if IsKubernetesResourceNotFoundError(err) {
+		return false, nil
+	}
+	return false, err
+}
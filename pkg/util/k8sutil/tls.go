@@ -15,12 +15,28 @@
 package k8sutil
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
 	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
 
+	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
+// certManagerCAKey is the key of the CA certificate in secrets issued by cert-manager.
+const certManagerCAKey = "ca.crt"
+
+// The keys of the peer certificate, key and CA certificate in static peer secrets.
+const (
+	peerCertKey = "peer.crt"
+	peerKeyKey  = "peer.key"
+	peerCAKey   = "peer-ca.crt"
+)
+
 type TLSData struct {
 	CertData []byte
 	KeyData  []byte
@@ -33,9 +49,81 @@ func GetTLSDataFromSecret(kubecli kubernetes.Interface, ns, se string) (*TLSData
 	if err != nil {
 		return nil, err
 	}
+	if _, ok := secret.Data[etcdutil.CliCertFile]; !ok && secret.Type == v1.SecretTypeTLS {
+		// issued by cert-manager
+		return &TLSData{
+			CertData: secret.Data[v1.TLSCertKey],
+			KeyData:  secret.Data[v1.TLSPrivateKeyKey],
+			CAData:   secret.Data[certManagerCAKey],
+		}, nil
+	}
 	return &TLSData{
 		CertData: secret.Data[etcdutil.CliCertFile],
 		KeyData:  secret.Data[etcdutil.CliKeyFile],
 		CAData:   secret.Data[etcdutil.CliCAFile],
 	}, nil
 }
+
+// tlsSecretVolumeSource returns the volume source of the TLS secret se. The
+// keys of secrets issued by cert-manager are projected to the file names etcd
+// is started with: "<prefix>.crt", "<prefix>.key" and "<prefix>-ca.crt".
+func tlsSecretVolumeSource(tp *api.TLSPolicy, se, prefix string) v1.VolumeSource {
+	vs := v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: se}}
+	if tp.CertManager != nil {
+		vs.Secret.Items = []v1.KeyToPath{
+			{Key: v1.TLSCertKey, Path: prefix + ".crt"},
+			{Key: v1.TLSPrivateKeyKey, Path: prefix + ".key"},
+			{Key: certManagerCAKey, Path: prefix + "-ca.crt"},
+		}
+	}
+	return vs
+}
+
+// GetPeerSecret returns the name of the peer TLS secret mounted in the etcd pod,
+// or "" if the pod does not use peer TLS.
+func GetPeerSecret(pod *v1.Pod) string {
+	for _, v := range pod.Spec.Volumes {
+		if v.Name == peerTLSVolume && v.Secret != nil {
+			return v.Secret.SecretName
+		}
+	}
+	return ""
+}
+
+// ValidatePeerSecret checks that the static peer secret se holds a certificate
+// and key pair signed by the CA certificate of the secret.
+func ValidatePeerSecret(kubecli kubernetes.Interface, ns, se string) error {
+	secret, err := kubecli.CoreV1().Secrets(ns).Get(se, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if err := validatePeerTLSData(secret.Data); err != nil {
+		return fmt.Errorf("invalid peer secret (%s): %v", se, err)
+	}
+	return nil
+}
+
+func validatePeerTLSData(data map[string][]byte) error {
+	for _, k := range []string{peerCertKey, peerKeyKey, peerCAKey} {
+		if len(data[k]) == 0 {
+			return fmt.Errorf("missing %s", k)
+		}
+	}
+	pair, err := tls.X509KeyPair(data[peerCertKey], data[peerKeyKey])
+	if err != nil {
+		return err
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(data[peerCAKey]) {
+		return fmt.Errorf("no CA certificate in %s", peerCAKey)
+	}
+	_, err = cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+	if err != nil {
+		return fmt.Errorf("peer certificate is not signed by the CA: %v", err)
+	}
+	return nil
+}
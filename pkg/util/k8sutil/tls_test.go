@@ -0,0 +1,104 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+)
+
+// newTestCert returns a PEM encoded certificate and key signed by parent, or a
+// self-signed CA certificate if parent is nil.
+func newTestCert(t *testing.T, serial int64, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, []byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestValidatePeerTLSData(t *testing.T) {
+	ca, caKey, caPEM, _ := newTestCert(t, 1, nil, nil)
+	_, _, certPEM, keyPEM := newTestCert(t, 2, ca, caKey)
+	_, _, otherCAPEM, otherKeyPEM := newTestCert(t, 3, nil, nil)
+
+	tests := []struct {
+		data    map[string][]byte
+		wantErr bool
+	}{
+		{data: map[string][]byte{peerCertKey: certPEM, peerKeyKey: keyPEM, peerCAKey: caPEM}},
+		// missing key
+		{data: map[string][]byte{peerCertKey: certPEM, peerCAKey: caPEM}, wantErr: true},
+		// key of another certificate
+		{data: map[string][]byte{peerCertKey: certPEM, peerKeyKey: otherKeyPEM, peerCAKey: caPEM}, wantErr: true},
+		// certificate signed by another CA
+		{data: map[string][]byte{peerCertKey: certPEM, peerKeyKey: keyPEM, peerCAKey: otherCAPEM}, wantErr: true},
+	}
+	for i, tt := range tests {
+		err := validatePeerTLSData(tt.data)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("#%d: err = %v, want error %v", i, err, tt.wantErr)
+		}
+	}
+}
+
+func TestGetPeerSecret(t *testing.T) {
+	pod := &v1.Pod{}
+	if se := GetPeerSecret(pod); se != "" {
+		t.Errorf("peer secret of pod without peer TLS = %q, want empty", se)
+	}
+	pod.Spec.Volumes = []v1.Volume{
+		{Name: "etcd-data", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+		{Name: peerTLSVolume, VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: "peer-tls-2"}}},
+	}
+	if se := GetPeerSecret(pod); se != "peer-tls-2" {
+		t.Errorf("peer secret = %q, want %q", se, "peer-tls-2")
+	}
+}
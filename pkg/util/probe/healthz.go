@@ -0,0 +1,55 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probe
+
+import (
+	"net/http"
+	"time"
+)
+
+const (
+	HTTPHealthzEndpoint = "/healthz"
+
+	// HeartbeatTimeout is how long the control loop of the operator can go
+	// without a heartbeat before the operator is reported unhealthy.
+	HeartbeatTimeout = 30 * time.Second
+)
+
+var lastHeartbeat time.Time
+
+// Heartbeat records that the control loop of the operator is alive.
+func Heartbeat() {
+	mu.Lock()
+	lastHeartbeat = time.Now()
+	mu.Unlock()
+}
+
+// HealthzHandler writes back the HTTP status code 200 if the control loop had a
+// heartbeat within HeartbeatTimeout, and 500 otherwise. The operator is healthy
+// before the control loop starts, e.g. while it waits to become the leader.
+func HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	mu.Lock()
+	last := lastHeartbeat
+	mu.Unlock()
+	if isHealthy(last, time.Now()) {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func isHealthy(lastHeartbeat, now time.Time) bool {
+	return lastHeartbeat.IsZero() || now.Sub(lastHeartbeat) <= HeartbeatTimeout
+}
@@ -0,0 +1,38 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probe
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsHealthy(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		lastHeartbeat time.Time
+		want          bool
+	}{
+		{lastHeartbeat: time.Time{}, want: true},
+		{lastHeartbeat: now.Add(-time.Second), want: true},
+		{lastHeartbeat: now.Add(-HeartbeatTimeout), want: true},
+		{lastHeartbeat: now.Add(-HeartbeatTimeout - time.Second), want: false},
+	}
+	for i, tt := range tests {
+		if got := isHealthy(tt.lastHeartbeat, now); got != tt.want {
+			t.Errorf("#%d: healthy = %v, want %v", i, got, tt.want)
+		}
+	}
+}
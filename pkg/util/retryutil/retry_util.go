@@ -60,3 +60,31 @@ func Retry(interval time.Duration, maxRetries int, f ConditionFunc) error {
 	}
 	return &RetryError{maxRetries}
 }
+
+// RetryWithBackoff retries f until it is done or timeout has passed. The
+// interval starts at initial and doubles after every attempt, up to max.
+// f is not retried if the next attempt would start after timeout.
+func RetryWithBackoff(initial, max, timeout time.Duration, f ConditionFunc) error {
+	if initial <= 0 || max < initial {
+		return fmt.Errorf("invalid back-off interval (initial %v, max %v)", initial, max)
+	}
+	deadline := time.Now().Add(timeout)
+	interval := initial
+	for i := 0; ; i++ {
+		ok, err := f()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		if time.Now().Add(interval).After(deadline) {
+			return &RetryError{i}
+		}
+		time.Sleep(interval)
+		interval *= 2
+		if interval > max {
+			interval = max
+		}
+	}
+}
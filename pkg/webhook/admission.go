@@ -0,0 +1,83 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"encoding/json"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// The admission.k8s.io/v1beta1 API is not part of the vendored k8s.io/api.
+// The types below are the subset of it that the webhook needs.
+
+// Operation is the type of resource operation being checked for admission control.
+type Operation string
+
+const (
+	Create Operation = "CREATE"
+	Update Operation = "UPDATE"
+	Delete Operation = "DELETE"
+)
+
+// AdmissionReview describes an admission review request/response.
+type AdmissionReview struct {
+	metav1.TypeMeta `json:",inline"`
+	// Request describes the attributes for the admission request.
+	Request *AdmissionRequest `json:"request,omitempty"`
+	// Response describes the attributes for the admission response.
+	Response *AdmissionResponse `json:"response,omitempty"`
+}
+
+// AdmissionRequest describes the admission.Attributes for the admission request.
+type AdmissionRequest struct {
+	// UID is an identifier for the individual request/response.
+	UID types.UID `json:"uid"`
+	// Kind is the type of object being manipulated.
+	Kind metav1.GroupVersionKind `json:"kind"`
+	// Name is the name of the object as presented in the request.
+	Name string `json:"name,omitempty"`
+	// Namespace is the namespace associated with the request (if any).
+	Namespace string `json:"namespace,omitempty"`
+	// Operation is the operation being performed.
+	Operation Operation `json:"operation"`
+	// Object is the object from the incoming request.
+	Object json.RawMessage `json:"object,omitempty"`
+	// OldObject is the existing object. Only populated for UPDATE requests.
+	OldObject json.RawMessage `json:"oldObject,omitempty"`
+}
+
+// AdmissionResponse describes an admission response.
+type AdmissionResponse struct {
+	// UID is an identifier for the individual request/response.
+	// This should be copied over from the corresponding AdmissionRequest.
+	UID types.UID `json:"uid"`
+	// Allowed indicates whether or not the admission request was permitted.
+	Allowed bool `json:"allowed"`
+	// Result contains extra details into why an admission request was denied.
+	Result *metav1.Status `json:"status,omitempty"`
+	// Patch is the patch body. Currently only JSONPatch (RFC 6902) is supported.
+	Patch []byte `json:"patch,omitempty"`
+	// PatchType is the type of Patch.
+	PatchType *PatchType `json:"patchType,omitempty"`
+}
+
+// PatchType is the type of patch being used to represent the mutated object.
+type PatchType string
+
+const (
+	PatchTypeJSONPatch PatchType = "JSONPatch"
+)
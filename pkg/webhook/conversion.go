@@ -0,0 +1,246 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// ConvertPath is the HTTP path of the EtcdCluster conversion webhook.
+	ConvertPath = "/convert"
+
+	// v1beta2SpecAnnotation holds the v1beta2 spec of an EtcdCluster converted
+	// to v1alpha1, so that converting it back restores the fields v1alpha1
+	// does not have.
+	v1beta2SpecAnnotation = "etcd.database.coreos.com/v1beta2-spec"
+)
+
+var (
+	apiVersionV1alpha1 = api.SchemeGroupVersion.Group + "/v1alpha1"
+	apiVersionV1beta2  = api.SchemeGroupVersion.String()
+)
+
+// The CRD conversion types of apiextensions.k8s.io/v1beta1 are not part of
+// the vendored k8s.io/apiextensions-apiserver.
+// The types below are the subset of them that the webhook needs.
+
+// ConversionReview describes a conversion request/response.
+type ConversionReview struct {
+	metav1.TypeMeta `json:",inline"`
+	// Request describes the attributes for the conversion request.
+	Request *ConversionRequest `json:"request,omitempty"`
+	// Response describes the attributes for the conversion response.
+	Response *ConversionResponse `json:"response,omitempty"`
+}
+
+// ConversionRequest describes the conversion request parameters.
+type ConversionRequest struct {
+	// UID is an identifier for the individual request/response.
+	UID types.UID `json:"uid"`
+	// DesiredAPIVersion is the version to convert given objects to, e.g. "myapi.example.com/v1".
+	DesiredAPIVersion string `json:"desiredAPIVersion"`
+	// Objects is the list of custom resource objects to be converted.
+	Objects []json.RawMessage `json:"objects"`
+}
+
+// ConversionResponse describes a conversion response.
+type ConversionResponse struct {
+	// UID is an identifier for the individual request/response.
+	// This should be copied over from the corresponding ConversionRequest.
+	UID types.UID `json:"uid"`
+	// ConvertedObjects is the list of converted version of Request.Objects, in the same order.
+	ConvertedObjects []json.RawMessage `json:"convertedObjects"`
+	// Result contains the result of conversion with extra details if the conversion failed.
+	Result metav1.Status `json:"result"`
+}
+
+// etcdClusterV1alpha1 is the EtcdCluster of the v1alpha1 API, which the
+// operator no longer serves. Its status is the same as in v1beta2.
+type etcdClusterV1alpha1 struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              clusterSpecV1alpha1 `json:"spec"`
+	Status            api.ClusterStatus   `json:"status,omitempty"`
+}
+
+type clusterSpecV1alpha1 struct {
+	// Cluster became the size, version and paused fields of the v1beta2 spec.
+	Cluster    clusterV1alpha1       `json:"cluster"`
+	Repository string                `json:"repository,omitempty"`
+	Pod        *api.PodPolicy        `json:"pod,omitempty"`
+	SelfHosted *api.SelfHostedPolicy `json:"selfHosted,omitempty"`
+	TLS        *api.TLSPolicy        `json:"TLS,omitempty"`
+	// Backup is the backup policy of the operator, which was removed in
+	// favor of EtcdBackup resources.
+	Backup json.RawMessage `json:"backup,omitempty"`
+}
+
+type clusterV1alpha1 struct {
+	Size    int    `json:"size"`
+	Version string `json:"version,omitempty"`
+	Paused  bool   `json:"paused,omitempty"`
+}
+
+// ServeConvert handles the conversion reviews of EtcdClusters between v1alpha1 and v1beta2.
+func ServeConvert(w http.ResponseWriter, req *http.Request) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	review := &ConversionReview{}
+	if err := json.Unmarshal(body, review); err != nil || review.Request == nil {
+		http.Error(w, "invalid conversion review", http.StatusBadRequest)
+		return
+	}
+
+	resp := &ConversionResponse{UID: review.Request.UID, Result: metav1.Status{Status: metav1.StatusSuccess}}
+	for _, obj := range review.Request.Objects {
+		converted, err := convertEtcdCluster(obj, review.Request.DesiredAPIVersion)
+		if err != nil {
+			logrus.Infof("failed to convert EtcdCluster to %s: %v", review.Request.DesiredAPIVersion, err)
+			resp.ConvertedObjects = nil
+			resp.Result = metav1.Status{
+				Status:  metav1.StatusFailure,
+				Message: err.Error(),
+			}
+			break
+		}
+		resp.ConvertedObjects = append(resp.ConvertedObjects, converted)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&ConversionReview{TypeMeta: review.TypeMeta, Response: resp})
+	if err != nil {
+		logrus.Errorf("failed to write conversion review response: %v", err)
+	}
+}
+
+// convertEtcdCluster converts the EtcdCluster obj to the desired API version.
+func convertEtcdCluster(obj json.RawMessage, desiredAPIVersion string) (json.RawMessage, error) {
+	tm := metav1.TypeMeta{}
+	if err := json.Unmarshal(obj, &tm); err != nil {
+		return nil, fmt.Errorf("failed to decode object: %v", err)
+	}
+	if tm.APIVersion == desiredAPIVersion {
+		return obj, nil
+	}
+
+	switch {
+	case tm.APIVersion == apiVersionV1alpha1 && desiredAPIVersion == apiVersionV1beta2:
+		in := &etcdClusterV1alpha1{}
+		if err := json.Unmarshal(obj, in); err != nil {
+			return nil, fmt.Errorf("failed to decode object: %v", err)
+		}
+		out, err := convertToV1beta2(in)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(out)
+	case tm.APIVersion == apiVersionV1beta2 && desiredAPIVersion == apiVersionV1alpha1:
+		in := &api.EtcdCluster{}
+		if err := json.Unmarshal(obj, in); err != nil {
+			return nil, fmt.Errorf("failed to decode object: %v", err)
+		}
+		out, err := convertToV1alpha1(in)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(out)
+	default:
+		return nil, fmt.Errorf("unsupported conversion from %s to %s", tm.APIVersion, desiredAPIVersion)
+	}
+}
+
+// convertToV1beta2 converts a v1alpha1 EtcdCluster to v1beta2. The fields added
+// in v1beta2 are restored from the v1beta2SpecAnnotation, if any, and left empty
+// otherwise. The removed backup policy is dropped.
+func convertToV1beta2(in *etcdClusterV1alpha1) (*api.EtcdCluster, error) {
+	out := &api.EtcdCluster{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: apiVersionV1beta2,
+			Kind:       api.EtcdClusterResourceKind,
+		},
+		ObjectMeta: *in.ObjectMeta.DeepCopy(),
+		Status:     in.Status,
+	}
+	if stashed, ok := out.Annotations[v1beta2SpecAnnotation]; ok {
+		if err := json.Unmarshal([]byte(stashed), &out.Spec); err != nil {
+			return nil, fmt.Errorf("failed to decode annotation %s: %v", v1beta2SpecAnnotation, err)
+		}
+		delete(out.Annotations, v1beta2SpecAnnotation)
+		if len(out.Annotations) == 0 {
+			out.Annotations = nil
+		}
+	}
+	// The fields v1alpha1 has may have been updated since the object was
+	// converted to it, so they take precedence over the stashed ones.
+	out.Spec.Size = in.Spec.Cluster.Size
+	out.Spec.Version = in.Spec.Cluster.Version
+	out.Spec.Paused = in.Spec.Cluster.Paused
+	out.Spec.Repository = in.Spec.Repository
+	out.Spec.Pod = in.Spec.Pod
+	out.Spec.SelfHosted = in.Spec.SelfHosted
+	out.Spec.TLS = in.Spec.TLS
+	if len(in.Spec.Backup) != 0 && string(in.Spec.Backup) != "null" {
+		logrus.Warningf("dropping the backup policy of EtcdCluster (%s/%s); use an EtcdBackup instead", in.Namespace, in.Name)
+	}
+	return out, nil
+}
+
+// convertToV1alpha1 converts a v1beta2 EtcdCluster to v1alpha1. The v1beta2
+// spec is stashed in the v1beta2SpecAnnotation so that the fields added in
+// v1beta2 survive a round trip. The removed backup policy is left empty.
+func convertToV1alpha1(in *api.EtcdCluster) (*etcdClusterV1alpha1, error) {
+	stashed, err := json.Marshal(in.Spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode spec: %v", err)
+	}
+	meta := *in.ObjectMeta.DeepCopy()
+	if meta.Annotations == nil {
+		meta.Annotations = map[string]string{}
+	}
+	meta.Annotations[v1beta2SpecAnnotation] = string(stashed)
+	return &etcdClusterV1alpha1{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: apiVersionV1alpha1,
+			Kind:       api.EtcdClusterResourceKind,
+		},
+		ObjectMeta: meta,
+		Spec: clusterSpecV1alpha1{
+			Cluster: clusterV1alpha1{
+				Size:    in.Spec.Size,
+				Version: in.Spec.Version,
+				Paused:  in.Spec.Paused,
+			},
+			Repository: in.Spec.Repository,
+			Pod:        in.Spec.Pod,
+			SelfHosted: in.Spec.SelfHosted,
+			TLS:        in.Spec.TLS,
+		},
+		Status: in.Status,
+	}, nil
+}
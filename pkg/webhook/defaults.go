@@ -0,0 +1,145 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// MutateEtcdClusterPath is the HTTP path of the EtcdCluster defaulting webhook.
+	MutateEtcdClusterPath = "/mutate/etcdclusters"
+
+	// EnvDefaultEtcdVersion is the environment variable that sets the default spec.version.
+	EnvDefaultEtcdVersion = "DEFAULT_ETCD_VERSION"
+	// EnvDefaultClusterSize is the environment variable that sets the default spec.size.
+	EnvDefaultClusterSize = "DEFAULT_CLUSTER_SIZE"
+)
+
+// Defaults are the operator-level values the defaulting webhook sets on
+// EtcdCluster specs that leave the corresponding fields empty.
+// A zero value field is not defaulted.
+type Defaults struct {
+	Version string
+	Size    int
+}
+
+// DefaultsFromEnv reads the webhook defaults from the DEFAULT_ETCD_VERSION and
+// DEFAULT_CLUSTER_SIZE environment variables.
+func DefaultsFromEnv() (Defaults, error) {
+	d := Defaults{Version: os.Getenv(EnvDefaultEtcdVersion)}
+	if s := os.Getenv(EnvDefaultClusterSize); len(s) != 0 {
+		size, err := strconv.Atoi(s)
+		if err != nil {
+			return d, fmt.Errorf("invalid %s (%s): %v", EnvDefaultClusterSize, s, err)
+		}
+		if err := ValidateSizeChange(size, size); err != nil {
+			return d, fmt.Errorf("invalid %s: %v", EnvDefaultClusterSize, err)
+		}
+		d.Size = size
+	}
+	return d, nil
+}
+
+type patchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// ServeMutateEtcdCluster handles the admission reviews of EtcdCluster creations.
+// It patches the missing spec fields with the defaults.
+func (d Defaults) ServeMutateEtcdCluster(w http.ResponseWriter, req *http.Request) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	review := &AdmissionReview{}
+	if err := json.Unmarshal(body, review); err != nil || review.Request == nil {
+		http.Error(w, "invalid admission review", http.StatusBadRequest)
+		return
+	}
+
+	resp := &AdmissionResponse{UID: review.Request.UID, Allowed: true}
+	patch, err := d.defaultEtcdCluster(review.Request)
+	if err != nil {
+		logrus.Infof("rejecting creation of EtcdCluster (%s/%s): %v", review.Request.Namespace, review.Request.Name, err)
+		resp.Allowed = false
+		resp.Result = &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Message: err.Error(),
+			Reason:  metav1.StatusReasonBadRequest,
+		}
+	} else if len(patch) != 0 {
+		resp.Patch, err = json.Marshal(patch)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to encode patch: %v", err), http.StatusInternalServerError)
+			return
+		}
+		pt := PatchTypeJSONPatch
+		resp.PatchType = &pt
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&AdmissionReview{TypeMeta: review.TypeMeta, Response: resp})
+	if err != nil {
+		logrus.Errorf("failed to write admission review response: %v", err)
+	}
+}
+
+func (d Defaults) defaultEtcdCluster(ar *AdmissionRequest) ([]patchOperation, error) {
+	if ar.Operation != Create {
+		return nil, nil
+	}
+
+	cluster := &api.EtcdCluster{}
+	if err := json.Unmarshal(ar.Object, cluster); err != nil {
+		return nil, fmt.Errorf("failed to decode object: %v", err)
+	}
+	// Adding a member to a missing spec fails, so the spec is checked on the raw object.
+	raw := struct {
+		Spec json.RawMessage `json:"spec"`
+	}{}
+	if err := json.Unmarshal(ar.Object, &raw); err != nil {
+		return nil, fmt.Errorf("failed to decode object: %v", err)
+	}
+
+	var patch []patchOperation
+	if len(raw.Spec) == 0 || string(raw.Spec) == "null" {
+		patch = append(patch, patchOperation{Op: "add", Path: "/spec", Value: map[string]interface{}{}})
+	}
+	if cluster.Spec.Size == 0 && d.Size != 0 {
+		patch = append(patch, patchOperation{Op: "add", Path: "/spec/size", Value: d.Size})
+	}
+	if len(cluster.Spec.Version) == 0 && len(d.Version) != 0 {
+		patch = append(patch, patchOperation{Op: "add", Path: "/spec/version", Value: d.Version})
+	}
+	if len(patch) == 1 && patch[0].Path == "/spec" {
+		return nil, nil
+	}
+	return patch, nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ValidateEtcdClusterPath is the HTTP path of the EtcdCluster validating webhook.
+	ValidateEtcdClusterPath = "/validate/etcdclusters"
+
+	// maxSizeDecrease is the maximum number of members a single update may remove.
+	maxSizeDecrease = 2
+)
+
+// ValidateSizeChange checks that resizing an etcd cluster from oldSize to newSize
+// cannot destroy its quorum.
+func ValidateSizeChange(oldSize, newSize int) error {
+	if newSize < 1 {
+		return fmt.Errorf("size (%d) must be at least 1", newSize)
+	}
+	if newSize%2 == 0 {
+		return fmt.Errorf("size (%d) must be an odd number", newSize)
+	}
+	if oldSize-newSize > maxSizeDecrease {
+		return fmt.Errorf("cannot scale down from %d to %d: size can be decreased by at most %d at a time", oldSize, newSize, maxSizeDecrease)
+	}
+	return nil
+}
+
+// ServeValidateEtcdCluster handles the admission reviews of EtcdCluster updates.
+func ServeValidateEtcdCluster(w http.ResponseWriter, req *http.Request) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	review := &AdmissionReview{}
+	if err := json.Unmarshal(body, review); err != nil || review.Request == nil {
+		http.Error(w, "invalid admission review", http.StatusBadRequest)
+		return
+	}
+
+	resp := &AdmissionResponse{UID: review.Request.UID, Allowed: true}
+	if err := validateEtcdCluster(review.Request); err != nil {
+		logrus.Infof("rejecting update of EtcdCluster (%s/%s): %v", review.Request.Namespace, review.Request.Name, err)
+		resp.Allowed = false
+		resp.Result = &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Message: err.Error(),
+			Reason:  metav1.StatusReasonInvalid,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&AdmissionReview{TypeMeta: review.TypeMeta, Response: resp})
+	if err != nil {
+		logrus.Errorf("failed to write admission review response: %v", err)
+	}
+}
+
+func validateEtcdCluster(ar *AdmissionRequest) error {
+	if ar.Operation != Update {
+		return nil
+	}
+
+	oldCluster, newCluster := &api.EtcdCluster{}, &api.EtcdCluster{}
+	if err := json.Unmarshal(ar.OldObject, oldCluster); err != nil {
+		return fmt.Errorf("failed to decode old object: %v", err)
+	}
+	if err := json.Unmarshal(ar.Object, newCluster); err != nil {
+		return fmt.Errorf("failed to decode object: %v", err)
+	}
+
+	if oldCluster.Spec.SelfHosted == nil && newCluster.Spec.SelfHosted != nil {
+		return errors.New("spec.selfHosted cannot be set on an existing cluster")
+	}
+	if oldCluster.Spec.Size == newCluster.Spec.Size {
+		return nil
+	}
+	return ValidateSizeChange(oldCluster.Spec.Size, newCluster.Spec.Size)
+}
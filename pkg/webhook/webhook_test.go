@@ -0,0 +1,207 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidateSizeChange(t *testing.T) {
+	tests := []struct {
+		oldSize int
+		newSize int
+		wErr    bool
+	}{
+		{oldSize: 5, newSize: 3, wErr: false},
+		{oldSize: 3, newSize: 5, wErr: false},
+		{oldSize: 1, newSize: 7, wErr: false},
+		{oldSize: 5, newSize: 1, wErr: true},
+		{oldSize: 3, newSize: 4, wErr: true},
+		{oldSize: 3, newSize: 0, wErr: true},
+		{oldSize: 1, newSize: -1, wErr: true},
+	}
+	for i, tt := range tests {
+		err := ValidateSizeChange(tt.oldSize, tt.newSize)
+		if (err != nil) != tt.wErr {
+			t.Errorf("#%d: resize %d -> %d: err = %v, want error %v", i, tt.oldSize, tt.newSize, err, tt.wErr)
+		}
+	}
+}
+
+func TestValidateEtcdCluster(t *testing.T) {
+	tests := []struct {
+		oldSpec api.ClusterSpec
+		newSpec api.ClusterSpec
+		wErr    bool
+	}{
+		{oldSpec: api.ClusterSpec{Size: 3}, newSpec: api.ClusterSpec{Size: 5}, wErr: false},
+		{oldSpec: api.ClusterSpec{Size: 5}, newSpec: api.ClusterSpec{Size: 1}, wErr: true},
+		// selfHosted can be removed but not set on an existing cluster
+		{oldSpec: api.ClusterSpec{Size: 3, SelfHosted: &api.SelfHostedPolicy{}}, newSpec: api.ClusterSpec{Size: 3}, wErr: false},
+		{oldSpec: api.ClusterSpec{Size: 3}, newSpec: api.ClusterSpec{Size: 3, SelfHosted: &api.SelfHostedPolicy{}}, wErr: true},
+	}
+	for i, tt := range tests {
+		oldObj, err := json.Marshal(&api.EtcdCluster{Spec: tt.oldSpec})
+		if err != nil {
+			t.Fatal(err)
+		}
+		newObj, err := json.Marshal(&api.EtcdCluster{Spec: tt.newSpec})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = validateEtcdCluster(&AdmissionRequest{Operation: Update, OldObject: oldObj, Object: newObj})
+		if (err != nil) != tt.wErr {
+			t.Errorf("#%d: err = %v, want error %v", i, err, tt.wErr)
+		}
+	}
+}
+
+func TestDefaultEtcdCluster(t *testing.T) {
+	d := Defaults{Version: "3.2.13", Size: 3}
+	tests := []struct {
+		object string
+		wPatch []string
+	}{
+		{object: `{"metadata":{"name":"a"}}`, wPatch: []string{"/spec", "/spec/size", "/spec/version"}},
+		{object: `{"spec":{}}`, wPatch: []string{"/spec/size", "/spec/version"}},
+		{object: `{"spec":{"size":5}}`, wPatch: []string{"/spec/version"}},
+		{object: `{"spec":{"version":"3.1.10"}}`, wPatch: []string{"/spec/size"}},
+		{object: `{"spec":{"size":1,"version":"3.1.10"}}`, wPatch: nil},
+	}
+	for i, tt := range tests {
+		patch, err := d.defaultEtcdCluster(&AdmissionRequest{Operation: Create, Object: []byte(tt.object)})
+		if err != nil {
+			t.Fatalf("#%d: unexpected error: %v", i, err)
+		}
+		var paths []string
+		for _, p := range patch {
+			paths = append(paths, p.Path)
+		}
+		if !reflect.DeepEqual(paths, tt.wPatch) {
+			t.Errorf("#%d: patched paths = %v, want %v", i, paths, tt.wPatch)
+		}
+	}
+}
+
+func TestDefaultEtcdClusterIgnoresUpdate(t *testing.T) {
+	d := Defaults{Version: "3.2.13", Size: 3}
+	patch, err := d.defaultEtcdCluster(&AdmissionRequest{Operation: Update, Object: []byte(`{"spec":{}}`)})
+	if err != nil || len(patch) != 0 {
+		t.Errorf("patch = %v, err = %v, want no patch", patch, err)
+	}
+}
+
+func TestConvertEtcdCluster(t *testing.T) {
+	v1alpha1 := `{"apiVersion":"etcd.database.coreos.com/v1alpha1","kind":"EtcdCluster","metadata":{"name":"a"},` +
+		`"spec":{"cluster":{"size":3,"version":"3.2.13","paused":true},"repository":"quay.io/coreos/etcd","backup":{"backupIntervalInSecond":60}}}`
+
+	obj, err := convertEtcdCluster(json.RawMessage(v1alpha1), apiVersionV1beta2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl := &api.EtcdCluster{}
+	if err := json.Unmarshal(obj, cl); err != nil {
+		t.Fatal(err)
+	}
+	want := api.ClusterSpec{Size: 3, Version: "3.2.13", Paused: true, Repository: "quay.io/coreos/etcd"}
+	if cl.APIVersion != apiVersionV1beta2 || cl.Name != "a" || !reflect.DeepEqual(cl.Spec, want) {
+		t.Errorf("converted %s %s with spec %+v, want %s a with spec %+v", cl.APIVersion, cl.Name, cl.Spec, apiVersionV1beta2, want)
+	}
+
+	// the fields added in v1beta2 are not part of the v1alpha1 spec
+	cl.Spec.GatewayEnabled = true
+	obj, err = json.Marshal(cl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj, err = convertEtcdCluster(obj, apiVersionV1alpha1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	back := &etcdClusterV1alpha1{}
+	if err := json.Unmarshal(obj, back); err != nil {
+		t.Fatal(err)
+	}
+	wantCluster := clusterV1alpha1{Size: 3, Version: "3.2.13", Paused: true}
+	if back.APIVersion != apiVersionV1alpha1 || back.Spec.Cluster != wantCluster || len(back.Spec.Backup) != 0 {
+		t.Errorf("converted back %s with spec %+v, want %s with cluster %+v", back.APIVersion, back.Spec, apiVersionV1alpha1, wantCluster)
+	}
+
+	if got, err := convertEtcdCluster(json.RawMessage(v1alpha1), apiVersionV1alpha1); err != nil || string(got) != v1alpha1 {
+		t.Errorf("conversion to the same version = %s, %v, want the object unchanged", got, err)
+	}
+	if _, err := convertEtcdCluster(json.RawMessage(v1alpha1), "etcd.database.coreos.com/v1"); err == nil {
+		t.Error("want error for unsupported version, got nil")
+	}
+}
+
+func TestConvertEtcdClusterRoundTrip(t *testing.T) {
+	in := &api.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "a", Annotations: map[string]string{"team": "storage"}},
+		Spec: api.ClusterSpec{
+			Size:           3,
+			Version:        "3.2.13",
+			GatewayEnabled: true,
+			ServiceType:    v1.ServiceTypeNodePort,
+		},
+	}
+	in.APIVersion = apiVersionV1beta2
+	obj, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj, err = convertEtcdCluster(obj, apiVersionV1alpha1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a v1alpha1 client updates the size
+	old := &etcdClusterV1alpha1{}
+	if err := json.Unmarshal(obj, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := old.Annotations[v1beta2SpecAnnotation]; !ok {
+		t.Fatalf("annotations = %v, want %s", old.Annotations, v1beta2SpecAnnotation)
+	}
+	old.Spec.Cluster.Size = 5
+	obj, err = json.Marshal(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj, err = convertEtcdCluster(obj, apiVersionV1beta2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	back := &api.EtcdCluster{}
+	if err := json.Unmarshal(obj, back); err != nil {
+		t.Fatal(err)
+	}
+	want := in.Spec
+	want.Size = 5
+	if !reflect.DeepEqual(back.Spec, want) {
+		t.Errorf("spec after round trip = %+v, want %+v", back.Spec, want)
+	}
+	if wantAnn := map[string]string{"team": "storage"}; !reflect.DeepEqual(back.Annotations, wantAnn) {
+		t.Errorf("annotations after round trip = %v, want %v", back.Annotations, wantAnn)
+	}
+}